@@ -0,0 +1,133 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package alert implements alert deduplication for tools that watch
+// processes and notify on crashes.
+//
+// A crash loop can print the same panic thousands of times; Deduper ensures
+// the same signature is only alerted on once per suppression window.
+package alert
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// Severity is the severity of an alert.
+type Severity int
+
+// Severities, from the least to the most severe.
+const (
+	Info Severity = iota
+	Warning
+	Critical
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Info:
+		return "info"
+	case Warning:
+		return "warning"
+	case Critical:
+		return "critical"
+	default:
+		return "unknown"
+	}
+}
+
+// Deduper suppresses alerts for a signature already alerted on recently.
+//
+// The signature key is opaque to Deduper; it must be stable across processes
+// and restarts, e.g. a hash of the stack without pointer values.
+//
+// It is safe to use concurrently.
+type Deduper struct {
+	windows map[Severity]time.Duration
+	path    string
+
+	mu   sync.Mutex
+	last map[string]entry
+}
+
+// New returns a Deduper with a suppression window per severity.
+//
+// An alert is suppressed when the same key was alerted on within the window
+// of its severity at the same or a higher severity. An escalation to a higher
+// severity is never suppressed. A severity without a window is never
+// suppressed.
+//
+// When path is not empty, the state is loaded from and saved to this file so
+// it survives restarts of the watcher. A missing file is not an error.
+func New(path string, windows map[Severity]time.Duration) (*Deduper, error) {
+	d := &Deduper{windows: windows, path: path, last: map[string]entry{}}
+	if path == "" {
+		return d, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return d, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &d.last); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Allow returns true if an alert for key at severity s should be sent at
+// time now, and records it.
+//
+// The error is only about persisting the state; the returned bool is valid
+// even if an error is returned.
+func (d *Deduper) Allow(key string, s Severity, now time.Time) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e, ok := d.last[key]; ok && e.Severity >= s && now.Sub(e.Time) < d.windows[s] {
+		return false, nil
+	}
+	d.last[key] = entry{Time: now, Severity: s}
+	return true, d.save(now)
+}
+
+// Private stuff.
+
+// entry is the last alert sent for a key.
+type entry struct {
+	Time     time.Time
+	Severity Severity
+}
+
+// save prunes the expired entries and writes the state to d.path, if any.
+func (d *Deduper) save(now time.Time) error {
+	var longest time.Duration
+	for _, w := range d.windows {
+		if w > longest {
+			longest = w
+		}
+	}
+	for k, e := range d.last {
+		if now.Sub(e.Time) >= longest {
+			delete(d.last, k)
+		}
+	}
+	if d.path == "" {
+		return nil
+	}
+	b, err := json.Marshal(d.last)
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first so a crash doesn't corrupt the state.
+	tmp := d.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, d.path)
+}
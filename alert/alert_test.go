@@ -0,0 +1,74 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package alert
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/maruel/ut"
+)
+
+func TestDeduper(t *testing.T) {
+	t.Parallel()
+	d, err := New("", map[Severity]time.Duration{Warning: time.Hour, Critical: 10 * time.Minute})
+	ut.AssertEqual(t, nil, err)
+	now := time.Date(2016, 3, 1, 12, 0, 0, 0, time.UTC)
+	allow := func(key string, s Severity, offset time.Duration) bool {
+		ok, err := d.Allow(key, s, now.Add(offset))
+		ut.AssertEqual(t, nil, err)
+		return ok
+	}
+	ut.AssertEqual(t, true, allow("a", Warning, 0))
+	ut.AssertEqual(t, false, allow("a", Warning, 30*time.Minute))
+	// Other signatures are independent.
+	ut.AssertEqual(t, true, allow("b", Warning, 30*time.Minute))
+	// Escalation goes through.
+	ut.AssertEqual(t, true, allow("a", Critical, 40*time.Minute))
+	ut.AssertEqual(t, false, allow("a", Critical, 45*time.Minute))
+	// A lower severity is suppressed by the critical alert.
+	ut.AssertEqual(t, false, allow("a", Warning, 50*time.Minute))
+	// The critical window is shorter.
+	ut.AssertEqual(t, true, allow("a", Critical, 51*time.Minute))
+	// No window for Info.
+	ut.AssertEqual(t, true, allow("c", Info, 0))
+	ut.AssertEqual(t, true, allow("c", Info, 0))
+}
+
+func TestDeduperPersistence(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "panicparse")
+	ut.AssertEqual(t, nil, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "alerts.json")
+	windows := map[Severity]time.Duration{Warning: time.Hour}
+	now := time.Date(2016, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	d, err := New(path, windows)
+	ut.AssertEqual(t, nil, err)
+	ok, err := d.Allow("a", Warning, now)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, true, ok)
+
+	// Simulates a restart.
+	d, err = New(path, windows)
+	ut.AssertEqual(t, nil, err)
+	ok, err = d.Allow("a", Warning, now.Add(time.Minute))
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, false, ok)
+	ok, err = d.Allow("a", Warning, now.Add(2*time.Hour))
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, true, ok)
+}
+
+func TestSeverityString(t *testing.T) {
+	t.Parallel()
+	ut.AssertEqual(t, "info", Info.String())
+	ut.AssertEqual(t, "critical", Critical.String())
+	ut.AssertEqual(t, "unknown", Severity(10).String())
+}
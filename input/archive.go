@@ -0,0 +1,136 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package input
+
+import (
+	"archive/tar"
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+// IsArchive returns true if p is a directory or a tar archive, compressed or
+// not, e.g. a support bundle.
+func IsArchive(p string) bool {
+	fi, err := os.Stat(p)
+	if err != nil {
+		return false
+	}
+	if fi.IsDir() {
+		return true
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	r, err := stack.Decompress(f)
+	if err != nil {
+		return false
+	}
+	return isTar(bufio.NewReader(r))
+}
+
+// Walk calls fn with the name and the decompressed content of each file in
+// p, a directory or a tar archive. The archives found inside are walked too.
+//
+// The names are relative to p and use '/' as the separator; the files of an
+// archive inside p are named after it, e.g. "logs/old.tgz/app.log". When p is
+// a plain file, fn is called once with its base name. Walking stops at the
+// first error returned by fn, which is returned.
+func Walk(p string, fn func(name string, r io.Reader) error) error {
+	fi, err := os.Stat(p)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return walkFile(p, "", fn)
+	}
+	return filepath.Walk(p, func(file string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(p, file)
+		if err != nil {
+			return err
+		}
+		return walkFile(file, filepath.ToSlash(rel), fn)
+	})
+}
+
+// ParseAll parses the goroutine dumps found in p, a directory or a tar
+// archive, keyed by file name as returned by Walk.
+//
+// The files without a goroutine are skipped. A file that failed to parse is
+// kept with the goroutines found, which are marked as Incomplete.
+func ParseAll(p string) (map[string]*stack.Snapshot, error) {
+	out := map[string]*stack.Snapshot{}
+	err := Walk(p, func(name string, r io.Reader) error {
+		s, _ := stack.ParseSnapshot(r, ioutil.Discard)
+		if s != nil && len(s.Goroutines) != 0 {
+			out[name] = s
+		}
+		return nil
+	})
+	return out, err
+}
+
+// Private stuff.
+
+// walkFile calls fn with the content of the file, or of each file in it if
+// it is a tar archive.
+func walkFile(file, name string, fn func(name string, r io.Reader) error) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return walkReader(f, name, func(n string, r io.Reader) error {
+		if n == "" {
+			// Walk was called on a plain file.
+			n = filepath.Base(file)
+		}
+		return fn(n, r)
+	})
+}
+
+// walkReader calls fn with r, or with each file in it if it is a tar archive.
+func walkReader(r io.Reader, name string, fn func(name string, r io.Reader) error) error {
+	r, err := stack.Decompress(r)
+	if err != nil {
+		return err
+	}
+	br := bufio.NewReader(r)
+	if !isTar(br) {
+		return fn(name, br)
+	}
+	t := tar.NewReader(br)
+	for {
+		h, err := t.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if h.Typeflag != tar.TypeReg && h.Typeflag != tar.TypeRegA {
+			continue
+		}
+		if err = walkReader(t, path.Join(name, h.Name), fn); err != nil {
+			return err
+		}
+	}
+}
+
+// isTar returns true if r starts with a POSIX or GNU tar header.
+func isTar(r *bufio.Reader) bool {
+	b, _ := r.Peek(262)
+	return len(b) == 262 && string(b[257:262]) == "ustar"
+}
@@ -0,0 +1,62 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package input
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+const archiveDump = "goroutine 1 [running]:\nmain.main()\n\t/home/user/src/app/main.go:12 +0x17\n\n"
+
+func TestParseAll(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "input")
+	ut.AssertEqual(t, nil, err)
+	defer os.RemoveAll(dir)
+	ut.AssertEqual(t, nil, os.Mkdir(filepath.Join(dir, "logs"), 0700))
+	ut.AssertEqual(t, nil, ioutil.WriteFile(filepath.Join(dir, "logs", "app.log"), []byte("starting\n"+archiveDump), 0600))
+	ut.AssertEqual(t, nil, ioutil.WriteFile(filepath.Join(dir, "README"), []byte("nothing to see\n"), 0600))
+	// A compressed archive in the directory.
+	buf := &bytes.Buffer{}
+	z := gzip.NewWriter(buf)
+	w := tar.NewWriter(z)
+	for _, name := range []string{"a.log", "sub/b.log"} {
+		ut.AssertEqual(t, nil, w.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(archiveDump)), Typeflag: tar.TypeReg}))
+		_, err = w.Write([]byte(archiveDump))
+		ut.AssertEqual(t, nil, err)
+	}
+	ut.AssertEqual(t, nil, w.Close())
+	ut.AssertEqual(t, nil, z.Close())
+	tgz := filepath.Join(dir, "old.tgz")
+	ut.AssertEqual(t, nil, ioutil.WriteFile(tgz, buf.Bytes(), 0600))
+
+	ut.AssertEqual(t, true, IsArchive(dir))
+	ut.AssertEqual(t, true, IsArchive(tgz))
+	ut.AssertEqual(t, false, IsArchive(filepath.Join(dir, "README")))
+
+	snapshots, err := ParseAll(dir)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 3, len(snapshots))
+	for _, name := range []string{"logs/app.log", "old.tgz/a.log", "old.tgz/sub/b.log"} {
+		ut.AssertEqual(t, 1, len(snapshots[name].Goroutines))
+	}
+
+	snapshots, err = ParseAll(tgz)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 2, len(snapshots))
+	ut.AssertEqual(t, 12, snapshots["sub/b.log"].Goroutines[0].Stack.Calls[0].Line)
+
+	snapshots, err = ParseAll(filepath.Join(dir, "logs", "app.log"))
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 1, len(snapshots["app.log"].Goroutines))
+}
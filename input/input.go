@@ -0,0 +1,374 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package input defines where stack dumps are read from.
+//
+// A Source is a file, stdin, an HTTP endpoint like /debug/pprof/goroutine or
+// the logs of a Kubernetes pod, a systemd unit or a Docker container. Parse
+// returns the Source for a command line argument, so all the modes of pp
+// accept the same inputs. Third parties can implement Source for their own
+// log storage.
+package input
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Source is where a dump is read from.
+type Source interface {
+	// Open returns the content available now.
+	Open() (io.ReadCloser, error)
+	// Tail returns the content available now then the content appended
+	// afterward, until the reader is closed.
+	Tail() (io.ReadCloser, error)
+	// Describe returns a short human readable description of the source, for
+	// messages.
+	Describe() string
+}
+
+// Parse returns the Source described by spec:
+//   - "-" is stdin
+//   - "http://..." and "https://..." is the body of a GET request
+//   - "k8s:[namespace/]pod[/container]" is the logs of a Kubernetes pod
+//   - "journald:unit" is the logs of a systemd unit
+//   - "docker:container" is the logs of a Docker container
+//   - anything else is a file path
+func Parse(spec string) (Source, error) {
+	switch {
+	case spec == "":
+		return nil, errors.New("empty input")
+	case spec == "-":
+		return Stdin{}, nil
+	case strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+		return &HTTP{URL: spec}, nil
+	case strings.HasPrefix(spec, "k8s:"):
+		parts := strings.Split(spec[len("k8s:"):], "/")
+		k := &Kubernetes{}
+		switch len(parts) {
+		case 1:
+			k.Pod = parts[0]
+		case 2:
+			k.Namespace, k.Pod = parts[0], parts[1]
+		case 3:
+			k.Namespace, k.Pod, k.Container = parts[0], parts[1], parts[2]
+		default:
+			return nil, fmt.Errorf("invalid input %q, expected k8s:[namespace/]pod[/container]", spec)
+		}
+		if k.Pod == "" {
+			return nil, fmt.Errorf("invalid input %q, expected k8s:[namespace/]pod[/container]", spec)
+		}
+		return k, nil
+	case strings.HasPrefix(spec, "journald:"):
+		if spec == "journald:" {
+			return nil, fmt.Errorf("invalid input %q, expected journald:unit", spec)
+		}
+		return &Journald{Unit: spec[len("journald:"):]}, nil
+	case strings.HasPrefix(spec, "docker:"):
+		if spec == "docker:" {
+			return nil, fmt.Errorf("invalid input %q, expected docker:container", spec)
+		}
+		return &Docker{Container: spec[len("docker:"):]}, nil
+	}
+	return File(spec), nil
+}
+
+// File is a file path.
+type File string
+
+// Open implements Source.
+func (f File) Open() (io.ReadCloser, error) {
+	return os.Open(string(f))
+}
+
+// Tail implements Source.
+//
+// The file is polled for new content, so it works on any file system.
+func (f File) Tail() (io.ReadCloser, error) {
+	h, err := os.Open(string(f))
+	if err != nil {
+		return nil, err
+	}
+	return &follower{f: h, done: make(chan struct{})}, nil
+}
+
+// Describe implements Source.
+func (f File) Describe() string {
+	return string(f)
+}
+
+// Stdin is the standard input of the process.
+type Stdin struct{}
+
+// Open implements Source.
+func (Stdin) Open() (io.ReadCloser, error) {
+	return ioutil.NopCloser(os.Stdin), nil
+}
+
+// Tail implements Source.
+//
+// Stdin is a stream so it is the same as Open.
+func (s Stdin) Tail() (io.ReadCloser, error) {
+	return s.Open()
+}
+
+// Describe implements Source.
+func (Stdin) Describe() string {
+	return "stdin"
+}
+
+// HTTP is the body of a GET request, e.g. to the /debug/pprof/goroutine?debug=2
+// endpoint of a process.
+type HTTP struct {
+	URL string
+	// Client is the client to use. http.DefaultClient is used if nil.
+	Client *http.Client
+}
+
+// Open implements Source.
+func (h *HTTP) Open() (io.ReadCloser, error) {
+	c := h.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	resp, err := c.Get(h.URL)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", h.URL, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// Tail implements Source.
+//
+// The body is streamed as it is received, which is useful with an endpoint
+// streaming logs.
+func (h *HTTP) Tail() (io.ReadCloser, error) {
+	return h.Open()
+}
+
+// Describe implements Source.
+func (h *HTTP) Describe() string {
+	return h.URL
+}
+
+// Kubernetes is the logs of a container of a pod, as returned by kubectl.
+type Kubernetes struct {
+	// Namespace is the namespace of the pod. The one of the current context
+	// is used if empty.
+	Namespace string
+	Pod       string
+	// Container is the container in the pod. It is required when the pod has
+	// more than one container.
+	Container string
+	// Previous is set to get the logs of the previous instance of the
+	// container, the one that crashed when the container was restarted.
+	Previous bool
+}
+
+// Open implements Source.
+func (k *Kubernetes) Open() (io.ReadCloser, error) {
+	return startCommand(k.args(false))
+}
+
+// Tail implements Source.
+func (k *Kubernetes) Tail() (io.ReadCloser, error) {
+	return startCommand(k.args(true))
+}
+
+// Describe implements Source.
+func (k *Kubernetes) Describe() string {
+	out := "pod " + k.Pod
+	if k.Namespace != "" {
+		out = "pod " + k.Namespace + "/" + k.Pod
+	}
+	if k.Container != "" {
+		out += " container " + k.Container
+	}
+	return out
+}
+
+func (k *Kubernetes) args(follow bool) []string {
+	args := []string{"kubectl", "logs"}
+	if k.Namespace != "" {
+		args = append(args, "-n", k.Namespace)
+	}
+	if k.Previous {
+		args = append(args, "-p")
+	}
+	if follow {
+		args = append(args, "-f")
+	}
+	args = append(args, k.Pod)
+	if k.Container != "" {
+		args = append(args, "-c", k.Container)
+	}
+	return args
+}
+
+// Journald is the logs of a systemd unit, as returned by journalctl.
+type Journald struct {
+	Unit string
+}
+
+// Open implements Source.
+func (j *Journald) Open() (io.ReadCloser, error) {
+	return startCommand(j.args(false))
+}
+
+// Tail implements Source.
+func (j *Journald) Tail() (io.ReadCloser, error) {
+	return startCommand(j.args(true))
+}
+
+// Describe implements Source.
+func (j *Journald) Describe() string {
+	return "unit " + j.Unit
+}
+
+func (j *Journald) args(follow bool) []string {
+	// -o cat prints the messages without the syslog like prefix.
+	args := []string{"journalctl", "-u", j.Unit, "-o", "cat", "--no-pager"}
+	if follow {
+		args = append(args, "-f", "-n", "all")
+	}
+	return args
+}
+
+// Docker is the logs of a Docker container, as returned by docker logs.
+type Docker struct {
+	Container string
+}
+
+// Open implements Source.
+func (d *Docker) Open() (io.ReadCloser, error) {
+	return startCommand(d.args(false))
+}
+
+// Tail implements Source.
+func (d *Docker) Tail() (io.ReadCloser, error) {
+	return startCommand(d.args(true))
+}
+
+// Describe implements Source.
+func (d *Docker) Describe() string {
+	return "container " + d.Container
+}
+
+func (d *Docker) args(follow bool) []string {
+	args := []string{"docker", "logs"}
+	if follow {
+		args = append(args, "-f")
+	}
+	return append(args, d.Container)
+}
+
+// Private stuff.
+
+// pollInterval is how often a file is checked for new content.
+var pollInterval = 250 * time.Millisecond
+
+// follower reads a file and waits for more content at the end instead of
+// returning io.EOF, until it is closed.
+type follower struct {
+	f    *os.File
+	done chan struct{}
+	once sync.Once
+}
+
+func (f *follower) Read(p []byte) (int, error) {
+	for {
+		n, err := f.f.Read(p)
+		if n != 0 || err != io.EOF {
+			select {
+			case <-f.done:
+				// The file was closed while reading.
+				return n, io.EOF
+			default:
+			}
+			return n, err
+		}
+		select {
+		case <-f.done:
+			return 0, io.EOF
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func (f *follower) Close() error {
+	err := os.ErrClosed
+	f.once.Do(func() {
+		close(f.done)
+		err = f.f.Close()
+	})
+	return err
+}
+
+// command is the output of a running command. Closing it kills the command.
+type command struct {
+	cmd  *exec.Cmd
+	r    *os.File
+	done chan struct{}
+	err  error // err is the exit status, set before done is closed.
+}
+
+// startCommand starts a command and returns its merged stdout and stderr,
+// since the logs of the process are printed on both.
+func startCommand(args []string) (io.ReadCloser, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = w
+	cmd.Stderr = w
+	err = cmd.Start()
+	// The child has its own copy.
+	w.Close()
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	c := &command{cmd: cmd, r: r, done: make(chan struct{})}
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			c.err = fmt.Errorf("%s: %s", strings.Join(args[:2], " "), err)
+		}
+		close(c.done)
+	}()
+	return c, nil
+}
+
+func (c *command) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if err == io.EOF {
+		<-c.done
+		if c.err != nil {
+			err = c.err
+		}
+	}
+	return n, err
+}
+
+func (c *command) Close() error {
+	select {
+	case <-c.done:
+	default:
+		_ = c.cmd.Process.Kill()
+		<-c.done
+	}
+	return c.r.Close()
+}
@@ -0,0 +1,163 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package input
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maruel/ut"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		spec     string
+		expected Source
+	}{
+		{"-", Stdin{}},
+		{"crash.txt", File("crash.txt")},
+		{"http://localhost:6060/debug/pprof/goroutine?debug=2", &HTTP{URL: "http://localhost:6060/debug/pprof/goroutine?debug=2"}},
+		{"k8s:server-5d8f", &Kubernetes{Pod: "server-5d8f"}},
+		{"k8s:prod/server-5d8f", &Kubernetes{Namespace: "prod", Pod: "server-5d8f"}},
+		{"k8s:prod/server-5d8f/app", &Kubernetes{Namespace: "prod", Pod: "server-5d8f", Container: "app"}},
+		{"journald:server.service", &Journald{Unit: "server.service"}},
+		{"docker:server", &Docker{Container: "server"}},
+	}
+	for i, line := range data {
+		s, err := Parse(line.spec)
+		ut.AssertEqualIndex(t, i, nil, err)
+		ut.AssertEqualIndex(t, i, line.expected, s)
+	}
+	for _, spec := range []string{"", "k8s:", "k8s:a/b/c/d", "journald:", "docker:"} {
+		_, err := Parse(spec)
+		ut.AssertEqual(t, true, err != nil)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	t.Parallel()
+	ut.AssertEqual(t, "stdin", Stdin{}.Describe())
+	ut.AssertEqual(t, "pod prod/server container app", (&Kubernetes{Namespace: "prod", Pod: "server", Container: "app"}).Describe())
+	ut.AssertEqual(t, "unit server.service", (&Journald{Unit: "server.service"}).Describe())
+	ut.AssertEqual(t, "container server", (&Docker{Container: "server"}).Describe())
+}
+
+func TestCommandArgs(t *testing.T) {
+	t.Parallel()
+	k := &Kubernetes{Namespace: "prod", Pod: "server", Container: "app", Previous: true}
+	ut.AssertEqual(t, []string{"kubectl", "logs", "-n", "prod", "-p", "server", "-c", "app"}, k.args(false))
+	ut.AssertEqual(t, []string{"kubectl", "logs", "-f", "server"}, (&Kubernetes{Pod: "server"}).args(true))
+	j := &Journald{Unit: "server.service"}
+	ut.AssertEqual(t, []string{"journalctl", "-u", "server.service", "-o", "cat", "--no-pager"}, j.args(false))
+	ut.AssertEqual(t, []string{"journalctl", "-u", "server.service", "-o", "cat", "--no-pager", "-f", "-n", "all"}, j.args(true))
+	d := &Docker{Container: "server"}
+	ut.AssertEqual(t, []string{"docker", "logs", "server"}, d.args(false))
+	ut.AssertEqual(t, []string{"docker", "logs", "-f", "server"}, d.args(true))
+}
+
+func TestFile(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "input")
+	ut.AssertEqual(t, nil, err)
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "crash.txt")
+	ut.AssertEqual(t, nil, ioutil.WriteFile(p, []byte("goroutine 1 [running]:\n"), 0600))
+	f := File(p)
+	r, err := f.Open()
+	ut.AssertEqual(t, nil, err)
+	b, err := ioutil.ReadAll(r)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "goroutine 1 [running]:\n", string(b))
+	ut.AssertEqual(t, nil, r.Close())
+
+	r, err = f.Tail()
+	ut.AssertEqual(t, nil, err)
+	buf := make([]byte, 64)
+	n, err := io.ReadAtLeast(r, buf, len("goroutine 1 [running]:\n"))
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "goroutine 1 [running]:\n", string(buf[:n]))
+	// The content appended afterward is returned.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		w, err := os.OpenFile(p, os.O_APPEND|os.O_WRONLY, 0600)
+		if err == nil {
+			_, _ = w.WriteString("main.main()\n")
+			w.Close()
+		}
+	}()
+	n, err = io.ReadAtLeast(r, buf, len("main.main()\n"))
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "main.main()\n", string(buf[:n]))
+	ut.AssertEqual(t, nil, r.Close())
+	n, err = r.Read(buf)
+	ut.AssertEqual(t, 0, n)
+	ut.AssertEqual(t, io.EOF, err)
+
+	_, err = File(filepath.Join(dir, "missing.txt")).Open()
+	ut.AssertEqual(t, true, err != nil)
+}
+
+func TestHTTP(t *testing.T) {
+	t.Parallel()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/debug/pprof/goroutine" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = io.WriteString(w, "goroutine 1 [running]:\n")
+	}))
+	defer s.Close()
+	src, err := Parse(s.URL + "/debug/pprof/goroutine?debug=2")
+	ut.AssertEqual(t, nil, err)
+	r, err := src.Open()
+	ut.AssertEqual(t, nil, err)
+	b, err := ioutil.ReadAll(r)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "goroutine 1 [running]:\n", string(b))
+	ut.AssertEqual(t, nil, r.Close())
+
+	_, err = (&HTTP{URL: s.URL + "/missing"}).Open()
+	ut.AssertEqual(t, true, err != nil)
+}
+
+func TestStartCommand(t *testing.T) {
+	t.Parallel()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is required")
+	}
+	r, err := startCommand([]string{"sh", "-c", "echo out; echo err >&2"})
+	ut.AssertEqual(t, nil, err)
+	b, err := ioutil.ReadAll(r)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, nil, r.Close())
+	// The order of the two streams is not guaranteed.
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	sort.Strings(lines)
+	ut.AssertEqual(t, []string{"err", "out"}, lines)
+
+	r, err = startCommand([]string{"sh", "-c", "exit 3"})
+	ut.AssertEqual(t, nil, err)
+	_, err = ioutil.ReadAll(r)
+	ut.AssertEqual(t, true, err != nil)
+	ut.AssertEqual(t, nil, r.Close())
+
+	// Closing kills a command that doesn't exit on its own.
+	r, err = startCommand([]string{"sh", "-c", "echo started; sleep 60"})
+	ut.AssertEqual(t, nil, err)
+	buf := make([]byte, 8)
+	_, err = io.ReadFull(r, buf)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, nil, r.Close())
+}
@@ -0,0 +1,19 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package internal
+
+import "debug/buildinfo"
+
+// readBuildInfo returns the build info embedded in an executable.
+func readBuildInfo(binary string) (string, error) {
+	info, err := buildinfo.ReadFile(binary)
+	if err != nil {
+		return "", err
+	}
+	return info.String(), nil
+}
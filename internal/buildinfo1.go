@@ -0,0 +1,17 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+//go:build !go1.18
+// +build !go1.18
+
+package internal
+
+import "errors"
+
+// readBuildInfo returns the build info embedded in an executable.
+//
+// Package debug/buildinfo was added in Go 1.18.
+func readBuildInfo(binary string) (string, error) {
+	return "", errors.New("reading the build info requires panicparse to be built with Go 1.18 or later")
+}
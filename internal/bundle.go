@@ -0,0 +1,230 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/maruel/panicparse/stack"
+	"github.com/mattn/go-colorable"
+	"github.com/mattn/go-isatty"
+)
+
+// Files in a crash report bundle.
+const (
+	bundleDump        = "dump.txt"
+	bundleBuckets     = "buckets.json"
+	bundleReport      = "report.html"
+	bundleBuildInfo   = "buildinfo.txt"
+	bundleEnvironment = "environment.json"
+)
+
+// environment is a summary of the environment in which a bundle was created.
+type environment struct {
+	Created     time.Time `json:"created"`
+	Hostname    string    `json:"hostname"`
+	GOOS        string    `json:"goos"`
+	GOARCH      string    `json:"goarch"`
+	GOTRACEBACK string    `json:"gotraceback"`
+	// GoVersion is the version of Go used to build panicparse, which is not
+	// necessarily the one of the process that crashed; see buildinfo.txt.
+	GoVersion string `json:"go_version"`
+}
+
+func currentEnvironment() environment {
+	hostname, _ := os.Hostname()
+	return environment{
+		Created:     time.Now().UTC(),
+		Hostname:    hostname,
+		GOOS:        runtime.GOOS,
+		GOARCH:      runtime.GOARCH,
+		GOTRACEBACK: os.Getenv("GOTRACEBACK"),
+		GoVersion:   runtime.Version(),
+	}
+}
+
+// writeBundle writes a zip file containing the raw dump, the buckets as JSON,
+// an HTML report, the build info of binary, if specified, and env.
+func writeBundle(w io.Writer, raw []byte, c *stack.Criteria, parse bool, binary string, env environment) error {
+	symbols, err := openSymbols(binary)
+	if err != nil {
+		return err
+	}
+	_, buckets, err := parseBuckets(bytes.NewReader(raw), &stack.Parser{}, c, parse, symbols)
+	if err != nil {
+		return err
+	}
+	z := zip.NewWriter(w)
+	f, err := z.Create(bundleDump)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(raw); err != nil {
+		return err
+	}
+	if f, err = z.Create(bundleBuckets); err != nil {
+		return err
+	}
+	if err = json.NewEncoder(f).Encode(buckets); err != nil {
+		return err
+	}
+	if f, err = z.Create(bundleReport); err != nil {
+		return err
+	}
+	if err = stack.HTML(f, buckets, true); err != nil {
+		return err
+	}
+	if binary != "" {
+		info, err := readBuildInfo(binary)
+		if err != nil {
+			return fmt.Errorf("failed to read the build info of %s: %s", binary, err)
+		}
+		if f, err = z.Create(bundleBuildInfo); err != nil {
+			return err
+		}
+		if _, err = io.WriteString(f, info); err != nil {
+			return err
+		}
+	}
+	if f, err = z.Create(bundleEnvironment); err != nil {
+		return err
+	}
+	if err = json.NewEncoder(f).Encode(env); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+// openBundle prints the summary of a bundle then the processed dump.
+func openBundle(r io.ReaderAt, size int64, out io.Writer, p *stack.Palette, c *stack.Criteria, fullPath bool) error {
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	files := map[string]*zip.File{}
+	for _, f := range z.File {
+		files[f.Name] = f
+	}
+	var env environment
+	if err = readBundleJSON(files[bundleEnvironment], &env); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(out, "Bundle created %s on %s (%s/%s), GOTRACEBACK=%q\n", env.Created.Format(time.RFC3339), env.Hostname, env.GOOS, env.GOARCH, env.GOTRACEBACK)
+	if f := files[bundleBuildInfo]; f != nil {
+		info, err := readBundleFile(f)
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(out, "%s\n", info)
+	}
+	dump, err := readBundleFile(files[bundleDump])
+	if err != nil {
+		return err
+	}
+	// The sources are likely not present on this machine.
+	return process(bytes.NewReader(dump), out, p, c, &options{fullPath: fullPath})
+}
+
+// readBundleFile returns the content of a file in a bundle.
+func readBundleFile(f *zip.File) ([]byte, error) {
+	if f == nil {
+		return nil, errors.New("not a panicparse bundle")
+	}
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// readBundleJSON decodes a JSON file in a bundle.
+func readBundleJSON(f *zip.File, v interface{}) error {
+	b, err := readBundleFile(f)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// bundleMain implements "pp bundle".
+func bundleMain(args []string) error {
+	fs := flag.NewFlagSet("bundle", flag.ContinueOnError)
+	output := fs.String("o", "", "Bundle file to create")
+	binary := fs.String("binary", "", "Executable that generated the stack dump, to include its build info and recover elided and inlined frames")
+	parse := fs.Bool("parse", true, "Parses source files to deduct types")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: pp bundle -o <bundle.zip> [-binary <exe>] [dump]\n\nCreates a crash report bundle to attach to bug reports.\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *output == "" {
+		return errors.New("-o is required")
+	}
+	raw, err := readInput(fs.Args())
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first so a failure doesn't leave a truncated
+	// bundle behind.
+	tmp := *output + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	err = writeBundle(f, raw, &stack.Criteria{Similarity: stack.AnyPointer}, *parse, *binary, currentEnvironment())
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, *output)
+}
+
+// openMain implements "pp open".
+func openMain(args []string) error {
+	fs := flag.NewFlagSet("open", flag.ContinueOnError)
+	fullPath := fs.Bool("full-path", false, "Print full sources path")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: pp open <bundle.zip>\n\nPrints a crash report bundle created with pp bundle.\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("specify a single bundle file")
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	var out io.Writer = os.Stdout
+	p := &stack.Palette{}
+	if isatty.IsTerminal(os.Stdout.Fd()) && os.Getenv("TERM") != "dumb" {
+		p = &defaultPalette
+		out = colorable.NewColorableStdout()
+	}
+	return openBundle(f, st.Size(), out, p, &stack.Criteria{Similarity: stack.AnyPointer}, *fullPath)
+}
@@ -0,0 +1,78 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maruel/panicparse/stack"
+	"github.com/maruel/ut"
+)
+
+func TestBundle(t *testing.T) {
+	env := environment{
+		Created:  time.Date(2016, 3, 1, 12, 0, 0, 0, time.UTC),
+		Hostname: "host",
+		GOOS:     "linux",
+		GOARCH:   "amd64",
+	}
+	raw := []byte(strings.Join(data, "\n"))
+	b := &bytes.Buffer{}
+	ut.AssertEqual(t, nil, writeBundle(b, raw, &stack.Criteria{Similarity: stack.AnyPointer}, false, "", env))
+
+	z, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	ut.AssertEqual(t, nil, err)
+	var names []string
+	for _, f := range z.File {
+		names = append(names, f.Name)
+	}
+	ut.AssertEqual(t, []string{"dump.txt", "buckets.json", "report.html", "environment.json"}, names)
+
+	out := &bytes.Buffer{}
+	err = openBundle(bytes.NewReader(b.Bytes()), int64(b.Len()), out, &stack.Palette{}, &stack.Criteria{Similarity: stack.AnyPointer}, false)
+	ut.AssertEqual(t, nil, err)
+	expected := []string{
+		"Bundle created 2016-03-01T12:00:00Z on host (linux/amd64), GOTRACEBACK=\"\"",
+		"panic: runtime error: index out of range",
+		"",
+		"1: running [5 minutes] [locked] [Created by main.(*batchArchiveRun).main @ batch_archive.go:167]",
+	}
+	ut.AssertEqual(t, expected, strings.Split(out.String(), "\n")[:len(expected)])
+}
+
+func TestBundleMainFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "panicparse")
+	ut.AssertEqual(t, nil, err)
+	defer os.RemoveAll(dir)
+	dump := filepath.Join(dir, "dump.txt")
+	ut.AssertEqual(t, nil, ioutil.WriteFile(dump, []byte(strings.Join(data, "\n")), 0600))
+	output := filepath.Join(dir, "bundle.zip")
+	err = bundleMain([]string{"-o", output, "-binary", filepath.Join(dir, "missing"), dump})
+	ut.AssertEqual(t, true, err != nil)
+	entries, err := ioutil.ReadDir(dir)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 1, len(entries))
+
+	ut.AssertEqual(t, nil, bundleMain([]string{"-o", output, dump}))
+	_, err = os.Stat(output)
+	ut.AssertEqual(t, nil, err)
+	_, err = os.Stat(output + ".tmp")
+	ut.AssertEqual(t, true, os.IsNotExist(err))
+}
+
+func TestOpenBundleInvalid(t *testing.T) {
+	b := &bytes.Buffer{}
+	z := zip.NewWriter(b)
+	ut.AssertEqual(t, nil, z.Close())
+	err := openBundle(bytes.NewReader(b.Bytes()), int64(b.Len()), &bytes.Buffer{}, &stack.Palette{}, &stack.Criteria{}, false)
+	ut.AssertEqual(t, "not a panicparse bundle", err.Error())
+}
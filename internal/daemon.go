@@ -0,0 +1,230 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+// JSON-RPC 2.0 error codes.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcServerError    = -32000
+)
+
+// maxMessageSize is the largest message accepted, so a bogus Content-Length
+// header doesn't allocate an arbitrary amount of memory.
+const maxMessageSize = 64 * 1024 * 1024
+
+// rpcRequest is a JSON-RPC 2.0 request. ID is nil for notifications.
+type rpcRequest struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Method  string           `json:"method"`
+	Params  json.RawMessage  `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  interface{}      `json:"result,omitempty"`
+	Error   *rpcError        `json:"error,omitempty"`
+}
+
+// parseParams are the parameters of the "parse" method.
+type parseParams struct {
+	// Dump is the raw stack dump.
+	Dump string `json:"dump"`
+	// Aggressive is the same as -aggressive.
+	Aggressive bool `json:"aggressive"`
+	// NoParse disables parsing the source files, like -parse=false.
+	NoParse bool `json:"noParse"`
+	// Binary is the executable that generated the dump, like -binary.
+	Binary string `json:"binary"`
+}
+
+// parseResult is the result of the "parse" method.
+type parseResult struct {
+	Buckets     stack.Buckets           `json:"buckets"`
+	Diagnostics []stack.FileDiagnostics `json:"diagnostics"`
+	Reason      *stack.PanicReason      `json:"reason,omitempty"`
+	Fatal       *stack.FatalError       `json:"fatal,omitempty"`
+}
+
+// daemon serves JSON-RPC requests. It keeps the symbols of the executables
+// loaded between requests.
+type daemon struct {
+	symbols map[string]*stack.Symbols
+}
+
+// serve reads requests from r and writes the responses to w until the
+// "exit" notification or the end of r.
+//
+// The messages are framed with a Content-Length header like in the Language
+// Server Protocol.
+func (d *daemon) serve(r io.Reader, w io.Writer) error {
+	br := bufio.NewReader(r)
+	for {
+		b, err := readMessage(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		req := rpcRequest{}
+		resp := rpcResponse{JSONRPC: "2.0"}
+		if err = json.Unmarshal(b, &req); err != nil {
+			resp.Error = &rpcError{rpcParseError, err.Error()}
+		} else {
+			if req.Method == "exit" {
+				return nil
+			}
+			resp.ID = req.ID
+			resp.Result, resp.Error = d.call(&req)
+			if req.ID == nil {
+				continue
+			}
+			if resp.Error == nil && resp.Result == nil {
+				// A successful response must have a result, even if null.
+				resp.Result = json.RawMessage("null")
+			}
+		}
+		if err = writeMessage(w, &resp); err != nil {
+			return err
+		}
+	}
+}
+
+// call runs a request.
+func (d *daemon) call(req *rpcRequest) (interface{}, *rpcError) {
+	switch req.Method {
+	case "parse":
+		p := parseParams{}
+		if err := json.Unmarshal(req.Params, &p); err != nil {
+			return nil, &rpcError{rpcInvalidParams, err.Error()}
+		}
+		res, err := d.parse(&p)
+		if err != nil {
+			return nil, &rpcError{rpcServerError, err.Error()}
+		}
+		return res, nil
+	case "shutdown":
+		return nil, nil
+	case "":
+		return nil, &rpcError{rpcInvalidRequest, "method is required"}
+	default:
+		return nil, &rpcError{rpcMethodNotFound, "unknown method " + req.Method}
+	}
+}
+
+// parse implements the "parse" method.
+func (d *daemon) parse(p *parseParams) (*parseResult, error) {
+	var symbols *stack.Symbols
+	if p.Binary != "" {
+		if symbols = d.symbols[p.Binary]; symbols == nil {
+			var err error
+			if symbols, err = stack.OpenSymbols(p.Binary); err != nil {
+				return nil, err
+			}
+			d.symbols[p.Binary] = symbols
+		}
+	}
+	c := &stack.Criteria{Similarity: stack.AnyPointer}
+	if p.Aggressive {
+		c.Similarity = stack.AnyValue
+	}
+	snapshot, buckets, err := parseBuckets(strings.NewReader(p.Dump), &stack.Parser{}, c, !p.NoParse, symbols)
+	if err != nil {
+		return nil, err
+	}
+	return &parseResult{
+		Buckets:     buckets,
+		Diagnostics: stack.Diagnostics(buckets),
+		Reason:      snapshot.Reason,
+		Fatal:       snapshot.Fatal,
+	}, nil
+}
+
+// readMessage reads a message framed with a Content-Length header.
+func readMessage(r *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && line != "" {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		if i := strings.IndexByte(line, ':'); i != -1 && strings.EqualFold(line[:i], "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(line[i+1:])); err != nil || length < 0 {
+				return nil, fmt.Errorf("invalid header %q", line)
+			}
+			if length > maxMessageSize {
+				return nil, fmt.Errorf("message of %d bytes is larger than %d bytes", length, maxMessageSize)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, errors.New("missing Content-Length header")
+	}
+	b := make([]byte, length)
+	_, err := io.ReadFull(r, b)
+	return b, err
+}
+
+// writeMessage writes a message framed with a Content-Length header.
+func writeMessage(w io.Writer, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	buf := bytes.Buffer{}
+	fmt.Fprintf(&buf, "Content-Length: %d\r\n\r\n", len(b))
+	buf.Write(b)
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// daemonMain implements "pp daemon".
+func daemonMain(args []string) error {
+	fs := flag.NewFlagSet("daemon", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: pp daemon\n\nServes JSON-RPC 2.0 requests on stdin and stdout, framed like the Language\nServer Protocol. The \"parse\" method takes {\"dump\": \"...\"} and returns the\nbuckets and the diagnostics.\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("unexpected arguments")
+	}
+	d := &daemon{symbols: map[string]*stack.Symbols{}}
+	return d.serve(os.Stdin, os.Stdout)
+}
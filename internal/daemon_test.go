@@ -0,0 +1,75 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/maruel/panicparse/stack"
+	"github.com/maruel/ut"
+)
+
+func TestDaemon(t *testing.T) {
+	dump := strings.Join([]string{
+		"panic: boom",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"	/gopath/src/github.com/foo/bar/main.go:12 +0x1d",
+		"",
+	}, "\n")
+	in := &bytes.Buffer{}
+	params, _ := json.Marshal(parseParams{Dump: dump, NoParse: true})
+	for _, msg := range []string{
+		`{"jsonrpc":"2.0","id":1,"method":"parse","params":` + string(params) + `}`,
+		`{"jsonrpc":"2.0","id":"a","method":"foo"}`,
+		`{"jsonrpc":"2.0","method":"initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"shutdown"}`,
+	} {
+		ut.AssertEqual(t, nil, writeMessage(in, json.RawMessage(msg)))
+	}
+	out := &bytes.Buffer{}
+	d := &daemon{symbols: map[string]*stack.Symbols{}}
+	ut.AssertEqual(t, nil, d.serve(in, out))
+
+	r := bufio.NewReader(out)
+	b, err := readMessage(r)
+	ut.AssertEqual(t, nil, err)
+	resp := struct {
+		ID     int
+		Result parseResult
+	}{}
+	ut.AssertEqual(t, nil, json.Unmarshal(b, &resp))
+	ut.AssertEqual(t, 1, resp.ID)
+	ut.AssertEqual(t, 1, len(resp.Result.Buckets))
+	ut.AssertEqual(t, "main.main", resp.Result.Buckets[0].Stack.Calls[0].Func.Raw)
+	ut.AssertEqual(t, "boom", resp.Result.Reason.Value)
+	ut.AssertEqual(t, 1, len(resp.Result.Diagnostics))
+
+	b, err = readMessage(r)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, `{"jsonrpc":"2.0","id":"a","error":{"code":-32601,"message":"unknown method foo"}}`, string(b))
+	b, err = readMessage(r)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, `{"jsonrpc":"2.0","id":2,"result":null}`, string(b))
+	// Nothing is processed after "exit".
+	_, err = readMessage(r)
+	ut.AssertEqual(t, "EOF", err.Error())
+}
+
+func TestReadMessageTooLarge(t *testing.T) {
+	r := bufio.NewReader(bytes.NewBufferString("Content-Length: 1000000000\r\n\r\n{}"))
+	_, err := readMessage(r)
+	ut.AssertEqual(t, "message of 1000000000 bytes is larger than 67108864 bytes", err.Error())
+	r = bufio.NewReader(bytes.NewBufferString("Content-Length: -1\r\n\r\n{}"))
+	_, err = readMessage(r)
+	ut.AssertEqual(t, "invalid header \"Content-Length: -1\"", err.Error())
+}
@@ -17,6 +17,8 @@
 package internal
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -24,9 +26,16 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"os/exec"
 	"os/signal"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
 	"syscall"
 
+	"github.com/maruel/panicparse/input"
 	"github.com/maruel/panicparse/stack"
 	"github.com/mattn/go-colorable"
 	"github.com/mattn/go-isatty"
@@ -52,27 +61,584 @@ var defaultPalette = stack.Palette{
 	FunctionOther:          ansi.Red,
 	FunctionOtherExported:  ansi.ColorCode("red+b"),
 	Arguments:              resetFG,
+	CountIncrease:          ansi.ColorCode("red+b"),
+	CountDecrease:          ansi.ColorCode("green+b"),
+}
+
+// options are the options of process.
+type options struct {
+	fullPath bool
+	// origins prints the signatures folded into each bucket below it.
+	origins bool
+	// args prints the pointer arguments shared by all the goroutines of each
+	// bucket below it.
+	args bool
+	// memory prints the estimated stack memory of each bucket below it.
+	memory bool
+	// ids prints the goroutine IDs of each bucket below it.
+	ids bool
+	// fingerprint prints the fingerprint of each bucket below it.
+	fingerprint bool
+	// known tags or hides the buckets of known issues.
+	known  stack.KnownIssues
+	parse  bool
+	binary string
+	// age prints how long the goroutines of each bucket have been blocked
+	// below it.
+	age bool
+	// minAge hides the buckets whose oldest goroutine has been blocked for
+	// less minutes.
+	minAge int
+	// orders re-sorts the buckets, when set.
+	orders []stack.BucketOrder
+	// top is the number of buckets printed, the others are only counted. 0
+	// prints all of them.
+	top int
+	// analyze prints the findings of the registered analyzers after the
+	// buckets.
+	analyze bool
+	// noise shows the buckets of runtime background goroutines.
+	noise bool
+	// dropStdlib hides the buckets entirely in the standard library.
+	dropStdlib bool
+	// parser holds the parsing options.
+	parser stack.Parser
 }
 
 // process copies stdin to stdout and processes any "panic: " line found.
-func process(in io.Reader, out io.Writer, p *stack.Palette, s stack.Similarity, fullPath, parse bool) error {
-	goroutines, err := stack.ParseDump(in, out)
-	if err != nil {
+//
+// Each dump is processed separately and its buckets are printed in place of
+// it.
+func process(in io.Reader, out io.Writer, p *stack.Palette, c *stack.Criteria, opts *options) error {
+	f := opts.parser.NewFollower(out, func(snapshot *stack.Snapshot) error {
+		return processSnapshot(snapshot, out, p, c, opts)
+	})
+	if _, err := io.Copy(f, in); err != nil {
 		return err
 	}
+	return f.Close()
+}
+
+// processSnapshot prints the buckets of a dump.
+func processSnapshot(snapshot *stack.Snapshot, out io.Writer, p *stack.Palette, c *stack.Criteria, opts *options) error {
+	fullPath := opts.fullPath
+	for _, w := range snapshot.Warnings {
+		_, _ = fmt.Fprintf(out, "warning: %s\n", w)
+	}
+	if snapshot.Incomplete {
+		_, _ = fmt.Fprintf(out, "warning: the dump is incomplete, it was cut while being printed\n")
+	}
+	goroutines := snapshot.Goroutines
+	stack.TrimGCAssist(goroutines)
+	if opts.binary != "" {
+		symbols, err := stack.OpenSymbols(opts.binary)
+		if err != nil {
+			return err
+		}
+		symbols.RecoverElided(goroutines)
+		symbols.ExpandInlined(goroutines)
+	}
 	if len(goroutines) == 1 && showBanner() {
 		_, _ = io.WriteString(out, "\nTo see all goroutines, visit https://github.com/maruel/panicparse#GOTRACEBACK\n\n")
 	}
-	if parse {
+	if opts.parse {
 		stack.Augment(goroutines)
 	}
-	buckets := stack.SortBuckets(stack.Bucketize(goroutines, s))
+	buckets := c.Buckets(goroutines)
+	known := 0
+	if opts.known != nil {
+		buckets, known = opts.known.Apply(buckets)
+	}
+	if opts.minAge != 0 {
+		buckets = stack.FilterByAge(buckets, opts.minAge)
+	}
+	if len(opts.orders) != 0 {
+		stack.SortBucketsBy(buckets, opts.orders...)
+	}
+	if opts.dropStdlib {
+		buckets = stack.FilterStdlib(buckets)
+	}
+	hidden := 0
+	if !opts.noise {
+		all := len(buckets)
+		buckets = stack.FilterNoise(buckets)
+		hidden = all - len(buckets)
+	}
+	// The buckets not shown still count in the summary and the findings.
+	shown, remainder := stack.Top(buckets, opts.top)
+	srcLen, pkgLen := stack.CalcLengths(shown, fullPath)
+	for _, bucket := range shown {
+		_, _ = io.WriteString(out, p.BucketHeader(&bucket, fullPath, len(buckets) > 1))
+		_, _ = io.WriteString(out, p.StackLines(&bucket.Signature, srcLen, pkgLen, fullPath))
+		if opts.args {
+			_, _ = io.WriteString(out, p.ArgLines(&bucket))
+		}
+		if opts.ids {
+			_, _ = io.WriteString(out, p.IDLine(&bucket))
+		}
+		if opts.fingerprint {
+			_, _ = io.WriteString(out, p.FingerprintLine(&bucket))
+		}
+		if opts.age {
+			_, _ = io.WriteString(out, p.AgeLine(&bucket))
+		}
+		if opts.memory {
+			_, _ = io.WriteString(out, p.MemoryLine(&bucket))
+		}
+		if opts.origins {
+			_, _ = io.WriteString(out, p.OriginLines(&bucket, srcLen, pkgLen, fullPath))
+		}
+	}
+	_, _ = io.WriteString(out, p.RemainderLine(remainder))
+	if opts.memory {
+		_, _ = io.WriteString(out, p.MemorySummary(buckets))
+	}
+	if opts.analyze {
+		_, _ = io.WriteString(out, p.FindingLines(stack.Analyze(snapshot, buckets), buckets, fullPath))
+	}
+	if hidden != 0 {
+		_, _ = fmt.Fprintf(out, "%d buckets of runtime goroutines hidden, use -noise to show them\n", hidden)
+	}
+	if known != 0 {
+		_, _ = fmt.Fprintf(out, "%d buckets of known issues hidden\n", known)
+	}
+	return nil
+}
+
+// processDiff parses two dumps and prints the difference between them.
+func processDiff(old, newer io.Reader, out io.Writer, p *stack.Palette, parser *stack.Parser, c *stack.Criteria, fullPath, parse, html bool, binary string) error {
+	symbols, err := openSymbols(binary)
+	if err != nil {
+		return err
+	}
+	oldSnapshot, oldBuckets, err := parseBuckets(old, parser, c, parse, symbols)
+	if err != nil {
+		return err
+	}
+	newSnapshot, newBuckets, err := parseBuckets(newer, parser, c, parse, symbols)
+	if err != nil {
+		return err
+	}
+	d := c.Diff(oldBuckets, newBuckets)
+	if html {
+		return stack.DiffHTML(out, d, fullPath)
+	}
+	if rate, ok := stack.SpawnRate(oldSnapshot, newSnapshot); ok {
+		net := len(newSnapshot.Goroutines) - len(oldSnapshot.Goroutines)
+		_, _ = fmt.Fprintf(out, "Spawn rate: %.1f goroutines/s over %s, net change %+d\n", rate, newSnapshot.Time.Sub(oldSnapshot.Time), net)
+	}
+	srcLen, pkgLen := stack.CalcLengths(d.Buckets(), fullPath)
+	_, err = io.WriteString(out, p.DiffLines(d, srcLen, pkgLen, fullPath))
+	return err
+}
+
+// processLeaks prints the buckets whose goroutine count grew over the dumps,
+// oldest first.
+func processLeaks(ins []io.Reader, out io.Writer, p *stack.Palette, parser *stack.Parser, c *stack.Criteria, fullPath, parse bool, binary string) error {
+	symbols, err := openSymbols(binary)
+	if err != nil {
+		return err
+	}
+	snapshots := make([]*stack.Snapshot, len(ins))
+	for i, in := range ins {
+		if snapshots[i], _, err = parseBuckets(in, parser, c, parse, symbols); err != nil {
+			return err
+		}
+	}
+	leaks := c.FindLeaks(snapshots)
+	if len(leaks) == 0 {
+		_, err = io.WriteString(out, "No leak suspect.\n")
+		return err
+	}
+	buckets := make(stack.Buckets, len(leaks))
+	for i := range leaks {
+		buckets[i] = leaks[i].Bucket
+	}
+	srcLen, pkgLen := stack.CalcLengths(buckets, fullPath)
+	_, err = io.WriteString(out, p.LeakLines(leaks, srcLen, pkgLen, fullPath))
+	return err
+}
+
+// processDiagnostics prints the diagnostics for the dump as JSON.
+func processDiagnostics(in io.Reader, out io.Writer, parser *stack.Parser, c *stack.Criteria, parse bool, binary string) error {
+	symbols, err := openSymbols(binary)
+	if err != nil {
+		return err
+	}
+	_, buckets, err := parseBuckets(in, parser, c, parse, symbols)
+	if err != nil {
+		return err
+	}
+	e := json.NewEncoder(out)
+	e.SetIndent("", "  ")
+	return e.Encode(stack.Diagnostics(buckets))
+}
+
+// processQuickfix prints the source lines involved in the dump in the
+// quickfix format.
+func processQuickfix(in io.Reader, out io.Writer, parser *stack.Parser, c *stack.Criteria, parse bool, binary string) error {
+	symbols, err := openSymbols(binary)
+	if err != nil {
+		return err
+	}
+	_, buckets, err := parseBuckets(in, parser, c, parse, symbols)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(out, stack.Quickfix(buckets))
+	return err
+}
+
+// processChannels prints the number of goroutines blocked sending and
+// receiving per channel, then the candidate deadlocks with their buckets.
+func processChannels(in io.Reader, out io.Writer, p *stack.Palette, parser *stack.Parser, c *stack.Criteria, fullPath, parse bool, binary string) error {
+	symbols, err := openSymbols(binary)
+	if err != nil {
+		return err
+	}
+	snapshot, buckets, err := parseBuckets(in, parser, c, parse, symbols)
+	if err != nil {
+		return err
+	}
+	for i, ch := range stack.Channels(snapshot.Goroutines) {
+		if _, err = fmt.Fprintf(out, "channel #%d (0x%x): %d senders vs %d receivers\n", i+1, ch.Addr, ch.Senders, ch.Receivers); err != nil {
+			return err
+		}
+	}
+	for i, cycle := range stack.ChannelCycles(snapshot.Goroutines) {
+		steps := make([]string, len(cycle.Goroutines))
+		for j, id := range cycle.Goroutines {
+			steps[j] = fmt.Sprintf("goroutine %d on 0x%x", id, cycle.Channels[j])
+		}
+		if _, err = fmt.Fprintf(out, "deadlock candidate #%d: %s -> goroutine %d\n", i+1, strings.Join(steps, " -> "), cycle.Goroutines[0]); err != nil {
+			return err
+		}
+		involved := cycle.Buckets(buckets)
+		srcLen, pkgLen := stack.CalcLengths(involved, fullPath)
+		for j := range involved {
+			_, _ = io.WriteString(out, p.BucketHeader(&involved[j], fullPath, false))
+			_, _ = io.WriteString(out, p.StackLines(&involved[j].Signature, srcLen, pkgLen, fullPath))
+		}
+	}
+	return nil
+}
+
+// processLabels prints the number of goroutines per value of the pprof label
+// key.
+func processLabels(in io.Reader, out io.Writer, parser *stack.Parser, c *stack.Criteria, key string) error {
+	snapshot, _, err := parseBuckets(in, parser, c, false, nil)
+	if err != nil {
+		return err
+	}
+	for _, g := range stack.GroupByLabel(snapshot.Goroutines, key) {
+		if _, err = fmt.Fprintf(out, "%s=%s: %d goroutines\n", key, g.Value, len(g.Goroutines)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// processStats prints the overview of the goroutines.
+func processStats(in io.Reader, out io.Writer, parser *stack.Parser, c *stack.Criteria) error {
+	snapshot, _, err := parseBuckets(in, parser, c, false, nil)
+	if err != nil {
+		return err
+	}
+	s := stack.Stats(snapshot.Goroutines)
+	text := fmt.Sprintf("Goroutines: %d, locked to a thread: %d", s.Total, s.Locked)
+	if s.LongestWaitID != 0 {
+		text += fmt.Sprintf(", longest wait: %d minutes (goroutine %d)", s.LongestWait, s.LongestWaitID)
+	}
+	text += "\nStates:\n"
+	for _, k := range sortedByCount(s.States) {
+		text += fmt.Sprintf("  %d %s\n", s.States[k], k)
+	}
+	text += "Packages:\n"
+	for _, k := range sortedByCount(s.Packages) {
+		name := k
+		if name == "" {
+			name = "(standard library)"
+		}
+		text += fmt.Sprintf("  %d %s\n", s.Packages[k], name)
+	}
+	_, err = io.WriteString(out, text)
+	return err
+}
+
+// processTree prints the goroutines rolled up under their creator.
+func processTree(in io.Reader, out io.Writer, p *stack.Palette, parser *stack.Parser, c *stack.Criteria, fullPath bool) error {
+	snapshot, _, err := parseBuckets(in, parser, c, false, nil)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(out, p.TreeLines(c.BucketizeTree(snapshot.Tree()), fullPath))
+	return err
+}
+
+// processRace prints the data race reports in the input, deduplicated.
+func processRace(in io.Reader, out io.Writer, p *stack.Palette, c *stack.Criteria, fullPath bool) error {
+	reports, err := stack.ParseRaceReports(in, out)
+	if err != nil {
+		return err
+	}
+	var goroutines []stack.Goroutine
+	for i := range reports {
+		goroutines = append(goroutines, reports[i].Goroutines()...)
+	}
+	buckets := c.Buckets(goroutines)
+	_, _ = fmt.Fprintf(out, "%d data races, %d unique accesses\n", len(reports), len(buckets))
+	srcLen, pkgLen := stack.CalcLengths(buckets, fullPath)
+	for _, bucket := range buckets {
+		_, _ = io.WriteString(out, p.BucketHeader(&bucket, fullPath, false))
+		_, _ = io.WriteString(out, p.StackLines(&bucket.Signature, srcLen, pkgLen, fullPath))
+	}
+	return nil
+}
+
+// processProfile prints a goroutine profile, either in the protocol buffer
+// format or in the debug=1 text format.
+func processProfile(in io.Reader, out io.Writer, p *stack.Palette, fullPath bool) error {
+	b, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	// The text format never parses as a protocol buffer, as "goroutine" starts
+	// with an invalid tag, so a parse error means it is text. A gzip header is
+	// always a compressed protocol buffer.
+	buckets, err := stack.ParseProfileProto(bytes.NewReader(b))
+	if err != nil && !bytes.HasPrefix(b, []byte{0x1f, 0x8b}) {
+		total := 0
+		buckets, total, err = stack.ParseProfileTotal(bytes.NewReader(b))
+		if n := stack.ProfileCount(buckets); err == nil && total != -1 && total != n {
+			_, _ = fmt.Fprintf(out, "warning: the profile header says %d goroutines but %d were parsed\n", total, n)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	sort.Sort(buckets)
 	srcLen, pkgLen := stack.CalcLengths(buckets, fullPath)
 	for _, bucket := range buckets {
 		_, _ = io.WriteString(out, p.BucketHeader(&bucket, fullPath, len(buckets) > 1))
 		_, _ = io.WriteString(out, p.StackLines(&bucket.Signature, srcLen, pkgLen, fullPath))
 	}
-	return err
+	return nil
+}
+
+// printVersion prints the Go version used to build the executable and the
+// digest of each embedded asset.
+func printVersion(out io.Writer) error {
+	if _, err := fmt.Fprintf(out, "panicparse built with %s\n", runtime.Version()); err != nil {
+		return err
+	}
+	assets := stack.AssetVersions()
+	names := make([]string, 0, len(assets))
+	for name := range assets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := fmt.Fprintf(out, "  %s %s\n", name, assets[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortedByCount returns the keys with the highest count first, then
+// alphabetically.
+func sortedByCount(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	sort.Stable(byCount{keys, m})
+	return keys
+}
+
+type byCount struct {
+	keys []string
+	m    map[string]int
+}
+
+func (b byCount) Len() int {
+	return len(b.keys)
+}
+
+func (b byCount) Less(i, j int) bool {
+	return b.m[b.keys[i]] > b.m[b.keys[j]]
+}
+
+func (b byCount) Swap(i, j int) {
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+}
+
+// openSymbols loads the symbols of binary, if specified.
+func openSymbols(binary string) (*stack.Symbols, error) {
+	if binary == "" {
+		return nil, nil
+	}
+	return stack.OpenSymbols(binary)
+}
+
+// parseBuckets parses a dump and discards the junk.
+//
+// symbols is optional.
+func parseBuckets(in io.Reader, parser *stack.Parser, c *stack.Criteria, parse bool, symbols *stack.Symbols) (*stack.Snapshot, stack.Buckets, error) {
+	snapshot, err := parser.ParseSnapshot(in, ioutil.Discard)
+	if err != nil {
+		return nil, nil, err
+	}
+	stack.TrimGCAssist(snapshot.Goroutines)
+	if symbols != nil {
+		symbols.RecoverElided(snapshot.Goroutines)
+		symbols.ExpandInlined(snapshot.Goroutines)
+	}
+	if parse {
+		stack.Augment(snapshot.Goroutines)
+	}
+	return snapshot, c.Buckets(snapshot.Goroutines), nil
+}
+
+// openInput opens the dump described by spec, a file path or any other input
+// supported by input.Parse.
+func openInput(spec string) (io.ReadCloser, error) {
+	src, err := input.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	r, err := src.Open()
+	if err != nil {
+		if _, ok := src.(input.File); ok {
+			return nil, fmt.Errorf("did you mean to specify a valid stack dump file name? %s", err)
+		}
+		return nil, fmt.Errorf("failed to read %s: %s", src.Describe(), err)
+	}
+	return r, nil
+}
+
+// readInput reads the whole dump from stdin if args is empty, or from the
+// single input in args.
+func readInput(args []string) ([]byte, error) {
+	switch len(args) {
+	case 0:
+		return ioutil.ReadAll(os.Stdin)
+	case 1:
+		r, err := openInput(args[0])
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	default:
+		return nil, errors.New("pipe from stdin or specify a single file")
+	}
+}
+
+// adaptInput returns a reader decompressing the input, unwrapping the JSON
+// log lines, e.g. of a container, unescaping the dumps embedded in string
+// values, optionally normalizing a dump copied from a web UI, optionally
+// removing the Markdown wrapping of a pasted dump and stripping the -prefix
+// value from each line.
+//
+// A profile is only decompressed, as the protocol buffer format is binary.
+func adaptInput(r io.Reader, prefix string, unescapeHTML, markdown, profile bool) (io.Reader, error) {
+	r, err := stack.Decompress(r)
+	if err != nil || profile {
+		return r, err
+	}
+	r = stack.UnescapeJSONStrings(stack.UnwrapJSONLogs(r, ""))
+	if unescapeHTML {
+		r = stack.UnescapeHTML(r)
+	}
+	if markdown {
+		r = stack.StripMarkdown(r)
+	}
+	switch prefix {
+	case "":
+		return r, nil
+	case "auto":
+		return stack.StripPrefixes(r, nil), nil
+	default:
+		re, err := regexp.Compile("^(?:" + prefix + ")")
+		if err != nil {
+			return nil, fmt.Errorf("invalid -prefix: %s", err)
+		}
+		return stack.StripPrefixes(r, re), nil
+	}
+}
+
+// newZstdReader decompresses r with the zstd command, streaming its output.
+func newZstdReader(r io.Reader) (io.Reader, error) {
+	cmd := exec.Command("zstd", "-d", "-c")
+	cmd.Stdin = r
+	z := &zstdReader{cmd: cmd}
+	cmd.Stderr = &z.stderr
+	var err error
+	if z.out, err = cmd.StdoutPipe(); err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("zstd: %s", err)
+	}
+	return z, nil
+}
+
+// zstdReader reads the output of the zstd command and reports its failure at
+// the end of the stream.
+type zstdReader struct {
+	cmd    *exec.Cmd
+	out    io.Reader
+	stderr bytes.Buffer
+	err    error
+}
+
+func (z *zstdReader) Read(b []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	n, err := z.out.Read(b)
+	if err == io.EOF {
+		if werr := z.cmd.Wait(); werr != nil {
+			err = fmt.Errorf("zstd: %s: %s", werr, bytes.TrimSpace(z.stderr.Bytes()))
+		}
+	}
+	z.err = err
+	return n, err
+}
+
+// loadRules reads the rules file set by -rules, if any.
+func loadRules(name string) (stack.Rules, error) {
+	if name == "" {
+		return nil, nil
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rules, err := stack.ParseRules(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	return rules, nil
+}
+
+// parseSleepRanges parses a comma separated list of minutes.
+func parseSleepRanges(s string) ([]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var out []int
+	for _, item := range strings.Split(s, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(item))
+		if err != nil || v <= 0 || (len(out) != 0 && v <= out[len(out)-1]) {
+			return nil, fmt.Errorf("invalid sleep range %q; expected increasing minutes, e.g. 30,60", s)
+		}
+		out = append(out, v)
+	}
+	return out, nil
 }
 
 func showBanner() bool {
@@ -87,30 +653,143 @@ func showBanner() bool {
 // compiled. This is to work around the Perl Package manager 'pp' that is
 // preinstalled on some OSes.
 func Main() error {
-	signals := make(chan os.Signal)
+	signals := make(chan os.Signal, 1)
 	go func() {
 		for {
 			<-signals
 		}
 	}()
 	signal.Notify(signals, os.Interrupt, syscall.SIGQUIT)
-	aggressive := flag.Bool("aggressive", false, "Aggressive deduplication including non pointers")
+	stack.NewZstdReader = newZstdReader
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "bundle":
+			return bundleMain(os.Args[2:])
+		case "daemon":
+			return daemonMain(os.Args[2:])
+		case "open":
+			return openMain(os.Args[2:])
+		case "replay":
+			return replayMain(os.Args[2:])
+		case "serve":
+			return serveMain(os.Args[2:])
+		case "selftest":
+			return selftestMain(os.Args[2:])
+		}
+	}
+	aggressive := flag.Bool("aggressive", false, "Aggressive deduplication including non pointers; same as -similarity anyvalue")
+	similarity := flag.String("similarity", "anypointer", "How much the arguments of the goroutines merged in a bucket may differ: exactflags, exactlines, anypointer or anyvalue")
 	fullPath := flag.Bool("full-path", false, "Print full sources path")
 	noColor := flag.Bool("no-color", !isatty.IsTerminal(os.Stdout.Fd()) || os.Getenv("TERM") == "dumb", "Disable coloring")
 	forceColor := flag.Bool("force-color", false, "Forcibly enable coloring when with stdout is redirected")
 	parse := flag.Bool("parse", true, "Parses source files to deduct types; use -parse=false to work around bugs in source parser")
 	verboseFlag := flag.Bool("v", false, "Enables verbose logging output")
+	diff := flag.Bool("diff", false, "Compares two stack dump files: old then new")
+	leaks := flag.Bool("leaks", false, "Finds the buckets growing over stack dump files of the same process, oldest first")
+	html := flag.Bool("html", false, "Prints the -diff output as HTML")
+	binary := flag.String("binary", "", "Executable that generated the stack dump, used to recover elided and inlined frames")
+	diagnostics := flag.Bool("diagnostics", false, "Prints Language Server Protocol diagnostics as JSON, for editor integration")
+	quickfix := flag.Bool("quickfix", false, "Prints file:line: message lines for Vim's quickfix list and Emacs' compilation mode")
+	channels := flag.Bool("channels", false, "Prints the number of goroutines blocked sending and receiving per channel and the candidate deadlocks")
+	byLabel := flag.String("by-label", "", "Prints the number of goroutines per value of this pprof label, e.g. request; requires GODEBUG=tracebacklabels=1")
+	stats := flag.Bool("stats", false, "Prints the number of goroutines per state and per package instead of the buckets")
+	tree := flag.Bool("tree", false, "Prints the buckets indented under the bucket of the goroutines that created them")
+	race := flag.Bool("race", false, "Parses and deduplicates the data race reports of a binary built with -race")
+	profile := flag.Bool("profile", false, "Parses a /debug/pprof/goroutine profile, binary or debug=1, instead of a stack dump")
+	memory := flag.Bool("memory", false, "Prints the estimated stack memory of each bucket")
+	fingerprint := flag.Bool("fingerprint", false, "Prints the fingerprint of each bucket, to list it in a -known file")
+	rulesFile := flag.String("rules", "", "JSON file of rules matching buckets by function, package or state regexps to tag and explain them, e.g. [{\"func\": \"database/sql\", \"tags\": [\"db\"], \"explanation\": \"see runbook\"}]")
+	knownFile := flag.String("known", "", "File of known issues, one \"<fingerprint> <issue> [hide]\" per line; their buckets are tagged with the issue or hidden")
+	ids := flag.Bool("ids", false, "Prints the IDs of the goroutines of each bucket as ranges, e.g. 5, 18-24, 101")
+	args := flag.Bool("args", false, "Prints the pointer arguments identical across all the goroutines of each bucket")
+	dropStdlib := flag.Bool("drop-stdlib", false, "Hides the buckets without any call outside the standard library and -framework, e.g. HTTP/2 readers")
+	noise := flag.Bool("noise", false, "Shows the buckets of runtime background goroutines, e.g. GC workers")
+	analyze := flag.Bool("analyze", false, "Prints the issues found by the analyzers, e.g. deadlocks, after the buckets")
+	origins := flag.Bool("origins", false, "Prints the signatures with exact arguments folded into each bucket")
+	version := flag.Bool("version", false, "Prints the Go version and the embedded assets digests then exits")
+	prefix := flag.String("prefix", "auto", "Regexp of the prefix to strip from each line, e.g. added by a logger; \"auto\" detects common log formats, \"\" disables")
+	demux := flag.String("demux", "", "Regexp matching the prefix identifying the process of each line, with a group for the process name, e.g. '^\\[([^\\]]+)\\] '; each process is processed separately")
+	age := flag.Bool("age", false, "Prints how long the goroutines of each bucket have been blocked: the oldest, median and newest")
+	minAge := flag.Int("min-age", 0, "Hides the buckets whose oldest goroutine has been blocked for less than this number of minutes")
+	top := flag.Int("top", 0, "Prints only this number of buckets, the first ones once sorted, and counts the others")
+	sortBy := flag.String("sort", "", "Comma separated orders of the buckets, each breaking the ties of the previous one: crashed, count, wait, state, private or default, e.g. wait,count")
+	sortAge := flag.Bool("sort-age", false, "Sorts the buckets with the one blocked the longest first; same as -sort wait")
+	topFrames := flag.Int("top-frames", 0, "Puts the goroutines whose innermost calls are the same in the same bucket, regardless of their callers, e.g. 3")
+	bottomFrames := flag.Int("bottom-frames", 0, "Puts the goroutines whose outermost calls and creator are the same in the same bucket, regardless of where they are blocked")
+	ignoreTop := flag.String("ignore-top", "", "Comma separated functions; ignores the goroutines blocked in any of them, like goleak.IgnoreTopFunction")
+	ignoreAny := flag.String("ignore-any", "", "Comma separated functions; ignores the goroutines with any of them in their stack, like goleak.IgnoreAnyFunction")
+	ignoreCreatedBy := flag.String("ignore-created-by", "", "Comma separated functions; ignores the goroutines created by any of them, like goleak.IgnoreCreatedBy")
+	anyLine := flag.Bool("any-line", false, "Puts the goroutines whose calls only differ by line number in the same bucket, e.g. to merge dumps of slightly different builds")
+	anyClosure := flag.Bool("any-closure", false, "Puts the goroutines whose calls only differ by the number of an anonymous function, e.g. Worker.func1 and Worker.func2, in the same bucket")
+	splitLocked := flag.Bool("split-locked", false, "Separates goroutines locked to an OS thread from the others")
+	splitLabels := flag.String("split-labels", "", "Separates goroutines by the value of these comma separated pprof labels, e.g. tenant; requires GODEBUG=tracebacklabels=1")
+	unescapeHTML := flag.Bool("unescape-html", false, "Unescapes the HTML entities and non-breaking spaces of a dump copied from a web UI, e.g. Grafana or Kibana")
+	noMarkdown := flag.Bool("no-markdown", false, "Keeps the Markdown code fences and blockquotes of a dump pasted in a GitHub issue or a chat message")
+	stripANSI := flag.Bool("strip-ansi", true, "Removes the ANSI escape sequences, e.g. colors, from the dump before parsing it; use -strip-ansi=false to parse them as is")
+	framework := flag.String("framework", "", "Comma separated import paths or source directories of code to rank and color like the standard library, e.g. github.com/acme/kit")
+	splitSleep := flag.String("split-sleep", "", "Separates goroutines by sleep duration, e.g. 30,60 for <30, 30~59 and >=60 minutes")
 	flag.Parse()
 
 	log.SetFlags(log.Lmicroseconds)
 	if !*verboseFlag {
 		log.SetOutput(ioutil.Discard)
 	}
+	if *version {
+		return printVersion(os.Stdout)
+	}
 
-	s := stack.AnyPointer
+	c := &stack.Criteria{Locked: *splitLocked, AnyLine: *anyLine, AnyClosure: *anyClosure, TopFrames: *topFrames, BottomFrames: *bottomFrames}
+	var err error
+	if c.Similarity, err = stack.ParseSimilarity(*similarity); err != nil {
+		return err
+	}
 	if *aggressive {
-		s = stack.AnyValue
+		c.Similarity = stack.AnyValue
+	}
+	if c.SleepRanges, err = parseSleepRanges(*splitSleep); err != nil {
+		return err
+	}
+	if *splitLabels != "" {
+		c.Labels = strings.Split(*splitLabels, ",")
+	}
+	if *framework != "" {
+		c.FrameworkPrefixes = strings.Split(*framework, ",")
+	}
+	for _, r := range []struct {
+		list string
+		rule func(string) stack.IgnoreRule
+	}{{*ignoreTop, stack.IgnoreTopFunction}, {*ignoreAny, stack.IgnoreAnyFunction}, {*ignoreCreatedBy, stack.IgnoreCreatedBy}} {
+		if r.list != "" {
+			for _, f := range strings.Split(r.list, ",") {
+				c.Ignore = append(c.Ignore, r.rule(f))
+			}
+		}
 	}
+	var orders []stack.BucketOrder
+	if *sortAge {
+		orders = []stack.BucketOrder{stack.ByWait}
+	}
+	if *sortBy != "" {
+		if orders, err = stack.ParseBucketOrders(*sortBy); err != nil {
+			return err
+		}
+	}
+	var known stack.KnownIssues
+	if *knownFile != "" {
+		f, err := os.Open(*knownFile)
+		if err != nil {
+			return err
+		}
+		known, err = stack.ParseKnownIssues(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %s", *knownFile, err)
+		}
+	}
+	if c.Rules, err = loadRules(*rulesFile); err != nil {
+		return err
+	}
+	parser := &stack.Parser{KeepANSI: !*stripANSI}
 
 	var out io.Writer
 	p := &defaultPalette
@@ -121,19 +800,168 @@ func Main() error {
 		out = colorable.NewColorableStdout()
 	}
 
-	var in *os.File
+	modes := 0
+	for _, m := range []bool{*diagnostics, *quickfix, *channels, *byLabel != "", *stats, *tree, *race, *profile} {
+		if m {
+			modes++
+		}
+	}
+	if modes != 0 && (*diff || *leaks) {
+		return errors.New("-diagnostics, -quickfix, -channels, -by-label, -stats, -tree, -race and -profile are not supported with -diff and -leaks")
+	}
+	if *diff && *leaks {
+		return errors.New("-diff and -leaks are mutually exclusive")
+	}
+	if modes > 1 {
+		return errors.New("-diagnostics, -quickfix, -channels, -by-label, -stats, -tree, -race and -profile are mutually exclusive")
+	}
+	if *diff {
+		if flag.NArg() != 2 {
+			return errors.New("-diff requires two stack dump files")
+		}
+		old, err := openInput(flag.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer old.Close()
+		newer, err := openInput(flag.Arg(1))
+		if err != nil {
+			return err
+		}
+		defer newer.Close()
+		oldIn, err := adaptInput(old, *prefix, *unescapeHTML, !*noMarkdown, false)
+		if err != nil {
+			return err
+		}
+		newIn, err := adaptInput(newer, *prefix, *unescapeHTML, !*noMarkdown, false)
+		if err != nil {
+			return err
+		}
+		return processDiff(oldIn, newIn, out, p, parser, c, *fullPath, *parse, *html, *binary)
+	}
+	if *leaks {
+		if flag.NArg() < 2 {
+			return errors.New("-leaks requires at least two stack dump files")
+		}
+		ins := make([]io.Reader, flag.NArg())
+		for i, arg := range flag.Args() {
+			f, err := openInput(arg)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			if ins[i], err = adaptInput(f, *prefix, *unescapeHTML, !*noMarkdown, false); err != nil {
+				return err
+			}
+		}
+		return processLeaks(ins, out, p, parser, c, *fullPath, *parse, *binary)
+	}
+	if *html {
+		return errors.New("-html is only supported with -diff")
+	}
+
+	run := func(in io.Reader) error {
+		if *diagnostics {
+			return processDiagnostics(in, out, parser, c, *parse, *binary)
+		}
+		if *quickfix {
+			return processQuickfix(in, out, parser, c, *parse, *binary)
+		}
+		if *channels {
+			return processChannels(in, out, p, parser, c, *fullPath, *parse, *binary)
+		}
+		if *byLabel != "" {
+			return processLabels(in, out, parser, c, *byLabel)
+		}
+		if *stats {
+			return processStats(in, out, parser, c)
+		}
+		if *tree {
+			return processTree(in, out, p, parser, c, *fullPath)
+		}
+		if *race {
+			return processRace(in, out, p, c, *fullPath)
+		}
+		if *profile {
+			return processProfile(in, out, p, *fullPath)
+		}
+		return process(in, out, p, c, &options{
+			fullPath:    *fullPath,
+			origins:     *origins,
+			args:        *args,
+			memory:      *memory,
+			ids:         *ids,
+			fingerprint: *fingerprint,
+			known:       known,
+			parse:       *parse,
+			binary:      *binary,
+			age:         *age,
+			minAge:      *minAge,
+			orders:      orders,
+			top:         *top,
+			analyze:     *analyze,
+			noise:       *noise,
+			dropStdlib:  *dropStdlib,
+			parser:      *parser,
+		})
+	}
+
+	if flag.NArg() == 1 && input.IsArchive(flag.Arg(0)) {
+		// Process each file of a directory or of a tar archive, e.g. a support
+		// bundle, that contains a dump.
+		return input.Walk(flag.Arg(0), func(name string, r io.Reader) error {
+			b, err := ioutil.ReadAll(r)
+			if err != nil || !bytes.Contains(b, []byte("goroutine ")) {
+				return err
+			}
+			if _, err = fmt.Fprintf(out, "%s:\n", name); err != nil {
+				return err
+			}
+			in, err := adaptInput(bytes.NewReader(b), *prefix, *unescapeHTML, !*noMarkdown, *profile)
+			if err != nil {
+				return err
+			}
+			return run(in)
+		})
+	}
+
+	var f io.ReadCloser
 	switch flag.NArg() {
 	case 0:
-		in = os.Stdin
+		f = os.Stdin
 	case 1:
-		var err error
-		name := flag.Arg(0)
-		if in, err = os.Open(name); err != nil {
-			return fmt.Errorf("did you mean to specify a valid stack dump file name? %s", err)
+		if f, err = openInput(flag.Arg(0)); err != nil {
+			return err
 		}
-		defer in.Close()
+		defer f.Close()
 	default:
 		return errors.New("pipe from stdin or specify a single file")
 	}
-	return process(in, out, p, s, *fullPath, *parse)
+	in, err := adaptInput(f, *prefix, *unescapeHTML, !*noMarkdown, *profile)
+	if err != nil {
+		return err
+	}
+	if *demux == "" {
+		return run(in)
+	}
+	re, err := regexp.Compile(*demux)
+	if err != nil {
+		return fmt.Errorf("invalid -demux: %s", err)
+	}
+	if re.NumSubexp() < 1 {
+		return errors.New("-demux requires a group matching the source")
+	}
+	streams, err := stack.Demux(in, stack.RegexpSource(re))
+	if err != nil {
+		return err
+	}
+	for _, s := range streams {
+		if _, err = fmt.Fprintf(out, "%s:\n", s.Source); err != nil {
+			return err
+		}
+		if err = run(bytes.NewReader(s.Data)); err != nil {
+			return err
+		}
+	}
+	return nil
 }
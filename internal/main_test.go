@@ -6,6 +6,13 @@ package internal
 
 import (
 	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"runtime/pprof"
 	"strings"
 	"testing"
 
@@ -48,7 +55,7 @@ var data = []string{
 
 func TestProcess(t *testing.T) {
 	out := &bytes.Buffer{}
-	err := process(bytes.NewBufferString(strings.Join(data, "\n")), out, &defaultPalette, stack.AnyPointer, false, false)
+	err := process(bytes.NewBufferString(strings.Join(data, "\n")), out, &defaultPalette, &stack.Criteria{Similarity: stack.AnyPointer}, &options{})
 	ut.AssertEqual(t, nil, err)
 	expected := []string{
 		"panic: runtime error: index out of range",
@@ -71,9 +78,107 @@ func TestProcess(t *testing.T) {
 	ut.AssertEqual(t, expected, actual)
 }
 
+func TestProcessNoise(t *testing.T) {
+	data := []string{
+		"goroutine 1 [chan receive]:",
+		"main.main()",
+		"	/gopath/src/github.com/foo/bar/baz.go:10 +0x27",
+		"",
+		"goroutine 2 [force gc (idle)]:",
+		"runtime.gopark(0x4a1e28, 0x5a2d40, 0x1411, 0x1)",
+		"	/goroot/src/runtime/proc.go:367 +0xd6",
+		"runtime.forcegchelper()",
+		"	/goroot/src/runtime/proc.go:301 +0xad",
+		"created by runtime.init.7",
+		"	/goroot/src/runtime/proc.go:289 +0x25",
+		"",
+	}
+	expected := []string{
+		"1: chan receive",
+		"    main baz.go:10 main()",
+		"1 buckets of runtime goroutines hidden, use -noise to show them",
+		"",
+	}
+	out := &bytes.Buffer{}
+	err := process(bytes.NewBufferString(strings.Join(data, "\n")), out, &stack.Palette{}, &stack.Criteria{Similarity: stack.AnyPointer}, &options{})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, strings.Join(expected, "\n"), out.String())
+
+	out.Reset()
+	err = process(bytes.NewBufferString(strings.Join(data, "\n")), out, &stack.Palette{}, &stack.Criteria{Similarity: stack.AnyPointer}, &options{noise: true})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, true, strings.Contains(out.String(), "1: force gc (idle) [Created by runtime.init.7 @ proc.go:289]\n"))
+}
+
+func TestProcessRules(t *testing.T) {
+	rules, err := stack.ParseRules(bytes.NewBufferString(`[{"func": "^main\\.main$", "tags": ["entry"], "explanation": "see the runbook"}]`))
+	ut.AssertEqual(t, nil, err)
+	c := &stack.Criteria{Similarity: stack.AnyPointer, Rules: rules}
+	data := []string{
+		"goroutine 1 [chan receive]:",
+		"main.main()",
+		"	/gopath/src/github.com/foo/bar/baz.go:10 +0x27",
+		"",
+		"goroutine 2 [select]:",
+		"main.a()",
+		"	/gopath/src/github.com/foo/bar/baz.go:20 +0x27",
+		"",
+	}
+	expected := []string{
+		"1: chan receive [entry, explanation=\"see the runbook\"]",
+		"    main baz.go:10 main()",
+		"1: select",
+		"    main baz.go:20 a()",
+		"",
+	}
+	out := &bytes.Buffer{}
+	err = process(bytes.NewBufferString(strings.Join(data, "\n")), out, &stack.Palette{}, c, &options{})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, strings.Join(expected, "\n"), out.String())
+
+	// The rules apply to every output mode.
+	out.Reset()
+	err = processTree(bytes.NewBufferString(strings.Join(data, "\n")), out, &stack.Palette{}, &stack.Parser{}, c, false)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, true, strings.Contains(out.String(), "1: chan receive [entry, explanation=\"see the runbook\"] main.main @ baz.go:10\n"))
+}
+
+func TestProcessTop(t *testing.T) {
+	data := []string{
+		"goroutine 1 [chan receive]:",
+		"main.main()",
+		"	/gopath/src/github.com/foo/bar/baz.go:10 +0x27",
+		"",
+		"goroutine 2 [select]:",
+		"main.a()",
+		"	/gopath/src/github.com/foo/bar/baz.go:20 +0x27",
+		"",
+		"goroutine 3 [select]:",
+		"main.a()",
+		"	/gopath/src/github.com/foo/bar/baz.go:20 +0x27",
+		"",
+	}
+	expected := []string{
+		"1: chan receive",
+		"    main baz.go:10 main()",
+		"and 1 more signatures (2 goroutines)",
+		"",
+	}
+	out := &bytes.Buffer{}
+	err := process(bytes.NewBufferString(strings.Join(data, "\n")), out, &stack.Palette{}, &stack.Criteria{Similarity: stack.AnyPointer}, &options{top: 1})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, strings.Join(expected, "\n"), out.String())
+
+	// The summary counts the buckets not shown.
+	out.Reset()
+	err = process(bytes.NewBufferString(strings.Join(data, "\n")), out, &stack.Palette{}, &stack.Criteria{Similarity: stack.AnyPointer}, &options{top: 1, memory: true})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, true, strings.Contains(out.String(), " in 3 goroutines\n"))
+}
+
 func TestProcessFullPath(t *testing.T) {
 	out := &bytes.Buffer{}
-	err := process(bytes.NewBufferString(strings.Join(data, "\n")), out, &defaultPalette, stack.AnyValue, true, false)
+	err := process(bytes.NewBufferString(strings.Join(data, "\n")), out, &defaultPalette, &stack.Criteria{Similarity: stack.AnyValue}, &options{fullPath: true})
 	ut.AssertEqual(t, nil, err)
 	expected := []string{
 		"panic: runtime error: index out of range",
@@ -98,7 +203,7 @@ func TestProcessFullPath(t *testing.T) {
 
 func TestProcessNoColor(t *testing.T) {
 	out := &bytes.Buffer{}
-	err := process(bytes.NewBufferString(strings.Join(data, "\n")), out, &stack.Palette{}, stack.AnyPointer, false, false)
+	err := process(bytes.NewBufferString(strings.Join(data, "\n")), out, &stack.Palette{}, &stack.Criteria{Similarity: stack.AnyPointer}, &options{})
 	ut.AssertEqual(t, nil, err)
 	expected := []string{
 		"panic: runtime error: index out of range",
@@ -120,3 +225,540 @@ func TestProcessNoColor(t *testing.T) {
 	}
 	ut.AssertEqual(t, expected, actual)
 }
+
+func TestProcessMultipleDumps(t *testing.T) {
+	in := []string{
+		"starting the server",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"\t/gopath/src/foo/main.go:10 +0x27",
+		"",
+		"restarting the server",
+		"goroutine 1 [chan receive]:",
+		"main.main()",
+		"\t/gopath/src/foo/main.go:12 +0x27",
+		"",
+		"the server stopped",
+		"",
+	}
+	out := &bytes.Buffer{}
+	err := process(bytes.NewBufferString(strings.Join(in, "\n")), out, &stack.Palette{}, &stack.Criteria{Similarity: stack.AnyPointer}, &options{})
+	ut.AssertEqual(t, nil, err)
+	expected := []string{
+		"starting the server",
+		"",
+		"To see all goroutines, visit https://github.com/maruel/panicparse#GOTRACEBACK",
+		"",
+		"1: running",
+		"    main main.go:10 main()",
+		"restarting the server",
+		"",
+		"To see all goroutines, visit https://github.com/maruel/panicparse#GOTRACEBACK",
+		"",
+		"1: chan receive",
+		"    main main.go:12 main()",
+		"the server stopped",
+		"",
+	}
+	ut.AssertEqual(t, expected, strings.Split(out.String(), "\n"))
+}
+
+func TestProcessWarnings(t *testing.T) {
+	in := []string{
+		"goroutine 1 [running]:",
+		"main.main({0x1, 0x2)",
+		"\t/gopath/src/foo/main.go:10 +0x27",
+		"",
+	}
+	out := &bytes.Buffer{}
+	err := process(bytes.NewBufferString(strings.Join(in, "\n")), out, &stack.Palette{}, &stack.Criteria{Similarity: stack.AnyPointer}, &options{})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, true, strings.Contains(out.String(), "warning: line 2: failed to parse arguments \"{0x1, 0x2\": missing '}'\n"))
+}
+
+func TestProcessIncomplete(t *testing.T) {
+	in := []string{
+		"goroutine 1 [running]:",
+		"main.main()",
+		"\t/gopath/src/foo/main.go:10 +0x27",
+		"",
+		"goroutine 2 [chan receive]:",
+		"main.ser",
+	}
+	out := &bytes.Buffer{}
+	err := process(bytes.NewBufferString(strings.Join(in, "\n")), out, &stack.Palette{}, &stack.Criteria{Similarity: stack.AnyPointer}, &options{})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, true, strings.HasPrefix(out.String(), "warning: the dump is incomplete, it was cut while being printed\n"))
+}
+
+func TestProcessDiff(t *testing.T) {
+	newData := []string{
+		"goroutine 2 [running, 1 minutes]:",
+		"gopkg.in/yaml%2ev2.handleErr(0xc208033b20)",
+		" /gopath/src/gopkg.in/yaml.v2/yaml.go:153 +0xc6",
+		"main.main()",
+		" /gopath/src/github.com/maruel/pre-commit-go/main.go:428 +0x27",
+		"",
+		"goroutine 3 [running, 2 minutes]:",
+		"gopkg.in/yaml%2ev2.handleErr(0xc208033b50)",
+		" /gopath/src/gopkg.in/yaml.v2/yaml.go:153 +0xc6",
+		"reflect.Value.assignTo(0x570860, 0xc20803f3e0, 0x15)",
+		" c:/go/src/reflect/value.go:2125 +0x368",
+		"main.main()",
+		" /gopath/src/github.com/maruel/pre-commit-go/main.go:428 +0x27",
+		"",
+	}
+	out := &bytes.Buffer{}
+	err := processDiff(bytes.NewBufferString(strings.Join(data, "\n")), bytes.NewBufferString(strings.Join(newData, "\n")), out, &stack.Palette{}, &stack.Parser{}, &stack.Criteria{Similarity: stack.AnyPointer}, false, false, false, "")
+	ut.AssertEqual(t, nil, err)
+	expected := []string{
+		"Matching:",
+		"2 -> 1 (-1): running [0~1 minutes] | running [2 minutes]",
+		"    yaml.v2  yaml.go:153          handleErr(#1)",
+		"    reflect  value.go:2125        Value.assignTo(0x570860, #2, 0x15)",
+		"    main     main.go:428          main()",
+		"Only in old:",
+		"1: running [5 minutes] [locked] [Created by main.(*batchArchiveRun).main @ batch_archive.go:167]",
+		"    archiver archiver.go:325      (*archiver).PushFile(#1, 0xc20968a3c0, 0x5b, 0xc20988c280, 0x7d, 0, 0)",
+		"    isolate  isolate.go:148       archive(#4, #1, #2, 0x22, #3, 0xc20804666a, 0x17, 0, 0, 0, ...)",
+		"    isolate  isolate.go:102       Archive(#4, #1, #2, 0x22, #3, 0, 0)",
+		"    main     batch_archive.go:166 func·004(0x7fffc3b8f13a, 0x2c)",
+		"Only in new:",
+		"1: running [1 minutes]",
+		"    yaml.v2  yaml.go:153          handleErr(0xc208033b20)",
+		"    main     main.go:428          main()",
+		"",
+	}
+	ut.AssertEqual(t, expected, strings.Split(out.String(), "\n"))
+}
+
+func TestParseSleepRanges(t *testing.T) {
+	r, err := parseSleepRanges("")
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, []int(nil), r)
+	r, err = parseSleepRanges("30, 60")
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, []int{30, 60}, r)
+	_, err = parseSleepRanges("60,30")
+	ut.AssertEqual(t, false, err == nil)
+	_, err = parseSleepRanges("a")
+	ut.AssertEqual(t, false, err == nil)
+}
+
+func TestProcessDiffSpawnRate(t *testing.T) {
+	oldData := []string{
+		"2016/03/01 12:00:00 dumping",
+		"goroutine 4 [running]:",
+		"main.main()",
+		" /gopath/src/github.com/maruel/pre-commit-go/main.go:428 +0x27",
+		"",
+	}
+	newData := []string{
+		"2016/03/01 12:00:10 dumping",
+		"goroutine 54 [running]:",
+		"main.main()",
+		" /gopath/src/github.com/maruel/pre-commit-go/main.go:428 +0x27",
+		"",
+	}
+	out := &bytes.Buffer{}
+	err := processDiff(bytes.NewBufferString(strings.Join(oldData, "\n")), bytes.NewBufferString(strings.Join(newData, "\n")), out, &stack.Palette{}, &stack.Parser{}, &stack.Criteria{Similarity: stack.AnyPointer}, false, false, false, "")
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "Spawn rate: 5.0 goroutines/s over 10s, net change +0", strings.Split(out.String(), "\n")[0])
+}
+
+func TestProcessLeaks(t *testing.T) {
+	dump := func(ts string, ids ...int) io.Reader {
+		lines := []string{ts + " dumping"}
+		for _, id := range ids {
+			lines = append(lines,
+				fmt.Sprintf("goroutine %d [chan send]:", id),
+				"main.worker(0xc208033b20)",
+				" /gopath/src/github.com/maruel/pre-commit-go/main.go:20 +0x27",
+				"created by main.main",
+				" /gopath/src/github.com/maruel/pre-commit-go/main.go:10 +0x27",
+				"")
+		}
+		return bytes.NewBufferString(strings.Join(lines, "\n"))
+	}
+	ins := []io.Reader{
+		dump("2016/03/01 12:00:00", 10),
+		dump("2016/03/01 12:00:10", 10, 11),
+		dump("2016/03/01 12:00:20", 10, 11, 12, 13),
+	}
+	out := &bytes.Buffer{}
+	err := processLeaks(ins, out, &stack.Palette{}, &stack.Parser{}, &stack.Criteria{Similarity: stack.AnyPointer}, false, false, "")
+	ut.AssertEqual(t, nil, err)
+	expected := []string{
+		"1 -> 2 -> 4 (+3, 0.15/s): chan send [Created by main.main @ main.go:10]; e.g. goroutine 13, 12, 11",
+		"    main main.go:20 worker(#1)",
+		"",
+	}
+	ut.AssertEqual(t, strings.Join(expected, "\n"), out.String())
+}
+
+func TestProcessDiagnostics(t *testing.T) {
+	out := &bytes.Buffer{}
+	err := processDiagnostics(bytes.NewBufferString(strings.Join(data, "\n")), out, &stack.Parser{}, &stack.Criteria{Similarity: stack.AnyPointer}, false, "")
+	ut.AssertEqual(t, nil, err)
+	var actual []stack.FileDiagnostics
+	ut.AssertEqual(t, nil, json.Unmarshal(out.Bytes(), &actual))
+	ut.AssertEqual(t, 4, len(actual))
+	ut.AssertEqual(t, "file:///gopath/path/to/archiver.go", actual[0].URI)
+	ut.AssertEqual(t, stack.DiagnosticError, actual[0].Diagnostics[0].Severity)
+	ut.AssertEqual(t, 324, actual[0].Diagnostics[0].Range.Start.Line)
+}
+
+func TestProcessQuickfix(t *testing.T) {
+	out := &bytes.Buffer{}
+	err := processQuickfix(bytes.NewBufferString(strings.Join(data, "\n")), out, &stack.Parser{}, &stack.Criteria{Similarity: stack.AnyPointer}, false, "")
+	ut.AssertEqual(t, nil, err)
+	expected := []string{
+		"/gopath/path/to/archiver.go:325: goroutine 11 running in archiver.(*archiver).PushFile",
+		"/gopath/path/to/isolate.go:148: goroutine 11 running, called from isolate.archive",
+		"/gopath/path/to/isolate.go:102: goroutine 11 running, called from isolate.Archive",
+		"/gopath/path/to/batch_archive.go:166: goroutine 11 running, called from main.func·004",
+		"/gopath/src/gopkg.in/yaml.v2/yaml.go:153: 2 goroutines running in yaml.v2.handleErr",
+		"",
+	}
+	ut.AssertEqual(t, expected, strings.Split(out.String(), "\n"))
+}
+
+func TestProcessChannels(t *testing.T) {
+	data := []string{
+		"panic: oh no",
+		"",
+		"goroutine 1 [chan send]:",
+		"runtime.chansend1(0xc208010060, 0xc20802a000)",
+		"	/goroot/src/runtime/chan.go:144 +0x2f",
+		"main.main()",
+		"	/gopath/src/github.com/foo/bar/baz.go:10 +0x27",
+		"",
+		"goroutine 2 [chan send]:",
+		"runtime.chansend1(0xc208010060, 0xc20802a008)",
+		"	/goroot/src/runtime/chan.go:144 +0x2f",
+		"main.main()",
+		"	/gopath/src/github.com/foo/bar/baz.go:11 +0x27",
+		"",
+	}
+	out := &bytes.Buffer{}
+	err := processChannels(bytes.NewBufferString(strings.Join(data, "\n")), out, &stack.Palette{}, &stack.Parser{}, &stack.Criteria{Similarity: stack.AnyPointer}, false, false, "")
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "channel #1 (0xc208010060): 2 senders vs 0 receivers\n", out.String())
+}
+
+func TestProcessChannelsDeadlock(t *testing.T) {
+	data := []string{
+		"goroutine 5 [chan receive]:",
+		"runtime.chanrecv1(0xc208010060, 0x0)",
+		"	/goroot/src/runtime/chan.go:144 +0x2f",
+		"main.a(0xc208010090)",
+		"	/gopath/src/github.com/foo/bar/baz.go:10 +0x27",
+		"",
+		"goroutine 6 [chan send]:",
+		"runtime.chansend1(0xc208010090, 0xc20802a008)",
+		"	/goroot/src/runtime/chan.go:144 +0x2f",
+		"main.b(0xc208010060)",
+		"	/gopath/src/github.com/foo/bar/baz.go:20 +0x27",
+		"",
+	}
+	out := &bytes.Buffer{}
+	err := processChannels(bytes.NewBufferString(strings.Join(data, "\n")), out, &stack.Palette{}, &stack.Parser{}, &stack.Criteria{Similarity: stack.AnyPointer}, false, false, "")
+	ut.AssertEqual(t, nil, err)
+	expected := []string{
+		"channel #1 (0xc208010060): 0 senders vs 1 receivers",
+		"channel #2 (0xc208010090): 1 senders vs 0 receivers",
+		"deadlock candidate #1: goroutine 5 on 0xc208010060 -> goroutine 6 on 0xc208010090 -> goroutine 5",
+		"1: chan receive",
+		"    runtime chan.go:144 chanrecv1(#1, 0)",
+		"    main    baz.go:10   a(#2)",
+		"1: chan send",
+		"    runtime chan.go:144 chansend1(#2, #3)",
+		"    main    baz.go:20   b(#1)",
+		"",
+	}
+	ut.AssertEqual(t, strings.Join(expected, "\n"), out.String())
+}
+
+func TestProcessLabels(t *testing.T) {
+	data := []string{
+		"goroutine 2 [chan receive] {request: abc123}:",
+		"main.serve()",
+		"	/gopath/src/github.com/foo/bar/baz.go:20 +0x27",
+		"",
+		"goroutine 3 [select] {request: abc123}:",
+		"main.fetch()",
+		"	/gopath/src/github.com/foo/bar/baz.go:30 +0x27",
+		"",
+	}
+	out := &bytes.Buffer{}
+	err := processLabels(bytes.NewBufferString(strings.Join(data, "\n")), out, &stack.Parser{}, &stack.Criteria{Similarity: stack.AnyPointer}, "request")
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "request=abc123: 2 goroutines\n", out.String())
+}
+
+func TestProcessRace(t *testing.T) {
+	report := []string{
+		"==================",
+		"WARNING: DATA RACE",
+		"Read at 0x00c000018168 by main goroutine:",
+		"  main.main()",
+		"      /tmp/race/r.go:11 +0xb8",
+		"",
+		"Previous write at 0x00c000018168 by goroutine 7:",
+		"  main.main.func1()",
+		"      /tmp/race/r.go:8 +0x2e",
+		"",
+		"Goroutine 7 (finished) created at:",
+		"  main.main()",
+		"      /tmp/race/r.go:7 +0xa4",
+		"==================",
+	}
+	// The same race reported by two tests.
+	in := strings.Join(append(append([]string{"=== RUN   TestA"}, report...), append([]string{"=== RUN   TestB"}, report...)...), "\n")
+	out := &bytes.Buffer{}
+	err := processRace(bytes.NewBufferString(in), out, &stack.Palette{}, &stack.Criteria{Similarity: stack.AnyPointer}, false)
+	ut.AssertEqual(t, nil, err)
+	expected := []string{
+		"=== RUN   TestA",
+		"=== RUN   TestB",
+		"2 data races, 2 unique accesses",
+		"2: previous write [Created by main.main @ r.go:7]",
+		"    main r.go:8  main.func1()",
+		"2: read",
+		"    main r.go:11 main()",
+		"",
+	}
+	ut.AssertEqual(t, expected, strings.Split(out.String(), "\n"))
+}
+
+func TestProcessProfile(t *testing.T) {
+	data := []string{
+		"goroutine profile: total 3",
+		"1 @ 0x43a5c5 0x46a6e1",
+		"#	0x46a6e0	main.main+0x20	/gopath/src/github.com/foo/bar/main.go:12",
+		"",
+		"2 @ 0x43a5c5 0x406838 0x46a6e1",
+		"#	0x406837	main.worker+0x37	/gopath/src/github.com/foo/bar/main.go:10",
+		"",
+	}
+	out := &bytes.Buffer{}
+	err := processProfile(bytes.NewBufferString(strings.Join(data, "\n")), out, &stack.Palette{}, false)
+	ut.AssertEqual(t, nil, err)
+	expected := []string{
+		"2: ",
+		"    main main.go:10 worker()",
+		"1: ",
+		"    main main.go:12 main()",
+		"",
+	}
+	ut.AssertEqual(t, expected, strings.Split(out.String(), "\n"))
+}
+
+func TestProcessProfileTotal(t *testing.T) {
+	data := []string{
+		"goroutine profile: total 5",
+		"1 @ 0x43a5c5 0x46a6e1",
+		"#	0x46a6e0	main.main+0x20	/gopath/src/github.com/foo/bar/main.go:12",
+		"",
+	}
+	out := &bytes.Buffer{}
+	err := processProfile(bytes.NewBufferString(strings.Join(data, "\n")), out, &stack.Palette{}, false)
+	ut.AssertEqual(t, nil, err)
+	expected := []string{
+		"warning: the profile header says 5 goroutines but 1 were parsed",
+		"1: ",
+		"    main main.go:12 main()",
+		"",
+	}
+	ut.AssertEqual(t, expected, strings.Split(out.String(), "\n"))
+}
+
+func TestProcessProfileProto(t *testing.T) {
+	b := &bytes.Buffer{}
+	ut.AssertEqual(t, nil, pprof.Lookup("goroutine").WriteTo(b, 0))
+	compressed := b.Bytes()
+	out := &bytes.Buffer{}
+	err := processProfile(bytes.NewReader(compressed), out, &stack.Palette{}, false)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, true, strings.Contains(out.String(), "TestProcessProfileProto()"))
+
+	// Uncompressed, the first byte is a field tag, which can be printable or a
+	// newline.
+	z, err := gzip.NewReader(bytes.NewReader(compressed))
+	ut.AssertEqual(t, nil, err)
+	raw, err := ioutil.ReadAll(z)
+	ut.AssertEqual(t, nil, err)
+	out.Reset()
+	ut.AssertEqual(t, nil, processProfile(bytes.NewReader(raw), out, &stack.Palette{}, false))
+	ut.AssertEqual(t, true, strings.Contains(out.String(), "TestProcessProfileProto()"))
+}
+
+func TestAdaptInputMarkdown(t *testing.T) {
+	const data = "> panic: boom\n"
+	for _, c := range []struct {
+		markdown bool
+		expected string
+	}{
+		{true, "panic: boom\n"},
+		{false, data},
+	} {
+		in, err := adaptInput(bytes.NewBufferString(data), "", false, c.markdown, false)
+		ut.AssertEqual(t, nil, err)
+		b, err := ioutil.ReadAll(in)
+		ut.AssertEqual(t, nil, err)
+		ut.AssertEqual(t, c.expected, string(b))
+	}
+}
+
+func TestProcessProfileAdapted(t *testing.T) {
+	b := &bytes.Buffer{}
+	ut.AssertEqual(t, nil, pprof.Lookup("goroutine").WriteTo(b, 0))
+	in, err := adaptInput(b, "auto", false, true, true)
+	ut.AssertEqual(t, nil, err)
+	out := &bytes.Buffer{}
+	ut.AssertEqual(t, nil, processProfile(in, out, &stack.Palette{}, false))
+	ut.AssertEqual(t, true, strings.Contains(out.String(), "TestProcessProfileAdapted()"))
+}
+
+func TestZstd(t *testing.T) {
+	if _, err := exec.LookPath("zstd"); err != nil {
+		t.Skip("zstd is not installed")
+	}
+	cmd := exec.Command("zstd", "-c")
+	cmd.Stdin = strings.NewReader("goroutine 1 [running]:\nmain.main()\n\t/src/main.go:12 +0x1d\n")
+	b, err := cmd.Output()
+	ut.AssertEqual(t, nil, err)
+	r, err := newZstdReader(bytes.NewReader(b))
+	ut.AssertEqual(t, nil, err)
+	goroutines, err := stack.ParseDump(r, ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 1, len(goroutines))
+
+	r, err = newZstdReader(strings.NewReader("not zstd"))
+	ut.AssertEqual(t, nil, err)
+	_, err = ioutil.ReadAll(r)
+	ut.AssertEqual(t, true, err != nil && strings.HasPrefix(err.Error(), "zstd: exit status 1: "))
+}
+
+func TestProcessOrigins(t *testing.T) {
+	data := []string{
+		"goroutine 1 [chan receive]:",
+		"main.worker(0x1)",
+		"	/gopath/src/github.com/foo/bar/baz.go:20 +0x27",
+		"",
+		"goroutine 2 [chan receive]:",
+		"main.worker(0x2)",
+		"	/gopath/src/github.com/foo/bar/baz.go:20 +0x27",
+		"",
+		"goroutine 3 [chan receive]:",
+		"main.worker(0x2)",
+		"	/gopath/src/github.com/foo/bar/baz.go:20 +0x27",
+		"",
+	}
+	out := &bytes.Buffer{}
+	err := process(bytes.NewBufferString(strings.Join(data, "\n")), out, &stack.Palette{}, &stack.Criteria{Similarity: stack.AnyValue}, &options{origins: true})
+	ut.AssertEqual(t, nil, err)
+	expected := []string{
+		"3: chan receive",
+		"    main baz.go:20 worker(*)",
+		"  Folded from 2 signatures:",
+		"  - 1: chan receive",
+		"    main baz.go:20 worker(0x1)",
+		"  - 2: chan receive",
+		"    main baz.go:20 worker(0x2)",
+		"",
+	}
+	ut.AssertEqual(t, expected, strings.Split(out.String(), "\n"))
+}
+
+func TestProcessArgs(t *testing.T) {
+	data := []string{
+		"goroutine 1 [semacquire]:",
+		"sync.(*Mutex).Lock(0xc00012c000)",
+		"	/goroot/src/sync/mutex.go:81 +0x47",
+		"main.worker(0xc00012c000, 0xc000010001)",
+		"	/gopath/src/github.com/foo/bar/baz.go:20 +0x27",
+		"",
+		"goroutine 2 [semacquire]:",
+		"sync.(*Mutex).Lock(0xc00012c000)",
+		"	/goroot/src/sync/mutex.go:81 +0x47",
+		"main.worker(0xc00012c000, 0xc000010002)",
+		"	/gopath/src/github.com/foo/bar/baz.go:20 +0x27",
+		"",
+	}
+	out := &bytes.Buffer{}
+	err := process(bytes.NewBufferString(strings.Join(data, "\n")), out, &stack.Palette{}, &stack.Criteria{Similarity: stack.AnyPointer}, &options{args: true})
+	ut.AssertEqual(t, nil, err)
+	expected := []string{
+		"2: semacquire",
+		"    sync mutex.go:81 (*Mutex).Lock(#1)",
+		"    main baz.go:20   worker(#1, *)",
+		"  sync.(*Mutex).Lock arg #1 identical across all 2 goroutines of the bucket (0xc00012c000)",
+		"  main.worker arg #1 identical across all 2 goroutines of the bucket (0xc00012c000)",
+		"",
+	}
+	ut.AssertEqual(t, expected, strings.Split(out.String(), "\n"))
+}
+
+func TestProcessMemory(t *testing.T) {
+	data := []string{
+		"goroutine 5 [syscall]:",
+		"runtime.notetsleepg(0x918100, 0xffffffffffffffff, 0x1)",
+		"	/goroot/src/runtime/lock_futex.go:201 +0x52 fp=0xc208018f68 sp=0xc208018f40",
+		"os/signal.loop()",
+		"	/goroot/src/os/signal/signal_unix.go:21 +0x1f fp=0xc208018fe0 sp=0xc208018fa0",
+		"",
+		"goroutine 6 [chan receive]:",
+		"main.worker()",
+		"	/gopath/src/github.com/foo/bar/baz.go:20 +0x27",
+		"",
+	}
+	out := &bytes.Buffer{}
+	err := process(bytes.NewBufferString(strings.Join(data, "\n")), out, &stack.Palette{}, &stack.Criteria{Similarity: stack.AnyPointer}, &options{memory: true})
+	ut.AssertEqual(t, nil, err)
+	expected := []string{
+		"1: syscall",
+		"    runtime lock_futex.go:201 notetsleepg(0x918100, 0xffffffffffffffff, 0x1)",
+		"    signal  signal_unix.go:21 loop()",
+		"  stack memory: ~2.0KiB (1/1 goroutines measured)",
+		"1: chan receive",
+		"    main    baz.go:20         worker()",
+		"  stack memory: >=2.0KiB (no frame pointers, assuming 2.0KiB each)",
+		"Stack memory: ~4.0KiB in 2 goroutines",
+		"",
+	}
+	ut.AssertEqual(t, expected, strings.Split(out.String(), "\n"))
+}
+
+func TestProcessStats(t *testing.T) {
+	data := []string{
+		"goroutine 1 [chan receive, 5 minutes]:",
+		"main.main()",
+		"	/gopath/src/github.com/foo/bar/baz.go:10 +0x27",
+		"",
+		"goroutine 2 [chan receive, locked to thread]:",
+		"github.com/foo/bar/qux.Wait()",
+		"	/gopath/src/github.com/foo/bar/qux/qux.go:10 +0x27",
+		"main.main()",
+		"	/gopath/src/github.com/foo/bar/baz.go:12 +0x27",
+		"",
+		"goroutine 3 [select]:",
+		"github.com/foo/bar/qux.Loop()",
+		"	/gopath/src/github.com/foo/bar/qux/qux.go:20 +0x27",
+		"",
+	}
+	out := &bytes.Buffer{}
+	err := processStats(bytes.NewBufferString(strings.Join(data, "\n")), out, &stack.Parser{}, &stack.Criteria{Similarity: stack.AnyPointer})
+	ut.AssertEqual(t, nil, err)
+	expected := []string{
+		"Goroutines: 3, locked to a thread: 1, longest wait: 5 minutes (goroutine 1)",
+		"States:",
+		"  2 chan receive",
+		"  1 select",
+		"Packages:",
+		"  2 github.com/foo/bar/qux",
+		"  1 main",
+		"",
+	}
+	ut.AssertEqual(t, strings.Join(expected, "\n"), out.String())
+}
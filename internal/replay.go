@@ -0,0 +1,71 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/maruel/panicparse/replay"
+)
+
+// printReplay prints the results that are not OK and returns an error if there
+// is any.
+func printReplay(out io.Writer, results []replay.Result) error {
+	failed := 0
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+			_, _ = fmt.Fprintf(out, "FAIL %s: %s\n", r.Path, r.Err)
+		case r.Missing:
+			_, _ = fmt.Fprintf(out, "MISSING %s: no recording; run with -update\n", r.Path)
+		default:
+			if r.Changed {
+				_, _ = fmt.Fprintf(out, "CHANGED %s\n", r.Path)
+			}
+			if len(r.NewJunk) != 0 {
+				_, _ = fmt.Fprintf(out, "NEW LINES %s:\n", r.Path)
+				for _, l := range r.NewJunk {
+					_, _ = fmt.Fprintf(out, "  %s\n", l)
+				}
+			}
+		}
+		if !r.OK() {
+			failed++
+		}
+	}
+	if failed != 0 {
+		return fmt.Errorf("%d of %d dumps regressed", failed, len(results))
+	}
+	_, _ = fmt.Fprintf(out, "%d dumps OK\n", len(results))
+	return nil
+}
+
+// replayMain implements "pp replay".
+func replayMain(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	update := fs.Bool("update", false, "Records the current parsing result of each dump")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: pp replay [-update] <dir>\n\nReplays the recorded stack dumps in a directory to detect parsing regressions.\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("specify a single directory")
+	}
+	if *update {
+		return replay.Update(fs.Arg(0))
+	}
+	results, err := replay.Replay(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return printReplay(os.Stdout, results)
+}
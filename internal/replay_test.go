@@ -0,0 +1,35 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/maruel/panicparse/replay"
+	"github.com/maruel/ut"
+)
+
+func TestPrintReplay(t *testing.T) {
+	out := &bytes.Buffer{}
+	results := []replay.Result{
+		{Path: "a.txt"},
+		{Path: "b.txt", Err: errors.New("boom")},
+		{Path: "c.txt", Missing: true},
+		{Path: "d.txt", Changed: true, NewJunk: []string{"foo"}},
+	}
+	ut.AssertEqual(t, "3 of 4 dumps regressed", printReplay(out, results).Error())
+	expected := "FAIL b.txt: boom\n" +
+		"MISSING c.txt: no recording; run with -update\n" +
+		"CHANGED d.txt\n" +
+		"NEW LINES d.txt:\n" +
+		"  foo\n"
+	ut.AssertEqual(t, expected, out.String())
+
+	out.Reset()
+	ut.AssertEqual(t, nil, printReplay(out, results[:1]))
+	ut.AssertEqual(t, "1 dumps OK\n", out.String())
+}
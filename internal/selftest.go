@@ -0,0 +1,264 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+// selftestCase is a program that crashes and the checks on its dump.
+//
+// Lines of the source ending with "// frame" must be printed in the stack of
+// the first goroutine, with the function and line number of the line.
+type selftestCase struct {
+	name   string
+	source string
+	check  func(s *stack.Snapshot) error
+}
+
+var selftestCases = []selftestCase{
+	{
+		name: "panic",
+		source: `package main
+
+type point struct{ x, y int }
+
+func c(s string, p point, l []int) {
+	panic("boom") // frame
+}
+
+func b(i int) {
+	c("hello", point{1, 2}, []int{1, 2, 3}) // frame
+}
+
+func main() {
+	b(42) // frame
+}
+`,
+		check: func(s *stack.Snapshot) error {
+			if s.Reason == nil || s.Reason.Value != "boom" {
+				return fmt.Errorf("expected panic \"boom\", got %q", s.Panic)
+			}
+			return nil
+		},
+	},
+	{
+		name: "nil",
+		source: `package main
+
+type T struct{ v int }
+
+//go:noinline
+func deref(t *T) int {
+	return t.v // frame
+}
+
+func main() {
+	deref(nil) // frame
+}
+`,
+		check: func(s *stack.Snapshot) error {
+			if s.Reason == nil || !s.Reason.RuntimeError {
+				return fmt.Errorf("expected a runtime error, got %q", s.Panic)
+			}
+			if s.Signal == nil || s.Signal.Name != "SIGSEGV" {
+				return errors.New("expected a SIGSEGV signal line")
+			}
+			return nil
+		},
+	},
+	{
+		name: "goroutines",
+		source: `package main
+
+import "time"
+
+func worker(c chan int) {
+	<-c
+}
+
+func main() {
+	c := make(chan int)
+	for i := 0; i < 10; i++ {
+		go worker(c)
+	}
+	time.Sleep(100 * time.Millisecond)
+	panic("done") // frame
+}
+`,
+		check: func(s *stack.Snapshot) error {
+			c := stack.Criteria{Similarity: stack.AnyPointer}
+			for _, b := range stack.SortBuckets(c.Bucketize(s.Goroutines)) {
+				if len(b.Stack.Calls) != 0 && b.Stack.Calls[0].Func.Raw == "main.worker" {
+					if len(b.Routines) != 10 {
+						return fmt.Errorf("expected 10 workers, got %d", len(b.Routines))
+					}
+					if b.CreatedBy.Func.Raw != "main.main" {
+						return fmt.Errorf("expected the workers to be created by main.main, got %q", b.CreatedBy.Func.Raw)
+					}
+					return nil
+				}
+			}
+			return errors.New("expected a bucket of workers")
+		},
+	},
+	{
+		name: "deadlock",
+		source: `package main
+
+func main() {
+	c := make(chan int)
+	<-c // frame
+}
+`,
+		check: func(s *stack.Snapshot) error {
+			if s.Fatal == nil || s.Fatal.Kind != stack.FatalDeadlock {
+				return errors.New("expected a deadlock fatal error")
+			}
+			return nil
+		},
+	},
+}
+
+// reFrameMarker matches a line that must be printed as a frame.
+var reFrameMarker = regexp.MustCompile(`// frame$`)
+
+// reSourceLine matches the source line of a frame in a dump.
+var reSourceLine = regexp.MustCompile(`^\t.+\.(?:go|s|c):\d+`)
+
+// expectedJunk are the prefixes of the lines around a dump that are not part
+// of it.
+var expectedJunk = []string{"panic: ", "fatal error: ", "[signal ", "exit status ", "goroutine running on other thread"}
+
+// runSelftest runs each case with the go toolchain and verifies the parsing of
+// its dump.
+func runSelftest(out io.Writer, goexe string) error {
+	dir, err := ioutil.TempDir("", "panicparse")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	v, err := exec.Command(goexe, "version").Output()
+	if err != nil {
+		return fmt.Errorf("failed to run %s: %s", goexe, err)
+	}
+	_, _ = fmt.Fprintf(out, "%s", v)
+	failed := 0
+	for _, tc := range selftestCases {
+		if err := runSelftestCase(dir, goexe, &tc); err != nil {
+			_, _ = fmt.Fprintf(out, "FAIL %s: %s\n", tc.name, err)
+			failed++
+		} else {
+			_, _ = fmt.Fprintf(out, "ok   %s\n", tc.name)
+		}
+	}
+	if failed != 0 {
+		return fmt.Errorf("%d of %d cases failed; the traceback format of this Go version may not be supported", failed, len(selftestCases))
+	}
+	return nil
+}
+
+// runSelftestCase runs a case and checks the round trip of its dump.
+func runSelftestCase(dir, goexe string, tc *selftestCase) error {
+	main := filepath.Join(dir, tc.name+".go")
+	if err := ioutil.WriteFile(main, []byte(tc.source), 0600); err != nil {
+		return err
+	}
+	cmd := exec.Command(goexe, "run", main)
+	cmd.Env = append(os.Environ(), "GOTRACEBACK=all")
+	raw, err := cmd.CombinedOutput()
+	if err == nil {
+		return errors.New("the program didn't crash")
+	}
+	junk := &bytes.Buffer{}
+	s, err := stack.ParseSnapshot(bytes.NewReader(raw), junk)
+	if err != nil {
+		return err
+	}
+	if len(s.Goroutines) == 0 {
+		return errors.New("no goroutine found")
+	}
+	for _, l := range strings.Split(junk.String(), "\n") {
+		if l = strings.TrimSpace(l); l != "" && !hasAnyPrefix(l, expectedJunk) {
+			return fmt.Errorf("line not recognized: %q", l)
+		}
+	}
+	// Every source line printed must have been parsed.
+	printed := 0
+	for _, l := range strings.Split(string(raw), "\n") {
+		if reSourceLine.MatchString(l) {
+			printed++
+		}
+	}
+	parsed := 0
+	for i := range s.Goroutines {
+		g := &s.Goroutines[i]
+		parsed += len(g.Stack.Calls)
+		if g.CreatedBy.SourcePath != "" {
+			parsed++
+		}
+	}
+	if printed != parsed {
+		return fmt.Errorf("%d source lines printed but %d parsed", printed, parsed)
+	}
+	for i, l := range strings.Split(tc.source, "\n") {
+		if !reFrameMarker.MatchString(l) {
+			continue
+		}
+		if !hasFrame(&s.Goroutines[0], main, i+1) {
+			return fmt.Errorf("frame at line %d not found in the first goroutine", i+1)
+		}
+	}
+	return tc.check(s)
+}
+
+// hasFrame returns true if the goroutine has a call at the source line.
+func hasFrame(g *stack.Goroutine, path string, line int) bool {
+	for _, c := range g.Stack.Calls {
+		if c.Line == line && filepath.Base(c.SourcePath) == filepath.Base(path) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// selftestMain implements "pp selftest".
+func selftestMain(args []string) error {
+	fs := flag.NewFlagSet("selftest", flag.ContinueOnError)
+	goexe := fs.String("go", "go", "Go toolchain to test")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: pp selftest [-go <go>]\n\nCrashes programs built with the local Go toolchain and verifies their dumps are fully parsed.\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("unexpected argument " + strconv.Quote(fs.Arg(0)))
+	}
+	return runSelftest(os.Stdout, *goexe)
+}
@@ -0,0 +1,31 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestSelftest(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is required")
+	}
+	out := &bytes.Buffer{}
+	err := runSelftest(out, "go")
+	ut.AssertEqual(t, nil, err)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	ut.AssertEqual(t, true, strings.HasPrefix(lines[0], "go version "))
+	ut.AssertEqual(t, []string{"ok   panic", "ok   nil", "ok   goroutines", "ok   deadlock"}, lines[1:])
+}
+
+func TestSelftestMissingGo(t *testing.T) {
+	err := runSelftest(&bytes.Buffer{}, "/nonexistent/go")
+	ut.AssertEqual(t, true, err != nil)
+}
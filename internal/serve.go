@@ -0,0 +1,192 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+// server serves a dump as an HTML page plus REST endpoints to explore its
+// buckets.
+type server struct {
+	raw        []byte
+	goroutines []stack.Goroutine
+	rules      stack.Rules
+}
+
+// newServer parses the dump.
+func newServer(raw []byte, parse bool, rules stack.Rules) (*server, error) {
+	snapshot, err := stack.ParseSnapshot(bytes.NewReader(raw), ioutil.Discard)
+	if err != nil {
+		return nil, err
+	}
+	stack.TrimGCAssist(snapshot.Goroutines)
+	if parse {
+		stack.Augment(snapshot.Goroutines)
+	}
+	return &server{raw: raw, goroutines: snapshot.Goroutines, rules: rules}, nil
+}
+
+// bucketJSON is a bucket as returned by /api/buckets.
+type bucketJSON struct {
+	Header string `json:"header"`
+	Count  int    `json:"count"`
+	State  string `json:"state"`
+	Stack  string `json:"stack"`
+	IDs    []int  `json:"ids"`
+}
+
+// ServeHTTP implements the endpoints:
+//   - /: the buckets as an HTML page
+//   - /api/buckets: the buckets as JSON
+//   - /api/buckets/<n>: the goroutine IDs of the bucket n
+//   - /api/goroutines/<id>: the raw text of the goroutine
+//
+// The buckets endpoints accept ?similarity=exact|pointer|value to bucketize
+// with another similarity than the default, pointer.
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	similar, err := parseSimilarity(r.URL.Query().Get("similarity"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c := &stack.Criteria{Similarity: similar, Rules: s.rules}
+	buckets := c.Buckets(s.goroutines)
+	switch p := r.URL.Path; {
+	case p == "/":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err = stack.HTML(w, buckets, false); err != nil {
+			log.Printf("serve: %s", err)
+		}
+	case p == "/api/buckets":
+		p := &stack.Palette{}
+		srcLen, pkgLen := stack.CalcLengths(buckets, false)
+		out := make([]bucketJSON, 0, len(buckets))
+		for i := range buckets {
+			b := &buckets[i]
+			out = append(out, bucketJSON{
+				Header: strings.TrimSuffix(p.BucketHeader(b, false, false), "\n"),
+				Count:  len(b.Routines),
+				State:  b.State,
+				Stack:  p.StackLines(&b.Signature, srcLen, pkgLen, false),
+				IDs:    bucketIDs(b),
+			})
+		}
+		writeJSON(w, out)
+	case strings.HasPrefix(p, "/api/buckets/"):
+		n, err := strconv.Atoi(p[len("/api/buckets/"):])
+		if err != nil || n < 0 || n >= len(buckets) {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, bucketIDs(&buckets[n]))
+	case strings.HasPrefix(p, "/api/goroutines/"):
+		id, err := strconv.Atoi(p[len("/api/goroutines/"):])
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		raw := rawGoroutine(s.raw, id)
+		if raw == "" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte(raw))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// parseSimilarity parses the similarity query parameter. It defaults to
+// stack.AnyPointer like the command line.
+func parseSimilarity(s string) (stack.Similarity, error) {
+	if s == "" {
+		return stack.AnyPointer, nil
+	}
+	return stack.ParseSimilarity(s)
+}
+
+// bucketIDs returns the goroutine IDs of the bucket.
+func bucketIDs(b *stack.Bucket) []int {
+	ids := make([]int, 0, len(b.Routines))
+	for _, g := range b.Routines {
+		ids = append(ids, g.ID)
+	}
+	return ids
+}
+
+// rawGoroutine returns the lines of the goroutine as printed in the dump, or
+// an empty string if it is not found.
+func rawGoroutine(raw []byte, id int) string {
+	header := fmt.Sprintf("goroutine %d ", id)
+	out := ""
+	found := false
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !found {
+			found = strings.HasPrefix(line, header)
+		} else if strings.TrimSpace(line) == "" {
+			break
+		}
+		if found {
+			out += line + "\n"
+		}
+	}
+	return out
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("serve: %s", err)
+	}
+}
+
+// serveMain implements "pp serve".
+func serveMain(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("http", "localhost:8080", "Address to listen on")
+	parse := fs.Bool("parse", true, "Parses source files to deduct types")
+	rulesFile := fs.String("rules", "", "JSON file of rules to tag and explain the buckets, like pp -rules")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: pp serve [-http <addr>] [dump]\n\nServes the dump as a web page with REST endpoints to explore the buckets.\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	raw, err := readInput(fs.Args())
+	if err != nil {
+		return err
+	}
+	rules, err := loadRules(*rulesFile)
+	if err != nil {
+		return err
+	}
+	s, err := newServer(raw, *parse, rules)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Serving on http://%s/\n", *addr)
+	return http.ListenAndServe(*addr, s)
+}
@@ -0,0 +1,58 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestServe(t *testing.T) {
+	dump := strings.Join([]string{
+		"goroutine 1 [chan receive]:",
+		"main.worker(0x1)",
+		"	/gopath/src/github.com/foo/bar/baz.go:20 +0x27",
+		"",
+		"goroutine 2 [chan receive]:",
+		"main.worker(0x2)",
+		"	/gopath/src/github.com/foo/bar/baz.go:20 +0x27",
+		"",
+	}, "\n")
+	s, err := newServer([]byte(dump), false, nil)
+	ut.AssertEqual(t, nil, err)
+	get := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		return w
+	}
+
+	w := get("/api/buckets")
+	ut.AssertEqual(t, http.StatusOK, w.Code)
+	var buckets []bucketJSON
+	ut.AssertEqual(t, nil, json.Unmarshal(w.Body.Bytes(), &buckets))
+	ut.AssertEqual(t, 2, len(buckets))
+
+	w = get("/api/buckets?similarity=value")
+	ut.AssertEqual(t, nil, json.Unmarshal(w.Body.Bytes(), &buckets))
+	ut.AssertEqual(t, 1, len(buckets))
+	ut.AssertEqual(t, "2: chan receive", buckets[0].Header)
+	ut.AssertEqual(t, []int{1, 2}, buckets[0].IDs)
+
+	w = get("/api/buckets/0?similarity=value")
+	ut.AssertEqual(t, "[1,2]\n", w.Body.String())
+
+	w = get("/api/goroutines/2")
+	ut.AssertEqual(t, "goroutine 2 [chan receive]:\nmain.worker(0x2)\n\t/gopath/src/github.com/foo/bar/baz.go:20 +0x27\n", w.Body.String())
+
+	ut.AssertEqual(t, http.StatusNotFound, get("/api/goroutines/3").Code)
+	ut.AssertEqual(t, http.StatusNotFound, get("/api/buckets/1?similarity=value").Code)
+	ut.AssertEqual(t, http.StatusBadRequest, get("/api/buckets?similarity=foo").Code)
+	ut.AssertEqual(t, true, strings.Contains(get("/").Body.String(), "<title>panicparse</title>"))
+}
@@ -0,0 +1,53 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package labels sets pprof labels on the goroutines serving a request so
+// they can be attributed to it in a goroutine dump.
+//
+// The runtime prints the labels in the goroutine header when the process runs
+// with GODEBUG=tracebacklabels=1. Use pp -by-label request to list the
+// goroutines per request. The labels are inherited by the goroutines started
+// while serving the request.
+package labels
+
+import (
+	"context"
+	"net/http"
+	"runtime/pprof"
+	"strconv"
+	"sync/atomic"
+)
+
+// Label keys set by this package.
+const (
+	RequestKey  = "request"
+	EndpointKey = "endpoint"
+)
+
+// RequestIDHeader is the HTTP header Handler reads the request ID from.
+const RequestIDHeader = "X-Request-Id"
+
+// Do calls f with the request and endpoint labels set on the current
+// goroutine, and on the goroutines it starts.
+func Do(ctx context.Context, request, endpoint string, f func(context.Context)) {
+	pprof.Do(ctx, pprof.Labels(RequestKey, request, EndpointKey, endpoint), f)
+}
+
+// Handler wraps h so each request is served with the request and endpoint
+// labels set.
+//
+// The request ID is the RequestIDHeader header if present, otherwise a
+// sequence number. The endpoint is the URL path.
+func Handler(h http.Handler) http.Handler {
+	var seq int64
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" {
+			id = strconv.FormatInt(atomic.AddInt64(&seq, 1), 10)
+		}
+		Do(r.Context(), id, r.URL.Path, func(ctx context.Context) {
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	})
+}
@@ -0,0 +1,40 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package labels
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"runtime/pprof"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+	var got []string
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request, _ := pprof.Label(r.Context(), RequestKey)
+		endpoint, _ := pprof.Label(r.Context(), EndpointKey)
+		got = append(got, request, endpoint)
+	}))
+	r := httptest.NewRequest("GET", "/foo", nil)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	r = httptest.NewRequest("GET", "/bar", nil)
+	r.Header.Set(RequestIDHeader, "abc123")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	ut.AssertEqual(t, []string{"1", "/foo", "abc123", "/bar"}, got)
+}
+
+func TestDo(t *testing.T) {
+	t.Parallel()
+	Do(context.Background(), "abc123", "/foo", func(ctx context.Context) {
+		v, ok := pprof.Label(ctx, RequestKey)
+		ut.AssertEqual(t, true, ok)
+		ut.AssertEqual(t, "abc123", v)
+	})
+}
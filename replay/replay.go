@@ -0,0 +1,172 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package replay replays a corpus of recorded stack dumps through the parser
+// to detect regressions.
+//
+// Users maintaining a private corpus of production dumps record the parsing
+// result once with Update, then Replay after upgrading panicparse or Go to
+// find the dumps that now fail to parse, parse differently or have lines that
+// are not recognized anymore.
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+// GoldenSuffix is appended to the dump file name to name its recording.
+const GoldenSuffix = ".golden.json"
+
+// Result is the outcome of replaying one dump.
+type Result struct {
+	// Path is the path of the dump.
+	Path string
+	// Err is set when the dump failed to parse or its recording couldn't be
+	// read.
+	Err error
+	// Missing is set when there is no recording for the dump.
+	Missing bool
+	// Changed is set when the goroutines differ from the recording.
+	Changed bool
+	// NewJunk are the lines that were not recognized and are not in the
+	// recording, in the order of the dump.
+	NewJunk []string
+}
+
+// OK returns true if the dump parsed exactly as recorded.
+func (r *Result) OK() bool {
+	return r.Err == nil && !r.Missing && !r.Changed && len(r.NewJunk) == 0
+}
+
+// Replay parses every dump in dir and compares it with its recording.
+//
+// Every file in dir that doesn't have the GoldenSuffix is a dump. The results
+// are sorted by path.
+func Replay(dir string) ([]Result, error) {
+	paths, err := dumps(dir)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Result, 0, len(paths))
+	for _, p := range paths {
+		out = append(out, replayOne(p))
+	}
+	return out, nil
+}
+
+// Update parses every dump in dir and writes its recording, overwriting the
+// existing one.
+func Update(dir string) error {
+	paths, err := dumps(dir)
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		r, err := parse(p)
+		if err != nil {
+			return err
+		}
+		b, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(p+GoldenSuffix, append(b, '\n'), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Private stuff.
+
+// recording is the content of a golden file.
+type recording struct {
+	Goroutines []stack.Goroutine
+	Junk       []string
+}
+
+// dumps returns the sorted paths of the dumps in dir.
+func dumps(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, e := range entries {
+		if e.Mode().IsRegular() && !strings.HasSuffix(e.Name(), GoldenSuffix) {
+			out = append(out, filepath.Join(dir, e.Name()))
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// parse parses a dump into a recording.
+func parse(path string) (*recording, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	junk := &bytes.Buffer{}
+	goroutines, err := stack.ParseDump(f, junk)
+	if err != nil {
+		return nil, err
+	}
+	r := &recording{Goroutines: goroutines}
+	for _, l := range strings.SplitAfter(junk.String(), "\n") {
+		if l != "" {
+			r.Junk = append(r.Junk, strings.TrimRight(l, "\r\n"))
+		}
+	}
+	return r, nil
+}
+
+// replayOne replays a single dump.
+func replayOne(path string) Result {
+	out := Result{Path: path}
+	actual, err := parse(path)
+	if err != nil {
+		out.Err = err
+		return out
+	}
+	b, err := ioutil.ReadFile(path + GoldenSuffix)
+	if os.IsNotExist(err) {
+		out.Missing = true
+		return out
+	}
+	if err != nil {
+		out.Err = err
+		return out
+	}
+	expected := &recording{}
+	if err := json.Unmarshal(b, expected); err != nil {
+		out.Err = err
+		return out
+	}
+	// Compare the JSON encodings since expected was decoded from one: the
+	// fields that are not encoded are lost and an empty slice omitted with
+	// omitempty is decoded as nil, so it can't be compared as is.
+	e, _ := json.Marshal(expected.Goroutines)
+	a, _ := json.Marshal(actual.Goroutines)
+	out.Changed = !bytes.Equal(e, a)
+	known := map[string]bool{}
+	for _, l := range expected.Junk {
+		known[l] = true
+	}
+	for _, l := range actual.Junk {
+		if !known[l] {
+			out.NewJunk = append(out.NewJunk, l)
+		}
+	}
+	return out
+}
@@ -0,0 +1,59 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package replay
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestReplay(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "panicparse")
+	ut.AssertEqual(t, nil, err)
+	defer os.RemoveAll(dir)
+	dump := strings.Join([]string{
+		"panic: oh no",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"	/gopath/src/github.com/foo/bar/baz.go:428 +0x27",
+		"",
+	}, "\n")
+	write := func(name, content string) {
+		ut.AssertEqual(t, nil, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+	}
+	write("a.txt", dump)
+	write("b.txt", dump)
+
+	results, err := Replay(dir)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, []Result{{Path: filepath.Join(dir, "a.txt"), Missing: true}, {Path: filepath.Join(dir, "b.txt"), Missing: true}}, results)
+
+	ut.AssertEqual(t, nil, Update(dir))
+	results, err = Replay(dir)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 2, len(results))
+	ut.AssertEqual(t, true, results[0].OK())
+	ut.AssertEqual(t, true, results[1].OK())
+
+	// Simulates a parser behavior change by altering the dumps.
+	write("a.txt", strings.Replace(dump, "baz.go:428", "baz.go:429", 1))
+	write("b.txt", "junk\n"+dump)
+	results, err = Replay(dir)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, []Result{{Path: filepath.Join(dir, "a.txt"), Changed: true}, {Path: filepath.Join(dir, "b.txt"), NewJunk: []string{"junk"}}}, results)
+}
+
+func TestReplayNoDir(t *testing.T) {
+	t.Parallel()
+	_, err := Replay("does not exist")
+	ut.AssertEqual(t, false, err == nil)
+}
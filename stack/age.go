@@ -0,0 +1,55 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import "sort"
+
+// Age is how long the goroutines of a bucket have been blocked, in minutes.
+//
+// The runtime only prints the wait duration of goroutines blocked for at least
+// one minute, so 0 means less than a minute or not blocked.
+type Age struct {
+	// Oldest is the duration of the goroutine blocked the longest. It tells
+	// how long the blocked population has existed.
+	Oldest int
+	// Median is the median duration. A median close to Oldest means most
+	// goroutines got stuck at the same time, a low one that they keep piling
+	// up.
+	Median int
+	// Newest is the duration of the goroutine blocked the shortest.
+	Newest int
+}
+
+// Age returns how long the goroutines of the bucket have been blocked.
+func (b *Bucket) Age() Age {
+	if len(b.Routines) == 0 {
+		return Age{}
+	}
+	minutes := make([]int, len(b.Routines))
+	for i := range b.Routines {
+		minutes[i] = b.Routines[i].SleepMax
+	}
+	sort.Ints(minutes)
+	return Age{Oldest: minutes[len(minutes)-1], Median: minutes[len(minutes)/2], Newest: minutes[0]}
+}
+
+// SortByAge sorts the buckets with the one whose oldest goroutine has been
+// blocked the longest first. Buckets with the same age are kept in their
+// order.
+func SortByAge(buckets Buckets) {
+	SortBucketsBy(buckets, ByWait)
+}
+
+// FilterByAge returns the buckets whose oldest goroutine has been blocked for
+// at least minutes, to focus on long-standing leaks instead of fresh load.
+func FilterByAge(buckets Buckets, minutes int) Buckets {
+	out := Buckets{}
+	for i := range buckets {
+		if buckets[i].SleepMax >= minutes {
+			out = append(out, buckets[i])
+		}
+	}
+	return out
+}
@@ -0,0 +1,58 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestBucketAge(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"goroutine 1 [chan receive, 142 minutes]:",
+		"main.serve()",
+		"	/gopath/src/github.com/foo/bar/baz.go:20 +0x27",
+		"",
+		"goroutine 2 [chan receive, 3 minutes]:",
+		"main.serve()",
+		"	/gopath/src/github.com/foo/bar/baz.go:20 +0x27",
+		"",
+		"goroutine 3 [chan receive]:",
+		"main.serve()",
+		"	/gopath/src/github.com/foo/bar/baz.go:20 +0x27",
+		"",
+		"goroutine 4 [select, 5 minutes]:",
+		"main.poll()",
+		"	/gopath/src/github.com/foo/bar/baz.go:30 +0x27",
+		"",
+		"goroutine 5 [IO wait]:",
+		"main.accept()",
+		"	/gopath/src/github.com/foo/bar/baz.go:40 +0x27",
+		"",
+	}
+	goroutines, err := ParseDump(bytes.NewBufferString(strings.Join(data, "\n")), &bytes.Buffer{})
+	ut.AssertEqual(t, nil, err)
+	buckets := SortBuckets((&Criteria{Similarity: AnyPointer}).Bucketize(goroutines))
+	ut.AssertEqual(t, 3, len(buckets))
+	SortByAge(buckets)
+	ut.AssertEqual(t, "main.serve", buckets[0].Stack.Calls[0].Func.Raw)
+	ut.AssertEqual(t, Age{Oldest: 142, Median: 3, Newest: 0}, buckets[0].Age())
+	ut.AssertEqual(t, "main.poll", buckets[1].Stack.Calls[0].Func.Raw)
+	ut.AssertEqual(t, Age{Oldest: 5, Median: 5, Newest: 5}, buckets[1].Age())
+	ut.AssertEqual(t, Age{}, buckets[2].Age())
+	p := &Palette{}
+	ut.AssertEqual(t, "  blocked: oldest 142 minutes, median 3, newest 0\n", p.AgeLine(&buckets[0]))
+	ut.AssertEqual(t, "  blocked: 5 minutes\n", p.AgeLine(&buckets[1]))
+	ut.AssertEqual(t, "", p.AgeLine(&buckets[2]))
+
+	old := FilterByAge(buckets, 5)
+	ut.AssertEqual(t, 2, len(old))
+	ut.AssertEqual(t, 1, len(FilterByAge(buckets, 6)))
+	ut.AssertEqual(t, 0, len(FilterByAge(buckets, 143)))
+}
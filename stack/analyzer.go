@@ -0,0 +1,186 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Severity is how much a finding matters.
+type Severity int
+
+// Severities, from the least to the most severe.
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// Finding is an issue found in a dump by an Analyzer.
+type Finding struct {
+	// Name is the name of the analyzer that reported it. Analyze sets it.
+	Name     string
+	Severity Severity
+	// Buckets are the indexes of the affected buckets in the buckets passed to
+	// the analyzer.
+	Buckets []int
+	// Explanation is a one line human readable description of the issue.
+	Explanation string
+}
+
+// Analyzer is a detector of a class of issues in a dump.
+//
+// Register custom ones with RegisterAnalyzer so they run along the built-in
+// ones.
+type Analyzer interface {
+	// Name is a short unique identifier, e.g. "deadlock".
+	Name() string
+	// Analyze returns the findings in the dump. The buckets are the ones of
+	// the snapshot goroutines, sorted. It must not modify them.
+	Analyze(s *Snapshot, buckets Buckets) []Finding
+}
+
+// RegisterAnalyzer adds an analyzer run by Analyze.
+//
+// It panics if an analyzer with the same name is already registered.
+func RegisterAnalyzer(a Analyzer) {
+	analyzersMu.Lock()
+	defer analyzersMu.Unlock()
+	name := a.Name()
+	if _, ok := analyzers[name]; ok {
+		panic(fmt.Sprintf("stack: analyzer %q registered twice", name))
+	}
+	analyzers[name] = a
+}
+
+// Analyzers returns the registered analyzers, sorted by name.
+func Analyzers() []Analyzer {
+	analyzersMu.Lock()
+	defer analyzersMu.Unlock()
+	names := make([]string, 0, len(analyzers))
+	for name := range analyzers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := make([]Analyzer, len(names))
+	for i, name := range names {
+		out[i] = analyzers[name]
+	}
+	return out
+}
+
+// Analyze runs the registered analyzers on the dump and returns their
+// findings, the most severe first.
+func Analyze(s *Snapshot, buckets Buckets) []Finding {
+	var out []Finding
+	for _, a := range Analyzers() {
+		for _, f := range a.Analyze(s, buckets) {
+			f.Name = a.Name()
+			out = append(out, f)
+		}
+	}
+	sort.Stable(findingsBySeverity(out))
+	return out
+}
+
+// Private stuff.
+
+var (
+	analyzersMu sync.Mutex
+	analyzers   = map[string]Analyzer{
+		"channel":     channelAnalyzer{},
+		"deadlock":    deadlockAnalyzer{},
+		"mutex":       mutexAnalyzer{},
+		"nil-channel": nilChannelAnalyzer{},
+	}
+)
+
+// deadlockAnalyzer reports the channel cycles.
+type deadlockAnalyzer struct{}
+
+func (deadlockAnalyzer) Name() string {
+	return "deadlock"
+}
+
+func (deadlockAnalyzer) Analyze(s *Snapshot, buckets Buckets) []Finding {
+	var out []Finding
+	for _, c := range ChannelCycles(s.Goroutines) {
+		out = append(out, Finding{
+			Severity:    SeverityError,
+			Buckets:     bucketIndexes(buckets, c.Goroutines),
+			Explanation: fmt.Sprintf("%d goroutines are blocked on channels in a cycle", len(c.Goroutines)),
+		})
+	}
+	return out
+}
+
+// nilChannelAnalyzer reports the goroutines blocked on a nil channel, which
+// never unblock.
+type nilChannelAnalyzer struct{}
+
+func (nilChannelAnalyzer) Name() string {
+	return "nil-channel"
+}
+
+func (nilChannelAnalyzer) Analyze(s *Snapshot, buckets Buckets) []Finding {
+	f := Finding{Severity: SeverityWarning}
+	count := 0
+	for i := range buckets {
+		if b, ok := buckets[i].BlockedOn(); ok && b.Kind == BlockNilChannel {
+			f.Buckets = append(f.Buckets, i)
+			count += len(buckets[i].Routines)
+		}
+	}
+	if count == 0 {
+		return nil
+	}
+	f.Explanation = fmt.Sprintf("%d goroutines are blocked forever on a nil channel", count)
+	return []Finding{f}
+}
+
+// bucketIndexes returns the indexes of the buckets containing the goroutines,
+// in order of first occurrence.
+func bucketIndexes(buckets Buckets, ids []int) []int {
+	var out []int
+	seen := map[int]bool{}
+	for _, id := range ids {
+		for i := range buckets {
+			if !seen[i] && buckets[i].hasID(id) {
+				seen[i] = true
+				out = append(out, i)
+			}
+		}
+	}
+	return out
+}
+
+type findingsBySeverity []Finding
+
+func (f findingsBySeverity) Len() int {
+	return len(f)
+}
+
+func (f findingsBySeverity) Less(i, j int) bool {
+	return f[i].Severity > f[j].Severity
+}
+
+func (f findingsBySeverity) Swap(i, j int) {
+	f[i], f[j] = f[j], f[i]
+}
@@ -0,0 +1,102 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestAnalyze(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"goroutine 1 [select]:",
+		"main.main()",
+		"	/home/user/src/main.go:22 +0x40",
+		"",
+		"goroutine 5 [chan receive]:",
+		"runtime.chanrecv1(0xc208010060, 0x0)",
+		"	/goroot/src/runtime/chan.go:144 +0x2f",
+		"main.a(0xc208010090)",
+		"	/home/user/src/main.go:10 +0x27",
+		"",
+		"goroutine 6 [chan send]:",
+		"runtime.chansend1(0xc208010090, 0xc20802a008)",
+		"	/goroot/src/runtime/chan.go:144 +0x2f",
+		"main.b(0xc208010060)",
+		"	/home/user/src/main.go:20 +0x27",
+		"",
+		"goroutine 7 [chan receive (nil chan)]:",
+		"main.c()",
+		"	/home/user/src/main.go:30 +0x27",
+		"",
+	}
+	s, err := ParseSnapshot(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	buckets := SortBuckets(Bucketize(s.Goroutines, AnyPointer))
+	ut.AssertEqual(t, 4, len(buckets))
+	findings := Analyze(s, buckets)
+	ut.AssertEqual(t, 2, len(findings))
+	ut.AssertEqual(t, "deadlock", findings[0].Name)
+	ut.AssertEqual(t, SeverityError, findings[0].Severity)
+	ut.AssertEqual(t, "2 goroutines are blocked on channels in a cycle", findings[0].Explanation)
+	ut.AssertEqual(t, 2, len(findings[0].Buckets))
+	ut.AssertEqual(t, 5, buckets[findings[0].Buckets[0]].Routines[0].ID)
+	ut.AssertEqual(t, 6, buckets[findings[0].Buckets[1]].Routines[0].ID)
+	ut.AssertEqual(t, "nil-channel", findings[1].Name)
+	ut.AssertEqual(t, SeverityWarning, findings[1].Severity)
+	ut.AssertEqual(t, 7, buckets[findings[1].Buckets[0]].Routines[0].ID)
+
+	expected := []string{
+		"error: deadlock: 2 goroutines are blocked on channels in a cycle",
+		"  - 1: chan receive",
+		"  - 1: chan send",
+		"warning: nil-channel: 1 goroutines are blocked forever on a nil channel",
+		"  - 1: chan receive (nil chan)",
+		"",
+	}
+	ut.AssertEqual(t, strings.Join(expected, "\n"), (&Palette{}).FindingLines(findings, buckets, false))
+}
+
+type testAnalyzer struct{}
+
+func (testAnalyzer) Name() string {
+	return "test-main"
+}
+
+func (testAnalyzer) Analyze(s *Snapshot, buckets Buckets) []Finding {
+	for i := range buckets {
+		if buckets[i].Stack.Calls[0].Func.Raw == "main.main" {
+			return []Finding{{Severity: SeverityInfo, Buckets: []int{i}, Explanation: "main is alive"}}
+		}
+	}
+	return nil
+}
+
+func TestRegisterAnalyzer(t *testing.T) {
+	// Not parallel as it modifies the registry.
+	RegisterAnalyzer(testAnalyzer{})
+	defer func() {
+		analyzersMu.Lock()
+		delete(analyzers, "test-main")
+		analyzersMu.Unlock()
+	}()
+	names := []string{}
+	for _, a := range Analyzers() {
+		names = append(names, a.Name())
+	}
+	ut.AssertEqual(t, []string{"channel", "deadlock", "mutex", "nil-channel", "test-main"}, names)
+	s := &Snapshot{Goroutines: []Goroutine{{Signature: Signature{State: "select", Stack: Stack{Calls: []Call{{Func: Function{"main.main"}}}}}}}}
+	expected := []Finding{{Name: "test-main", Severity: SeverityInfo, Buckets: []int{0}, Explanation: "main is alive"}}
+	ut.AssertEqual(t, expected, Analyze(s, SortBuckets(Bucketize(s.Goroutines, AnyPointer))))
+	defer func() {
+		ut.AssertEqual(t, "stack: analyzer \"test-main\" registered twice", recover())
+	}()
+	RegisterAnalyzer(testAnalyzer{})
+}
@@ -0,0 +1,56 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+// ArgStat is how one argument of a call varies across the goroutines of a
+// bucket.
+type ArgStat struct {
+	// Call is the index of the call in Stack.Calls.
+	Call int
+	// Arg is the index of the argument in Args.Values.
+	Arg int
+	// Distinct is the number of distinct values. It is 1 when the argument is
+	// identical across all the goroutines.
+	Distinct int
+	// Value is the value of the first goroutine, which is the value of all of
+	// them when Distinct is 1.
+	Value uint64
+}
+
+// Constant returns true if the argument is identical across all the
+// goroutines.
+func (a *ArgStat) Constant() bool {
+	return a.Distinct == 1
+}
+
+// ArgStats returns how each argument of each call varies across the
+// goroutines of the bucket, in call then argument order.
+//
+// A pointer identical across many goroutines is a strong hint that they all
+// share one object, e.g. a mutex or a channel.
+func (b *Bucket) ArgStats() []ArgStat {
+	var out []ArgStat
+	for i := range b.Stack.Calls {
+		for j := range b.Stack.Calls[i].Args.Values {
+			values := map[uint64]bool{}
+			s := ArgStat{Call: i, Arg: j}
+			for k := range b.Routines {
+				calls := b.Routines[k].Stack.Calls
+				if i >= len(calls) || j >= len(calls[i].Args.Values) {
+					continue
+				}
+				v := calls[i].Args.Values[j].Value
+				if len(values) == 0 {
+					s.Value = v
+				}
+				values[v] = true
+			}
+			if s.Distinct = len(values); s.Distinct != 0 {
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,43 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestArgStats(t *testing.T) {
+	t.Parallel()
+	call := func(args ...uint64) Signature {
+		c := Call{Func: Function{"main.worker"}}
+		for _, a := range args {
+			c.Args.Values = append(c.Args.Values, Arg{Value: a})
+		}
+		return Signature{Stack: Stack{Calls: []Call{c}}}
+	}
+	b := Bucket{
+		Signature: call(0xc00012c000, 0),
+		Routines: []Goroutine{
+			{Signature: call(0xc00012c000, 1)},
+			{Signature: call(0xc00012c000, 2)},
+			{Signature: call(0xc00012c000, 2)},
+		},
+	}
+	expected := []ArgStat{
+		{Call: 0, Arg: 0, Distinct: 1, Value: 0xc00012c000},
+		{Call: 0, Arg: 1, Distinct: 2, Value: 1},
+	}
+	stats := b.ArgStats()
+	ut.AssertEqual(t, expected, stats)
+	ut.AssertEqual(t, true, stats[0].Constant())
+	ut.AssertEqual(t, false, stats[1].Constant())
+
+	p := &Palette{}
+	ut.AssertEqual(t, "  main.worker arg #1 identical across all 3 goroutines of the bucket (0xc00012c000)\n", p.ArgLines(&b))
+	b.Routines = b.Routines[:1]
+	ut.AssertEqual(t, "", p.ArgLines(&b))
+}
@@ -0,0 +1,427 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// This file contains the code to process the executable that generated the
+// stack dump, to be able to recover information the runtime didn't print.
+
+package stack
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"debug/gosym"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Symbols is the Go symbol table of an executable.
+type Symbols struct {
+	table *gosym.Table
+	exe   *executable
+}
+
+// OpenSymbols loads the Go symbol table of an ELF, Mach-O or PE executable.
+//
+// The executable must be the exact one that generated the stack dump,
+// otherwise the recovered information will be garbage.
+func OpenSymbols(binary string) (*Symbols, error) {
+	exe, err := loadExecutable(binary)
+	if err != nil {
+		return nil, err
+	}
+	table, err := gosym.NewTable(nil, gosym.NewLineTable(exe.pclntab, exe.text))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse symbols of %s: %s", binary, err)
+	}
+	return &Symbols{table, exe}, nil
+}
+
+// RecoverElided reconstructs the bottom frames of the goroutines whose stack
+// was elided by the runtime.
+//
+// Before Go 1.21 the runtime only prints the first 100 frames. Stacks with
+// frames elided from the middle by newer versions still have their bottom
+// frames and are left alone. The function started by the go statement is
+// found by decoding the function value passed to runtime.newproc right before
+// the CreatedBy return address, which is only supported on amd64. Otherwise
+// it is looked up in the symbol table when it is a closure defined on the
+// CreatedBy line. runtime.goexit is always the bottom frame. The recovered
+// calls have Reconstructed set and their line is the entry of the function.
+//
+// It modifies goroutines in place. Stacks that already have reconstructed
+// calls are left alone so it is safe to call it more than once.
+func (s *Symbols) RecoverElided(goroutines []Goroutine) {
+	goexit := s.table.LookupFunc("runtime.goexit")
+	for i := range goroutines {
+		g := &goroutines[i]
+		if !g.Stack.Elided || g.CreatedBy.Func.Raw == "" || g.Stack.isReconstructed() {
+			continue
+		}
+		if f := s.goroutineEntry(&g.CreatedBy); f != nil {
+			g.Stack.Calls = append(g.Stack.Calls, s.reconstructed(f))
+		}
+		if goexit != nil {
+			g.Stack.Calls = append(g.Stack.Calls, s.reconstructed(goexit))
+		}
+	}
+}
+
+// ExpandInlined expands the calls that contain inlined functions into one
+// call per function so the stack matches the source level call chain.
+//
+// Since Go 1.12 the runtime prints inlined functions itself. Older runtimes
+// only print the physical frames, with the position in the innermost inlined
+// function. The inlined functions are looked up in the DWARF information of
+// the executable at the address printed as the call offset; it is a no-op if
+// the executable was stripped with -ldflags=-w. The added calls have Inlined
+// set and the physical call is moved to the line calling the first inlined
+// function.
+//
+// It modifies goroutines in place. Calls already expanded by the runtime or a
+// previous call are left alone.
+func (s *Symbols) ExpandInlined(goroutines []Goroutine) {
+	if s.exe.dwarf == nil {
+		return
+	}
+	for i := range goroutines {
+		calls := goroutines[i].Stack.Calls
+		for j := 0; j < len(calls); j++ {
+			chain := s.inlinedChain(&calls[j], j == 0)
+			if len(chain) == 0 || (j != 0 && calls[j-1].Func.Raw == chain[0].name) {
+				continue
+			}
+			// The innermost function is at the position printed, each caller is
+			// at the call site of its callee.
+			expanded := make([]Call, 0, len(chain)+1)
+			file, line := calls[j].SourcePath, calls[j].Line
+			for k := len(chain) - 1; k >= 0; k-- {
+				expanded = append(expanded, Call{SourcePath: file, Line: line, Func: Function{chain[k].name}, Inlined: true})
+				file, line = chain[k].file, chain[k].line
+			}
+			physical := calls[j]
+			physical.SourcePath, physical.Line = file, line
+			expanded = append(expanded, physical)
+			calls = append(calls[:j], append(expanded, calls[j+1:]...)...)
+			j += len(chain)
+		}
+		goroutines[i].Stack.Calls = calls
+	}
+}
+
+// Private stuff.
+
+// executable is the content of an executable needed to recover frames.
+type executable struct {
+	pclntab  []byte
+	text     uint64 // text is the address of the text section.
+	sections []section
+	amd64    bool
+	dwarf    *dwarf.Data // dwarf is nil when the executable has no debug information.
+}
+
+// section is a chunk of the executable as loaded in memory.
+type section struct {
+	addr uint64
+	data []byte
+}
+
+// read returns n bytes at the virtual address addr or nil if they are not
+// in the executable.
+func (e *executable) read(addr uint64, n int) []byte {
+	for _, s := range e.sections {
+		if addr >= s.addr && addr+uint64(n) <= s.addr+uint64(len(s.data)) {
+			return s.data[addr-s.addr : addr-s.addr+uint64(n)]
+		}
+	}
+	return nil
+}
+
+// isReconstructed returns true if RecoverElided already processed the stack.
+func (s *Stack) isReconstructed() bool {
+	for i := range s.Calls {
+		if s.Calls[i].Reconstructed {
+			return true
+		}
+	}
+	return false
+}
+
+// goroutineEntry returns the function started by the go statement at created.
+func (s *Symbols) goroutineEntry(created *Call) *gosym.Func {
+	if f := s.goTarget(created); f != nil {
+		return f
+	}
+	return s.closureEntry(created)
+}
+
+// goTarget decodes the function value loaded right before the call to
+// runtime.newproc, which is the instruction before the return address
+// printed for the CreatedBy call:
+//
+//	LEAQ funcval(IP), AX
+//	CALL runtime.newproc(SB)
+//
+// The function value is only in the executable when the go statement doesn't
+// capture anything, otherwise it is allocated at runtime and nil is returned.
+func (s *Symbols) goTarget(created *Call) *gosym.Func {
+	if !s.exe.amd64 || created.Offset == 0 {
+		return nil
+	}
+	caller := s.table.LookupFunc(created.Func.Raw)
+	if caller == nil {
+		return nil
+	}
+	code := s.exe.read(caller.Entry, int(created.Offset))
+	// The smallest sequence is LEAQ (7 bytes) then CALL (5 bytes).
+	if len(code) < 12 || code[len(code)-5] != 0xe8 {
+		return nil
+	}
+	// Search backward for the closest RIP relative LEAQ to any register.
+	for i := len(code) - 12; i >= 0; i-- {
+		if code[i]&0xfb != 0x48 || code[i+1] != 0x8d || code[i+2]&0xc7 != 0x05 {
+			continue
+		}
+		disp := int32(binary.LittleEndian.Uint32(code[i+3:]))
+		fv := s.exe.read(uint64(int64(caller.Entry)+int64(i)+7+int64(disp)), 8)
+		if fv == nil {
+			return nil
+		}
+		pc := binary.LittleEndian.Uint64(fv)
+		if f := s.table.PCToFunc(pc); f != nil && f.Entry == pc {
+			return f
+		}
+		return nil
+	}
+	return nil
+}
+
+// closureEntry returns the closure defined on the line of the go statement at
+// created.
+func (s *Symbols) closureEntry(created *Call) *gosym.Func {
+	prefix := created.Func.Raw + "."
+	for i := range s.table.Funcs {
+		f := &s.table.Funcs[i]
+		if !strings.HasPrefix(f.Name, prefix) {
+			continue
+		}
+		if file, line, _ := s.table.PCToLine(f.Entry); line == created.Line && file == created.SourcePath {
+			return f
+		}
+	}
+	return nil
+}
+
+// inlinedCall is a function inlined at an address.
+type inlinedCall struct {
+	name string
+	// file and line are the call site in the caller.
+	file string
+	line int
+}
+
+// inlinedChain returns the functions inlined at the address of c, outermost
+// first.
+//
+// The address printed for the frames but the leaf one is the return address,
+// which may be after the inlined code so the call instruction is used instead.
+func (s *Symbols) inlinedChain(c *Call, leaf bool) []inlinedCall {
+	if c.Offset == 0 || c.Reconstructed || c.Inlined {
+		return nil
+	}
+	f := s.table.LookupFunc(c.Func.Raw)
+	if f == nil {
+		return nil
+	}
+	pc := f.Entry + c.Offset
+	if !leaf {
+		pc--
+	}
+	r := s.exe.dwarf.Reader()
+	cu, err := r.SeekPC(pc)
+	if err != nil {
+		return nil
+	}
+	lr, err := s.exe.dwarf.LineReader(cu)
+	if err != nil || lr == nil {
+		return nil
+	}
+	chain, _ := s.inlinedAt(r, lr.Files(), pc, nil)
+	return chain
+}
+
+// inlinedAt walks the sibling entries read by r to find the one containing pc
+// and recurses into its children, appending the inlined functions to out.
+func (s *Symbols) inlinedAt(r *dwarf.Reader, files []*dwarf.LineFile, pc uint64, out []inlinedCall) ([]inlinedCall, error) {
+	for {
+		e, err := r.Next()
+		if err != nil || e == nil || e.Tag == 0 {
+			return out, err
+		}
+		if e.Tag != dwarf.TagSubprogram && e.Tag != dwarf.TagInlinedSubroutine && e.Tag != dwarf.TagLexDwarfBlock {
+			r.SkipChildren()
+			continue
+		}
+		ranges, err := s.exe.dwarf.Ranges(e)
+		if err != nil {
+			return out, err
+		}
+		found := false
+		for _, rg := range ranges {
+			if pc >= rg[0] && pc < rg[1] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			r.SkipChildren()
+			continue
+		}
+		if e.Tag == dwarf.TagInlinedSubroutine {
+			c := inlinedCall{name: s.abstractName(e)}
+			if i, ok := e.Val(dwarf.AttrCallFile).(int64); ok && i >= 0 && int(i) < len(files) && files[i] != nil {
+				c.file = files[i].Name
+			}
+			if l, ok := e.Val(dwarf.AttrCallLine).(int64); ok {
+				c.line = int(l)
+			}
+			if c.name == "" {
+				return out, errors.New("inlined function without a name")
+			}
+			out = append(out, c)
+		}
+		if !e.Children {
+			return out, nil
+		}
+		// Only one sibling contains pc.
+		return s.inlinedAt(r, files, pc, out)
+	}
+}
+
+// abstractName returns the name of the function an inlined subroutine entry
+// refers to.
+func (s *Symbols) abstractName(e *dwarf.Entry) string {
+	off, ok := e.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset)
+	if !ok {
+		return ""
+	}
+	r := s.exe.dwarf.Reader()
+	r.Seek(off)
+	a, err := r.Next()
+	if err != nil || a == nil {
+		return ""
+	}
+	name, _ := a.Val(dwarf.AttrName).(string)
+	return name
+}
+
+// reconstructed returns a Call for the entry point of f.
+func (s *Symbols) reconstructed(f *gosym.Func) Call {
+	file, line, _ := s.table.PCToLine(f.Entry)
+	return Call{SourcePath: file, Line: line, Func: Function{f.Name}, Reconstructed: true}
+}
+
+// loadExecutable loads the pclntab and the sections mapped in memory.
+func loadExecutable(binary string) (*executable, error) {
+	if f, err := elf.Open(binary); err == nil {
+		defer f.Close()
+		pclntab := f.Section(".gopclntab")
+		text := f.Section(".text")
+		if pclntab == nil || text == nil {
+			return nil, fmt.Errorf("%s has no Go symbol table", binary)
+		}
+		e := &executable{text: text.Addr, amd64: f.Machine == elf.EM_X86_64}
+		if e.pclntab, err = pclntab.Data(); err != nil {
+			return nil, err
+		}
+		for _, s := range f.Sections {
+			if s.Flags&elf.SHF_ALLOC == 0 || s.Type == elf.SHT_NOBITS {
+				continue
+			}
+			if data, err := s.Data(); err == nil {
+				e.sections = append(e.sections, section{s.Addr, data})
+			}
+		}
+		e.dwarf, _ = f.DWARF()
+		return e, nil
+	}
+	if f, err := macho.Open(binary); err == nil {
+		defer f.Close()
+		pclntab := f.Section("__gopclntab")
+		text := f.Section("__text")
+		if pclntab == nil || text == nil {
+			return nil, fmt.Errorf("%s has no Go symbol table", binary)
+		}
+		e := &executable{text: text.Addr, amd64: f.Cpu == macho.CpuAmd64}
+		if e.pclntab, err = pclntab.Data(); err != nil {
+			return nil, err
+		}
+		for _, s := range f.Sections {
+			// Skip debug information and zero filled sections.
+			if s.Seg == "__DWARF" || s.Flags&0xff == 1 {
+				continue
+			}
+			if data, err := s.Data(); err == nil {
+				e.sections = append(e.sections, section{s.Addr, data})
+			}
+		}
+		e.dwarf, _ = f.DWARF()
+		return e, nil
+	}
+	if f, err := pe.Open(binary); err == nil {
+		defer f.Close()
+		return loadPE(f)
+	}
+	return nil, fmt.Errorf("%s is not a supported executable", binary)
+}
+
+// loadPE finds the pclntab via the runtime.pclntab and runtime.epclntab
+// symbols since PE has no dedicated section for it.
+func loadPE(f *pe.File) (*executable, error) {
+	var imageBase uint64
+	switch h := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		imageBase = uint64(h.ImageBase)
+	case *pe.OptionalHeader64:
+		imageBase = h.ImageBase
+	}
+	var start, end *pe.Symbol
+	for _, s := range f.Symbols {
+		switch s.Name {
+		case "runtime.pclntab":
+			start = s
+		case "runtime.epclntab":
+			end = s
+		}
+	}
+	text := f.Section(".text")
+	if start == nil || end == nil || text == nil || start.SectionNumber != end.SectionNumber || start.SectionNumber < 1 {
+		return nil, errors.New("no Go symbol table")
+	}
+	data, err := f.Sections[start.SectionNumber-1].Data()
+	if err != nil {
+		return nil, err
+	}
+	if int(end.Value) > len(data) || start.Value > end.Value {
+		return nil, errors.New("corrupted Go symbol table")
+	}
+	e := &executable{
+		pclntab: data[start.Value:end.Value],
+		text:    imageBase + uint64(text.VirtualAddress),
+		amd64:   f.Machine == pe.IMAGE_FILE_MACHINE_AMD64,
+	}
+	for _, s := range f.Sections {
+		if s.Characteristics&(pe.IMAGE_SCN_CNT_CODE|pe.IMAGE_SCN_CNT_INITIALIZED_DATA) == 0 {
+			continue
+		}
+		if data, err := s.Data(); err == nil {
+			e.sections = append(e.sections, section{imageBase + uint64(s.VirtualAddress), data})
+		}
+	}
+	e.dwarf, _ = f.DWARF()
+	return e, nil
+}
@@ -0,0 +1,221 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestRecoverElided(t *testing.T) {
+	name, err := ioutil.TempDir("", "panicparse")
+	ut.AssertEqual(t, nil, err)
+	defer os.RemoveAll(name)
+	main, binary := build(t, name, elidedSource)
+	symbols, err := OpenSymbols(binary)
+	ut.AssertEqual(t, nil, err)
+
+	recurse := Call{SourcePath: main, Line: 7, Func: Function{"main.recurse"}}
+	goroutines := []Goroutine{
+		{
+			Signature: Signature{
+				State:     "running",
+				CreatedBy: Call{SourcePath: main, Line: 12, Func: Function{"main.main"}},
+				Stack:     Stack{Calls: []Call{recurse}, Elided: true},
+			},
+			ID: 1,
+		},
+		{
+			// Not elided, left alone.
+			Signature: Signature{
+				State:     "running",
+				CreatedBy: Call{SourcePath: main, Line: 12, Func: Function{"main.main"}},
+				Stack:     Stack{Calls: []Call{recurse}},
+			},
+			ID: 2,
+		},
+		{
+			// Elided in the middle, the bottom frames are there.
+			Signature: Signature{
+				State:     "running",
+				CreatedBy: Call{SourcePath: main, Line: 12, Func: Function{"main.main"}},
+				Stack:     Stack{Calls: []Call{recurse, recurse}, MiddleElided: 100, MiddleIndex: 1},
+			},
+			ID: 3,
+		},
+	}
+	symbols.RecoverElided(goroutines)
+	calls := goroutines[0].Stack.Calls
+	ut.AssertEqual(t, 3, len(calls))
+	ut.AssertEqual(t, recurse, calls[0])
+	ut.AssertEqual(t, Call{SourcePath: main, Line: 12, Func: Function{"main.main.func1"}, Reconstructed: true}, calls[1])
+	ut.AssertEqual(t, "runtime.goexit", calls[2].Func.Raw)
+	ut.AssertEqual(t, true, calls[2].Reconstructed)
+	ut.AssertEqual(t, []Call{recurse}, goroutines[1].Stack.Calls)
+	ut.AssertEqual(t, []Call{recurse, recurse}, goroutines[2].Stack.Calls)
+
+	// Calling it again is a no-op.
+	symbols.RecoverElided(goroutines)
+	ut.AssertEqual(t, calls, goroutines[0].Stack.Calls)
+}
+
+func TestRecoverElidedFunc(t *testing.T) {
+	if runtime.GOARCH != "amd64" {
+		t.Skip("only supported on amd64")
+	}
+	name, err := ioutil.TempDir("", "panicparse")
+	ut.AssertEqual(t, nil, err)
+	defer os.RemoveAll(name)
+	main, binary := build(t, name, elidedFuncSource)
+	symbols, err := OpenSymbols(binary)
+	ut.AssertEqual(t, nil, err)
+
+	// The offset of the go statement depends on the compiler, get it from an
+	// actual crash.
+	out, _ := exec.Command(binary).CombinedOutput()
+	match := regexp.MustCompile("created by main\\.main.*\n\\s+.+:15 \\+0x([0-9a-f]+)").FindSubmatch(out)
+	if match == nil {
+		t.Fatalf("unexpected output:\n%s", out)
+	}
+	offset, err := strconv.ParseUint(string(match[1]), 16, 64)
+	ut.AssertEqual(t, nil, err)
+
+	recurse := Call{SourcePath: main, Line: 7, Func: Function{"main.recurse"}}
+	goroutines := []Goroutine{
+		{
+			Signature: Signature{
+				State:     "running",
+				CreatedBy: Call{SourcePath: main, Line: 15, Offset: offset, Func: Function{"main.main"}},
+				Stack:     Stack{Calls: []Call{recurse}, Elided: true},
+			},
+			ID: 1,
+		},
+	}
+	symbols.RecoverElided(goroutines)
+	calls := goroutines[0].Stack.Calls
+	ut.AssertEqual(t, 3, len(calls))
+	ut.AssertEqual(t, Call{SourcePath: main, Line: 10, Func: Function{"main.worker"}, Reconstructed: true}, calls[1])
+	ut.AssertEqual(t, "runtime.goexit", calls[2].Func.Raw)
+}
+
+func TestExpandInlined(t *testing.T) {
+	name, err := ioutil.TempDir("", "panicparse")
+	ut.AssertEqual(t, nil, err)
+	defer os.RemoveAll(name)
+	main, binary := build(t, name, inlinedSource)
+	symbols, err := OpenSymbols(binary)
+	ut.AssertEqual(t, nil, err)
+
+	// The runtime expands the inlined calls itself, get the offset of the
+	// physical frame from an actual crash.
+	out, _ := exec.Command(binary).CombinedOutput()
+	match := regexp.MustCompile("main\\.main\\(\\)\n\\s+.+:12 \\+0x([0-9a-f]+)").FindSubmatch(out)
+	if match == nil {
+		t.Fatalf("unexpected output:\n%s", out)
+	}
+	offset, err := strconv.ParseUint(string(match[1]), 16, 64)
+	ut.AssertEqual(t, nil, err)
+
+	// Simulates an old runtime that only prints the physical frame.
+	panicCall := Call{SourcePath: "/goroot/src/runtime/panic.go", Line: 1, Func: Function{"panic"}}
+	goroutines := []Goroutine{
+		{
+			Signature: Signature{
+				State: "running",
+				Stack: Stack{Calls: []Call{panicCall, {SourcePath: main, Line: 4, Offset: offset, Func: Function{"main.main"}}}},
+			},
+			ID: 1,
+		},
+	}
+	expected := []Call{
+		panicCall,
+		{SourcePath: main, Line: 4, Func: Function{"main.inner"}, Inlined: true},
+		{SourcePath: main, Line: 8, Func: Function{"main.outer"}, Inlined: true},
+		{SourcePath: main, Line: 12, Offset: offset, Func: Function{"main.main"}},
+	}
+	symbols.ExpandInlined(goroutines)
+	ut.AssertEqual(t, expected, goroutines[0].Stack.Calls)
+	// It is idempotent.
+	symbols.ExpandInlined(goroutines)
+	ut.AssertEqual(t, expected, goroutines[0].Stack.Calls)
+}
+
+func TestOpenSymbolsInvalid(t *testing.T) {
+	_, err := OpenSymbols("binary_test.go")
+	ut.AssertEqual(t, false, err == nil)
+}
+
+// build writes src in dir and compiles it. It returns the path of the source
+// file and of the executable.
+func build(t *testing.T, dir, src string) (string, string) {
+	main := filepath.Join(dir, "main.go")
+	ut.AssertEqual(t, nil, ioutil.WriteFile(main, []byte(src), 0500))
+	binary := filepath.Join(dir, "main")
+	if out, err := exec.Command("go", "build", "-o", binary, main).CombinedOutput(); err != nil {
+		t.Fatalf("failed to build: %s\n%s", err, out)
+	}
+	return main, binary
+}
+
+const elidedSource = `package main
+
+func recurse(i int) {
+	if i == 0 {
+		panic("deep")
+	}
+	recurse(i - 1)
+}
+
+func main() {
+	done := make(chan bool)
+	go func() {
+		recurse(200)
+		done <- true
+	}()
+	<-done
+}
+`
+
+const elidedFuncSource = `package main
+
+func recurse(i int) {
+	if i == 0 {
+		panic("deep")
+	}
+	recurse(i - 1)
+}
+
+func worker() {
+	recurse(200)
+}
+
+func main() {
+	go worker()
+	select {}
+}
+`
+
+const inlinedSource = `package main
+
+func inner() {
+	panic("inner")
+}
+
+func outer() {
+	inner()
+}
+
+func main() {
+	outer()
+}
+`
@@ -0,0 +1,290 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// BlockKind is what a goroutine is blocked on.
+type BlockKind int
+
+// Block kinds.
+const (
+	// BlockChannel is a send or a receive on a channel.
+	BlockChannel BlockKind = iota + 1
+	// BlockNilChannel is a send or a receive on a nil channel, which blocks
+	// forever.
+	BlockNilChannel
+	// BlockSelect is a select statement, on any number of channels.
+	BlockSelect
+)
+
+func (k BlockKind) String() string {
+	switch k {
+	case BlockChannel:
+		return "channel"
+	case BlockNilChannel:
+		return "nil channel"
+	case BlockSelect:
+		return "select"
+	default:
+		return "unknown"
+	}
+}
+
+// Direction is the direction of a channel operation.
+type Direction int
+
+// Channel operation directions.
+const (
+	// DirUnknown is when the direction can't be determined, e.g. for a select.
+	DirUnknown Direction = iota
+	DirSend
+	DirReceive
+)
+
+func (d Direction) String() string {
+	switch d {
+	case DirSend:
+		return "send"
+	case DirReceive:
+		return "receive"
+	default:
+		return "unknown"
+	}
+}
+
+// BlockedOn describes the channel operation a goroutine is blocked on.
+type BlockedOn struct {
+	Kind      BlockKind
+	Direction Direction
+	// Addr is the address of the channel. It is 0 when unknown, e.g. for a
+	// select or when the channel argument was not printed.
+	Addr uint64
+}
+
+// BlockedOn returns the channel operation the goroutine is blocked on.
+//
+// It returns false if the goroutine is not blocked on a channel operation.
+// The kind and the direction are from the state, the address is the first
+// argument of the runtime channel function in the stack.
+func (s *Signature) BlockedOn() (BlockedOn, bool) {
+	var b BlockedOn
+	switch {
+	case strings.HasPrefix(s.State, "chan send"):
+		b.Kind, b.Direction = BlockChannel, DirSend
+	case strings.HasPrefix(s.State, "chan receive"):
+		b.Kind, b.Direction = BlockChannel, DirReceive
+	case strings.HasPrefix(s.State, "select"):
+		b.Kind = BlockSelect
+		return b, true
+	default:
+		return b, false
+	}
+	if strings.HasSuffix(s.State, "(nil chan)") {
+		b.Kind = BlockNilChannel
+		return b, true
+	}
+	for i := range s.Stack.Calls {
+		c := &s.Stack.Calls[i]
+		if c.Func.PkgName() != "runtime" || !chanFuncs[c.Func.Name()] {
+			continue
+		}
+		if len(c.Args.Values) != 0 {
+			b.Addr = c.Args.Values[0].Value
+		}
+		break
+	}
+	return b, true
+}
+
+// Channel is the number of goroutines blocked on a channel.
+type Channel struct {
+	Addr      uint64
+	Senders   int
+	Receivers int
+}
+
+// Channels returns the channels goroutines are blocked on, with the most
+// blocked goroutines first.
+//
+// A large imbalance between senders and receivers is usually the sign of a
+// consumer that stopped or a producer that leaks goroutines.
+func Channels(goroutines []Goroutine) []Channel {
+	channels := map[uint64]*Channel{}
+	for i := range goroutines {
+		b, ok := goroutines[i].BlockedOn()
+		if !ok || b.Kind != BlockChannel || b.Addr == 0 {
+			continue
+		}
+		c := channels[b.Addr]
+		if c == nil {
+			c = &Channel{Addr: b.Addr}
+			channels[b.Addr] = c
+		}
+		if b.Direction == DirSend {
+			c.Senders++
+		} else {
+			c.Receivers++
+		}
+	}
+	out := make([]Channel, 0, len(channels))
+	for _, c := range channels {
+		out = append(out, *c)
+	}
+	sort.Sort(channelsByCount(out))
+	return out
+}
+
+// MinChannelPileUp is the number of goroutines blocked in the same direction
+// on the same channel from which ChannelPileUps reports them.
+var MinChannelPileUp = 5
+
+// ChannelPileUp is a group of goroutines blocked in the same direction on the
+// same channel.
+type ChannelPileUp struct {
+	Addr      uint64
+	Direction Direction
+	// Site is the channel operation most of the goroutines are blocked at.
+	Site Call
+	// Goroutines are the IDs of the goroutines blocked, in dump order.
+	Goroutines []int
+}
+
+// ChannelPileUps returns the channels at least MinChannelPileUp goroutines
+// are blocked sending to or receiving from, the most goroutines first.
+//
+// Many senders blocked on a channel almost always means its consumer stalled,
+// many receivers that its producer did.
+func ChannelPileUps(goroutines []Goroutine) []ChannelPileUp {
+	var out []ChannelPileUp
+	for _, c := range Channels(goroutines) {
+		if c.Senders >= MinChannelPileUp {
+			out = appendPileUp(out, goroutines, c.Addr, DirSend)
+		}
+		if c.Receivers >= MinChannelPileUp {
+			out = appendPileUp(out, goroutines, c.Addr, DirReceive)
+		}
+	}
+	sort.Stable(pileUpsByCount(out))
+	return out
+}
+
+// Private stuff.
+
+// chanSite returns the call to the channel operation, the caller of the
+// outermost runtime channel function.
+func (s *Stack) chanSite() *Call {
+	k := -1
+	for i := range s.Calls {
+		c := &s.Calls[i]
+		if c.Func.PkgName() == "runtime" && chanFuncs[c.Func.Name()] {
+			k = i
+		}
+	}
+	if k == -1 || k+1 >= len(s.Calls) {
+		return nil
+	}
+	return &s.Calls[k+1]
+}
+
+// appendPileUp appends the goroutines blocked on the channel in the direction
+// to out, if at least MinChannelPileUp of them are at a channel operation.
+func appendPileUp(out []ChannelPileUp, goroutines []Goroutine, addr uint64, dir Direction) []ChannelPileUp {
+	c := ChannelPileUp{Addr: addr, Direction: dir}
+	// sites counts the goroutines per call site, best is the count of the
+	// current Site.
+	sites := map[string]int{}
+	best := 0
+	for i := range goroutines {
+		g := &goroutines[i]
+		b, ok := g.BlockedOn()
+		if !ok || b.Kind != BlockChannel || b.Addr != addr || b.Direction != dir {
+			continue
+		}
+		site := g.Stack.chanSite()
+		if site == nil {
+			continue
+		}
+		c.Goroutines = append(c.Goroutines, g.ID)
+		s := fmt.Sprintf("%s:%d", site.SourcePath, site.Line)
+		if sites[s]++; sites[s] > best {
+			best = sites[s]
+			c.Site = *site
+		}
+	}
+	if len(c.Goroutines) < MinChannelPileUp {
+		return out
+	}
+	return append(out, c)
+}
+
+// channelAnalyzer reports the channel pile-ups.
+type channelAnalyzer struct{}
+
+func (channelAnalyzer) Name() string {
+	return "channel"
+}
+
+func (channelAnalyzer) Analyze(s *Snapshot, buckets Buckets) []Finding {
+	var out []Finding
+	for _, c := range ChannelPileUps(s.Goroutines) {
+		op, other := "sending to", "receiver"
+		if c.Direction == DirReceive {
+			op, other = "receiving from", "sender"
+		}
+		out = append(out, Finding{
+			Severity:    SeverityWarning,
+			Buckets:     bucketIndexes(buckets, c.Goroutines),
+			Explanation: fmt.Sprintf("%d goroutines are blocked %s channel 0x%x at %s in %s; its %s likely stalled", len(c.Goroutines), op, c.Addr, c.Site.SourceLine(), c.Site.Func.PkgDotName(), other),
+		})
+	}
+	return out
+}
+
+// chanFuncs are the runtime functions of channel operations; the channel is
+// their first argument.
+var chanFuncs = map[string]bool{
+	"chanrecv":  true,
+	"chanrecv1": true,
+	"chanrecv2": true,
+	"chansend":  true,
+	"chansend1": true,
+}
+
+type channelsByCount []Channel
+
+func (c channelsByCount) Len() int {
+	return len(c)
+}
+
+func (c channelsByCount) Less(i, j int) bool {
+	l, r := c[i].Senders+c[i].Receivers, c[j].Senders+c[j].Receivers
+	if l != r {
+		return l > r
+	}
+	return c[i].Addr < c[j].Addr
+}
+
+func (c channelsByCount) Swap(i, j int) {
+	c[i], c[j] = c[j], c[i]
+}
+
+type pileUpsByCount []ChannelPileUp
+
+func (c pileUpsByCount) Len() int {
+	return len(c)
+}
+
+func (c pileUpsByCount) Less(i, j int) bool {
+	return len(c[i].Goroutines) > len(c[j].Goroutines)
+}
+
+func (c pileUpsByCount) Swap(i, j int) {
+	c[i], c[j] = c[j], c[i]
+}
@@ -0,0 +1,94 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestBlockedOn(t *testing.T) {
+	t.Parallel()
+	send := Stack{Calls: []Call{
+		{Func: Function{"runtime.gopark"}},
+		{Func: Function{"runtime.chansend"}, Args: Args{Values: []Arg{{Value: 0xc208010060}, {Value: 0xc20802a000}}}},
+		{Func: Function{"runtime.chansend1"}, Args: Args{Values: []Arg{{Value: 0xc208010060}, {Value: 0xc20802a000}}}},
+		{Func: Function{"main.produce"}},
+	}}
+	data := []struct {
+		s        Signature
+		expected BlockedOn
+		ok       bool
+	}{
+		{Signature{State: "chan send", Stack: send}, BlockedOn{BlockChannel, DirSend, 0xc208010060}, true},
+		{Signature{State: "chan receive", Stack: Stack{Calls: []Call{{Func: Function{"main.consume"}}}}}, BlockedOn{BlockChannel, DirReceive, 0}, true},
+		{Signature{State: "chan receive (nil chan)"}, BlockedOn{BlockNilChannel, DirReceive, 0}, true},
+		{Signature{State: "select"}, BlockedOn{Kind: BlockSelect}, true},
+		{Signature{State: "running"}, BlockedOn{}, false},
+	}
+	for i, line := range data {
+		b, ok := line.s.BlockedOn()
+		ut.AssertEqualIndex(t, i, line.ok, ok)
+		ut.AssertEqualIndex(t, i, line.expected, b)
+	}
+}
+
+func TestChannels(t *testing.T) {
+	t.Parallel()
+	blocked := func(state string, addr uint64) Goroutine {
+		calls := []Call{{Func: Function{"runtime.chanrecv1"}, Args: Args{Values: []Arg{{Value: addr}}}}}
+		return Goroutine{Signature: Signature{State: state, Stack: Stack{Calls: calls}}}
+	}
+	goroutines := []Goroutine{
+		blocked("chan send", 0x2000),
+		blocked("chan receive", 0x1000),
+		blocked("chan send", 0x2000),
+		blocked("chan send", 0x2000),
+		blocked("chan receive", 0x1000),
+		blocked("select", 0x3000),
+		blocked("running", 0x4000),
+	}
+	expected := []Channel{
+		{Addr: 0x2000, Senders: 3},
+		{Addr: 0x1000, Receivers: 2},
+	}
+	ut.AssertEqual(t, expected, Channels(goroutines))
+}
+
+func TestChannelPileUps(t *testing.T) {
+	t.Parallel()
+	blocked := func(id int, state string, addr uint64, line int) Goroutine {
+		calls := []Call{
+			{Func: Function{"runtime.gopark"}},
+			{Func: Function{"runtime.chansend"}, Args: Args{Values: []Arg{{Value: addr}}}},
+			{Func: Function{"runtime.chansend1"}, Args: Args{Values: []Arg{{Value: addr}}}},
+			{Func: Function{"main.produce"}, SourcePath: "/home/user/src/main.go", Line: line},
+		}
+		return Goroutine{ID: id, Signature: Signature{State: state, Stack: Stack{Calls: calls}}}
+	}
+	goroutines := []Goroutine{
+		blocked(1, "chan send", 0x1000, 12),
+		blocked(2, "chan send", 0x1000, 10),
+		blocked(3, "chan send", 0x1000, 10),
+		blocked(4, "chan send", 0x1000, 10),
+		blocked(5, "chan send", 0x1000, 12),
+		blocked(6, "chan receive", 0x1000, 20),
+		blocked(7, "chan send", 0x2000, 10),
+	}
+	p := ChannelPileUps(goroutines)
+	ut.AssertEqual(t, 1, len(p))
+	ut.AssertEqual(t, uint64(0x1000), p[0].Addr)
+	ut.AssertEqual(t, DirSend, p[0].Direction)
+	ut.AssertEqual(t, 10, p[0].Site.Line)
+	ut.AssertEqual(t, []int{1, 2, 3, 4, 5}, p[0].Goroutines)
+
+	s := &Snapshot{Goroutines: goroutines}
+	buckets := SortBuckets(Bucketize(goroutines, AnyValue))
+	f := channelAnalyzer{}.Analyze(s, buckets)
+	ut.AssertEqual(t, 1, len(f))
+	ut.AssertEqual(t, "5 goroutines are blocked sending to channel 0x1000 at main.go:10 in main.produce; its receiver likely stalled", f[0].Explanation)
+	ut.AssertEqual(t, 2, len(f[0].Buckets))
+}
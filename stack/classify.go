@@ -0,0 +1,87 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import "strings"
+
+// CodeKind is where the code of a call comes from.
+type CodeKind int
+
+// Code kinds.
+const (
+	// CodeOwn is the code of the program itself.
+	CodeOwn CodeKind = iota
+	// CodeStdlib is the Go standard library, including the runtime.
+	CodeStdlib
+	// CodeThirdParty is a dependency of the program.
+	CodeThirdParty
+)
+
+func (k CodeKind) String() string {
+	switch k {
+	case CodeOwn:
+		return "own"
+	case CodeStdlib:
+		return "stdlib"
+	case CodeThirdParty:
+		return "third party"
+	default:
+		return "unknown"
+	}
+}
+
+// Classifier returns where the code of a call comes from.
+type Classifier func(c *Call) CodeKind
+
+// DefaultClassifier classifies the calls in a vendor directory or in the
+// module cache as third party.
+func DefaultClassifier(c *Call) CodeKind {
+	if c.IsStdlib() {
+		return CodeStdlib
+	}
+	p := strings.Replace(c.SourcePath, "\\", "/", -1)
+	if strings.Contains(p, "/vendor/") || strings.Contains(p, "/pkg/mod/") {
+		return CodeThirdParty
+	}
+	return CodeOwn
+}
+
+// ModuleClassifier returns a Classifier where the code of the program is in
+// the main package and in the packages of the import path prefixes, e.g.
+// "github.com/maruel/panicparse". Everything else outside the standard
+// library is third party.
+func ModuleClassifier(prefixes ...string) Classifier {
+	return func(c *Call) CodeKind {
+		if c.IsStdlib() {
+			return CodeStdlib
+		}
+		if c.IsPkgMain() {
+			return CodeOwn
+		}
+		for _, p := range prefixes {
+			if c.Func.Raw == p || strings.HasPrefix(c.Func.Raw, p+"/") || strings.HasPrefix(c.Func.Raw, p+".") {
+				return CodeOwn
+			}
+		}
+		return CodeThirdParty
+	}
+}
+
+// TopUserFrame returns the first call from the leaf that is the program's own
+// code, or nil if there is none.
+//
+// It is normally the most relevant line to title a bucket, e.g. in a
+// notification. A nil classifier uses DefaultClassifier.
+func (b *Bucket) TopUserFrame(classifier Classifier) *Call {
+	if classifier == nil {
+		classifier = DefaultClassifier
+	}
+	for i := range b.Stack.Calls {
+		if classifier(&b.Stack.Calls[i]) == CodeOwn {
+			return &b.Stack.Calls[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestTopUserFrame(t *testing.T) {
+	t.Parallel()
+	calls := []Call{
+		{SourcePath: "/usr/local/go/src/sync/mutex.go", Line: 81, Func: Function{"sync.(*Mutex).Lock"}},
+		{SourcePath: "/home/user/go/pkg/mod/github.com/lib/pq@v1.10.0/conn.go", Line: 310, Func: Function{"github.com/lib/pq.(*conn).query"}},
+		{SourcePath: "/home/user/src/app/store/store.go", Line: 42, Func: Function{"example.com/app/store.(*Store).Get"}},
+		{SourcePath: "/home/user/src/app/main.go", Line: 12, Func: Function{"main.main"}},
+	}
+	b := Bucket{Signature: Signature{Stack: Stack{Calls: calls}}}
+	ut.AssertEqual(t, &b.Stack.Calls[2], b.TopUserFrame(nil))
+	ut.AssertEqual(t, &b.Stack.Calls[2], b.TopUserFrame(ModuleClassifier("example.com/app")))
+	ut.AssertEqual(t, &b.Stack.Calls[3], b.TopUserFrame(ModuleClassifier("example.com/other")))
+	ut.AssertEqual(t, &b.Stack.Calls[1], b.TopUserFrame(ModuleClassifier("github.com/lib/pq")))
+
+	b.Stack.Calls = calls[:2]
+	ut.AssertEqual(t, (*Call)(nil), b.TopUserFrame(ModuleClassifier("example.com/app")))
+}
+
+func TestDefaultClassifier(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		c        Call
+		expected CodeKind
+	}{
+		{Call{SourcePath: "/usr/local/go/src/runtime/proc.go"}, CodeStdlib},
+		{Call{SourcePath: "/src/app/vendor/github.com/maruel/ut/ut.go"}, CodeThirdParty},
+		{Call{SourcePath: "/go/pkg/mod/golang.org/x/net@v0.1.0/http2/server.go"}, CodeThirdParty},
+		{Call{SourcePath: "/src/app/main.go"}, CodeOwn},
+	}
+	for i, line := range data {
+		ut.AssertEqualIndex(t, i, line.expected, DefaultClassifier(&line.c))
+	}
+}
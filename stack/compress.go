@@ -0,0 +1,49 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+)
+
+// NewZstdReader returns a reader decompressing the zstd stream r.
+//
+// The standard library has no zstd decoder so it is nil by default and zstd
+// input is an error. Set it to enable zstd, e.g. to zstd.NewReader of
+// github.com/klauspost/compress.
+var NewZstdReader func(r io.Reader) (io.Reader, error)
+
+// Decompress returns a reader decompressing r when it starts with the gzip or
+// the zstd magic bytes, e.g. a rotated log. Otherwise the returned reader
+// reads r as is.
+//
+// ParseDump, ParseSnapshot and ParseStream call it, so compressed dumps are
+// parsed transparently.
+func Decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	// A short read is not an error here, it is surfaced on the next read.
+	magic, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, zstdMagic):
+		if NewZstdReader == nil {
+			return nil, errors.New("zstd compressed input is not supported; set NewZstdReader")
+		}
+		return NewZstdReader(br)
+	}
+	return br, nil
+}
+
+// Private stuff.
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
@@ -0,0 +1,55 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+var compressedDump = strings.Join([]string{
+	"panic: ooh",
+	"",
+	"goroutine 1 [running]:",
+	"main.main()",
+	"	/home/user/src/app/main.go:12 +0x17",
+	"",
+}, "\n")
+
+func TestDecompressGzip(t *testing.T) {
+	t.Parallel()
+	buf := &bytes.Buffer{}
+	w := gzip.NewWriter(buf)
+	_, err := w.Write([]byte(compressedDump))
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, nil, w.Close())
+	extra := &bytes.Buffer{}
+	goroutines, err := ParseDump(buf, extra)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 1, len(goroutines))
+	ut.AssertEqual(t, "panic: ooh\n\n", extra.String())
+}
+
+func TestDecompressZstdUnsupported(t *testing.T) {
+	t.Parallel()
+	_, err := Decompress(bytes.NewReader([]byte{0x28, 0xb5, 0x2f, 0xfd, 0}))
+	ut.AssertEqual(t, "zstd compressed input is not supported; set NewZstdReader", err.Error())
+}
+
+func TestDecompressPlain(t *testing.T) {
+	t.Parallel()
+	for _, in := range []string{"", "a", compressedDump} {
+		r, err := Decompress(strings.NewReader(in))
+		ut.AssertEqual(t, nil, err)
+		b, err := ioutil.ReadAll(r)
+		ut.AssertEqual(t, nil, err)
+		ut.AssertEqual(t, in, string(b))
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// NormalizeMessage masks the parts of a panic message that usually vary
+// between two occurrences of the same crash: UUIDs, addresses and numbers.
+//
+// For example "index out of range [7] with length 5" becomes
+// "index out of range [N] with length N".
+func NormalizeMessage(msg string) string {
+	msg = reUUID.ReplaceAllString(msg, "<uuid>")
+	msg = reHexNumber.ReplaceAllString(msg, "0x?")
+	return reNumber.ReplaceAllString(msg, "N")
+}
+
+// CrashGroup is a set of crashes with the same normalized panic message and
+// a similar stack for the goroutine that crashed.
+type CrashGroup struct {
+	// Message is the normalized message.
+	Message string
+	// Stack is the stack of the goroutine that crashed in the first snapshot.
+	Stack Stack
+	// Snapshots are the crashes of the group.
+	Snapshots []*Snapshot
+}
+
+// GroupCrashes groups the snapshots by crash type, with the largest groups
+// first.
+//
+// The message is the panic message or the fatal error. The goroutine that
+// crashed is the first Crashed one, or the first one of the dump if none is.
+func GroupCrashes(snapshots []*Snapshot, similar Similarity) []CrashGroup {
+	var out []CrashGroup
+	for _, s := range snapshots {
+		msg := ""
+		if s.Reason != nil {
+			msg = s.Reason.Value
+		} else if s.Fatal != nil {
+			msg = s.Fatal.Message
+		}
+		msg = NormalizeMessage(msg)
+		var st Stack
+		if g := s.crashed(); g != nil {
+			st = g.Stack
+		}
+		found := false
+		for i := range out {
+			if out[i].Message == msg && out[i].Stack.Similar(&st, similar) {
+				out[i].Snapshots = append(out[i].Snapshots, s)
+				found = true
+				break
+			}
+		}
+		if !found {
+			out = append(out, CrashGroup{Message: msg, Stack: st, Snapshots: []*Snapshot{s}})
+		}
+	}
+	sort.Stable(crashGroupsBySize(out))
+	return out
+}
+
+// Crashed returns true if it contains a Crashed goroutine.
+func (b *Bucket) Crashed() bool {
+	for i := range b.Routines {
+		if b.Routines[i].Crashed {
+			return true
+		}
+	}
+	return false
+}
+
+// Private stuff.
+
+// crashFuncs are the runtime functions in the stack of a goroutine running a
+// panic or a fatal error. Go 1.17+ prints runtime.gopanic as "panic".
+var crashFuncs = map[string]bool{
+	"panic":              true,
+	"runtime.fatalpanic": true,
+	"runtime.fatalthrow": true,
+	"runtime.gopanic":    true,
+	"runtime.sigpanic":   true,
+	"runtime.throw":      true,
+}
+
+// crashed returns true if the goroutine is running and has a crashFuncs call
+// in its stack.
+func (g *Goroutine) crashed() bool {
+	if !strings.HasPrefix(g.State, "running") {
+		return false
+	}
+	for i := range g.Stack.Calls {
+		if crashFuncs[g.Stack.Calls[i].Func.Raw] {
+			return true
+		}
+	}
+	return false
+}
+
+// crashed returns the goroutine that crashed: the first Crashed one, else the
+// first one. It returns nil if there is no goroutine.
+func (s *Snapshot) crashed() *Goroutine {
+	for i := range s.Goroutines {
+		if s.Goroutines[i].Crashed {
+			return &s.Goroutines[i]
+		}
+	}
+	if len(s.Goroutines) != 0 {
+		return &s.Goroutines[0]
+	}
+	return nil
+}
+
+var (
+	reUUID      = regexp.MustCompile(`\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b`)
+	reHexNumber = regexp.MustCompile(`\b0x[0-9a-fA-F]+\b`)
+	reNumber    = regexp.MustCompile(`-?\b\d+\b`)
+)
+
+type crashGroupsBySize []CrashGroup
+
+func (c crashGroupsBySize) Len() int {
+	return len(c)
+}
+
+func (c crashGroupsBySize) Less(i, j int) bool {
+	return len(c[i].Snapshots) > len(c[j].Snapshots)
+}
+
+func (c crashGroupsBySize) Swap(i, j int) {
+	c[i], c[j] = c[j], c[i]
+}
@@ -0,0 +1,106 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestNormalizeMessage(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		in, expected string
+	}{
+		{"runtime error: index out of range [7] with length 5", "runtime error: index out of range [N] with length N"},
+		{"runtime error: slice bounds out of range [:-1]", "runtime error: slice bounds out of range [:N]"},
+		{"runtime error: invalid memory address or nil pointer dereference", "runtime error: invalid memory address or nil pointer dereference"},
+		{"(*errors.errorString) 0xc000010250", "(*errors.errorString) 0x?"},
+		{"user 123e4567-e89b-12d3-a456-426614174000 not found", "user <uuid> not found"},
+		{"v2 api", "v2 api"},
+	}
+	for i, line := range data {
+		ut.AssertEqualIndex(t, i, line.expected, NormalizeMessage(line.in))
+	}
+}
+
+func TestGroupCrashes(t *testing.T) {
+	t.Parallel()
+	crash := func(msg string, line string) *Snapshot {
+		data := []string{
+			"panic: " + msg,
+			"",
+			"goroutine 1 [running]:",
+			"main.main()",
+			"	/gopath/src/github.com/foo/bar/main.go:" + line + " +0x1d",
+			"",
+		}
+		s, err := ParseSnapshot(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard)
+		ut.AssertEqual(t, nil, err)
+		return s
+	}
+	snapshots := []*Snapshot{
+		crash("runtime error: index out of range [7] with length 5", "12"),
+		crash("boom", "12"),
+		crash("runtime error: index out of range [9] with length 5", "12"),
+		// Same message, another site.
+		crash("runtime error: index out of range [1] with length 0", "20"),
+	}
+	groups := GroupCrashes(snapshots, AnyValue)
+	ut.AssertEqual(t, 3, len(groups))
+	ut.AssertEqual(t, "runtime error: index out of range [N] with length N", groups[0].Message)
+	ut.AssertEqual(t, []*Snapshot{snapshots[0], snapshots[2]}, groups[0].Snapshots)
+	ut.AssertEqual(t, "boom", groups[1].Message)
+	ut.AssertEqual(t, []*Snapshot{snapshots[3]}, groups[2].Snapshots)
+}
+
+func TestCrashed(t *testing.T) {
+	t.Parallel()
+	// A pprof debug=2 dump: the goroutine serving the request is printed first
+	// and the one panicking later.
+	data := []string{
+		"goroutine 20 [running]:",
+		"runtime/pprof.writeGoroutineStacks(0x5a2d40, 0xc000010000)",
+		"	/goroot/src/runtime/pprof/pprof.go:693 +0x9f",
+		"",
+		"goroutine 1 [chan receive]:",
+		"main.main()",
+		"	/gopath/src/github.com/foo/bar/main.go:10 +0x27",
+		"",
+		"goroutine 7 [running]:",
+		"panic({0x4a1e28, 0x5a2d40})",
+		"	/goroot/src/runtime/panic.go:1038 +0x215",
+		"main.work()",
+		"	/gopath/src/github.com/foo/bar/main.go:20 +0x1d",
+		"",
+		"goroutine 8 [select]:",
+		"main.recovered()",
+		"	/gopath/src/github.com/foo/bar/main.go:30 +0x1d",
+		"runtime.gopanic(0x4a1e28)",
+		"	/goroot/src/runtime/panic.go:1038 +0x215",
+		"",
+	}
+	s, err := ParseSnapshot(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 4, len(s.Goroutines))
+	crashed := []bool{}
+	for _, g := range s.Goroutines {
+		crashed = append(crashed, g.Crashed)
+	}
+	ut.AssertEqual(t, []bool{false, false, true, false}, crashed)
+	ut.AssertEqual(t, true, s.Goroutines[0].First)
+
+	buckets := SortBuckets(Bucketize(s.Goroutines, AnyPointer))
+	ut.AssertEqual(t, 7, buckets[0].Routines[0].ID)
+	ut.AssertEqual(t, true, buckets[0].Crashed())
+	ut.AssertEqual(t, 20, buckets[1].Routines[0].ID)
+	ut.AssertEqual(t, 7, s.crashed().ID)
+	ut.AssertEqual(t, 20, (&Snapshot{Goroutines: s.Goroutines[:2]}).crashed().ID)
+	ut.AssertEqual(t, (*Goroutine)(nil), (&Snapshot{}).crashed())
+}
@@ -0,0 +1,243 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import "sort"
+
+// ChannelCycle is a candidate deadlock: goroutines each blocked on a channel
+// referenced by the next goroutine of the cycle, itself blocked on another
+// channel.
+type ChannelCycle struct {
+	// Goroutines are the IDs of the goroutines of the cycle, starting with the
+	// lowest. Goroutines[i] waits on Goroutines[i+1], which waits on
+	// Goroutines[0] for the last one.
+	Goroutines []int
+	// Channels[i] is the address of the channel Goroutines[i] is blocked on.
+	// Goroutines[i+1] has it in its arguments.
+	Channels []uint64
+}
+
+// Buckets returns the buckets the goroutines of the cycle are in, in cycle
+// order. A bucket is listed once even if several goroutines of the cycle are
+// in it.
+func (c *ChannelCycle) Buckets(buckets Buckets) Buckets {
+	var out Buckets
+	for _, i := range bucketIndexes(buckets, c.Goroutines) {
+		out = append(out, buckets[i])
+	}
+	return out
+}
+
+// ChannelCycles returns the candidate deadlocks among the goroutines blocked
+// sending to or receiving from a channel, the largest first.
+//
+// A goroutine blocked on a channel waits for the goroutines that have the
+// channel address in the arguments of their stack, as they are the ones that
+// could send or receive on it. When they are all blocked on other channels
+// and this leads back to the first goroutine, none can make progress.
+//
+// It is a candidate only: a goroutine can reach the channel without having
+// it in its arguments, e.g. through a struct field or a closure, and the
+// arguments are not always printed. The goroutines of a cycle are the
+// shortest cycle through the lowest goroutine ID of each set of goroutines
+// waiting on each other.
+func ChannelCycles(goroutines []Goroutine) []ChannelCycle {
+	// Index the goroutines blocked on a known channel, and by channel.
+	var nodes []int
+	addrs := map[int]uint64{}
+	waiters := map[uint64][]int{}
+	for i := range goroutines {
+		if b, ok := goroutines[i].BlockedOn(); ok && b.Kind == BlockChannel && b.Addr != 0 {
+			nodes = append(nodes, i)
+			addrs[i] = b.Addr
+			waiters[b.Addr] = append(waiters[b.Addr], i)
+		}
+	}
+	// edges[i] are the goroutines goroutines[i] waits on, in goroutine order.
+	edges := map[int][]int{}
+	for _, j := range nodes {
+		for _, addr := range goroutines[j].Stack.referenced() {
+			if addr == addrs[j] {
+				continue
+			}
+			for _, i := range waiters[addr] {
+				edges[i] = append(edges[i], j)
+			}
+		}
+	}
+	var out []ChannelCycle
+	for _, scc := range stronglyConnected(nodes, edges) {
+		if len(scc) < 2 {
+			continue
+		}
+		path := shortestCycle(lowestID(goroutines, scc), scc, edges)
+		cycle := ChannelCycle{}
+		for _, i := range path {
+			cycle.Goroutines = append(cycle.Goroutines, goroutines[i].ID)
+			cycle.Channels = append(cycle.Channels, addrs[i])
+		}
+		out = append(out, cycle)
+	}
+	sort.Sort(cyclesBySize(out))
+	return out
+}
+
+// Private stuff.
+
+// references returns true if the address is an argument of a call of the
+// stack, ignoring the runtime channel functions.
+func (s *Stack) references(addr uint64) bool {
+	for i := range s.Calls {
+		c := &s.Calls[i]
+		if c.Func.PkgName() == "runtime" && chanFuncs[c.Func.Name()] {
+			continue
+		}
+		for _, a := range c.Args.Values {
+			if a.Value == addr {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// referenced returns the distinct argument values of the calls of the stack,
+// ignoring the runtime channel functions.
+func (s *Stack) referenced() []uint64 {
+	var out []uint64
+	seen := map[uint64]bool{}
+	for i := range s.Calls {
+		c := &s.Calls[i]
+		if c.Func.PkgName() == "runtime" && chanFuncs[c.Func.Name()] {
+			continue
+		}
+		for _, a := range c.Args.Values {
+			if !seen[a.Value] {
+				seen[a.Value] = true
+				out = append(out, a.Value)
+			}
+		}
+	}
+	return out
+}
+
+// hasID returns true if the goroutine is in the bucket.
+func (b *Bucket) hasID(id int) bool {
+	for i := range b.Routines {
+		if b.Routines[i].ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// stronglyConnected returns the strongly connected components of the graph,
+// with Tarjan's algorithm.
+func stronglyConnected(nodes []int, edges map[int][]int) [][]int {
+	index := map[int]int{}
+	low := map[int]int{}
+	onStack := map[int]bool{}
+	var pending []int
+	var out [][]int
+	var visit func(n int)
+	visit = func(n int) {
+		index[n] = len(index)
+		low[n] = index[n]
+		pending = append(pending, n)
+		onStack[n] = true
+		for _, m := range edges[n] {
+			if _, ok := index[m]; !ok {
+				visit(m)
+				if low[m] < low[n] {
+					low[n] = low[m]
+				}
+			} else if onStack[m] && index[m] < low[n] {
+				low[n] = index[m]
+			}
+		}
+		if low[n] != index[n] {
+			return
+		}
+		var scc []int
+		for {
+			m := pending[len(pending)-1]
+			pending = pending[:len(pending)-1]
+			onStack[m] = false
+			scc = append(scc, m)
+			if m == n {
+				break
+			}
+		}
+		out = append(out, scc)
+	}
+	for _, n := range nodes {
+		if _, ok := index[n]; !ok {
+			visit(n)
+		}
+	}
+	return out
+}
+
+// lowestID returns the node of the goroutine with the lowest ID.
+func lowestID(goroutines []Goroutine, nodes []int) int {
+	out := nodes[0]
+	for _, n := range nodes[1:] {
+		if goroutines[n].ID < goroutines[out].ID {
+			out = n
+		}
+	}
+	return out
+}
+
+// shortestCycle returns the shortest path from start back to start within
+// the nodes, start first.
+func shortestCycle(start int, nodes []int, edges map[int][]int) []int {
+	in := map[int]bool{}
+	for _, n := range nodes {
+		in[n] = true
+	}
+	prev := map[int]int{}
+	queue := []int{start}
+	for len(queue) != 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, m := range edges[n] {
+			if m == start {
+				// Walk back to start.
+				path := []int{n}
+				for n != start {
+					n = prev[n]
+					path = append(path, n)
+				}
+				for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+					path[i], path[j] = path[j], path[i]
+				}
+				return path
+			}
+			if _, ok := prev[m]; !ok && in[m] {
+				prev[m] = n
+				queue = append(queue, m)
+			}
+		}
+	}
+	return nil
+}
+
+type cyclesBySize []ChannelCycle
+
+func (c cyclesBySize) Len() int {
+	return len(c)
+}
+
+func (c cyclesBySize) Less(i, j int) bool {
+	if len(c[i].Goroutines) != len(c[j].Goroutines) {
+		return len(c[i].Goroutines) > len(c[j].Goroutines)
+	}
+	return c[i].Goroutines[0] < c[j].Goroutines[0]
+}
+
+func (c cyclesBySize) Swap(i, j int) {
+	c[i], c[j] = c[j], c[i]
+}
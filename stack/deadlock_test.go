@@ -0,0 +1,55 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestChannelCycles(t *testing.T) {
+	t.Parallel()
+	// blocked returns a goroutine blocked on the channel addr with refs in the
+	// arguments of its own function.
+	blocked := func(id int, state, fn string, addr uint64, refs ...uint64) Goroutine {
+		args := make([]Arg, len(refs))
+		for i, r := range refs {
+			args[i] = Arg{Value: r}
+		}
+		calls := []Call{
+			{Func: Function{"runtime.chanrecv1"}, Args: Args{Values: []Arg{{Value: addr}}}},
+			{Func: Function{fn}, Args: Args{Values: args}},
+		}
+		return Goroutine{ID: id, Signature: Signature{State: state, Stack: Stack{Calls: calls}}}
+	}
+	goroutines := []Goroutine{
+		// 5 and 8 wait on each other.
+		blocked(8, "chan send", "main.b", 0x2000, 0x1000),
+		blocked(5, "chan receive", "main.a", 0x1000, 0x2000),
+		// 10 waits on 11 which waits on 12 which waits on 10.
+		blocked(10, "chan send", "main.c", 0x3000, 0x5000),
+		blocked(11, "chan send", "main.c", 0x4000, 0x3000),
+		blocked(12, "chan send", "main.c", 0x5000, 0x4000),
+		// 13 has the channel of 14 but 14 doesn't have the channel of 13.
+		blocked(13, "chan send", "main.d", 0x6000, 0x7000),
+		blocked(14, "chan send", "main.d", 0x7000),
+		// 15 is running so it can still unblock 16.
+		blocked(15, "running", "main.e", 0x8000, 0x9000),
+		blocked(16, "chan receive", "main.e", 0x9000, 0x8000),
+	}
+	expected := []ChannelCycle{
+		{Goroutines: []int{10, 11, 12}, Channels: []uint64{0x3000, 0x4000, 0x5000}},
+		{Goroutines: []int{5, 8}, Channels: []uint64{0x1000, 0x2000}},
+	}
+	cycles := ChannelCycles(goroutines)
+	ut.AssertEqual(t, expected, cycles)
+
+	buckets := SortBuckets(Bucketize(goroutines, AnyValue))
+	involved := cycles[0].Buckets(buckets)
+	ut.AssertEqual(t, 1, len(involved))
+	ut.AssertEqual(t, 3, len(involved[0].Routines))
+	ut.AssertEqual(t, 2, len(cycles[1].Buckets(buckets)))
+}
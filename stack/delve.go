@@ -0,0 +1,106 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ParseDelve parses the output of the "goroutines -t" command of Delve, e.g.
+// saved from a debugging session.
+//
+// Delve prints the wait reason of the blocked goroutines, which becomes the
+// State. The other goroutines are "running" when they are on a thread and
+// "runnable" otherwise. The goroutine marked as the current one with a '*' is
+// First. The arguments are not printed by Delve.
+//
+// The lines that are not part of the listing are streamed to out.
+func ParseDelve(r io.Reader, out io.Writer) ([]Goroutine, error) {
+	return (&Parser{}).ParseDelve(r, out)
+}
+
+// ParseDelve is ParseDelve with the options of p.
+func (p *Parser) ParseDelve(r io.Reader, out io.Writer) ([]Goroutine, error) {
+	var goroutines []Goroutine
+	var g *Goroutine
+	// c is the last frame, until its source line.
+	var c *Call
+	// end ends the goroutine being parsed. It was cut if its last frame has
+	// no source line.
+	end := func() {
+		if c != nil {
+			g.Incomplete = true
+		}
+		if g != nil {
+			g.Crashed = g.crashed()
+		}
+		g, c = nil, nil
+	}
+	scanner := newScanner(r)
+	for scanner.Scan() {
+		raw := scanner.Text()
+		line := p.clean(raw)
+		if m := reDelveHeader.FindStringSubmatch(line); m != nil {
+			end()
+			goroutines = append(goroutines, Goroutine{First: m[1] == "*"})
+			g = &goroutines[len(goroutines)-1]
+			g.ID, _ = strconv.Atoi(m[2])
+			switch {
+			case m[3] != "":
+				g.State = m[3]
+			case m[4] != "":
+				g.State = "running"
+				t, _ := strconv.Atoi(m[4])
+				g.OSThreadID = &t
+			default:
+				g.State = "runnable"
+			}
+			continue
+		}
+		if g != nil {
+			if m := reDelveFrame.FindStringSubmatch(line); m != nil {
+				g.Stack.Calls = append(g.Stack.Calls, Call{Func: Function{m[2]}})
+				c = &g.Stack.Calls[len(g.Stack.Calls)-1]
+				c.PC, _ = strconv.ParseUint(m[1], 16, 64)
+				continue
+			}
+			if m := reDelveSource.FindStringSubmatch(line); m != nil && c != nil {
+				if m[1] != "?" {
+					c.SourcePath, c.PathSeparator = normalizePath(m[1])
+				}
+				if l, _ := strconv.Atoi(m[2]); l > 0 {
+					c.Line = l
+				}
+				c = nil
+				continue
+			}
+			if strings.TrimSpace(line) == "(truncated)" {
+				g.Stack.Elided = true
+				continue
+			}
+			end()
+		}
+		if _, err := io.WriteString(out, raw); err != nil {
+			return goroutines, err
+		}
+	}
+	end()
+	return goroutines, scanner.Err()
+}
+
+// Private stuff.
+
+var (
+	// reDelveHeader matches "  Goroutine 1 - User: ./main.go:12 main.main
+	// (0x4a1b2c) [chan receive]" and "* Goroutine 7 - User: ... (thread 1234)".
+	reDelveHeader = regexp.MustCompile(`^([* ]) Goroutine (\d+) - [A-Za-z]+: .*?(?: \[([^\]]+)\])?(?: \(thread (\d+)\))?\n$`)
+	// reDelveFrame matches "0  0x000000000043e5ae in runtime.gopark".
+	reDelveFrame = regexp.MustCompile(`^\s+\d+\s+0x([0-9a-f]+) in (\S+)\n$`)
+	// reDelveSource matches "    at /usr/local/go/src/runtime/proc.go:399".
+	reDelveSource = regexp.MustCompile(`^\s+at (.+):(-?\d+)\n$`)
+)
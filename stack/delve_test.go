@@ -0,0 +1,80 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestParseDelve(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"(dlv) goroutines -t",
+		"  Goroutine 1 - User: ./main.go:12 main.main (0x462c25) [chan receive]",
+		"	0  0x000000000043e5ae in runtime.gopark",
+		"	    at /usr/local/go/src/runtime/proc.go:399",
+		"	1  0x0000000000462c25 in main.main",
+		"	    at ./main.go:12",
+		"* Goroutine 7 - User: ./main.go:20 main.(*worker).run (0x462c80) (thread 1234)",
+		"	0  0x0000000000462c80 in main.(*worker).run",
+		"	    at ./main.go:20",
+		"	1  0x000000000046a021 in runtime.goexit",
+		"	    at ?:-1",
+		"	(truncated)",
+		"  Goroutine 8 - Runtime: /usr/local/go/src/runtime/proc.go:399 runtime.gopark (0x43e5ae)",
+		"	0  0x000000000043e5ae in runtime.gopark",
+		"[3 goroutines]",
+		"(dlv) ",
+	}
+	extra := &bytes.Buffer{}
+	goroutines, err := ParseDelve(bytes.NewBufferString(strings.Join(data, "\n")), extra)
+	ut.AssertEqual(t, nil, err)
+	thread := 1234
+	expected := []Goroutine{
+		{
+			Signature: Signature{
+				State: "chan receive",
+				Stack: Stack{
+					Calls: []Call{
+						{SourcePath: "/usr/local/go/src/runtime/proc.go", Line: 399, Func: Function{"runtime.gopark"}, PC: 0x43e5ae},
+						{SourcePath: "./main.go", Line: 12, Func: Function{"main.main"}, PC: 0x462c25},
+					},
+				},
+			},
+			ID: 1,
+		},
+		{
+			Signature: Signature{
+				State: "running",
+				Stack: Stack{
+					Calls: []Call{
+						{SourcePath: "./main.go", Line: 20, Func: Function{"main.(*worker).run"}, PC: 0x462c80},
+						{Func: Function{"runtime.goexit"}, PC: 0x46a021},
+					},
+					Elided: true,
+				},
+			},
+			ID:         7,
+			First:      true,
+			OSThreadID: &thread,
+		},
+		{
+			Signature: Signature{
+				State: "runnable",
+				Stack: Stack{
+					Calls: []Call{{Func: Function{"runtime.gopark"}, PC: 0x43e5ae}},
+				},
+			},
+			ID:         8,
+			Incomplete: true,
+		},
+	}
+	ut.AssertEqual(t, expected, goroutines)
+	ut.AssertEqual(t, "(dlv) goroutines -t\n[3 goroutines]\n(dlv) ", extra.String())
+}
@@ -0,0 +1,66 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"io"
+	"regexp"
+)
+
+// SourceFunc returns the source of a line, e.g. a pod name or a PID, and the
+// line without the part identifying the source.
+//
+// It returns false when the line has no source.
+type SourceFunc func(line string) (source, rest string, ok bool)
+
+// RegexpSource returns a SourceFunc where the source is the first group of
+// re and the match is removed from the line, e.g. `^\[([^\]]+)\] ` for
+// "[pod-1] goroutine 1 [running]:".
+func RegexpSource(re *regexp.Regexp) SourceFunc {
+	return func(line string) (string, string, bool) {
+		m := re.FindStringSubmatchIndex(line)
+		if m == nil || len(m) < 4 || m[2] < 0 {
+			return "", line, false
+		}
+		return line[m[2]:m[3]], line[:m[0]] + line[m[1]:], true
+	}
+}
+
+// Stream is the lines of one source.
+type Stream struct {
+	Source string
+	Data   []byte
+}
+
+// Demux splits the interleaved lines of multiple processes writing to the
+// same log, e.g. the replicas of a service, so the dump of each can be
+// parsed separately.
+//
+// A line without a source is attributed to the source of the previous line.
+// The lines before the first line with a source are dropped. The streams are
+// in the order of the first line of each source.
+func Demux(r io.Reader, source SourceFunc) ([]Stream, error) {
+	scanner := newScanner(r)
+	var out []Stream
+	index := map[string]int{}
+	current := -1
+	for scanner.Scan() {
+		line := scanner.Text()
+		if src, rest, ok := source(line); ok {
+			i, ok := index[src]
+			if !ok {
+				i = len(out)
+				index[src] = i
+				out = append(out, Stream{Source: src})
+			}
+			current = i
+			line = rest
+		}
+		if current != -1 {
+			out[current].Data = append(out[current].Data, line...)
+		}
+	}
+	return out, scanner.Err()
+}
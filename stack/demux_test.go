@@ -0,0 +1,48 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestDemux(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"unrelated",
+		"[pod-1] panic: one",
+		"[pod-2] panic: two",
+		"[pod-1] ",
+		"[pod-2] ",
+		"[pod-1] goroutine 1 [running]:",
+		"[pod-2] goroutine 7 [running]:",
+		"[pod-2] main.main()",
+		"[pod-1] main.main()",
+		"[pod-1] 	/gopath/src/github.com/foo/bar/main.go:12 +0x1d",
+		"[pod-2] 	/gopath/src/github.com/foo/bar/main.go:20 +0x1d",
+		"exit status 2",
+		"",
+	}
+	streams, err := Demux(bytes.NewBufferString(strings.Join(data, "\n")), RegexpSource(regexp.MustCompile(`^\[([^\]]+)\] `)))
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 2, len(streams))
+	ut.AssertEqual(t, "pod-1", streams[0].Source)
+	ut.AssertEqual(t, "pod-2", streams[1].Source)
+	// The last line without a prefix goes to pod-2.
+	expected := "panic: two\n\ngoroutine 7 [running]:\nmain.main()\n\t/gopath/src/github.com/foo/bar/main.go:20 +0x1d\nexit status 2\n"
+	ut.AssertEqual(t, expected, string(streams[1].Data))
+
+	s, err := ParseSnapshot(bytes.NewReader(streams[0].Data), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "one", s.Reason.Value)
+	ut.AssertEqual(t, 1, s.Goroutines[0].ID)
+	ut.AssertEqual(t, 12, s.Goroutines[0].Stack.Calls[0].Line)
+}
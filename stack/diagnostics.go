@@ -0,0 +1,135 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Diagnostic severities, as defined by the Language Server Protocol.
+const (
+	DiagnosticError       = 1
+	DiagnosticWarning     = 2
+	DiagnosticInformation = 3
+	DiagnosticHint        = 4
+)
+
+// DiagnosticPosition is a zero based position in a source file.
+type DiagnosticPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// DiagnosticRange is a range in a source file; End is exclusive.
+type DiagnosticRange struct {
+	Start DiagnosticPosition `json:"start"`
+	End   DiagnosticPosition `json:"end"`
+}
+
+// Diagnostic is a message attached to a source line.
+type Diagnostic struct {
+	Range    DiagnosticRange `json:"range"`
+	Severity int             `json:"severity"`
+	Source   string          `json:"source"`
+	Message  string          `json:"message"`
+}
+
+// FileDiagnostics are the diagnostics of one source file.
+//
+// It has the shape of the Language Server Protocol
+// textDocument/publishDiagnostics parameters so it can be fed to editors,
+// e.g. VS Code, as is once encoded in JSON.
+type FileDiagnostics struct {
+	URI         string       `json:"uri"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// Diagnostics returns the diagnostics for the source lines referenced by the
+// buckets, grouped per file and sorted by URI.
+//
+// Only calls outside the standard library with a known source are reported.
+// For the bucket with the first goroutine, normally the one that crashed, the
+// top call is an error and every caller is reported as information. For the
+// other buckets, only the top call is reported as information.
+func Diagnostics(buckets Buckets) []FileDiagnostics {
+	files := map[string][]Diagnostic{}
+	sourceLines(buckets, func(c *Call, severity int, msg string) {
+		d := Diagnostic{
+			Range: DiagnosticRange{
+				Start: DiagnosticPosition{Line: c.Line - 1},
+				End:   DiagnosticPosition{Line: c.Line},
+			},
+			Severity: severity,
+			Source:   "panicparse",
+			Message:  msg,
+		}
+		uri := fileURI(c.SourcePath)
+		files[uri] = append(files[uri], d)
+	})
+	uris := make([]string, 0, len(files))
+	for uri := range files {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+	out := make([]FileDiagnostics, 0, len(files))
+	for _, uri := range uris {
+		out = append(out, FileDiagnostics{URI: uri, Diagnostics: files[uri]})
+	}
+	return out
+}
+
+// Quickfix returns the same source lines as Diagnostics in the
+// "file:line: message" format understood by Vim's quickfix list and Emacs'
+// compilation mode, in bucket order.
+func Quickfix(buckets Buckets) string {
+	out := ""
+	sourceLines(buckets, func(c *Call, severity int, msg string) {
+		out += fmt.Sprintf("%s:%d: %s\n", c.SourcePath, c.Line, msg)
+	})
+	return out
+}
+
+// Private stuff.
+
+// sourceLines calls f for each source line to report; see Diagnostics.
+func sourceLines(buckets Buckets, f func(c *Call, severity int, msg string)) {
+	for i := range buckets {
+		b := &buckets[i]
+		first := b.First()
+		top := true
+		for j := range b.Stack.Calls {
+			c := &b.Stack.Calls[j]
+			if !c.hasSource() {
+				continue
+			}
+			switch {
+			case first && top:
+				f(c, DiagnosticError, fmt.Sprintf("goroutine %d %s in %s", b.Routines[0].ID, b.State, c.Func.PkgDotName()))
+			case first:
+				f(c, DiagnosticInformation, fmt.Sprintf("goroutine %d %s, called from %s", b.Routines[0].ID, b.State, c.Func.PkgDotName()))
+			default:
+				f(c, DiagnosticInformation, fmt.Sprintf("%d goroutines %s in %s", len(b.Routines), b.State, c.Func.PkgDotName()))
+			}
+			if !first {
+				break
+			}
+			top = false
+		}
+	}
+}
+
+// fileURI returns the file:// URI of a source path, percent-encoded.
+func fileURI(path string) string {
+	path = strings.Replace(path, "\\", "/", -1)
+	if !strings.HasPrefix(path, "/") {
+		// Windows drive letter.
+		path = "/" + path
+	}
+	u := url.URL{Scheme: "file", Path: path}
+	return u.String()
+}
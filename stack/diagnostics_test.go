@@ -0,0 +1,116 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestDiagnostics(t *testing.T) {
+	t.Parallel()
+	buckets := Buckets{
+		{
+			Signature: Signature{
+				State: "running",
+				Stack: Stack{
+					Calls: []Call{
+						{SourcePath: goroot + "/src/reflect/value.go", Line: 2125, Func: Function{"reflect.Value.assignTo"}},
+						{SourcePath: "/src/foo/foo.go", Line: 10, Func: Function{"github.com/foo.Bar"}},
+						{SourcePath: "/src/main.go", Line: 20, Func: Function{"main.main"}},
+					},
+				},
+			},
+			Routines: []Goroutine{{ID: 1, First: true}},
+		},
+		{
+			Signature: Signature{
+				State: "chan receive",
+				Stack: Stack{
+					Calls: []Call{
+						{SourcePath: "/src/main.go", Line: 30, Func: Function{"main.worker"}},
+						{SourcePath: "/src/main.go", Line: 40, Func: Function{"main.main.func1"}},
+					},
+				},
+			},
+			Routines: []Goroutine{{ID: 2}, {ID: 3}},
+		},
+	}
+	expected := []FileDiagnostics{
+		{
+			URI: "file:///src/foo/foo.go",
+			Diagnostics: []Diagnostic{
+				{
+					Range:    DiagnosticRange{Start: DiagnosticPosition{Line: 9}, End: DiagnosticPosition{Line: 10}},
+					Severity: DiagnosticError,
+					Source:   "panicparse",
+					Message:  "goroutine 1 running in foo.Bar",
+				},
+			},
+		},
+		{
+			URI: "file:///src/main.go",
+			Diagnostics: []Diagnostic{
+				{
+					Range:    DiagnosticRange{Start: DiagnosticPosition{Line: 19}, End: DiagnosticPosition{Line: 20}},
+					Severity: DiagnosticInformation,
+					Source:   "panicparse",
+					Message:  "goroutine 1 running, called from main.main",
+				},
+				{
+					Range:    DiagnosticRange{Start: DiagnosticPosition{Line: 29}, End: DiagnosticPosition{Line: 30}},
+					Severity: DiagnosticInformation,
+					Source:   "panicparse",
+					Message:  "2 goroutines chan receive in main.worker",
+				},
+			},
+		},
+	}
+	ut.AssertEqual(t, expected, Diagnostics(buckets))
+}
+
+func TestQuickfix(t *testing.T) {
+	t.Parallel()
+	buckets := Buckets{
+		{
+			Signature: Signature{
+				State: "running",
+				Stack: Stack{
+					Calls: []Call{
+						{SourcePath: "/src/foo/foo.go", Line: 10, Func: Function{"github.com/foo.Bar"}},
+						{SourcePath: "/src/main.go", Line: 20, Func: Function{"main.main"}},
+					},
+				},
+			},
+			Routines: []Goroutine{{ID: 1, First: true}},
+		},
+		{
+			Signature: Signature{
+				State: "chan receive",
+				Stack: Stack{
+					Calls: []Call{
+						{SourcePath: "??", Func: Function{"runtime.cgocall"}},
+						{SourcePath: "/src/main.go", Line: 30, Func: Function{"main.worker"}},
+						{SourcePath: "/src/main.go", Line: 40, Func: Function{"main.main.func1"}},
+					},
+				},
+			},
+			Routines: []Goroutine{{ID: 2}, {ID: 3}},
+		},
+	}
+	expected := "/src/foo/foo.go:10: goroutine 1 running in foo.Bar\n" +
+		"/src/main.go:20: goroutine 1 running, called from main.main\n" +
+		"/src/main.go:30: 2 goroutines chan receive in main.worker\n"
+	ut.AssertEqual(t, expected, Quickfix(buckets))
+}
+
+func TestFileURI(t *testing.T) {
+	t.Parallel()
+	ut.AssertEqual(t, "file:///src/main.go", fileURI("/src/main.go"))
+	ut.AssertEqual(t, "file:///c:/go/src/main.go", fileURI("c:/go/src/main.go"))
+	ut.AssertEqual(t, "file:///c:/Users/John%20Doe/src/main.go", fileURI("c:\\Users\\John Doe\\src\\main.go"))
+	ut.AssertEqual(t, "file:///src/a%23b/100%25.go", fileURI("/src/a#b/100%.go"))
+}
@@ -0,0 +1,116 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import "sort"
+
+// BucketPair is a bucket found in both dumps.
+type BucketPair struct {
+	Old Bucket
+	New Bucket
+}
+
+// Delta returns the change in goroutine count between the two dumps.
+func (b BucketPair) Delta() int {
+	return len(b.New.Routines) - len(b.Old.Routines)
+}
+
+// BucketsDiff is the difference between two sets of buckets, normally
+// generated from two dumps of the same process taken at different times.
+type BucketsDiff struct {
+	Matched []BucketPair // Matched are the buckets present in both dumps.
+	Removed Buckets      // Removed are the buckets only present in the old dump.
+	Added   Buckets      // Added are the buckets only present in the new dump.
+}
+
+// Diff matches the buckets of two dumps per the criteria.
+//
+// It must be the same criteria that was used to bucketize both dumps,
+// otherwise a bucket could match more than one bucket on the other side. The
+// order of each input is preserved; Matched follows the order of newer.
+func (c *Criteria) Diff(old, newer Buckets) *BucketsDiff {
+	out := &BucketsDiff{}
+	used := make([]bool, len(old))
+	for _, n := range newer {
+		found := false
+		for i := range old {
+			if !used[i] && c.Similar(&old[i].Signature, &n.Signature) {
+				used[i] = true
+				found = true
+				out.Matched = append(out.Matched, BucketPair{Old: old[i], New: n})
+				break
+			}
+		}
+		if !found {
+			out.Added = append(out.Added, n)
+		}
+	}
+	for i := range old {
+		if !used[i] {
+			out.Removed = append(out.Removed, old[i])
+		}
+	}
+	return out
+}
+
+// Diff matches the buckets of two dumps that were bucketized at the similar
+// level.
+//
+// Pointer values are process specific so similar should be at least
+// AnyPointer when the dumps come from different processes.
+func Diff(old, newer Buckets, similar Similarity) *BucketsDiff {
+	c := Criteria{Similarity: similar}
+	return c.Diff(old, newer)
+}
+
+// Changed returns the matched buckets whose goroutine count changed, the
+// largest change first, e.g. the goroutines piling up in a hang.
+func (d *BucketsDiff) Changed() []BucketPair {
+	var out []BucketPair
+	for _, m := range d.Matched {
+		if m.Delta() != 0 {
+			out = append(out, m)
+		}
+	}
+	sort.Stable(bucketPairsByDelta(out))
+	return out
+}
+
+// Buckets returns all the buckets referenced by the diff, using the new side
+// for matched buckets.
+//
+// It is useful to call CalcLengths.
+func (d *BucketsDiff) Buckets() Buckets {
+	out := make(Buckets, 0, len(d.Matched)+len(d.Removed)+len(d.Added))
+	for _, m := range d.Matched {
+		out = append(out, m.New)
+	}
+	out = append(out, d.Removed...)
+	return append(out, d.Added...)
+}
+
+// Private stuff.
+
+// bucketPairsByDelta sorts by decreasing absolute change.
+type bucketPairsByDelta []BucketPair
+
+func (b bucketPairsByDelta) Len() int {
+	return len(b)
+}
+
+func (b bucketPairsByDelta) Less(i, j int) bool {
+	return abs(b[i].Delta()) > abs(b[j].Delta())
+}
+
+func (b bucketPairsByDelta) Swap(i, j int) {
+	b[j], b[i] = b[i], b[j]
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
@@ -0,0 +1,145 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+	old := Buckets{
+		{
+			Signature: Signature{
+				State: "chan receive",
+				Stack: Stack{Calls: []Call{{SourcePath: "/src/main.go", Line: 10, Func: Function{"main.worker"}}}},
+			},
+			Routines: []Goroutine{{ID: 1}, {ID: 2}},
+		},
+		{
+			Signature: Signature{
+				State: "running",
+				Stack: Stack{Calls: []Call{{SourcePath: "/src/main.go", Line: 20, Func: Function{"main.gone"}}}},
+			},
+			Routines: []Goroutine{{ID: 3}},
+		},
+		{
+			Signature: Signature{
+				State: "IO wait",
+				Stack: Stack{Calls: []Call{{SourcePath: "/src/main.go", Line: 30, Func: Function{"main.read"}}}},
+			},
+			Routines: []Goroutine{{ID: 4}, {ID: 5}, {ID: 6}},
+		},
+	}
+	newer := Buckets{
+		{
+			Signature: Signature{
+				State: "IO wait",
+				Stack: Stack{Calls: []Call{{SourcePath: "/src/main.go", Line: 30, Func: Function{"main.read"}}}},
+			},
+			Routines: []Goroutine{{ID: 4}},
+		},
+		{
+			Signature: Signature{
+				State: "chan receive",
+				Stack: Stack{Calls: []Call{{SourcePath: "/src/main.go", Line: 10, Func: Function{"main.worker"}}}},
+			},
+			Routines: []Goroutine{{ID: 1}, {ID: 2}, {ID: 7}, {ID: 8}},
+		},
+		{
+			Signature: Signature{
+				State: "semacquire",
+				Stack: Stack{Calls: []Call{{SourcePath: "/src/main.go", Line: 40, Func: Function{"main.lock"}}}},
+			},
+			Routines: []Goroutine{{ID: 9}},
+		},
+	}
+	d := Diff(old, newer, AnyPointer)
+	expected := &BucketsDiff{
+		Matched: []BucketPair{
+			{Old: old[2], New: newer[0]},
+			{Old: old[0], New: newer[1]},
+		},
+		Removed: Buckets{old[1]},
+		Added:   Buckets{newer[2]},
+	}
+	ut.AssertEqual(t, expected, d)
+	ut.AssertEqual(t, -2, d.Matched[0].Delta())
+	ut.AssertEqual(t, 2, d.Matched[1].Delta())
+	ut.AssertEqual(t, Buckets{newer[0], newer[1], old[1], newer[2]}, d.Buckets())
+	ut.AssertEqual(t, d.Matched, d.Changed())
+
+	// Only the changed counts are returned, the largest change first.
+	newer[1].Routines = newer[1].Routines[:2]
+	newer[0].Routines = nil
+	d = Diff(old, newer, AnyPointer)
+	ut.AssertEqual(t, []BucketPair{{Old: old[2], New: newer[0]}}, d.Changed())
+	ut.AssertEqual(t, -3, d.Changed()[0].Delta())
+}
+
+func TestDiffArgs(t *testing.T) {
+	t.Parallel()
+	// Pointer values are process specific.
+	old := Bucket{
+		Signature: Signature{
+			State: "running",
+			Stack: Stack{
+				Calls: []Call{
+					{
+						SourcePath: "/src/main.go",
+						Line:       10,
+						Func:       Function{"main.worker"},
+						Args:       Args{Values: []Arg{{Value: 0xc208012000, Name: "#1"}}},
+					},
+				},
+			},
+		},
+		Routines: []Goroutine{{ID: 1}},
+	}
+	newer := Bucket{
+		Signature: Signature{
+			State: "running",
+			Stack: Stack{
+				Calls: []Call{
+					{
+						SourcePath: "/src/main.go",
+						Line:       10,
+						Func:       Function{"main.worker"},
+						Args:       Args{Values: []Arg{{Value: 0xc208099000, Name: "#4"}}},
+					},
+				},
+			},
+		},
+		Routines: []Goroutine{{ID: 1}},
+	}
+	d := Diff(Buckets{old}, Buckets{newer}, AnyPointer)
+	ut.AssertEqual(t, 1, len(d.Matched))
+	ut.AssertEqual(t, 0, len(d.Removed))
+	ut.AssertEqual(t, 0, len(d.Added))
+}
+
+func TestDiffCriteria(t *testing.T) {
+	t.Parallel()
+	calls := []Call{{SourcePath: "/src/main.go", Line: 10, Func: Function{"main.worker"}}}
+	old := Buckets{
+		{
+			Signature: Signature{State: "chan receive", Stack: Stack{Calls: calls}, Locked: true},
+			Routines:  []Goroutine{{ID: 1}},
+		},
+	}
+	newer := Buckets{
+		{
+			Signature: Signature{State: "chan receive", Stack: Stack{Calls: calls}},
+			Routines:  []Goroutine{{ID: 1}},
+		},
+	}
+	// Locked is ignored at AnyPointer.
+	ut.AssertEqual(t, 1, len(Diff(old, newer, AnyPointer).Matched))
+	c := Criteria{Similarity: AnyPointer, Locked: true}
+	expected := &BucketsDiff{Removed: old, Added: newer}
+	ut.AssertEqual(t, expected, c.Diff(old, newer))
+}
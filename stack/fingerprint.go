@@ -0,0 +1,47 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Fingerprint returns a stable hash of the signature, to deduplicate crashes
+// across processes, restarts and machines, e.g. in an external issue tracker.
+//
+// It is computed from the state, the function, source file name and line of
+// each call and of the creator, so it ignores the arguments, the goroutine
+// IDs, the sleep times and where the sources were on the machine that built
+// the executable. The PC offsets are ignored too since they change with each
+// build. The format is stable across versions of this package.
+func (s *Signature) Fingerprint() string {
+	h := sha256.New()
+	// The version allows to change the hashed data while keeping the old
+	// fingerprints distinct.
+	_, _ = io.WriteString(h, "v1\n"+s.State+"\n")
+	for i := range s.Stack.Calls {
+		writeFingerprint(h, &s.Stack.Calls[i])
+	}
+	// The frames elided from the middle of the stack are hashed like the
+	// ones cut at the bottom so the fingerprints stay the same.
+	if s.Stack.Elided || s.Stack.MiddleElided != 0 {
+		_, _ = io.WriteString(h, "...\n")
+	}
+	if s.CreatedBy.Func.Raw != "" {
+		_, _ = io.WriteString(h, "created by\n")
+		writeFingerprint(h, &s.CreatedBy)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)[:16])
+}
+
+// Private stuff.
+
+// writeFingerprint writes the parts of the call hashed by Fingerprint.
+func writeFingerprint(w io.Writer, c *Call) {
+	_, _ = io.WriteString(w, c.Func.Raw+" "+c.SourceName()+":"+strconv.Itoa(c.Line)+"\n")
+}
@@ -0,0 +1,44 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestSignatureFingerprint(t *testing.T) {
+	t.Parallel()
+	s := Signature{
+		State:    "chan receive",
+		SleepMin: 5,
+		SleepMax: 5,
+		Stack: Stack{
+			Calls: []Call{
+				{SourcePath: "/home/a/go/src/app/main.go", Line: 12, Offset: 0x17, Func: Function{"main.f"}, Args: Args{Values: []Arg{{Value: 0xc000012345}}}},
+			},
+		},
+		CreatedBy:   Call{SourcePath: "/home/a/go/src/app/main.go", Line: 20, Func: Function{"main.main"}},
+		CreatedByID: 1,
+	}
+	// Hardcoded so a change of the format is noticed.
+	ut.AssertEqual(t, "d14d644566862709f5c2818b8ce0cc25", s.Fingerprint())
+
+	// Another process on another machine.
+	r := s
+	r.SleepMin, r.SleepMax = 30, 60
+	r.CreatedByID = 42
+	r.Stack.Calls = []Call{
+		{SourcePath: "/build/app/main.go", Line: 12, Offset: 0x20, Func: Function{"main.f"}, Args: Args{Values: []Arg{{Value: 0xc000099999}}}},
+	}
+	ut.AssertEqual(t, s.Fingerprint(), r.Fingerprint())
+
+	r.Stack.Calls[0].Line = 13
+	ut.AssertEqual(t, false, s.Fingerprint() == r.Fingerprint())
+	r = s
+	r.State = "select"
+	ut.AssertEqual(t, false, s.Fingerprint() == r.Fingerprint())
+}
@@ -0,0 +1,147 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"time"
+)
+
+// Follower parses the dumps of a growing input incrementally, e.g. a log file
+// followed like with "tail -f", without parsing it again from the start.
+//
+// The input is fed with Write as it is read, in chunks of any size. Each dump
+// is passed to the callback as a Snapshot once complete, that is when a line
+// that is not part of it is written, when the process exit status is printed,
+// or on Flush. The lines that are not part of a dump are streamed to out.
+type Follower struct {
+	p   Parser
+	out io.Writer
+	fn  func(*Snapshot) error
+	// partial is the last line written, until its '\n' is written.
+	partial []byte
+	// dump is the dump being buffered, nil outside of one.
+	dump []byte
+	b    dumpBoundary
+	// lines is the number of lines before the dump being buffered.
+	lines int
+	// last is the last timestamp seen outside of a dump.
+	last time.Time
+}
+
+// NewFollower returns a Follower calling fn with each dump found in the data
+// written to it.
+//
+// The StartLine and EndLine of the snapshots are numbered from the start of
+// the data written. When the dump has no timestamp, Time is the one of the
+// last log line before it.
+func NewFollower(out io.Writer, fn func(*Snapshot) error) *Follower {
+	return (&Parser{}).NewFollower(out, fn)
+}
+
+// NewFollower is NewFollower with the options of p.
+func (p *Parser) NewFollower(out io.Writer, fn func(*Snapshot) error) *Follower {
+	return &Follower{p: *p, out: out, fn: fn}
+}
+
+// Write implements io.Writer.
+//
+// The error returned by the callback is returned. A dump that failed to parse
+// is passed to the callback with its goroutines marked Incomplete, then the
+// parse error is returned. The Follower is still usable after an error.
+func (f *Follower) Write(p []byte) (int, error) {
+	f.partial = append(f.partial, p...)
+	var err error
+	for err == nil {
+		i := bytes.IndexByte(f.partial, '\n')
+		if i == -1 {
+			if len(f.partial) < MaxLineSize {
+				break
+			}
+			i = len(f.partial) - 1
+		}
+		line := string(f.partial[:i+1])
+		f.partial = f.partial[i+1:]
+		err = f.line(line)
+	}
+	if len(f.partial) == 0 {
+		f.partial = nil
+	}
+	return len(p), err
+}
+
+// Flush passes the dump being buffered, if any, to the callback.
+//
+// The end of a dump is only detected on the next line, so call it when no
+// data was written for a while, e.g. after the process died.
+func (f *Follower) Flush() error {
+	if f.dump == nil {
+		return nil
+	}
+	f.b.end()
+	return f.emit()
+}
+
+// Close processes the last line even if it has no '\n', then calls Flush.
+func (f *Follower) Close() error {
+	if len(f.partial) != 0 {
+		line := string(f.partial)
+		f.partial = nil
+		if err := f.line(line); err != nil {
+			return err
+		}
+	}
+	return f.Flush()
+}
+
+// Private stuff.
+
+// line processes a line, raw as written.
+func (f *Follower) line(raw string) error {
+	line := f.p.clean(raw)
+	ended, started := f.b.next(line)
+	if ended {
+		if err := f.emit(); err != nil {
+			return err
+		}
+	}
+	if started || (f.dump != nil && !ended) {
+		f.dump = append(f.dump, raw...)
+		if strings.HasPrefix(line, "exit status ") {
+			f.b.end()
+			return f.emit()
+		}
+		return nil
+	}
+	if t, ok := parseTimestamp(line); ok {
+		f.last = t
+	}
+	f.lines++
+	_, err := io.WriteString(f.out, raw)
+	return err
+}
+
+// emit parses the dump being buffered and passes it to the callback.
+func (f *Follower) emit() error {
+	dump := f.dump
+	f.dump = nil
+	s, err := f.p.ParseSnapshot(bytes.NewReader(dump), f.out)
+	if s.StartLine != 0 {
+		s.StartLine += f.lines
+	}
+	if s.EndLine != 0 {
+		s.EndLine += f.lines
+	}
+	f.lines += bytes.Count(dump, []byte{'\n'})
+	if s.Time.IsZero() {
+		s.Time = f.last
+	}
+	if err2 := f.fn(s); err2 != nil {
+		return err2
+	}
+	return err
+}
@@ -0,0 +1,86 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maruel/ut"
+)
+
+func TestFollower(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"2024/05/01 12:00:00 starting",
+		"panic: boom",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"	/home/user/src/app/main.go:12 +0x17",
+		"",
+		"2024/05/01 12:01:00 restarted",
+		"goroutine 1 [chan receive]:",
+		"main.main()",
+		"	/home/user/src/app/main.go:20 +0x17",
+		"",
+		"goroutine 2 [running]:",
+		"main.f()",
+		"	/home/user/src/app/main.go:30 +0x17",
+		"",
+	}
+	in := strings.Join(data, "\n")
+	var snapshots []*Snapshot
+	extra := &bytes.Buffer{}
+	f := NewFollower(extra, func(s *Snapshot) error {
+		snapshots = append(snapshots, s)
+		return nil
+	})
+	// Feed the input in small chunks, like a growing file.
+	i := strings.Index(in, "2024/05/01 12:01:00")
+	for j := 0; j < i; j += 7 {
+		end := j + 7
+		if end > i {
+			end = i
+		}
+		n, err := f.Write([]byte(in[j:end]))
+		ut.AssertEqual(t, nil, err)
+		ut.AssertEqual(t, end-j, n)
+	}
+	// The end of the first dump is not known yet.
+	ut.AssertEqual(t, 0, len(snapshots))
+	_, err := f.Write([]byte(in[i:]))
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 1, len(snapshots))
+	ut.AssertEqual(t, "boom", snapshots[0].Panic)
+	ut.AssertEqual(t, 1, len(snapshots[0].Goroutines))
+	ut.AssertEqual(t, 2, snapshots[0].StartLine)
+	ut.AssertEqual(t, true, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC).Equal(snapshots[0].Time))
+
+	ut.AssertEqual(t, nil, f.Flush())
+	ut.AssertEqual(t, 2, len(snapshots))
+	ut.AssertEqual(t, 2, len(snapshots[1].Goroutines))
+	ut.AssertEqual(t, 9, snapshots[1].StartLine)
+	ut.AssertEqual(t, nil, f.Close())
+	ut.AssertEqual(t, 2, len(snapshots))
+	ut.AssertEqual(t, "2024/05/01 12:00:00 starting\npanic: boom\n\n2024/05/01 12:01:00 restarted\n", extra.String())
+}
+
+func TestFollowerExitStatus(t *testing.T) {
+	t.Parallel()
+	data := "panic: boom\n\ngoroutine 1 [running]:\nmain.main()\n\t/home/user/src/app/main.go:12 +0x17\nexit status 2\n"
+	n := 0
+	f := NewFollower(&bytes.Buffer{}, func(s *Snapshot) error {
+		n++
+		return nil
+	})
+	_, err := f.Write([]byte(data))
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 1, n)
+	ut.AssertEqual(t, nil, f.Close())
+	ut.AssertEqual(t, 1, n)
+}
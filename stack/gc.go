@@ -0,0 +1,60 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+// TrimGCAssist removes the runtime calls at the top of the goroutines that
+// were captured while helping the garbage collector and sets GCAssist.
+//
+// An allocation or a pointer write may have to assist the GC marking or flush
+// the write barrier buffer. The goroutine is then captured in the runtime
+// instead of in the user code that triggered the work, creating a noise
+// signature per allocation site. Trimming these calls groups the goroutines
+// doing GC work by the user code that triggered it, in buckets kept apart
+// from the other goroutines in the same user code.
+//
+// Goroutines that only have runtime calls are left alone.
+func TrimGCAssist(goroutines []Goroutine) {
+	for i := range goroutines {
+		g := &goroutines[i]
+		assist := false
+		j := 0
+		for ; j < len(g.Stack.Calls); j++ {
+			f := &g.Stack.Calls[j].Func
+			if f.PkgName() != "runtime" {
+				break
+			}
+			if gcAssistFuncs[f.Name()] {
+				assist = true
+			}
+		}
+		if assist && j != len(g.Stack.Calls) {
+			g.Stack.Calls = g.Stack.Calls[j:]
+			g.GCAssist = true
+		}
+	}
+}
+
+// Private stuff.
+
+// gcAssistFuncs are the runtime functions doing GC work on behalf of the
+// goroutine that allocates or writes a pointer.
+var gcAssistFuncs = map[string]bool{
+	"bulkBarrierPreWrite": true,
+	"gcAssistAlloc":       true,
+	"gcAssistAlloc1":      true,
+	"gcDrainN":            true,
+	"gcParkAssist":        true,
+	"gcWriteBarrier":      true,
+	"gcWriteBarrier1":     true,
+	"gcWriteBarrier2":     true,
+	"gcWriteBarrier3":     true,
+	"gcWriteBarrier4":     true,
+	"gcWriteBarrier5":     true,
+	"gcWriteBarrier6":     true,
+	"gcWriteBarrier7":     true,
+	"gcWriteBarrier8":     true,
+	"wbBufFlush":          true,
+	"wbBufFlush1":         true,
+}
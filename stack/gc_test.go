@@ -0,0 +1,53 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestTrimGCAssist(t *testing.T) {
+	t.Parallel()
+	user := []Call{
+		{SourcePath: "/src/main.go", Line: 72, Func: Function{"main.alloc"}},
+		{SourcePath: "/src/main.go", Line: 80, Func: Function{"main.main"}},
+	}
+	assist := append([]Call{
+		{SourcePath: goroot + "/src/runtime/proc.go", Line: 363, Func: Function{"runtime.gopark"}},
+		{SourcePath: goroot + "/src/runtime/mgcmark.go", Line: 662, Func: Function{"runtime.gcParkAssist"}},
+		{SourcePath: goroot + "/src/runtime/mgcmark.go", Line: 501, Func: Function{"runtime.gcAssistAlloc"}},
+		{SourcePath: goroot + "/src/runtime/malloc.go", Line: 1014, Func: Function{"runtime.mallocgc"}},
+	}, user...)
+	parked := []Call{
+		{SourcePath: goroot + "/src/runtime/proc.go", Line: 363, Func: Function{"runtime.gopark"}},
+		{SourcePath: goroot + "/src/runtime/mgcmark.go", Line: 662, Func: Function{"runtime.gcParkAssist"}},
+	}
+	goroutines := []Goroutine{
+		{Signature: Signature{State: "running", Stack: Stack{Calls: user}}, ID: 1},
+		{Signature: Signature{State: "GC assist wait", Stack: Stack{Calls: assist}}, ID: 2},
+		{Signature: Signature{State: "GC assist wait", Stack: Stack{Calls: parked}}, ID: 3},
+	}
+	TrimGCAssist(goroutines)
+	ut.AssertEqual(t, user, goroutines[1].Stack.Calls)
+	ut.AssertEqual(t, true, goroutines[1].GCAssist)
+	// Nothing to attribute the work to.
+	ut.AssertEqual(t, parked, goroutines[2].Stack.Calls)
+	ut.AssertEqual(t, false, goroutines[2].GCAssist)
+
+	// GCAssist is part of the bucket key.
+	buckets := SortBuckets(Bucketize(goroutines, AnyPointer))
+	ut.AssertEqual(t, 3, len(buckets))
+	ut.AssertEqual(t, true, buckets[0].GCAssist)
+	ut.AssertEqual(t, "GC assist wait", buckets[0].State)
+	ut.AssertEqual(t, []Goroutine{goroutines[1]}, buckets[0].Routines)
+	ut.AssertEqual(t, false, buckets[1].GCAssist)
+	ut.AssertEqual(t, []Goroutine{goroutines[0]}, buckets[1].Routines)
+	a := goroutines[1].Signature
+	b := a
+	b.GCAssist = false
+	ut.AssertEqual(t, false, a.Similar(&b, AnyValue))
+}
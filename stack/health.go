@@ -0,0 +1,163 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import "strings"
+
+// Health is how much a bucket deserves attention.
+type Health int
+
+// Health classes.
+const (
+	// HealthNormal is the program's own code, running or blocked for a short
+	// time.
+	HealthNormal Health = iota
+	// HealthSystem is the runtime and standard library background goroutines,
+	// e.g. the GC workers, the finalizer or the signal handler.
+	HealthSystem
+	// HealthIdle is goroutines waiting for work by design, e.g. HTTP
+	// keep-alive connections or timers. They are reported but are not noise,
+	// as the line between idle and stuck is thin.
+	HealthIdle
+	// HealthSuspect is the program's own code blocked for at least
+	// SuspectMinutes.
+	HealthSuspect
+)
+
+func (h Health) String() string {
+	switch h {
+	case HealthNormal:
+		return "normal"
+	case HealthSystem:
+		return "system"
+	case HealthIdle:
+		return "idle"
+	case HealthSuspect:
+		return "suspect"
+	default:
+		return "unknown"
+	}
+}
+
+// Noise returns true for the classes that are rarely relevant to an
+// investigation and can be hidden by default.
+func (h Health) Noise() bool {
+	return h == HealthSystem
+}
+
+// SuspectMinutes is how long the program's own code must have been blocked
+// for its bucket to be HealthSuspect.
+var SuspectMinutes = 10
+
+// IdleFuncs are the functions of goroutines that are idle when blocked, e.g.
+// waiting for the next request. A goroutine blocked in any of them, i.e. with
+// it in the standard library calls at the top of its stack, is HealthIdle.
+// Append to it for the frameworks used by the program.
+var IdleFuncs = []string{
+	"database/sql.(*DB).connectionCleaner",
+	"database/sql.(*DB).connectionOpener",
+	"net/http.(*conn).serve",
+	"net/http.(*connReader).backgroundRead",
+	"net/http.(*persistConn).readLoop",
+	"net/http.(*persistConn).writeLoop",
+	"net/http.(*Server).Serve",
+	"runtime.timerproc",
+	"time.Sleep",
+}
+
+// Health returns the class of the bucket.
+//
+// The bucket with a Crashed goroutine or the first goroutine is never noise.
+// Otherwise a bucket blocked in an IdleFuncs function is HealthIdle, one
+// entirely in the standard library, creator included, is HealthSystem.
+//
+// A goroutine blocked in the program's own code is never idle, even if it
+// was called by an IdleFuncs function, e.g. an HTTP handler stuck on a mutex
+// under net/http.(*conn).serve.
+func (b *Bucket) Health() Health {
+	if !b.Crashed() && !b.First() {
+		if b.Stack.idle() {
+			return HealthIdle
+		}
+		if b.isSystem() {
+			return HealthSystem
+		}
+	}
+	if b.SleepMax >= SuspectMinutes && !strings.HasPrefix(b.State, "running") && !strings.HasPrefix(b.State, "runnable") {
+		return HealthSuspect
+	}
+	return HealthNormal
+}
+
+// FilterNoise returns the buckets whose Health is not noise. The idle buckets
+// are kept.
+func FilterNoise(buckets Buckets) Buckets {
+	out := Buckets{}
+	for i := range buckets {
+		if !buckets[i].Health().Noise() {
+			out = append(out, buckets[i])
+		}
+	}
+	return out
+}
+
+// FilterStdlib returns the buckets with at least one call outside the
+// standard library and Criteria.FrameworkPrefixes, so only the program's own
+// code remains. The bucket with the first goroutine is always kept.
+func FilterStdlib(buckets Buckets) Buckets {
+	out := Buckets{}
+	for i := range buckets {
+		if buckets[i].First() || !buckets[i].Stack.stdlibOnly(true) {
+			out = append(out, buckets[i])
+		}
+	}
+	return out
+}
+
+// Private stuff.
+
+// stdlibOnly returns true if the stack has calls and they are all in the
+// standard library, or in Criteria.FrameworkPrefixes if framework is true.
+func (s *Stack) stdlibOnly(framework bool) bool {
+	if len(s.Calls) == 0 {
+		return false
+	}
+	for i := range s.Calls {
+		if !s.Calls[i].IsStdlib() && !(framework && s.Calls[i].IsFramework()) {
+			return false
+		}
+	}
+	return true
+}
+
+// idle returns true if the stack is blocked in an IdleFuncs function: one of
+// them is in the standard library calls at the top of the stack, before any
+// call of the program's own code.
+func (s *Stack) idle() bool {
+	for i := range s.Calls {
+		if !s.Calls[i].IsStdlib() {
+			return false
+		}
+		if isIdleFunc(s.Calls[i].Func.Raw) {
+			return true
+		}
+	}
+	return false
+}
+
+func isIdleFunc(raw string) bool {
+	for _, f := range IdleFuncs {
+		if raw == f {
+			return true
+		}
+	}
+	return false
+}
+
+// isSystem returns true if all the calls of the bucket and its creator are in
+// the standard library.
+func (b *Bucket) isSystem() bool {
+	return b.Stack.stdlibOnly(false) && (b.CreatedBy.Func.Raw == "" || b.CreatedBy.IsStdlib())
+}
@@ -0,0 +1,102 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestBucketHealth(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"panic: oh no",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"	/home/user/src/main.go:22 +0x40",
+		"",
+		"goroutine 2 [force gc (idle), 5 minutes]:",
+		"runtime.gopark(0x4a1e28, 0x5a2d40, 0x1411, 0x1)",
+		"	/goroot/src/runtime/proc.go:367 +0xd6",
+		"runtime.forcegchelper()",
+		"	/goroot/src/runtime/proc.go:301 +0xad",
+		"created by runtime.init.7",
+		"	/goroot/src/runtime/proc.go:289 +0x25",
+		"",
+		"goroutine 7 [IO wait, 30 minutes]:",
+		"internal/poll.runtime_pollWait(0x7f0c3c1c8f18, 0x72)",
+		"	/goroot/src/runtime/netpoll.go:234 +0x89",
+		"net/http.(*persistConn).readLoop(0xc0000c6000)",
+		"	/goroot/src/net/http/transport.go:2068 +0x12a",
+		"created by net/http.(*Transport).dialConn",
+		"	/goroot/src/net/http/transport.go:1747 +0x1e05",
+		"",
+		"goroutine 8 [chan receive, 30 minutes]:",
+		"main.worker()",
+		"	/home/user/src/main.go:10 +0x27",
+		"created by main.main",
+		"	/home/user/src/main.go:20 +0x35",
+		"",
+		"goroutine 9 [chan receive, 2 minutes]:",
+		"main.consume()",
+		"	/home/user/src/main.go:30 +0x27",
+		"created by main.main",
+		"	/home/user/src/main.go:21 +0x35",
+		"",
+		"goroutine 10 [IO wait]:",
+		"internal/poll.runtime_pollWait(0x7f0c3c1c8e30, 0x72)",
+		"	/goroot/src/runtime/netpoll.go:234 +0x89",
+		"net/http.(*http2clientConnReadLoop).run(0xc000153fa8)",
+		"	/goroot/src/net/http/h2_bundle.go:8658 +0x1e5",
+		"created by main.dial",
+		"	/home/user/src/main.go:50 +0x35",
+		"",
+		"goroutine 11 [semacquire, 42 minutes]:",
+		"sync.runtime_SemacquireMutex(0xc0000b4004, 0x0, 0x1)",
+		"	/goroot/src/runtime/sema.go:71 +0x25",
+		"sync.(*Mutex).lockSlow(0xc0000b4000)",
+		"	/goroot/src/sync/mutex.go:138 +0x165",
+		"sync.(*Mutex).Lock(...)",
+		"	/goroot/src/sync/mutex.go:81",
+		"main.handler(0x5a2d40, 0xc0000c6000, 0xc000120000)",
+		"	/home/user/src/main.go:60 +0x45",
+		"net/http.HandlerFunc.ServeHTTP(0x4a1e28, 0x5a2d40, 0xc0000c6000, 0xc000120000)",
+		"	/goroot/src/net/http/server.go:2047 +0x44",
+		"net/http.(*conn).serve(0xc0000a6000, 0x5a2d40, 0xc0000b2000)",
+		"	/goroot/src/net/http/server.go:1952 +0x87f",
+		"created by net/http.(*Server).Serve",
+		"	/goroot/src/net/http/server.go:3013 +0x39b",
+		"",
+	}
+	s, err := ParseSnapshot(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	buckets := SortBuckets(Bucketize(s.Goroutines, AnyPointer))
+	health := map[int]Health{}
+	for i := range buckets {
+		health[buckets[i].Routines[0].ID] = buckets[i].Health()
+	}
+	expected := map[int]Health{1: HealthNormal, 2: HealthSystem, 7: HealthIdle, 8: HealthSuspect, 9: HealthNormal, 10: HealthNormal, 11: HealthSuspect}
+	ut.AssertEqual(t, expected, health)
+	ut.AssertEqual(t, 6, len(FilterNoise(buckets)))
+	var ids []int
+	for _, b := range FilterStdlib(buckets) {
+		ids = append(ids, b.Routines[0].ID)
+	}
+	ut.AssertEqual(t, []int{1, 9, 8, 11}, ids)
+	for i := range buckets {
+		if buckets[i].Routines[0].ID == 7 {
+			ut.AssertEqual(t, "1: IO wait [30 minutes] [idle] [Created by http.(*Transport).dialConn @ transport.go:1747]\n", (&Palette{}).BucketHeader(&buckets[i], false, false))
+		}
+	}
+	ut.AssertEqual(t, "suspect", HealthSuspect.String())
+	ut.AssertEqual(t, false, HealthIdle.Noise())
+	ut.AssertEqual(t, true, HealthSystem.Noise())
+	ut.AssertEqual(t, false, HealthSuspect.Noise())
+}
@@ -0,0 +1,111 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"crypto/sha256"
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+)
+
+// HTML writes the buckets of a dump as a self contained HTML page.
+func HTML(w io.Writer, buckets Buckets, fullPath bool) error {
+	return bucketsTpl.Execute(w, &htmlBuckets{buckets, newHTMLFormatter(buckets, fullPath)})
+}
+
+// DiffHTML writes a diff of two dumps as a self contained HTML page.
+//
+// The buckets found in both dumps are listed first with the old and new
+// headers side by side and the count change highlighted, followed by the
+// buckets that disappeared and the ones that appeared.
+func DiffHTML(w io.Writer, d *BucketsDiff, fullPath bool) error {
+	return diffTpl.Execute(w, &htmlDiff{d, newHTMLFormatter(d.Buckets(), fullPath)})
+}
+
+// Private stuff.
+
+// htmlFormatter formats buckets as uncolored text for the templates.
+type htmlFormatter struct {
+	p        *Palette
+	fullPath bool
+	srcLen   int
+	pkgLen   int
+}
+
+func newHTMLFormatter(buckets Buckets, fullPath bool) *htmlFormatter {
+	srcLen, pkgLen := CalcLengths(buckets, fullPath)
+	return &htmlFormatter{&Palette{}, fullPath, srcLen, pkgLen}
+}
+
+// Header returns the uncolored bucket header without the count.
+func (h *htmlFormatter) Header(b Bucket) string {
+	return b.State + h.p.bucketExtra(&b, h.fullPath)
+}
+
+// Stack returns the uncolored stack lines.
+func (h *htmlFormatter) Stack(b Bucket) string {
+	return h.p.StackLines(&b.Signature, h.srcLen, h.pkgLen, h.fullPath)
+}
+
+// Origins returns the signatures folded into the bucket with exact arguments,
+// or nil if there is only one.
+func (h *htmlFormatter) Origins(b Bucket) Buckets {
+	if o := b.Origins(ExactLines); len(o) > 1 {
+		return o
+	}
+	return nil
+}
+
+// htmlBuckets is the data passed to bucketsTpl.
+type htmlBuckets struct {
+	Buckets Buckets
+	*htmlFormatter
+}
+
+// htmlDiff is the data passed to diffTpl.
+type htmlDiff struct {
+	*BucketsDiff
+	*htmlFormatter
+}
+
+// htmlAssets are the HTML templates. They are embedded so the executable
+// is self-contained.
+//
+//go:embed html/*.html
+var htmlAssets embed.FS
+
+var (
+	bucketsTpl = mustTemplate("buckets")
+	diffTpl    = mustTemplate("diff")
+)
+
+// AssetVersions returns the embedded assets with the first 12 hex digits of
+// their SHA-256 digest, to identify the assets a binary was built with.
+func AssetVersions() map[string]string {
+	entries, _ := htmlAssets.ReadDir("html")
+	out := make(map[string]string, len(entries))
+	for _, e := range entries {
+		name := "html/" + e.Name()
+		b, _ := htmlAssets.ReadFile(name)
+		out[name] = fmt.Sprintf("%x", sha256.Sum256(b))[:12]
+	}
+	return out
+}
+
+// mustTemplate returns the template html/<name>.html preceded by the style
+// sheet.
+func mustTemplate(name string) *template.Template {
+	style, err := htmlAssets.ReadFile("html/style.html")
+	if err != nil {
+		panic(err)
+	}
+	b, err := htmlAssets.ReadFile("html/" + name + ".html")
+	if err != nil {
+		panic(err)
+	}
+	return template.Must(template.New(name).Parse(string(style) + string(b)))
+}
@@ -0,0 +1,128 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestDiffHTML(t *testing.T) {
+	t.Parallel()
+	d := &BucketsDiff{
+		Matched: []BucketPair{
+			{
+				Old: Bucket{
+					Signature: Signature{
+						State:    "chan receive",
+						SleepMin: 2,
+						SleepMax: 2,
+						Stack:    Stack{Calls: []Call{{SourcePath: "/src/main.go", Line: 10, Func: Function{"main.worker"}}}},
+					},
+					Routines: []Goroutine{{ID: 1}},
+				},
+				New: Bucket{
+					Signature: Signature{
+						State:  "chan receive",
+						Locked: true,
+						Stack:  Stack{Calls: []Call{{SourcePath: "/src/main.go", Line: 10, Func: Function{"main.worker"}}}},
+					},
+					Routines: []Goroutine{{ID: 1}, {ID: 2}, {ID: 7}},
+				},
+			},
+		},
+		Added: Buckets{
+			{
+				Signature: Signature{
+					State: "semacquire",
+					Stack: Stack{Calls: []Call{{SourcePath: "/src/main.go", Line: 40, Func: Function{"main.<lock>"}}}},
+				},
+				Routines: []Goroutine{{ID: 9}},
+			},
+		},
+	}
+	out := &bytes.Buffer{}
+	ut.AssertEqual(t, nil, DiffHTML(out, d, false))
+	actual := out.String()
+	for _, expected := range []string{
+		"<h1>Matching</h1>",
+		"<td>1</td>\n<td>3</td>\n<td class=\"increase\">&#43;2</td>\n<td>chan receive [2 minutes]</td>\n<td>chan receive [locked]</td>",
+		"<pre>    main main.go:10 worker()\n</pre>",
+		"<h1>Only in new</h1>\n<h2>1: semacquire</h2>",
+		"main.go:40 &lt;lock&gt;()",
+	} {
+		if !strings.Contains(actual, expected) {
+			t.Fatalf("%q not found in:\n%s", expected, actual)
+		}
+	}
+	ut.AssertEqual(t, false, strings.Contains(actual, "Only in old"))
+}
+
+func TestHTML(t *testing.T) {
+	t.Parallel()
+	buckets := Buckets{
+		{
+			Signature: Signature{
+				State: "running",
+				Stack: Stack{Calls: []Call{{SourcePath: "/src/main.go", Line: 10, Func: Function{"main.worker"}}}},
+			},
+			Routines: []Goroutine{{ID: 1, First: true}},
+		},
+		{
+			Signature: Signature{
+				State:  "chan receive",
+				Locked: true,
+				Stack:  Stack{Calls: []Call{{SourcePath: "/src/foo.go", Line: 40, Func: Function{"main.<lock>"}}}},
+			},
+			Routines: []Goroutine{{ID: 2}, {ID: 3}},
+		},
+	}
+	out := &bytes.Buffer{}
+	ut.AssertEqual(t, nil, HTML(out, buckets, false))
+	actual := out.String()
+	for _, expected := range []string{
+		"<title>panicparse</title>",
+		"<h2>1: running</h2>\n<pre>    main main.go:10 worker()\n</pre>",
+		"<h2>2: chan receive [locked]</h2>\n<pre>    main foo.go:40  &lt;lock&gt;()\n</pre>",
+	} {
+		if !strings.Contains(actual, expected) {
+			t.Fatalf("%q not found in:\n%s", expected, actual)
+		}
+	}
+}
+
+func TestHTMLOrigins(t *testing.T) {
+	t.Parallel()
+	worker := func(id int, arg uint64) Goroutine {
+		calls := []Call{{SourcePath: "/src/main.go", Line: 10, Func: Function{"main.worker"}, Args: Args{Values: []Arg{{Value: arg}}}}}
+		return Goroutine{Signature: Signature{State: "chan receive", Stack: Stack{Calls: calls}}, ID: id}
+	}
+	buckets := SortBuckets(Bucketize([]Goroutine{worker(1, 1), worker(2, 2)}, AnyValue))
+	ut.AssertEqual(t, 1, len(buckets))
+	ut.AssertEqual(t, 2, len(buckets[0].Origins(ExactLines)))
+	out := &bytes.Buffer{}
+	ut.AssertEqual(t, nil, HTML(out, buckets, false))
+	actual := out.String()
+	for _, expected := range []string{
+		"<details><summary>2 exact signatures</summary>",
+		"<h3>1: chan receive</h3>\n<pre>    main main.go:10 worker(0x1)\n</pre>",
+	} {
+		if !strings.Contains(actual, expected) {
+			t.Fatalf("%q not found in:\n%s", expected, actual)
+		}
+	}
+}
+
+func TestAssetVersions(t *testing.T) {
+	t.Parallel()
+	v := AssetVersions()
+	ut.AssertEqual(t, 3, len(v))
+	ut.AssertEqual(t, 12, len(v["html/buckets.html"]))
+	ut.AssertEqual(t, 12, len(v["html/diff.html"]))
+	ut.AssertEqual(t, 12, len(v["html/style.html"]))
+}
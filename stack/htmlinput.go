@@ -0,0 +1,36 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"html"
+	"io"
+	"strings"
+)
+
+// UnescapeHTML returns a reader that normalizes a dump copied from a web UI,
+// e.g. Grafana or Kibana, so it can be parsed.
+//
+// The HTML entities are unescaped, e.g. "&gt;" and "&amp;", the non-breaking
+// spaces are replaced with spaces and the zero-width spaces are removed. Since
+// the source lines may be indented with any mix of spaces, it is not a
+// problem that their leading tab was lost.
+func UnescapeHTML(r io.Reader) io.Reader {
+	return newLineReader(r, unescapeHTMLLine)
+}
+
+// Private stuff.
+
+// htmlReplacer replaces the characters of a pasted HTML page that break the
+// regexps.
+var htmlReplacer = strings.NewReplacer("\u00a0", " ", "\u200b", "", "\ufeff", "")
+
+// unescapeHTMLLine normalizes a line copied from a web UI.
+func unescapeHTMLLine(line string) string {
+	if strings.IndexByte(line, '&') != -1 {
+		line = html.UnescapeString(line)
+	}
+	return htmlReplacer.Replace(line)
+}
@@ -0,0 +1,37 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestUnescapeHTML(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"panic: a &lt; b &amp;&amp; c",
+		"",
+		"goroutine 1 [chan receive]:",
+		"main.(*server).handle(0xc000012345)",
+		"    /home/user/src/app/main.go:42 +0x1d",
+		"main.main()",
+		"&nbsp;&nbsp;&nbsp;&nbsp;/home/user/src/app/main.go:12\u200b +0x17",
+		"",
+	}
+	s, err := ParseSnapshot(UnescapeHTML(bytes.NewBufferString(strings.Join(data, "\n"))), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "a < b && c", s.Panic)
+	ut.AssertEqual(t, 1, len(s.Goroutines))
+	calls := s.Goroutines[0].Stack.Calls
+	ut.AssertEqual(t, 2, len(calls))
+	ut.AssertEqual(t, "main.(*server).handle", calls[0].Func.Raw)
+	ut.AssertEqual(t, 42, calls[0].Line)
+	ut.AssertEqual(t, 12, calls[1].Line)
+}
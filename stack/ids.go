@@ -0,0 +1,64 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// IDRange is a range of consecutive goroutine IDs, both included.
+type IDRange struct {
+	First int
+	Last  int
+}
+
+func (r IDRange) String() string {
+	if r.First == r.Last {
+		return strconv.Itoa(r.First)
+	}
+	return strconv.Itoa(r.First) + "-" + strconv.Itoa(r.Last)
+}
+
+// IDRanges is a sorted list of non-overlapping ranges of goroutine IDs.
+type IDRanges []IDRange
+
+// String returns the ranges in compact form, e.g. "5, 18-24, 101".
+func (r IDRanges) String() string {
+	out := make([]string, len(r))
+	for i := range r {
+		out[i] = r[i].String()
+	}
+	return strings.Join(out, ", ")
+}
+
+// Contains returns true if id is in one of the ranges.
+func (r IDRanges) Contains(id int) bool {
+	i := sort.Search(len(r), func(i int) bool { return r[i].Last >= id })
+	return i < len(r) && r[i].First <= id
+}
+
+// IDRanges returns the IDs of the goroutines of the bucket as ranges of
+// consecutive IDs, so the bucket can be traced back to the goroutines in the
+// dump.
+func (b *Bucket) IDRanges() IDRanges {
+	ids := make([]int, len(b.Routines))
+	for i := range b.Routines {
+		ids[i] = b.Routines[i].ID
+	}
+	sort.Ints(ids)
+	var out IDRanges
+	for _, id := range ids {
+		if l := len(out); l != 0 && id <= out[l-1].Last+1 {
+			if id > out[l-1].Last {
+				out[l-1].Last = id
+			}
+			continue
+		}
+		out = append(out, IDRange{First: id, Last: id})
+	}
+	return out
+}
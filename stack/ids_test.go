@@ -0,0 +1,31 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestBucketIDRanges(t *testing.T) {
+	t.Parallel()
+	b := &Bucket{}
+	for _, id := range []int{101, 24, 5, 18, 19, 20, 22, 21, 23, 23} {
+		b.Routines = append(b.Routines, Goroutine{ID: id})
+	}
+	r := b.IDRanges()
+	ut.AssertEqual(t, IDRanges{{5, 5}, {18, 24}, {101, 101}}, r)
+	ut.AssertEqual(t, "5, 18-24, 101", r.String())
+	ut.AssertEqual(t, "  goroutines: 5, 18-24, 101\n", (&Palette{}).IDLine(b))
+	for _, id := range []int{5, 18, 21, 24, 101} {
+		ut.AssertEqual(t, true, r.Contains(id))
+	}
+	for _, id := range []int{0, 6, 17, 25, 100, 102} {
+		ut.AssertEqual(t, false, r.Contains(id))
+	}
+	ut.AssertEqual(t, IDRanges(nil), (&Bucket{}).IDRanges())
+	ut.AssertEqual(t, "", IDRanges(nil).String())
+}
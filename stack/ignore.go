@@ -0,0 +1,69 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+// IgnoreRule returns true for a goroutine to exclude, e.g. an expected
+// background goroutine. The rules follow the semantics of the options of
+// go.uber.org/goleak so the same lists can be used.
+type IgnoreRule func(g *Goroutine) bool
+
+// IgnoreTopFunction ignores the goroutines whose top call, the one they are
+// blocked in, is the function, e.g. "internal/poll.runtime_pollWait".
+func IgnoreTopFunction(f string) IgnoreRule {
+	return func(g *Goroutine) bool {
+		return len(g.Stack.Calls) != 0 && g.Stack.Calls[0].Func.Raw == f
+	}
+}
+
+// IgnoreAnyFunction ignores the goroutines with the function anywhere in
+// their stack.
+func IgnoreAnyFunction(f string) IgnoreRule {
+	return func(g *Goroutine) bool {
+		return g.Stack.hasFunc(f)
+	}
+}
+
+// IgnoreCreatedBy ignores the goroutines created by the function.
+func IgnoreCreatedBy(f string) IgnoreRule {
+	return func(g *Goroutine) bool {
+		return g.CreatedBy.Func.Raw == f
+	}
+}
+
+// Ignore returns the goroutines none of the rules match.
+func Ignore(goroutines []Goroutine, rules ...IgnoreRule) []Goroutine {
+	if len(rules) == 0 {
+		return goroutines
+	}
+	out := make([]Goroutine, 0, len(goroutines))
+	for i := range goroutines {
+		if !ignored(&goroutines[i], rules) {
+			out = append(out, goroutines[i])
+		}
+	}
+	return out
+}
+
+// Private stuff.
+
+// hasFunc returns true if the function is in the stack.
+func (s *Stack) hasFunc(raw string) bool {
+	for i := range s.Calls {
+		if s.Calls[i].Func.Raw == raw {
+			return true
+		}
+	}
+	return false
+}
+
+// ignored returns true if any of the rules matches the goroutine.
+func ignored(g *Goroutine, rules []IgnoreRule) bool {
+	for _, r := range rules {
+		if r(g) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestIgnore(t *testing.T) {
+	t.Parallel()
+	call := func(fn string) Call {
+		return Call{SourcePath: "/src/main.go", Line: 10, Func: Function{fn}}
+	}
+	goroutines := []Goroutine{
+		{Signature: Signature{State: "IO wait", Stack: Stack{Calls: []Call{call("internal/poll.runtime_pollWait"), call("main.serve")}}}, ID: 1},
+		{Signature: Signature{State: "select", Stack: Stack{Calls: []Call{call("main.loop"), call("main.metrics")}}}, ID: 2},
+		{Signature: Signature{State: "select", Stack: Stack{Calls: []Call{call("main.loop")}}, CreatedBy: call("main.startWorker")}, ID: 3},
+		{Signature: Signature{State: "chan receive", Stack: Stack{Calls: []Call{call("main.main")}}}, ID: 4},
+	}
+	ids := func(goroutines []Goroutine) []int {
+		out := []int{}
+		for _, g := range goroutines {
+			out = append(out, g.ID)
+		}
+		return out
+	}
+	ut.AssertEqual(t, []int{1, 2, 3, 4}, ids(Ignore(goroutines)))
+	ut.AssertEqual(t, []int{2, 3, 4}, ids(Ignore(goroutines, IgnoreTopFunction("internal/poll.runtime_pollWait"))))
+	ut.AssertEqual(t, []int{1, 2, 3, 4}, ids(Ignore(goroutines, IgnoreTopFunction("main.serve"))))
+	ut.AssertEqual(t, []int{1, 3, 4}, ids(Ignore(goroutines, IgnoreAnyFunction("main.metrics"))))
+	ut.AssertEqual(t, []int{1, 2, 4}, ids(Ignore(goroutines, IgnoreCreatedBy("main.startWorker"))))
+	ut.AssertEqual(t, []int{4}, ids(Ignore(goroutines, IgnoreAnyFunction("main.serve"), IgnoreTopFunction("main.loop"))))
+
+	c := Criteria{Similarity: AnyPointer, Ignore: []IgnoreRule{IgnoreTopFunction("main.loop")}}
+	buckets := SortBuckets(c.Bucketize(goroutines))
+	ut.AssertEqual(t, 2, len(buckets))
+}
@@ -0,0 +1,221 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// DumpIndex is the location of a dump in a log file.
+//
+// It is meant to be saved along the log file so the dumps of an append-only
+// log can be queried without parsing the whole file every time.
+type DumpIndex struct {
+	// Offset is the offset of the first line of the dump in the file.
+	Offset int64 `json:"offset"`
+	// Length is the length of the dump in bytes.
+	Length int64 `json:"length"`
+	// Time is the timestamp of the last log line before the dump, or of the
+	// first one after it when there is none before. It is the zero value when
+	// there is none.
+	Time time.Time `json:"time"`
+}
+
+// IndexDumps finds the dumps in r without parsing them.
+//
+// offset is the offset of r in the file and is added to the offsets
+// returned. To index the data appended to a log file, call it with the file
+// positioned after the last dump indexed.
+func IndexDumps(r io.Reader, offset int64) ([]DumpIndex, error) {
+	return (&Parser{}).IndexDumps(r, offset)
+}
+
+// IndexDumps is IndexDumps with the options of p.
+func (p *Parser) IndexDumps(r io.Reader, offset int64) ([]DumpIndex, error) {
+	scanner := newScanner(r)
+	var out []DumpIndex
+	// d is the dump being indexed, if any. end is the offset after its last
+	// non empty line.
+	var d *DumpIndex
+	var end int64
+	var last time.Time
+	var b dumpBoundary
+	for scanner.Scan() {
+		raw := scanner.Text()
+		size := int64(len(raw))
+		line := p.clean(raw)
+		ended, started := b.next(line)
+		if ended {
+			d.Length = end - d.Offset
+			d = nil
+		}
+		if started {
+			out = append(out, DumpIndex{Offset: offset, Time: last})
+			d = &out[len(out)-1]
+			end = offset + size
+		} else if d != nil {
+			if strings.TrimRight(line, "\r\n") != "" {
+				end = offset + size
+			}
+		} else if t, ok := parseTimestamp(line); ok {
+			last = t
+			// A dump without a timestamp before is attributed to the one after.
+			if n := len(out); n != 0 && out[n-1].Time.IsZero() {
+				out[n-1].Time = t
+			}
+		}
+		offset += size
+	}
+	if d != nil {
+		d.Length = end - d.Offset
+	}
+	return out, scanner.Err()
+}
+
+// ParseRange parses the dumps of index with a timestamp in [from, to).
+//
+// A zero from or to is unbounded. The Time of each snapshot is the one of the
+// index.
+func ParseRange(r io.ReaderAt, index []DumpIndex, from, to time.Time) ([]*Snapshot, error) {
+	return (&Parser{}).ParseRange(r, index, from, to)
+}
+
+// ParseRange is ParseRange with the options of p.
+func (p *Parser) ParseRange(r io.ReaderAt, index []DumpIndex, from, to time.Time) ([]*Snapshot, error) {
+	var out []*Snapshot
+	for _, d := range index {
+		if (!from.IsZero() && d.Time.Before(from)) || (!to.IsZero() && !d.Time.Before(to)) {
+			continue
+		}
+		s, err := p.ParseSnapshot(io.NewSectionReader(r, d.Offset, d.Length), ioutil.Discard)
+		if err != nil {
+			return out, err
+		}
+		s.Time = d.Time
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// ParseSnapshots parses all the dumps in r, e.g. a log file of a process that
+// was restarted after each crash.
+//
+// Unlike ParseSnapshot which merges the goroutines of all the dumps, each
+// dump is returned as its own snapshot with its lines numbered from the start
+// of r. Like with ParseSnapshot, the lines that are not part of a goroutine
+// are streamed to out.
+func ParseSnapshots(r io.Reader, out io.Writer) ([]*Snapshot, error) {
+	return (&Parser{}).ParseSnapshots(r, out)
+}
+
+// ParseSnapshots is ParseSnapshots with the options of p.
+func (p *Parser) ParseSnapshots(r io.Reader, out io.Writer) ([]*Snapshot, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	index, err := p.IndexDumps(bytes.NewReader(b), 0)
+	if err != nil {
+		return nil, err
+	}
+	var snapshots []*Snapshot
+	prev := int64(0)
+	lines := 0
+	for _, d := range index {
+		if _, err = out.Write(b[prev:d.Offset]); err != nil {
+			return snapshots, err
+		}
+		lines += bytes.Count(b[prev:d.Offset], []byte{'\n'})
+		s, err := p.ParseSnapshot(bytes.NewReader(b[d.Offset:d.Offset+d.Length]), out)
+		if err != nil {
+			return snapshots, err
+		}
+		if s.StartLine != 0 {
+			s.StartLine += lines
+		}
+		if s.EndLine != 0 {
+			s.EndLine += lines
+		}
+		if s.Time.IsZero() {
+			s.Time = d.Time
+		}
+		snapshots = append(snapshots, s)
+		prev = d.Offset + d.Length
+		lines += bytes.Count(b[d.Offset:prev], []byte{'\n'})
+	}
+	_, err = out.Write(b[prev:])
+	return snapshots, err
+}
+
+// Private stuff.
+
+// isDumpLine returns true if the line can be part of a dump.
+func isDumpLine(line string) bool {
+	l := strings.TrimRight(line, "\r\n")
+	if l == "" || l[0] == '\t' || l[0] == ' ' {
+		// Empty line and source lines.
+		return true
+	}
+	return isDumpStart(line) ||
+		reFunc.MatchString(line) ||
+		reCreated.MatchString(line) ||
+		reElided.MatchString(line) ||
+		reCFunc.MatchString(line) ||
+		reSignal.MatchString(line) ||
+		reThreadSignal.MatchString(line) ||
+		reThreadPC.MatchString(line) ||
+		reRegister.MatchString(line) ||
+		l == "-----" ||
+		strings.HasPrefix(l, "goroutine ") ||
+		strings.HasPrefix(l, "[") ||
+		strings.HasPrefix(l, "exit status ")
+}
+
+// dumpBoundary finds where the dumps start and end in a sequence of lines.
+//
+// A dump ends on the first line that cannot be part of it. A dump starting
+// right after another one is detected by its panic message or by a goroutine
+// ID seen again.
+type dumpBoundary struct {
+	// in is true while in a dump. ids are the goroutine IDs seen in it.
+	in  bool
+	ids map[string]bool
+}
+
+// next processes a line and returns if the dump being read ended before it
+// and if a new dump starts with it.
+func (b *dumpBoundary) next(line string) (ended, started bool) {
+	if b.in {
+		ended = !isDumpLine(line)
+		if m := reRoutineHeader.FindStringSubmatch(line); m != nil {
+			ended = b.ids[m[1]]
+			b.ids[m[1]] = true
+		} else if len(b.ids) != 0 && isDumpStart(line) {
+			ended = true
+		}
+		if !ended {
+			return false, false
+		}
+		b.in = false
+	}
+	if !isDumpStart(line) {
+		return ended, false
+	}
+	b.in = true
+	b.ids = map[string]bool{}
+	if m := reRoutineHeader.FindStringSubmatch(line); m != nil {
+		b.ids[m[1]] = true
+	}
+	return ended, true
+}
+
+// end ends the dump being read, if any.
+func (b *dumpBoundary) end() {
+	b.in = false
+}
@@ -0,0 +1,113 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maruel/ut"
+)
+
+func TestIndexDumps(t *testing.T) {
+	t.Parallel()
+	dump := func(id string) []string {
+		return []string{
+			"panic: boom " + id,
+			"",
+			"goroutine " + id + " [running]:",
+			"main.main()",
+			"	/gopath/src/github.com/foo/bar/main.go:12 +0x1d",
+			"",
+		}
+	}
+	var lines []string
+	lines = append(lines, "2024/05/01 10:00:00 starting")
+	lines = append(lines, dump("1")...)
+	lines = append(lines, "2024/05/02 10:00:00 starting")
+	lines = append(lines, dump("2")...)
+	lines = append(lines, "exit status 2", "2024/05/03 10:00:00 starting", "serving")
+	lines = append(lines, dump("3")...)
+	lines = append(lines, "2024/05/04 10:00:00 starting")
+	data := []byte(strings.Join(lines, "\n"))
+
+	// Index in two passes, as if the file was appended to.
+	split := bytes.Index(data, []byte("2024/05/03"))
+	index, err := IndexDumps(bytes.NewReader(data[:split]), 0)
+	ut.AssertEqual(t, nil, err)
+	more, err := IndexDumps(bytes.NewReader(data[split:]), int64(split))
+	ut.AssertEqual(t, nil, err)
+	index = append(index, more...)
+
+	day := func(d int) time.Time {
+		return time.Date(2024, 5, d, 10, 0, 0, 0, time.UTC)
+	}
+	ut.AssertEqual(t, 3, len(index))
+	for i, d := range index {
+		ut.AssertEqualIndex(t, i, day(i+1), d.Time)
+		ut.AssertEqualIndex(t, i, true, bytes.HasPrefix(data[d.Offset:], []byte("panic: boom")))
+	}
+	ut.AssertEqual(t, strings.Join(dump("1")[:5], "\n")+"\n", string(data[index[0].Offset:index[0].Offset+index[0].Length]))
+	ut.AssertEqual(t, strings.Join(append(dump("2")[:5], "", "exit status 2"), "\n")+"\n", string(data[index[1].Offset:index[1].Offset+index[1].Length]))
+
+	snapshots, err := ParseRange(bytes.NewReader(data), index, day(2), day(3))
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 1, len(snapshots))
+	ut.AssertEqual(t, 2, snapshots[0].Goroutines[0].ID)
+	ut.AssertEqual(t, day(2), snapshots[0].Time)
+
+	snapshots, err = ParseRange(bytes.NewReader(data), index, day(2), time.Time{})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 2, len(snapshots))
+	ut.AssertEqual(t, 3, snapshots[1].Goroutines[0].ID)
+}
+
+func TestParseSnapshots(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"2024/05/01 10:00:00 starting",
+		"panic: first",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"	/gopath/src/github.com/foo/bar/main.go:12 +0x1d",
+		"",
+		"panic: second",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"	/gopath/src/github.com/foo/bar/main.go:14 +0x1d",
+		"",
+		"restarted",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"	/gopath/src/github.com/foo/bar/main.go:16 +0x1d",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"	/gopath/src/github.com/foo/bar/main.go:18 +0x1d",
+		"",
+	}
+	out := &bytes.Buffer{}
+	snapshots, err := ParseSnapshots(bytes.NewBufferString(strings.Join(data, "\n")), out)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 4, len(snapshots))
+	for i, s := range snapshots {
+		ut.AssertEqualIndex(t, i, 1, len(s.Goroutines))
+		ut.AssertEqualIndex(t, i, 12+2*i, s.Goroutines[0].Stack.Calls[0].Line)
+	}
+	ut.AssertEqual(t, "first", snapshots[0].Reason.Value)
+	ut.AssertEqual(t, "second", snapshots[1].Reason.Value)
+	ut.AssertEqual(t, (*PanicReason)(nil), snapshots[2].Reason)
+	ut.AssertEqual(t, 2, snapshots[0].StartLine)
+	ut.AssertEqual(t, 6, snapshots[0].EndLine)
+	ut.AssertEqual(t, 8, snapshots[1].StartLine)
+	ut.AssertEqual(t, 15, snapshots[2].StartLine)
+	ut.AssertEqual(t, 19, snapshots[3].StartLine)
+	ut.AssertEqual(t, time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), snapshots[1].Time)
+	ut.AssertEqual(t, "2024/05/01 10:00:00 starting\npanic: first\n\n\npanic: second\n\nrestarted\n\n", out.String())
+}
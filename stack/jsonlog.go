@@ -0,0 +1,152 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// JSONLogFields are the fields holding the message in JSON log lines, tried
+// in order by UnwrapJSONLogs when no field is specified.
+//
+// "log" is used by the Docker json-file driver and by fluentd, "message" and
+// "msg" by most structured loggers.
+var JSONLogFields = []string{"log", "message", "msg"}
+
+// UnwrapJSONLogs returns a reader that replaces the JSON objects in r, one
+// per line, by the string in their field, e.g. the output of a container
+// saved by Docker as {"log":"goroutine 1 [running]:\n","stream":"stderr"}.
+//
+// When field is empty, JSONLogFields are tried in order. The lines that are
+// not a JSON object with the field are returned untouched.
+//
+// Docker splits long lines in multiple objects and only the last one ends
+// with a new line, so the message of the "log" field is returned as is. A new
+// line is appended to the messages of the other fields.
+func UnwrapJSONLogs(r io.Reader, field string) io.Reader {
+	fields := JSONLogFields
+	if field != "" {
+		fields = []string{field}
+	}
+	return newLineReader(r, (&jsonLogUnwrapper{fields: fields}).unwrap)
+}
+
+// UnescapeJSONStrings returns a reader that unescapes the dumps embedded in a
+// string literal of a line of r, e.g. the "stack" field of
+// {"level":"error","stack":"goroutine 1 [running]:\nmain.main()\n..."} as
+// printed by structured loggers.
+//
+// A literal is unescaped when it contains an escaped new line and one of its
+// lines is a goroutine header or a "panic: " line. It is printed on its own
+// lines, with the text before and after it on the lines around. The other
+// lines are returned untouched.
+func UnescapeJSONStrings(r io.Reader) io.Reader {
+	return newLineReader(r, unescapeLine)
+}
+
+// Private stuff.
+
+// jsonLogUnwrapper holds the fields tried by UnwrapJSONLogs.
+type jsonLogUnwrapper struct {
+	fields []string
+}
+
+// unwrap returns the message of the line if it is a JSON log line.
+func (j *jsonLogUnwrapper) unwrap(line string) string {
+	if !strings.HasPrefix(strings.TrimLeft(line, " \t"), "{") {
+		return line
+	}
+	var obj map[string]json.RawMessage
+	if json.Unmarshal([]byte(line), &obj) != nil {
+		return line
+	}
+	for _, f := range j.fields {
+		raw, ok := obj[f]
+		if !ok {
+			continue
+		}
+		var msg string
+		if json.Unmarshal(raw, &msg) != nil {
+			continue
+		}
+		if f != "log" && !strings.HasSuffix(msg, "\n") {
+			msg += "\n"
+		}
+		return msg
+	}
+	return line
+}
+
+// unescapeLine unescapes the string literals of the line holding a dump.
+func unescapeLine(line string) string {
+	if !strings.Contains(line, `\n`) {
+		return line
+	}
+	out := ""
+	for {
+		start, end := nextStringLiteral(line)
+		if start == -1 {
+			return out + line
+		}
+		msg, ok := unquote(line[start:end])
+		if !ok || !isDump(msg) {
+			out += line[:end]
+			line = line[end:]
+			continue
+		}
+		if before := line[:start]; strings.TrimSpace(before) != "" {
+			out += before + "\n"
+		}
+		out += msg
+		if !strings.HasSuffix(msg, "\n") {
+			out += "\n"
+		}
+		line = line[end:]
+		if strings.TrimSpace(line) == "" {
+			return out
+		}
+	}
+}
+
+// nextStringLiteral returns the bounds of the first double quoted string
+// literal in s, quotes included, or -1 if there is none.
+func nextStringLiteral(s string) (int, int) {
+	start := strings.IndexByte(s, '"')
+	if start == -1 {
+		return -1, -1
+	}
+	for i := start + 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return start, i + 1
+		}
+	}
+	return -1, -1
+}
+
+// unquote decodes a JSON string literal, or a Go one as printed with %q.
+func unquote(s string) (string, bool) {
+	var msg string
+	if json.Unmarshal([]byte(s), &msg) == nil {
+		return msg, true
+	}
+	msg, err := strconv.Unquote(s)
+	return msg, err == nil
+}
+
+// isDump returns true if one of the lines of s starts a dump.
+func isDump(s string) bool {
+	for _, l := range strings.SplitAfter(s, "\n") {
+		if strings.HasPrefix(l, "panic: ") || reRoutineHeader.MatchString(trimCR(l)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestUnwrapJSONLogs(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		`{"log":"panic: boom\n","stream":"stderr","time":"2024-05-01T12:00:00.1Z"}`,
+		`{"log":"\n","stream":"stderr","time":"2024-05-01T12:00:00.1Z"}`,
+		`{"log":"goroutine 1 [running]:\n","stream":"stderr","time":"2024-05-01T12:00:00.1Z"}`,
+		// A line split by Docker.
+		`{"log":"main.main(","stream":"stderr","time":"2024-05-01T12:00:00.1Z"}`,
+		`{"log":")\n","stream":"stderr","time":"2024-05-01T12:00:00.1Z"}`,
+		`{"log":"\t/gopath/src/github.com/foo/bar/main.go:12 +0x1d\n","stream":"stderr","time":"2024-05-01T12:00:00.1Z"}`,
+		`{"level":"info","msg":"not a dump"}`,
+		`{"other":1}`,
+		"plain text",
+		"",
+	}
+	b, err := ioutil.ReadAll(UnwrapJSONLogs(bytes.NewBufferString(strings.Join(data, "\n")), ""))
+	ut.AssertEqual(t, nil, err)
+	expected := []string{
+		"panic: boom",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"\t/gopath/src/github.com/foo/bar/main.go:12 +0x1d",
+		"not a dump",
+		`{"other":1}`,
+		"plain text",
+		"",
+	}
+	ut.AssertEqual(t, strings.Join(expected, "\n"), string(b))
+
+	goroutines, err := ParseDump(UnwrapJSONLogs(bytes.NewBufferString(strings.Join(data, "\n")), "log"), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 1, len(goroutines))
+	ut.AssertEqual(t, 12, goroutines[0].Stack.Calls[0].Line)
+}
+
+func TestUnescapeJSONStrings(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		`{"level":"error","msg":"crashed","stack":"panic: boom\n\ngoroutine 1 [running]:\nmain.main()\n\t/gopath/src/github.com/foo/bar/main.go:12 +0x1d\n","ts":1}`,
+		`{"level":"info","msg":"a\nb"}`,
+		`stack="goroutine 2 [chan receive]:\nmain.f()\n\t/gopath/src/github.com/foo/bar/main.go:20 +0x10"`,
+		"plain text",
+		"",
+	}
+	b, err := ioutil.ReadAll(UnescapeJSONStrings(bytes.NewBufferString(strings.Join(data, "\n"))))
+	ut.AssertEqual(t, nil, err)
+	expected := []string{
+		`{"level":"error","msg":"crashed","stack":`,
+		"panic: boom",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"\t/gopath/src/github.com/foo/bar/main.go:12 +0x1d",
+		`,"ts":1}`,
+		`{"level":"info","msg":"a\nb"}`,
+		"stack=",
+		"goroutine 2 [chan receive]:",
+		"main.f()",
+		"\t/gopath/src/github.com/foo/bar/main.go:20 +0x10",
+		"plain text",
+		"",
+	}
+	ut.AssertEqual(t, strings.Join(expected, "\n"), string(b))
+
+	goroutines, err := ParseDump(UnescapeJSONStrings(bytes.NewBufferString(strings.Join(data, "\n"))), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 2, len(goroutines))
+	ut.AssertEqual(t, 20, goroutines[1].Stack.Calls[0].Line)
+}
@@ -0,0 +1,72 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// KnownIssue is a signature already triaged, e.g. tracked as a bug.
+type KnownIssue struct {
+	// Fingerprint is the Signature.Fingerprint of the buckets of the issue.
+	Fingerprint string
+	// Issue is the identifier of the issue, e.g. "FOO-123".
+	Issue string
+	// Hide hides the buckets instead of only tagging them.
+	Hide bool
+}
+
+// KnownIssues are known issues by fingerprint.
+type KnownIssues map[string]KnownIssue
+
+// ParseKnownIssues reads a list of known issues, one per line:
+//
+//	<fingerprint> <issue> [hide]
+//
+// Empty lines and lines starting with '#' are ignored.
+func ParseKnownIssues(r io.Reader) (KnownIssues, error) {
+	out := KnownIssues{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f := strings.Fields(line)
+		if len(f) < 2 || len(f) > 3 || (len(f) == 3 && f[2] != "hide") {
+			return nil, fmt.Errorf("line %d: expected \"<fingerprint> <issue> [hide]\", got %q", n, line)
+		}
+		if _, ok := out[f[0]]; ok {
+			return nil, fmt.Errorf("line %d: fingerprint %s listed twice", n, f[0])
+		}
+		out[f[0]] = KnownIssue{Fingerprint: f[0], Issue: f[1], Hide: len(f) == 3}
+	}
+	return out, scanner.Err()
+}
+
+// Apply annotates the buckets of known issues with "issue=<issue>" and
+// removes the hidden ones. It returns the remaining buckets and the number of
+// buckets hidden.
+func (k KnownIssues) Apply(buckets Buckets) (Buckets, int) {
+	out := Buckets{}
+	hidden := 0
+	for i := range buckets {
+		issue, ok := k[buckets[i].Fingerprint()]
+		if !ok {
+			out = append(out, buckets[i])
+			continue
+		}
+		if issue.Hide {
+			hidden++
+			continue
+		}
+		buckets[i].Annotate("issue", issue.Issue)
+		out = append(out, buckets[i])
+	}
+	return out, hidden
+}
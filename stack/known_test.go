@@ -0,0 +1,55 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestParseKnownIssues(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"# Triaged on 2016-05-01.",
+		"",
+		"0123 FOO-123",
+		"  4567   FOO-456 hide",
+	}
+	k, err := ParseKnownIssues(bytes.NewBufferString(strings.Join(data, "\n")))
+	ut.AssertEqual(t, nil, err)
+	expected := KnownIssues{
+		"0123": {Fingerprint: "0123", Issue: "FOO-123"},
+		"4567": {Fingerprint: "4567", Issue: "FOO-456", Hide: true},
+	}
+	ut.AssertEqual(t, expected, k)
+
+	_, err = ParseKnownIssues(bytes.NewBufferString("0123\n"))
+	ut.AssertEqual(t, "line 1: expected \"<fingerprint> <issue> [hide]\", got \"0123\"", err.Error())
+	_, err = ParseKnownIssues(bytes.NewBufferString("0123 FOO-1 show\n"))
+	ut.AssertEqual(t, "line 1: expected \"<fingerprint> <issue> [hide]\", got \"0123 FOO-1 show\"", err.Error())
+	_, err = ParseKnownIssues(bytes.NewBufferString("0123 FOO-1\n\n0123 FOO-2\n"))
+	ut.AssertEqual(t, "line 3: fingerprint 0123 listed twice", err.Error())
+}
+
+func TestKnownIssuesApply(t *testing.T) {
+	t.Parallel()
+	bucket := func(fn string) Bucket {
+		return Bucket{Signature: Signature{State: "select", Stack: Stack{Calls: []Call{{SourcePath: "/src/main.go", Line: 10, Func: Function{fn}}}}}}
+	}
+	buckets := Buckets{bucket("main.a"), bucket("main.b"), bucket("main.c")}
+	k := KnownIssues{
+		buckets[0].Fingerprint(): {Fingerprint: buckets[0].Fingerprint(), Issue: "FOO-123"},
+		buckets[2].Fingerprint(): {Fingerprint: buckets[2].Fingerprint(), Issue: "FOO-456", Hide: true},
+	}
+	out, hidden := k.Apply(buckets)
+	ut.AssertEqual(t, 1, hidden)
+	ut.AssertEqual(t, 2, len(out))
+	ut.AssertEqual(t, Annotations{"issue": "FOO-123"}, out[0].Annotations)
+	ut.AssertEqual(t, Annotations(nil), out[1].Annotations)
+	ut.AssertEqual(t, "  fingerprint: "+buckets[1].Fingerprint()+"\n", (&Palette{}).FingerprintLine(&out[1]))
+}
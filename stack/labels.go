@@ -0,0 +1,145 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LabelGroup is the goroutines that have the same value for a label.
+type LabelGroup struct {
+	Value      string
+	Goroutines []Goroutine
+}
+
+// GroupByLabel groups the goroutines by the value of the pprof label key, with
+// the largest group first.
+//
+// Goroutines without the label are skipped. It answers questions like "which
+// request are the stuck goroutines serving".
+func GroupByLabel(goroutines []Goroutine, key string) []LabelGroup {
+	groups := map[string][]Goroutine{}
+	for _, g := range goroutines {
+		if v, ok := g.Labels[key]; ok {
+			groups[v] = append(groups[v], g)
+		}
+	}
+	out := make([]LabelGroup, 0, len(groups))
+	for v, g := range groups {
+		out = append(out, LabelGroup{v, g})
+	}
+	sort.Sort(labelGroups(out))
+	return out
+}
+
+// Labels returns the pprof labels that all the goroutines of the bucket have
+// with the same value. It returns nil if there is none.
+func (b *Bucket) Labels() map[string]string {
+	if len(b.Routines) == 0 {
+		return nil
+	}
+	var out map[string]string
+	for k, v := range b.Routines[0].Labels {
+		same := true
+		for i := 1; i < len(b.Routines) && same; i++ {
+			w, ok := b.Routines[i].Labels[k]
+			same = ok && w == v
+		}
+		if same {
+			if out == nil {
+				out = map[string]string{}
+			}
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// Private stuff.
+
+// formatLabels formats the labels like the runtime does in the goroutine
+// header, sorted by key.
+func formatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]string, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, quoteLabel(k)+": "+quoteLabel(labels[k]))
+	}
+	return "{" + strings.Join(out, ", ") + "}"
+}
+
+// quoteLabel quotes s unless it only has letters, digits, '.', '/' and '_'.
+func quoteLabel(s string) string {
+	if s == "" {
+		return `""`
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '/' || r == '_') {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
+
+// parseLabels parses the labels printed by the runtime in the goroutine
+// header, e.g. `request: abc123, "user agent": "curl/7.64"`. Keys and values
+// are quoted only when they have characters other than letters, digits, '.',
+// '/' and '_'.
+func parseLabels(s string) map[string]string {
+	out := map[string]string{}
+	for s != "" {
+		key, rest, ok := labelToken(s, ':')
+		if !ok || !strings.HasPrefix(rest, ": ") {
+			break
+		}
+		value, rest, ok := labelToken(rest[2:], ',')
+		if !ok {
+			break
+		}
+		out[key] = value
+		s = strings.TrimPrefix(rest, ", ")
+	}
+	return out
+}
+
+// labelToken returns the first key or value in s, which is either quoted or
+// ends at sep.
+func labelToken(s string, sep byte) (string, string, bool) {
+	if strings.HasPrefix(s, "\"") {
+		q, err := strconv.QuotedPrefix(s)
+		if err != nil {
+			return "", "", false
+		}
+		v, err := strconv.Unquote(q)
+		return v, s[len(q):], err == nil
+	}
+	if i := strings.IndexByte(s, sep); i != -1 {
+		return s[:i], s[i:], true
+	}
+	return s, "", true
+}
+
+type labelGroups []LabelGroup
+
+func (l labelGroups) Len() int {
+	return len(l)
+}
+
+func (l labelGroups) Less(i, j int) bool {
+	if len(l[i].Goroutines) != len(l[j].Goroutines) {
+		return len(l[i].Goroutines) > len(l[j].Goroutines)
+	}
+	return l[i].Value < l[j].Value
+}
+
+func (l labelGroups) Swap(i, j int) {
+	l[i], l[j] = l[j], l[i]
+}
@@ -0,0 +1,101 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestParseLabels(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		in       string
+		expected map[string]string
+	}{
+		{"request: abc123", map[string]string{"request": "abc123"}},
+		{`request: abc123, "user agent": "curl/7.64, \"x\""`, map[string]string{"request": "abc123", "user agent": `curl/7.64, "x"`}},
+		{`endpoint: /foo/bar, request: 1`, map[string]string{"endpoint": "/foo/bar", "request": "1"}},
+	}
+	for i, line := range data {
+		ut.AssertEqualIndex(t, i, line.expected, parseLabels(line.in))
+	}
+}
+
+func TestGroupByLabel(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"goroutine 1 [running]:",
+		"main.main()",
+		"	/gopath/src/github.com/foo/bar/baz.go:10 +0x27",
+		"",
+		"goroutine 2 [chan receive] {endpoint: /foo, request: abc123}:",
+		"main.serve()",
+		"	/gopath/src/github.com/foo/bar/baz.go:20 +0x27",
+		"",
+		"goroutine 3 [select] {endpoint: /foo, request: abc123}:",
+		"main.fetch()",
+		"	/gopath/src/github.com/foo/bar/baz.go:30 +0x27",
+		"",
+		"goroutine 4 [chan receive] {request: def}:",
+		"main.serve()",
+		"	/gopath/src/github.com/foo/bar/baz.go:20 +0x27",
+		"",
+	}
+	goroutines, err := ParseDump(bytes.NewBufferString(strings.Join(data, "\n")), &bytes.Buffer{})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 4, len(goroutines))
+	ut.AssertEqual(t, map[string]string{"endpoint": "/foo", "request": "abc123"}, goroutines[1].Labels)
+	groups := GroupByLabel(goroutines, "request")
+	ut.AssertEqual(t, 2, len(groups))
+	ut.AssertEqual(t, "abc123", groups[0].Value)
+	ut.AssertEqual(t, []Goroutine{goroutines[1], goroutines[2]}, groups[0].Goroutines)
+	ut.AssertEqual(t, "def", groups[1].Value)
+}
+
+func TestBucketizeLabels(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"goroutine 1 [chan receive] {tenant: a, request: 1}:",
+		"main.serve()",
+		"	/gopath/src/github.com/foo/bar/baz.go:20 +0x27",
+		"",
+		"goroutine 2 [chan receive] {tenant: a, request: 2}:",
+		"main.serve()",
+		"	/gopath/src/github.com/foo/bar/baz.go:20 +0x27",
+		"",
+		"goroutine 3 [chan receive] {tenant: \"b c\", request: 3}:",
+		"main.serve()",
+		"	/gopath/src/github.com/foo/bar/baz.go:20 +0x27",
+		"",
+		"goroutine 4 [chan receive]:",
+		"main.serve()",
+		"	/gopath/src/github.com/foo/bar/baz.go:20 +0x27",
+		"",
+	}
+	goroutines, err := ParseDump(bytes.NewBufferString(strings.Join(data, "\n")), &bytes.Buffer{})
+	ut.AssertEqual(t, nil, err)
+	buckets := SortBuckets((&Criteria{Similarity: AnyPointer}).Bucketize(goroutines))
+	ut.AssertEqual(t, 1, len(buckets))
+	ut.AssertEqual(t, map[string]string(nil), buckets[0].Labels())
+
+	buckets = SortBuckets((&Criteria{Similarity: AnyPointer, Labels: []string{"tenant"}}).Bucketize(goroutines))
+	ut.AssertEqual(t, 3, len(buckets))
+	var headers []string
+	for i := range buckets {
+		headers = append(headers, (&Palette{}).BucketHeader(&buckets[i], false, false))
+	}
+	sort.Strings(headers)
+	expected := []string{
+		"1: chan receive\n",
+		"1: chan receive {request: 3, tenant: \"b c\"}\n",
+		"2: chan receive {tenant: a}\n",
+	}
+	ut.AssertEqual(t, expected, headers)
+}
@@ -0,0 +1,116 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import "sort"
+
+// MaxLeakExamples is the maximum number of goroutine IDs in
+// LeakSuspect.Examples.
+var MaxLeakExamples = 5
+
+// LeakSuspect is a bucket whose goroutine count grew over a sequence of
+// dumps of the same process.
+type LeakSuspect struct {
+	// Bucket is the bucket in the last dump. Its CreatedBy is where the
+	// leaking goroutines are created.
+	Bucket Bucket
+	// Counts is the goroutine count of the bucket in each dump, in order.
+	Counts []int
+	// Growth is the number of goroutines added between the first and the last
+	// dump.
+	Growth int
+	// Rate is the growth per second. It is 0 when the first or the last dump
+	// has no timestamp.
+	Rate float64
+	// Examples are the IDs of goroutines of the bucket created after the first
+	// dump, the newest first, to look them up in the last dump.
+	Examples []int
+}
+
+// FindLeaks returns the buckets whose goroutine count never decreased and
+// grew between the first and the last snapshot, the largest growth first.
+//
+// The snapshots must be of the same process, oldest first. Each one is
+// bucketized per the criteria and the buckets are matched across dumps like
+// with Diff. A bucket missing from a dump counts as 0. It returns nil with
+// less than two snapshots.
+func (c *Criteria) FindLeaks(snapshots []*Snapshot) []LeakSuspect {
+	if len(snapshots) < 2 {
+		return nil
+	}
+	dumps := make([]Buckets, len(snapshots))
+	for i, s := range snapshots {
+		dumps[i] = c.Buckets(s.Goroutines)
+	}
+	first, last := snapshots[0], snapshots[len(snapshots)-1]
+	var out []LeakSuspect
+	for _, b := range dumps[len(dumps)-1] {
+		l := LeakSuspect{Bucket: b, Counts: make([]int, len(dumps))}
+		grows := true
+		for i, buckets := range dumps {
+			for j := range buckets {
+				if c.Similar(&buckets[j].Signature, &b.Signature) {
+					l.Counts[i] += len(buckets[j].Routines)
+				}
+			}
+			if i != 0 && l.Counts[i] < l.Counts[i-1] {
+				grows = false
+				break
+			}
+		}
+		if !grows {
+			continue
+		}
+		if l.Growth = l.Counts[len(l.Counts)-1] - l.Counts[0]; l.Growth <= 0 {
+			continue
+		}
+		if !first.Time.IsZero() && last.Time.After(first.Time) {
+			l.Rate = float64(l.Growth) / last.Time.Sub(first.Time).Seconds()
+		}
+		l.Examples = leakExamples(b.Routines, first.maxID())
+		out = append(out, l)
+	}
+	sort.Stable(leaksByGrowth(out))
+	return out
+}
+
+// FindLeaks returns the buckets whose goroutine count grew over the
+// snapshots, bucketized at the similar level.
+func FindLeaks(snapshots []*Snapshot, similar Similarity) []LeakSuspect {
+	c := Criteria{Similarity: similar}
+	return c.FindLeaks(snapshots)
+}
+
+// Private stuff.
+
+// leakExamples returns up to MaxLeakExamples IDs of goroutines created after
+// the goroutine ID since, the newest first.
+func leakExamples(routines []Goroutine, since int) []int {
+	var ids []int
+	for i := range routines {
+		if routines[i].ID > since {
+			ids = append(ids, routines[i].ID)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(ids)))
+	if len(ids) > MaxLeakExamples {
+		ids = ids[:MaxLeakExamples]
+	}
+	return ids
+}
+
+type leaksByGrowth []LeakSuspect
+
+func (l leaksByGrowth) Len() int {
+	return len(l)
+}
+
+func (l leaksByGrowth) Less(i, j int) bool {
+	return l[i].Growth > l[j].Growth
+}
+
+func (l leaksByGrowth) Swap(i, j int) {
+	l[i], l[j] = l[j], l[i]
+}
@@ -0,0 +1,52 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"testing"
+	"time"
+
+	"github.com/maruel/ut"
+)
+
+func TestFindLeaks(t *testing.T) {
+	t.Parallel()
+	leak := Signature{
+		State:     "chan send",
+		Stack:     Stack{Calls: []Call{{SourcePath: "/src/main.go", Line: 10, Func: Function{"main.worker"}}}},
+		CreatedBy: Call{SourcePath: "/src/main.go", Line: 30, Func: Function{"main.serve"}},
+	}
+	stable := Signature{
+		State: "IO wait",
+		Stack: Stack{Calls: []Call{{SourcePath: "/src/main.go", Line: 20, Func: Function{"main.read"}}}},
+	}
+	// shrinking grows overall but went down in the middle.
+	shrinking := Signature{
+		State: "select",
+		Stack: Stack{Calls: []Call{{SourcePath: "/src/main.go", Line: 40, Func: Function{"main.poll"}}}},
+	}
+	goroutines := func(s Signature, ids ...int) []Goroutine {
+		var out []Goroutine
+		for _, id := range ids {
+			out = append(out, Goroutine{Signature: s, ID: id})
+		}
+		return out
+	}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	snapshots := []*Snapshot{
+		{Time: now, Goroutines: append(append(goroutines(leak, 10), goroutines(stable, 1, 2)...), goroutines(shrinking, 3, 4)...)},
+		{Time: now.Add(time.Minute), Goroutines: append(append(goroutines(leak, 10, 11, 12), goroutines(stable, 1, 2)...), goroutines(shrinking, 3)...)},
+		{Time: now.Add(2 * time.Minute), Goroutines: append(append(goroutines(leak, 10, 11, 12, 13, 14), goroutines(stable, 1, 2)...), goroutines(shrinking, 3, 4, 15)...)},
+	}
+	leaks := FindLeaks(snapshots, AnyPointer)
+	ut.AssertEqual(t, 1, len(leaks))
+	ut.AssertEqual(t, []int{1, 3, 5}, leaks[0].Counts)
+	ut.AssertEqual(t, 4, leaks[0].Growth)
+	ut.AssertEqual(t, 4./120., leaks[0].Rate)
+	ut.AssertEqual(t, []int{14, 13, 12, 11}, leaks[0].Examples)
+	ut.AssertEqual(t, "main.serve", leaks[0].Bucket.CreatedBy.Func.Raw)
+
+	ut.AssertEqual(t, []LeakSuspect(nil), FindLeaks(snapshots[:1], AnyPointer))
+}
@@ -0,0 +1,58 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// ParseLenient parses a lone stack, e.g. from debug.Stack(),
+// runtime.Stack(buf, false) or a logger printing the stack of an error.
+//
+// Unlike ParseDump, the goroutine header is optional. Without one, the stack
+// starting at the first function line followed by a source line is returned as
+// a goroutine with ID 0 in the "running" state. The function lines may also
+// omit the arguments, e.g. "main.main" instead of "main.main()", as printed by
+// some loggers.
+//
+// The whole input is read in memory, it is meant for snippets.
+func ParseLenient(r io.Reader, out io.Writer) ([]Goroutine, error) {
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.SplitAfter(string(raw), "\n")
+	header := false
+	for _, l := range lines {
+		if reRoutineHeader.MatchString(trimCR(l)) {
+			header = true
+			break
+		}
+	}
+	buf := bytes.Buffer{}
+	for i, l := range lines {
+		if i+1 < len(lines) && reFile.MatchString(trimCR(lines[i+1])) {
+			l = trimCR(l)
+			if reBareFunc.MatchString(l) && !reFunc.MatchString(l) {
+				l = l[:len(l)-1] + "()\n"
+			}
+			if !header && reFunc.MatchString(l) {
+				buf.WriteString("goroutine 0 [running]:\n")
+				header = true
+			}
+		}
+		buf.WriteString(l)
+	}
+	return ParseDump(&buf, out)
+}
+
+// Private stuff.
+
+// reBareFunc matches a function name printed without arguments.
+var reBareFunc = regexp.MustCompile(`^[^\s]+\n$`)
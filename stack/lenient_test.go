@@ -0,0 +1,100 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestParseLenient(t *testing.T) {
+	t.Parallel()
+	// A stack without a header, with and without arguments, surrounded by log
+	// lines.
+	data := []string{
+		"2024/05/01 12:00:00 request failed:",
+		"main.(*server).handle(0xc000012345)",
+		"\t/home/user/src/app/main.go:42 +0x1d",
+		"main.main",
+		"\t/home/user/src/app/main.go:12",
+		"2024/05/01 12:00:01 next request",
+		"",
+	}
+	extra := &bytes.Buffer{}
+	goroutines, err := ParseLenient(bytes.NewBufferString(strings.Join(data, "\n")), extra)
+	ut.AssertEqual(t, nil, err)
+	expected := []Goroutine{
+		{
+			Signature: Signature{
+				State: "running",
+				Stack: Stack{
+					Calls: []Call{
+						{
+							SourcePath: "/home/user/src/app/main.go",
+							Line:       42,
+							Offset:     0x1d,
+							Func:       Function{"main.(*server).handle"},
+							Args:       Args{Values: []Arg{{Value: 0xc000012345}}},
+						},
+						{
+							SourcePath: "/home/user/src/app/main.go",
+							Line:       12,
+							Func:       Function{"main.main"},
+						},
+					},
+				},
+			},
+			First: true,
+		},
+	}
+	ut.AssertEqual(t, expected, goroutines)
+	ut.AssertEqual(t, "2024/05/01 12:00:00 request failed:\n2024/05/01 12:00:01 next request\n", extra.String())
+
+	// Windows line endings.
+	goroutines, err = ParseLenient(bytes.NewBufferString(strings.Join(data, "\r\n")), &bytes.Buffer{})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, expected, goroutines)
+}
+
+func TestParseLenientCrashed(t *testing.T) {
+	t.Parallel()
+	// A recovered panic logged without the goroutine header nor the
+	// arguments.
+	data := []string{
+		"panic: boom [recovered]",
+		"runtime.gopanic",
+		"\t/usr/local/go/src/runtime/panic.go:884",
+		"main.main",
+		"\t/home/user/src/app/main.go:12",
+		"",
+	}
+	goroutines, err := ParseLenient(bytes.NewBufferString(strings.Join(data, "\n")), &bytes.Buffer{})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 1, len(goroutines))
+	ut.AssertEqual(t, true, goroutines[0].Crashed)
+}
+
+func TestParseLenientHeader(t *testing.T) {
+	t.Parallel()
+	// debug.Stack() output, not followed by an empty line.
+	data := []string{
+		"goroutine 7 [running]:",
+		"runtime/debug.Stack()",
+		"\t/usr/local/go/src/runtime/debug/stack.go:24 +0x5e",
+		"main.main()",
+		"\t/home/user/src/app/main.go:12 +0x17",
+		"done",
+	}
+	extra := &bytes.Buffer{}
+	goroutines, err := ParseLenient(bytes.NewBufferString(strings.Join(data, "\n")), extra)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 1, len(goroutines))
+	ut.AssertEqual(t, 7, goroutines[0].ID)
+	ut.AssertEqual(t, 2, len(goroutines[0].Stack.Calls))
+	ut.AssertEqual(t, "done", extra.String())
+}
@@ -0,0 +1,43 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bufio"
+	"io"
+)
+
+// Private stuff.
+
+// lineReader is an io.Reader returning the lines of r transformed by fn.
+//
+// fn is called with each line, '\n' included except on the last line if r
+// doesn't end with one. It may return multiple lines or none.
+type lineReader struct {
+	r   *bufio.Reader
+	fn  func(line string) string
+	buf string
+	err error
+}
+
+func newLineReader(r io.Reader, fn func(line string) string) *lineReader {
+	return &lineReader{r: bufio.NewReader(r), fn: fn}
+}
+
+func (l *lineReader) Read(b []byte) (int, error) {
+	for len(l.buf) == 0 {
+		if l.err != nil {
+			return 0, l.err
+		}
+		var line string
+		line, l.err = l.r.ReadString('\n')
+		if line != "" {
+			l.buf = l.fn(line)
+		}
+	}
+	n := copy(b, l.buf)
+	l.buf = l.buf[n:]
+	return n, nil
+}
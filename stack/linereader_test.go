@@ -0,0 +1,33 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestLineReader(t *testing.T) {
+	t.Parallel()
+	var lines []string
+	r := newLineReader(bytes.NewBufferString("a\nskip\nb\nc"), func(line string) string {
+		lines = append(lines, line)
+		switch line {
+		case "skip\n":
+			return ""
+		case "b\n":
+			return "b1\nb2\n"
+		}
+		return strings.ToUpper(line)
+	})
+	b, err := ioutil.ReadAll(r)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "A\nb1\nb2\nC", string(b))
+	ut.AssertEqual(t, []string{"a\n", "skip\n", "b\n", "c"}, lines)
+}
@@ -0,0 +1,67 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"io"
+	"regexp"
+	"strings"
+)
+
+// StripMarkdown returns a reader that removes the Markdown wrapping of a dump
+// pasted in a GitHub issue or a chat message, so it can be parsed.
+//
+// The "```" code fences sharing a line with the dump are removed, e.g.
+// "```goroutine 1 [running]:" as often pasted in Slack. The fences on their
+// own line are left alone, they are not part of the dump. The "> "
+// blockquote prefix is removed once a quoted line is the start of a dump, e.g.
+// "> panic: boom"; the lines before are returned untouched.
+func StripMarkdown(r io.Reader) io.Reader {
+	return newLineReader(r, (&markdownStripper{}).strip)
+}
+
+// Private stuff.
+
+var (
+	// reBlockquote matches the prefix of a blockquote line, possibly nested.
+	reBlockquote = regexp.MustCompile(`^(?:> ?)+`)
+	// reFenceInfo matches the info string following an opening fence, e.g.
+	// "go".
+	reFenceInfo = regexp.MustCompile(`^[\w+-]*$`)
+)
+
+// markdownStripper tracks if the dump is quoted.
+type markdownStripper struct {
+	quoted bool
+}
+
+// strip removes the blockquote prefix and the fences from line.
+func (m *markdownStripper) strip(line string) string {
+	if loc := reBlockquote.FindStringIndex(line); loc != nil {
+		if m.quoted {
+			return stripFences(line[loc[1]:])
+		}
+		if rest := stripFences(line[loc[1]:]); isDumpStart(trimCR(rest)) {
+			m.quoted = true
+			return rest
+		}
+		return line
+	}
+	return stripFences(line)
+}
+
+// stripFences removes the code fences at the start and the end of line,
+// unless the line is only a fence.
+func stripFences(line string) string {
+	body := strings.TrimRight(line, "\r\n")
+	eol := line[len(body):]
+	if strings.HasPrefix(body, "```") && !reFenceInfo.MatchString(body[3:]) {
+		body = body[3:]
+	}
+	if strings.HasSuffix(body, "```") && !strings.HasPrefix(body, "```") {
+		body = strings.TrimRight(body[:len(body)-3], " ")
+	}
+	return body + eol
+}
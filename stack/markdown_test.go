@@ -0,0 +1,57 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestStripMarkdown(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"It crashed with:",
+		"```go",
+		"panic: boom",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"	/home/user/src/app/main.go:12 +0x17",
+		"```",
+		"",
+		"```goroutine 2 [chan receive]:",
+		"main.f()",
+		"	/home/user/src/app/main.go:20 +0x10```",
+		"",
+	}
+	b, err := ioutil.ReadAll(StripMarkdown(bytes.NewBufferString(strings.Join(data, "\n"))))
+	ut.AssertEqual(t, nil, err)
+	expected := append([]string{}, data...)
+	expected[9] = "goroutine 2 [chan receive]:"
+	expected[11] = "	/home/user/src/app/main.go:20 +0x10"
+	ut.AssertEqual(t, strings.Join(expected, "\n"), string(b))
+}
+
+func TestStripMarkdownBlockquote(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"> I saw this:",
+		"> panic: boom",
+		">",
+		"> goroutine 1 [running]:",
+		"> main.main()",
+		"> 	/home/user/src/app/main.go:12 +0x17",
+		"",
+	}
+	s, err := ParseSnapshot(StripMarkdown(bytes.NewBufferString(strings.Join(data, "\n"))), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "boom", s.Panic)
+	ut.AssertEqual(t, 1, len(s.Goroutines))
+	ut.AssertEqual(t, 12, s.Goroutines[0].Stack.Calls[0].Line)
+}
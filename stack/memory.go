@@ -0,0 +1,86 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import "fmt"
+
+// MinStackSize is the size of the stack allocated to a new goroutine.
+const MinStackSize = 2048
+
+// StackUsage returns the number of bytes of stack used by the goroutine when
+// the dump was taken.
+//
+// It is computed from the frame and stack pointers, which are only printed
+// with GOTRACEBACK=system or crash. It returns false when they are not
+// available.
+func (g *Goroutine) StackUsage() (uint64, bool) {
+	var lo, hi uint64
+	for i := range g.Stack.Calls {
+		c := &g.Stack.Calls[i]
+		if c.FP == 0 || c.SP == 0 {
+			continue
+		}
+		if lo == 0 || c.SP < lo {
+			lo = c.SP
+		}
+		if c.FP > hi {
+			hi = c.FP
+		}
+	}
+	if lo == 0 || hi <= lo {
+		return 0, false
+	}
+	return hi - lo, true
+}
+
+// StackSize estimates the size of the stack allocated to the goroutine.
+//
+// Stacks start at MinStackSize and double each time they overflow, so the
+// estimate is the usage rounded up to the next power of two. It is a lower
+// bound since the runtime only shrinks a stack during a GC when a quarter of
+// it is used. MinStackSize is returned when the usage is unknown.
+func (g *Goroutine) StackSize() uint64 {
+	used, ok := g.StackUsage()
+	if !ok {
+		return MinStackSize
+	}
+	size := uint64(MinStackSize)
+	for size < used {
+		size *= 2
+	}
+	return size
+}
+
+// StackMemory estimates the stack memory allocated to the goroutines of the
+// bucket.
+//
+// measured is the number of goroutines whose usage was known. The other ones
+// are assumed to use MinStackSize, so the total is only meaningful when most
+// goroutines were measured.
+func (b *Bucket) StackMemory() (total uint64, measured int) {
+	for i := range b.Routines {
+		if _, ok := b.Routines[i].StackUsage(); ok {
+			measured++
+		}
+		total += b.Routines[i].StackSize()
+	}
+	return total, measured
+}
+
+// Private stuff.
+
+// formatBytes returns a human readable size.
+func formatBytes(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%dB", b)
+	}
+	div, exp := uint64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,50 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestStackMemory(t *testing.T) {
+	t.Parallel()
+	frames := func(fpsp ...uint64) Goroutine {
+		g := Goroutine{}
+		for i := 0; i < len(fpsp); i += 2 {
+			g.Stack.Calls = append(g.Stack.Calls, Call{FP: fpsp[i], SP: fpsp[i+1]})
+		}
+		return g
+	}
+	small := frames(0xc208018f68, 0xc208018f40, 0xc208018fe8, 0xc208018fe0)
+	used, ok := small.StackUsage()
+	ut.AssertEqual(t, true, ok)
+	ut.AssertEqual(t, uint64(0xa8), used)
+	ut.AssertEqual(t, uint64(MinStackSize), small.StackSize())
+
+	big := frames(0xc20cfc66d8, 0xc20cfc4470, 0xc20cfc8000, 0xc20cfc66d8)
+	used, ok = big.StackUsage()
+	ut.AssertEqual(t, true, ok)
+	ut.AssertEqual(t, uint64(0x3b90), used)
+	ut.AssertEqual(t, uint64(16384), big.StackSize())
+
+	unknown := Goroutine{Signature: Signature{Stack: Stack{Calls: []Call{{Func: Function{"main.main"}}}}}}
+	_, ok = unknown.StackUsage()
+	ut.AssertEqual(t, false, ok)
+	ut.AssertEqual(t, uint64(MinStackSize), unknown.StackSize())
+
+	b := Bucket{Routines: []Goroutine{small, big, unknown}}
+	total, measured := b.StackMemory()
+	ut.AssertEqual(t, uint64(2048+16384+2048), total)
+	ut.AssertEqual(t, 2, measured)
+}
+
+func TestFormatBytes(t *testing.T) {
+	t.Parallel()
+	ut.AssertEqual(t, "512B", formatBytes(512))
+	ut.AssertEqual(t, "2.0KiB", formatBytes(2048))
+	ut.AssertEqual(t, "1.5MiB", formatBytes(3<<19))
+}
@@ -0,0 +1,150 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MinMutexPileUp is the number of goroutines waiting to lock a mutex at the
+// same call site from which MutexPileUps reports them.
+var MinMutexPileUp = 5
+
+// MutexPileUp is a group of goroutines waiting to lock a mutex at the same
+// call site.
+type MutexPileUp struct {
+	// Site is the call to Lock or RLock.
+	Site Call
+	// Addr is the address of the mutex. It is 0 when the receiver is not
+	// printed or differs between the goroutines.
+	Addr uint64
+	// Waiters are the IDs of the goroutines waiting, in dump order.
+	Waiters []int
+	// Holders are the IDs of the goroutines likely holding the mutex, in dump
+	// order. It may be empty.
+	Holders []int
+}
+
+// MutexPileUps returns the call sites where at least MinMutexPileUp
+// goroutines wait to lock a sync.Mutex or a sync.RWMutex, the most waiters
+// first.
+//
+// The holder can't be known for sure from a dump. The likely holders are the
+// goroutines not waiting that have the mutex address in their arguments or,
+// when the address is unknown, that are in the function of the call site,
+// i.e. past the Lock call.
+func MutexPileUps(goroutines []Goroutine) []MutexPileUp {
+	var out []MutexPileUp
+	sites := map[string]int{}
+	waiting := map[int]bool{}
+	for i := range goroutines {
+		g := &goroutines[i]
+		k := g.lockFrame()
+		if k == -1 || k+1 >= len(g.Stack.Calls) {
+			continue
+		}
+		waiting[g.ID] = true
+		site := &g.Stack.Calls[k+1]
+		var addr uint64
+		if args := g.Stack.Calls[k].Args.Values; len(args) != 0 {
+			addr = args[0].Value
+		}
+		key := fmt.Sprintf("%s:%d", site.SourcePath, site.Line)
+		j, ok := sites[key]
+		if !ok {
+			j = len(out)
+			sites[key] = j
+			out = append(out, MutexPileUp{Site: *site, Addr: addr})
+		} else if out[j].Addr != addr {
+			out[j].Addr = 0
+		}
+		out[j].Waiters = append(out[j].Waiters, g.ID)
+	}
+	filtered := out[:0]
+	for _, m := range out {
+		if len(m.Waiters) < MinMutexPileUp {
+			continue
+		}
+		for i := range goroutines {
+			g := &goroutines[i]
+			if waiting[g.ID] {
+				continue
+			}
+			if m.Addr != 0 && g.Stack.references(m.Addr) || m.Addr == 0 && g.Stack.hasFunc(m.Site.Func.Raw) {
+				m.Holders = append(m.Holders, g.ID)
+			}
+		}
+		filtered = append(filtered, m)
+	}
+	sort.Stable(mutexesByWaiters(filtered))
+	return filtered
+}
+
+// Private stuff.
+
+// lockFuncs are the sync functions that block until the mutex is acquired.
+var lockFuncs = map[string]bool{
+	"sync.(*Mutex).Lock":    true,
+	"sync.(*RWMutex).Lock":  true,
+	"sync.(*RWMutex).RLock": true,
+}
+
+// lockFrame returns the index of the outermost Lock or RLock call of the
+// goroutine if it is blocked acquiring a mutex, -1 otherwise.
+func (g *Goroutine) lockFrame() int {
+	if !strings.HasPrefix(g.State, "semacquire") && !strings.HasPrefix(g.State, "sync.") {
+		return -1
+	}
+	out := -1
+	for i := range g.Stack.Calls {
+		if lockFuncs[g.Stack.Calls[i].Func.Raw] {
+			out = i
+		}
+	}
+	return out
+}
+
+// mutexAnalyzer reports the mutex pile-ups.
+type mutexAnalyzer struct{}
+
+func (mutexAnalyzer) Name() string {
+	return "mutex"
+}
+
+func (mutexAnalyzer) Analyze(s *Snapshot, buckets Buckets) []Finding {
+	var out []Finding
+	for _, m := range MutexPileUps(s.Goroutines) {
+		msg := fmt.Sprintf("%d goroutines are waiting to lock a mutex at %s in %s", len(m.Waiters), m.Site.SourceLine(), m.Site.Func.PkgDotName())
+		switch len(m.Holders) {
+		case 0:
+		case 1:
+			msg += fmt.Sprintf("; likely held by goroutine %d", m.Holders[0])
+		default:
+			msg += fmt.Sprintf("; likely held by one of %d goroutines", len(m.Holders))
+		}
+		out = append(out, Finding{
+			Severity:    SeverityWarning,
+			Buckets:     bucketIndexes(buckets, append(append([]int{}, m.Waiters...), m.Holders...)),
+			Explanation: msg,
+		})
+	}
+	return out
+}
+
+type mutexesByWaiters []MutexPileUp
+
+func (m mutexesByWaiters) Len() int {
+	return len(m)
+}
+
+func (m mutexesByWaiters) Less(i, j int) bool {
+	return len(m[i].Waiters) > len(m[j].Waiters)
+}
+
+func (m mutexesByWaiters) Swap(i, j int) {
+	m[i], m[j] = m[j], m[i]
+}
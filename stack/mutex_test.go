@@ -0,0 +1,69 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestMutexPileUps(t *testing.T) {
+	t.Parallel()
+	var data []string
+	for _, id := range []string{"10", "11", "12", "13", "14"} {
+		data = append(data,
+			"goroutine "+id+" [sync.Mutex.Lock]:",
+			"sync.runtime_SemacquireMutex(0xc000012345, 0x0, 0x1)",
+			"	/goroot/src/runtime/sema.go:77 +0x25",
+			"sync.(*Mutex).lockSlow(0xc000012340)",
+			"	/goroot/src/sync/mutex.go:171 +0x165",
+			"sync.(*Mutex).Lock(0xc000012340)",
+			"	/goroot/src/sync/mutex.go:90 +0x32",
+			"main.(*cache).get(0xc000012340, 0x1)",
+			"	/home/user/src/main.go:42 +0x45",
+			"")
+	}
+	data = append(data,
+		// Below the threshold.
+		"goroutine 20 [semacquire]:",
+		"sync.runtime_SemacquireMutex(0xc000022345, 0x0, 0x1)",
+		"	/goroot/src/runtime/sema.go:77 +0x25",
+		"sync.(*RWMutex).RLock(0xc000022340)",
+		"	/goroot/src/sync/rwmutex.go:71 +0x32",
+		"main.(*store).read(0xc000022340)",
+		"	/home/user/src/main.go:60 +0x45",
+		"",
+		// The holder.
+		"goroutine 7 [IO wait]:",
+		"main.fetch(0x2)",
+		"	/home/user/src/main.go:80 +0x45",
+		"main.(*cache).get(0xc000012340, 0x2)",
+		"	/home/user/src/main.go:45 +0x45",
+		"",
+		"goroutine 8 [select]:",
+		"main.main()",
+		"	/home/user/src/main.go:22 +0x40",
+		"")
+	s, err := ParseSnapshot(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	m := MutexPileUps(s.Goroutines)
+	ut.AssertEqual(t, 1, len(m))
+	ut.AssertEqual(t, "main.(*cache).get", m[0].Site.Func.Raw)
+	ut.AssertEqual(t, 42, m[0].Site.Line)
+	ut.AssertEqual(t, uint64(0xc000012340), m[0].Addr)
+	ut.AssertEqual(t, []int{10, 11, 12, 13, 14}, m[0].Waiters)
+	ut.AssertEqual(t, []int{7}, m[0].Holders)
+
+	buckets := SortBuckets(Bucketize(s.Goroutines, AnyPointer))
+	f := mutexAnalyzer{}.Analyze(s, buckets)
+	ut.AssertEqual(t, 1, len(f))
+	ut.AssertEqual(t, "5 goroutines are waiting to lock a mutex at main.go:42 in main.(*cache).get; likely held by goroutine 7", f[0].Explanation)
+	ut.AssertEqual(t, 2, len(f[0].Buckets))
+	ut.AssertEqual(t, 7, buckets[f[0].Buckets[1]].Routines[0].ID)
+}
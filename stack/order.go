@@ -0,0 +1,170 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// BucketOrder compares two buckets. It returns a negative number if l goes
+// first, a positive one if r goes first and 0 if it can't tell them apart.
+type BucketOrder func(l, r *Bucket) int
+
+// BucketOrders are the orders by name, as accepted by ParseBucketOrders. Add
+// to it to make a custom order selectable.
+var BucketOrders = map[string]BucketOrder{
+	"crashed": ByCrashed,
+	"count":   ByCount,
+	"wait":    ByWait,
+	"state":   ByState,
+	"private": ByScore(PrivateCalls),
+	"default": ByDefault,
+}
+
+// Scorer rates how important a bucket is, the higher the more important.
+type Scorer func(b *Bucket) int
+
+// ByScore returns the order putting the buckets with the highest score first.
+func ByScore(s Scorer) BucketOrder {
+	return func(l, r *Bucket) int {
+		return s(r) - s(l)
+	}
+}
+
+// PrivateCalls is the score of the default order: the number of calls outside
+// the standard library and Criteria.FrameworkPrefixes, so the program's own
+// code comes first.
+func PrivateCalls(b *Bucket) int {
+	private, _ := b.Stack.depths()
+	return private
+}
+
+// ByCrashed puts the bucket with a Crashed goroutine first, then the one with
+// the first goroutine, normally the one that crashed.
+func ByCrashed(l, r *Bucket) int {
+	if lCrashed, rCrashed := l.Crashed(), r.Crashed(); lCrashed != rCrashed {
+		if lCrashed {
+			return -1
+		}
+		return 1
+	}
+	if lFirst, rFirst := l.First(), r.First(); lFirst != rFirst {
+		if lFirst {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+// ByCount puts the buckets with the most goroutines first.
+func ByCount(l, r *Bucket) int {
+	return len(r.Routines) - len(l.Routines)
+}
+
+// ByWait puts the bucket whose oldest goroutine has been blocked the longest
+// first.
+func ByWait(l, r *Bucket) int {
+	// Signature.Merge keeps the longest duration so SleepMax is Age().Oldest
+	// without sorting the goroutines.
+	return r.SleepMax - l.SleepMax
+}
+
+// ByState sorts the buckets alphabetically by state, so the goroutines
+// blocked on the same kind of operation are together.
+func ByState(l, r *Bucket) int {
+	return strings.Compare(l.State, r.State)
+}
+
+// ByDefault is the order of SortBuckets, Bucket.Less: ByCrashed, then
+// ByScore(PrivateCalls), then ByCount, then Signature.Less and finally the
+// lowest goroutine ID first.
+func ByDefault(l, r *Bucket) int {
+	if l.Less(r) {
+		return -1
+	}
+	if r.Less(l) {
+		return 1
+	}
+	return 0
+}
+
+// SortBucketsBy sorts the buckets by the first order, then by the next one
+// for the buckets the first can't tell apart and so on. Buckets none of the
+// orders can tell apart keep their order.
+func SortBucketsBy(buckets Buckets, orders ...BucketOrder) {
+	sort.Stable(&bucketsBy{buckets, orders})
+}
+
+// SortBucketsWith creates a list of Bucket like SortBuckets but sorted by the
+// orders as SortBucketsBy does. The ties are broken by ByDefault so the result
+// doesn't depend on the map order.
+func SortBucketsWith(buckets map[*Signature][]Goroutine, orders ...BucketOrder) Buckets {
+	out := make(Buckets, 0, len(buckets))
+	for signature, count := range buckets {
+		out = append(out, Bucket{Signature: *signature, Routines: count})
+	}
+	SortBucketsBy(out, append(append([]BucketOrder{}, orders...), ByDefault)...)
+	return out
+}
+
+// ParseBucketOrders returns the orders of a comma separated list of names of
+// BucketOrders, e.g. "crashed,wait,count".
+func ParseBucketOrders(s string) ([]BucketOrder, error) {
+	var out []BucketOrder
+	for _, name := range strings.Split(s, ",") {
+		o, ok := BucketOrders[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("invalid bucket order %q; use crashed, count, wait, state, private or default", name)
+		}
+		out = append(out, o)
+	}
+	return out, nil
+}
+
+// Remainder is the buckets trimmed by Top.
+type Remainder struct {
+	Buckets    int
+	Goroutines int
+}
+
+// Top returns the first n buckets, normally the most important ones once
+// sorted, and the count of the others. n <= 0 keeps all the buckets.
+func Top(buckets Buckets, n int) (Buckets, Remainder) {
+	if n <= 0 || len(buckets) <= n {
+		return buckets, Remainder{}
+	}
+	r := Remainder{Buckets: len(buckets) - n}
+	for i := n; i < len(buckets); i++ {
+		r.Goroutines += len(buckets[i].Routines)
+	}
+	return buckets[:n], r
+}
+
+// Private stuff.
+
+type bucketsBy struct {
+	buckets Buckets
+	orders  []BucketOrder
+}
+
+func (b *bucketsBy) Len() int {
+	return len(b.buckets)
+}
+
+func (b *bucketsBy) Less(i, j int) bool {
+	for _, o := range b.orders {
+		if c := o(&b.buckets[i], &b.buckets[j]); c != 0 {
+			return c < 0
+		}
+	}
+	return false
+}
+
+func (b *bucketsBy) Swap(i, j int) {
+	b.buckets[i], b.buckets[j] = b.buckets[j], b.buckets[i]
+}
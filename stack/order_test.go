@@ -0,0 +1,99 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestSortBucketsBy(t *testing.T) {
+	t.Parallel()
+	bucket := func(id int, state string, sleep, count int, first bool) Bucket {
+		b := Bucket{Signature: Signature{State: state, SleepMax: sleep}}
+		for i := 0; i < count; i++ {
+			b.Routines = append(b.Routines, Goroutine{ID: id + i, First: first && i == 0})
+		}
+		return b
+	}
+	ids := func(buckets Buckets) []int {
+		out := make([]int, len(buckets))
+		for i := range buckets {
+			out[i] = buckets[i].Routines[0].ID
+		}
+		return out
+	}
+	buckets := Buckets{
+		bucket(10, "select", 5, 1, false),
+		bucket(20, "chan receive", 60, 3, false),
+		bucket(30, "running", 0, 1, true),
+		bucket(40, "chan receive", 5, 3, false),
+		bucket(50, "select", 60, 2, false),
+	}
+	SortBucketsBy(buckets, ByCount)
+	ut.AssertEqual(t, []int{20, 40, 50, 10, 30}, ids(buckets))
+	SortBucketsBy(buckets, ByWait, ByCount)
+	ut.AssertEqual(t, []int{20, 50, 40, 10, 30}, ids(buckets))
+	SortBucketsBy(buckets, ByCrashed, ByState, ByWait)
+	ut.AssertEqual(t, []int{30, 20, 40, 50, 10}, ids(buckets))
+
+	orders, err := ParseBucketOrders("crashed, Count")
+	ut.AssertEqual(t, nil, err)
+	SortBucketsBy(buckets, orders...)
+	ut.AssertEqual(t, []int{30, 20, 40, 50, 10}, ids(buckets))
+	_, err = ParseBucketOrders("count,age")
+	ut.AssertEqual(t, "invalid bucket order \"age\"; use crashed, count, wait, state, private or default", err.Error())
+}
+
+func TestTop(t *testing.T) {
+	t.Parallel()
+	buckets := Buckets{
+		{Routines: []Goroutine{{ID: 1}, {ID: 2}}},
+		{Routines: []Goroutine{{ID: 3}}},
+		{Routines: []Goroutine{{ID: 4}, {ID: 5}, {ID: 6}}},
+		{Routines: []Goroutine{{ID: 7}}},
+	}
+	top, r := Top(buckets, 2)
+	ut.AssertEqual(t, buckets[:2], top)
+	ut.AssertEqual(t, Remainder{Buckets: 2, Goroutines: 4}, r)
+	ut.AssertEqual(t, "and 2 more signatures (4 goroutines)\n", (&Palette{}).RemainderLine(r))
+
+	top, r = Top(buckets, 0)
+	ut.AssertEqual(t, buckets, top)
+	ut.AssertEqual(t, Remainder{}, r)
+	ut.AssertEqual(t, "", (&Palette{}).RemainderLine(r))
+	top, r = Top(buckets, 4)
+	ut.AssertEqual(t, buckets, top)
+	ut.AssertEqual(t, Remainder{}, r)
+}
+
+func TestSortBucketsWith(t *testing.T) {
+	t.Parallel()
+	user := Call{SourcePath: "/src/main.go", Line: 10, Func: Function{"main.a"}}
+	std := Call{SourcePath: goroot + "/src/reflect/value.go", Line: 2125, Func: Function{"reflect.Value.assignTo"}}
+	goroutines := []Goroutine{
+		{Signature: Signature{State: "select", Stack: Stack{Calls: []Call{std}}}, ID: 1},
+		{Signature: Signature{State: "select", Stack: Stack{Calls: []Call{user, std}}}, ID: 2},
+		{Signature: Signature{State: "select", Stack: Stack{Calls: []Call{user, user}}}, ID: 3},
+		{Signature: Signature{State: "select", Stack: Stack{Calls: []Call{std}}}, ID: 4},
+	}
+	ids := func(buckets Buckets) []int {
+		out := make([]int, len(buckets))
+		for i := range buckets {
+			out[i] = buckets[i].Routines[0].ID
+		}
+		return out
+	}
+	ut.AssertEqual(t, []int{3, 2, 1}, ids(SortBuckets(Bucketize(goroutines, AnyPointer))))
+	ut.AssertEqual(t, []int{3, 2, 1}, ids(SortBucketsWith(Bucketize(goroutines, AnyPointer))))
+	ut.AssertEqual(t, []int{1, 3, 2}, ids(SortBucketsWith(Bucketize(goroutines, AnyPointer), ByCount)))
+	// A custom score: the fewer calls the more important.
+	shallow := func(b *Bucket) int {
+		return -len(b.Stack.Calls)
+	}
+	ut.AssertEqual(t, []int{1, 3, 2}, ids(SortBucketsWith(Bucketize(goroutines, AnyPointer), ByScore(shallow))))
+	ut.AssertEqual(t, 2, PrivateCalls(&Bucket{Signature: goroutines[2].Signature}))
+}
@@ -0,0 +1,263 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// ParseProfileProto parses a goroutine profile in the protocol buffer format
+// served by /debug/pprof/goroutine, compressed or not.
+//
+// Like ParseProfile, each sample is returned as a bucket with as many
+// Routines as the sample count. Inlined calls are expanded and marked as
+// Inlined.
+func ParseProfileProto(r io.Reader) (Buckets, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) >= 2 && b[0] == 0x1f && b[1] == 0x8b {
+		z, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		if b, err = ioutil.ReadAll(z); err != nil {
+			return nil, err
+		}
+	}
+	p := &pprofProfile{functions: map[uint64]pprofFunction{}, locations: map[uint64][]pprofLine{}}
+	if err := p.parse(b); err != nil {
+		return nil, err
+	}
+	var buckets Buckets
+	for _, s := range p.samples {
+		bucket := Bucket{}
+		for _, id := range s.locations {
+			lines := p.locations[id]
+			for i, l := range lines {
+				f := p.functions[l.function]
+				bucket.Stack.Calls = append(bucket.Stack.Calls, Call{
+					SourcePath: p.str(f.filename),
+					Line:       int(l.line),
+					Func:       Function{p.str(f.name)},
+					// All but the last line of a location are inlined in the next one.
+					Inlined: i != len(lines)-1,
+				})
+			}
+		}
+		var labels map[string]string
+		for _, l := range s.labels {
+			if l.str == 0 {
+				continue
+			}
+			if labels == nil {
+				labels = map[string]string{}
+			}
+			labels[p.str(l.key)] = p.str(l.str)
+		}
+		g := Goroutine{Signature: bucket.Signature, Labels: labels}
+		for i := int64(0); i < s.count; i++ {
+			bucket.Routines = append(bucket.Routines, g)
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, nil
+}
+
+// Private stuff.
+
+// pprofProfile is the subset of profile.proto needed for goroutine profiles.
+//
+// See https://github.com/google/pprof/blob/master/proto/profile.proto.
+type pprofProfile struct {
+	samples   []pprofSample
+	locations map[uint64][]pprofLine
+	functions map[uint64]pprofFunction
+	strings   []string
+}
+
+type pprofSample struct {
+	locations []uint64
+	count     int64
+	labels    []pprofLabel
+}
+
+type pprofLabel struct {
+	key, str int64
+}
+
+type pprofLine struct {
+	function uint64
+	line     int64
+}
+
+type pprofFunction struct {
+	name, filename int64
+}
+
+var errProto = errors.New("invalid pprof profile")
+
+func (p *pprofProfile) str(i int64) string {
+	if i < 0 || i >= int64(len(p.strings)) {
+		return ""
+	}
+	return p.strings[i]
+}
+
+func (p *pprofProfile) parse(b []byte) error {
+	return protoFields(b, func(field int, v uint64, data []byte) error {
+		switch field {
+		case 2:
+			s := pprofSample{}
+			err := protoFields(data, func(field int, v uint64, data []byte) error {
+				switch field {
+				case 1:
+					s.locations = protoUints(s.locations, v, data)
+				case 2:
+					// The first value is the count.
+					if values := protoUints(nil, v, data); len(values) != 0 && s.count == 0 {
+						s.count = int64(values[0])
+					}
+				case 3:
+					l := pprofLabel{}
+					err := protoFields(data, func(field int, v uint64, data []byte) error {
+						switch field {
+						case 1:
+							l.key = int64(v)
+						case 2:
+							l.str = int64(v)
+						}
+						return nil
+					})
+					if err != nil {
+						return err
+					}
+					s.labels = append(s.labels, l)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			p.samples = append(p.samples, s)
+		case 4:
+			var id uint64
+			var lines []pprofLine
+			err := protoFields(data, func(field int, v uint64, data []byte) error {
+				switch field {
+				case 1:
+					id = v
+				case 4:
+					l := pprofLine{}
+					err := protoFields(data, func(field int, v uint64, data []byte) error {
+						switch field {
+						case 1:
+							l.function = v
+						case 2:
+							l.line = int64(v)
+						}
+						return nil
+					})
+					if err != nil {
+						return err
+					}
+					lines = append(lines, l)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			p.locations[id] = lines
+		case 5:
+			var id uint64
+			f := pprofFunction{}
+			err := protoFields(data, func(field int, v uint64, data []byte) error {
+				switch field {
+				case 1:
+					id = v
+				case 2:
+					f.name = int64(v)
+				case 4:
+					f.filename = int64(v)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			p.functions[id] = f
+		case 6:
+			p.strings = append(p.strings, string(data))
+		}
+		return nil
+	})
+}
+
+// protoFields calls fn for each field of the protocol buffer message. v is
+// the value of varint and fixed size fields, data is the content of length
+// delimited fields.
+func protoFields(b []byte, fn func(field int, v uint64, data []byte) error) error {
+	for len(b) != 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errProto
+		}
+		b = b[n:]
+		var v uint64
+		var data []byte
+		switch key & 7 {
+		case 0:
+			if v, n = binary.Uvarint(b); n <= 0 {
+				return errProto
+			}
+			b = b[n:]
+		case 1:
+			if len(b) < 8 {
+				return errProto
+			}
+			v, b = binary.LittleEndian.Uint64(b), b[8:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return errProto
+			}
+			data, b = b[n:n+int(l)], b[n+int(l):]
+		case 5:
+			if len(b) < 4 {
+				return errProto
+			}
+			v, b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		default:
+			return errProto
+		}
+		if err := fn(int(key>>3), v, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// protoUints appends a repeated integer field, packed (data is set) or not.
+func protoUints(out []uint64, v uint64, data []byte) []uint64 {
+	if data == nil {
+		return append(out, v)
+	}
+	for len(data) != 0 {
+		x, n := binary.Uvarint(data)
+		if n <= 0 {
+			break
+		}
+		out = append(out, x)
+		data = data[n:]
+	}
+	return out
+}
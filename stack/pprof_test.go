@@ -0,0 +1,62 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"context"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestParseProfileProto(t *testing.T) {
+	// Not parallel, the goroutines of the other tests would be in the profile.
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	ctx := pprof.WithLabels(context.Background(), pprof.Labels("request", "42"))
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go pprof.Do(ctx, pprof.Labels(), func(context.Context) {
+			wg.Done()
+			profileBlocked(done)
+		})
+	}
+	wg.Wait()
+	defer close(done)
+	b := &bytes.Buffer{}
+	ut.AssertEqual(t, nil, pprof.Lookup("goroutine").WriteTo(b, 0))
+
+	buckets, err := ParseProfileProto(b)
+	ut.AssertEqual(t, nil, err)
+	var found *Bucket
+	for i := range buckets {
+		for _, c := range buckets[i].Stack.Calls {
+			if strings.HasSuffix(c.Func.Raw, ".profileBlocked") {
+				found = &buckets[i]
+			}
+		}
+	}
+	if found == nil {
+		t.Fatalf("profileBlocked not found in %v", buckets)
+	}
+	ut.AssertEqual(t, 3, len(found.Routines))
+	ut.AssertEqual(t, map[string]string{"request": "42"}, found.Routines[0].Labels)
+	// The leaf is first, like in a dump.
+	ut.AssertEqual(t, "runtime.gopark", found.Stack.Calls[0].Func.Raw)
+}
+
+func TestParseProfileProtoInvalid(t *testing.T) {
+	t.Parallel()
+	_, err := ParseProfileProto(bytes.NewReader([]byte{0x12, 0x10, 0x01}))
+	ut.AssertEqual(t, errProto, err)
+}
+
+func profileBlocked(done chan struct{}) {
+	<-done
+}
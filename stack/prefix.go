@@ -0,0 +1,70 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"io"
+	"regexp"
+	"strings"
+)
+
+// LogPrefixes are the log line prefixes detected by StripPrefixes when no
+// prefix is specified.
+var LogPrefixes = []*regexp.Regexp{
+	// Kubernetes container runtime (CRI) log files:
+	// "2024-05-01T12:00:00.123456789Z stderr F ".
+	regexp.MustCompile(`^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d(?:\.\d+)?(?:Z|[+-]\d\d:\d\d) (?:stdout|stderr) [FP] `),
+	// glog and klog: "E0501 12:00:00.123456   12345 main.go:42] ".
+	regexp.MustCompile(`^[IWEF]\d{4} \d\d:\d\d:\d\d\.\d+ +\d+ [^ \]]+:\d+\] `),
+	// syslog: "May  1 12:00:00 host server[1234]: ".
+	regexp.MustCompile(`^[A-Z][a-z]{2} [ \d]\d \d\d:\d\d:\d\d [^ ]+ [^ :]+: `),
+	// RFC 3339 timestamps, as printed by zap, logrus or slog:
+	// "2024-05-01T12:00:00.123Z ".
+	regexp.MustCompile(`^\d{4}-\d\d-\d\d[T ]\d\d:\d\d:\d\d(?:[.,]\d+)?(?:Z|[+-]\d\d:?\d\d)?[ \t]`),
+	// Package log: "2024/05/01 12:00:00 ".
+	regexp.MustCompile(`^\d{4}/\d\d/\d\d \d\d:\d\d:\d\d(?:\.\d+)? `),
+}
+
+// StripPrefixes returns a reader that removes the prefix matched by re from
+// the lines of r, e.g. the timestamp added by a logger to each line of the
+// process' output, so the dump can be parsed.
+//
+// When re is nil, the prefix is detected on the first line that is the start
+// of a dump once one of LogPrefixes is removed, e.g. "panic: " or a goroutine
+// header. The lines before are returned untouched.
+//
+// The lines that do not have the prefix are returned untouched.
+func StripPrefixes(r io.Reader, re *regexp.Regexp) io.Reader {
+	return newLineReader(r, (&prefixStripper{re: re}).strip)
+}
+
+// Private stuff.
+
+// prefixStripper holds the prefix, once detected when not specified.
+type prefixStripper struct {
+	re *regexp.Regexp
+}
+
+// strip removes the prefix from line, detecting it first if needed.
+func (p *prefixStripper) strip(line string) string {
+	if p.re == nil {
+		for _, re := range LogPrefixes {
+			if loc := re.FindStringIndex(line); loc != nil && isDumpStart(line[loc[1]:]) {
+				p.re = re
+				return line[loc[1]:]
+			}
+		}
+		return line
+	}
+	if loc := p.re.FindStringIndex(line); loc != nil && loc[0] == 0 {
+		return line[loc[1]:]
+	}
+	return line
+}
+
+// isDumpStart returns true if the line is the first line of a dump.
+func isDumpStart(line string) bool {
+	return strings.HasPrefix(line, "panic: ") || strings.HasPrefix(line, "fatal error: ") || reRoutineHeader.MatchString(line)
+}
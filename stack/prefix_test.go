@@ -0,0 +1,69 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestStripPrefixes(t *testing.T) {
+	t.Parallel()
+	dump := []string{
+		"panic: boom",
+		"",
+		"goroutine 5 [running]:",
+		"main.main()",
+		"	/gopath/src/github.com/foo/bar/main.go:12 +0x1d",
+		"",
+	}
+	data := []struct {
+		prefix string
+		re     *regexp.Regexp
+	}{
+		{"2024-05-01T12:00:00.123456789Z stderr F ", nil},
+		{"E0501 12:00:00.123456   12345 main.go:42] ", nil},
+		{"May  1 12:00:00 host server[1234]: ", nil},
+		{"2024-05-01T12:00:00.123Z\t", nil},
+		{"2024/05/01 12:00:00 ", nil},
+		{"[server-1] ", regexp.MustCompile(`^\[[^\]]+\] `)},
+	}
+	for i, line := range data {
+		lines := []string{"starting " + line.prefix}
+		for _, l := range dump {
+			lines = append(lines, line.prefix+l)
+		}
+		b, err := ioutil.ReadAll(StripPrefixes(bytes.NewBufferString(strings.Join(lines, "\n")), line.re))
+		ut.AssertEqualIndex(t, i, nil, err)
+		// The line before the dump is not stripped when detecting the prefix.
+		first := "starting " + line.prefix
+		if line.re != nil {
+			first = "starting [server-1] "
+		}
+		ut.AssertEqualIndex(t, i, first+"\n"+strings.Join(dump, "\n"), string(b))
+	}
+}
+
+func TestStripPrefixesParse(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"2024-05-01T12:00:00Z stderr F panic: boom",
+		"2024-05-01T12:00:00Z stderr F ",
+		"2024-05-01T12:00:00Z stderr F goroutine 5 [running]:",
+		"2024-05-01T12:00:00Z stderr F main.main()",
+		"2024-05-01T12:00:00Z stderr F 	/gopath/src/github.com/foo/bar/main.go:12 +0x1d",
+		"2024-05-01T12:00:00Z stderr F ",
+	}
+	goroutines, err := ParseDump(StripPrefixes(bytes.NewBufferString(strings.Join(data, "\n")), nil), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 1, len(goroutines))
+	ut.AssertEqual(t, 5, goroutines[0].ID)
+	ut.AssertEqual(t, 12, goroutines[0].Stack.Calls[0].Line)
+}
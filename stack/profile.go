@@ -0,0 +1,101 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"encoding/json"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ParseProfile parses a goroutine profile in the aggregated text format
+// served by /debug/pprof/goroutine?debug=1.
+//
+// The profile is already aggregated by stack so each record is returned as a
+// bucket. The goroutine IDs, states and arguments are not part of the format;
+// each bucket has as many Routines as the record count, with ID 0. The
+// labels, if any, are set on the goroutines.
+func ParseProfile(r io.Reader) (Buckets, error) {
+	buckets, _, err := ParseProfileTotal(r)
+	return buckets, err
+}
+
+// ParseProfileTotal is ParseProfile that also returns the number of
+// goroutines in the "goroutine profile: total N" header, or -1 if there is
+// none.
+//
+// The total is counted by the runtime while the records are collected, so a
+// difference with the goroutines in the records means the profile was
+// truncated or mangled. See ProfileCount.
+func ParseProfileTotal(r io.Reader) (Buckets, int, error) {
+	total := -1
+	scanner := newScanner(r)
+	var buckets Buckets
+	var b *Bucket
+	count := 0
+	var labels map[string]string
+	flush := func() {
+		if b == nil {
+			return
+		}
+		g := Goroutine{Signature: b.Signature, Labels: labels}
+		for i := 0; i < count; i++ {
+			b.Routines = append(b.Routines, g)
+		}
+		buckets = append(buckets, *b)
+		b, count, labels = nil, 0, nil
+	}
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r\n")
+		if m := reProfileTotal.FindStringSubmatch(line); m != nil && b == nil && total == -1 {
+			total, _ = strconv.Atoi(m[1])
+		} else if m := reProfileRecord.FindStringSubmatch(line); m != nil {
+			flush()
+			count, _ = strconv.Atoi(m[1])
+			b = &Bucket{}
+		} else if b == nil {
+			continue
+		} else if m := reProfileFrame.FindStringSubmatch(line); m != nil {
+			c := Call{Func: Function{m[1]}}
+			c.SourcePath, c.PathSeparator = normalizePath(m[3])
+			c.Offset, _ = strconv.ParseUint(m[2], 16, 64)
+			c.Line, _ = strconv.Atoi(m[4])
+			b.Stack.Calls = append(b.Stack.Calls, c)
+		} else if m := reProfileLabels.FindStringSubmatch(line); m != nil {
+			// The labels are printed with %q, which is compatible with JSON for
+			// printable strings.
+			_ = json.Unmarshal([]byte(m[1]), &labels)
+		} else if line == "" {
+			flush()
+		}
+	}
+	flush()
+	return buckets, total, scanner.Err()
+}
+
+// ProfileCount returns the number of goroutines in the buckets, to compare
+// with the total returned by ParseProfileTotal.
+func ProfileCount(buckets Buckets) int {
+	n := 0
+	for i := range buckets {
+		n += len(buckets[i].Routines)
+	}
+	return n
+}
+
+// Private stuff.
+
+var (
+	// reProfileTotal matches "goroutine profile: total 4".
+	reProfileTotal = regexp.MustCompile(`^goroutine profile: total (\d+)$`)
+	// reProfileRecord matches "3 @ 0x43a5c5 0x406b5c 0x46a6e1".
+	reProfileRecord = regexp.MustCompile(`^(\d+) @(?: 0x[0-9a-f]+)*$`)
+	// reProfileFrame matches "#	0x46a6e0	main.main.func1+0x20	/tmp/x.go:10".
+	reProfileFrame = regexp.MustCompile(`^#\t0x[0-9a-f]+\t(.+)\+0x([0-9a-f]+)\t(.+):(\d+)$`)
+	// reProfileLabels matches "# labels: {"request":"42"}".
+	reProfileLabels = regexp.MustCompile(`^# labels: (\{.*\})$`)
+)
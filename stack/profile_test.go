@@ -0,0 +1,89 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestParseProfile(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"goroutine profile: total 4",
+		"3 @ 0x43a5c5 0x406b5c 0x406838 0x46a6e1",
+		"# labels: {\"request\":\"42\"}",
+		"#	0x406837	main.worker+0x37	/home/user/src/app/main.go:10",
+		"#	0x46a6e0	main.main.func1+0x20	/home/user/src/app/main.go:22",
+		"",
+		"1 @ 0x43a5c5 0x46a6e1",
+		"#	0x43a5c4	runtime/pprof.writeRuntimeProfile+0xa4	/usr/local/go/src/runtime/pprof/pprof.go:746",
+		"",
+	}
+	buckets, err := ParseProfile(bytes.NewBufferString(strings.Join(data, "\n")))
+	ut.AssertEqual(t, nil, err)
+	worker := Signature{
+		Stack: Stack{
+			Calls: []Call{
+				{SourcePath: "/home/user/src/app/main.go", Line: 10, Func: Function{"main.worker"}, Offset: 0x37},
+				{SourcePath: "/home/user/src/app/main.go", Line: 22, Func: Function{"main.main.func1"}, Offset: 0x20},
+			},
+		},
+	}
+	labels := map[string]string{"request": "42"}
+	profile := Signature{
+		Stack: Stack{
+			Calls: []Call{
+				{SourcePath: "/usr/local/go/src/runtime/pprof/pprof.go", Line: 746, Func: Function{"runtime/pprof.writeRuntimeProfile"}, Offset: 0xa4},
+			},
+		},
+	}
+	expected := Buckets{
+		{
+			Signature: worker,
+			Routines: []Goroutine{
+				{Signature: worker, Labels: labels},
+				{Signature: worker, Labels: labels},
+				{Signature: worker, Labels: labels},
+			},
+		},
+		{
+			Signature: profile,
+			Routines:  []Goroutine{{Signature: profile}},
+		},
+	}
+	ut.AssertEqual(t, expected, buckets)
+}
+
+func TestParseProfileTotal(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"goroutine profile: total 5",
+		"3 @ 0x43a5c5 0x406b5c 0x406838 0x46a6e1",
+		"#	0x406837	main.worker+0x37	/home/user/src/app/main.go:10",
+		"",
+		"1 @ 0x43a5c5 0x46a6e1",
+		"#	0x43a5c4	runtime/pprof.writeRuntimeProfile+0xa4	/usr/local/go/src/runtime/pprof/pprof.go:746",
+		"",
+	}
+	buckets, total, err := ParseProfileTotal(bytes.NewBufferString(strings.Join(data, "\n")))
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 5, total)
+	// The header doesn't match the records.
+	ut.AssertEqual(t, 4, ProfileCount(buckets))
+
+	_, total, err = ParseProfileTotal(bytes.NewBufferString(strings.Join(data[1:], "\n")))
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, -1, total)
+
+	// Windows line endings.
+	crlf, total, err := ParseProfileTotal(bytes.NewBufferString(strings.Join(data, "\r\n")))
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 5, total)
+	ut.AssertEqual(t, buckets, crlf)
+}
@@ -0,0 +1,153 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RaceAccess is one of the two memory accesses of a data race.
+type RaceAccess struct {
+	// Op is the operation as printed, e.g. "Write" or "Previous atomic read".
+	Op string
+	// Addr is the accessed address.
+	Addr uint64
+	// Goroutine is the ID of the goroutine doing the access. The main
+	// goroutine is 1.
+	Goroutine int
+	Stack     Stack
+}
+
+// IsWrite returns true if the access is a write.
+func (r *RaceAccess) IsWrite() bool {
+	return strings.HasSuffix(strings.ToLower(r.Op), "write")
+}
+
+// RaceReport is a "WARNING: DATA RACE" report printed by the race detector.
+type RaceReport struct {
+	// Accesses are the conflicting accesses, the current one first.
+	Accesses []RaceAccess
+	// CreatedBy is where the goroutines doing the accesses were created, by
+	// goroutine ID. The main goroutine has no entry.
+	CreatedBy map[int]Stack
+}
+
+// Goroutines returns the accesses as goroutines so reports can be bucketized
+// like goroutines.
+//
+// The state is the operation and CreatedBy is the call that started the
+// goroutine.
+func (r *RaceReport) Goroutines() []Goroutine {
+	out := make([]Goroutine, 0, len(r.Accesses))
+	for _, a := range r.Accesses {
+		g := Goroutine{
+			Signature: Signature{State: strings.ToLower(a.Op), Stack: a.Stack},
+			ID:        a.Goroutine,
+		}
+		if created := r.CreatedBy[a.Goroutine]; len(created.Calls) != 0 {
+			g.CreatedBy = created.Calls[0]
+		}
+		out = append(out, g)
+	}
+	return out
+}
+
+// ParseRaceReports parses the data race reports printed by a binary built with
+// -race, e.g. the output of go test -race.
+//
+// The lines that are not part of a report are streamed to out.
+func ParseRaceReports(r io.Reader, out io.Writer) ([]RaceReport, error) {
+	scanner := newScanner(r)
+	var reports []RaceReport
+	var report *RaceReport
+	// stack is the stack being parsed, if any. creating is the ID of the
+	// goroutine when it is a creation stack.
+	var stack *Stack
+	creating := 0
+	// separator is set when the separator preceding a report was held back.
+	separator := false
+	flush := func() {
+		if stack != nil && creating != 0 {
+			report.CreatedBy[creating] = *stack
+		}
+		stack, creating = nil, 0
+	}
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r\n")
+		if report == nil {
+			if line == raceHeader {
+				reports = append(reports, RaceReport{CreatedBy: map[int]Stack{}})
+				report = &reports[len(reports)-1]
+				separator = false
+				continue
+			}
+			if separator {
+				if _, err := io.WriteString(out, raceSeparator+"\n"); err != nil {
+					return reports, err
+				}
+			}
+			if separator = line == raceSeparator; separator {
+				continue
+			}
+			if _, err := io.WriteString(out, line+"\n"); err != nil {
+				return reports, err
+			}
+			continue
+		}
+		if line == raceSeparator {
+			flush()
+			report = nil
+		} else if line == "" {
+			flush()
+		} else if m := reRaceAccess.FindStringSubmatch(line); m != nil {
+			flush()
+			a := RaceAccess{Op: m[1], Goroutine: 1}
+			a.Addr, _ = strconv.ParseUint(m[2], 16, 64)
+			if m[3] != "" {
+				a.Goroutine, _ = strconv.Atoi(m[3])
+			}
+			report.Accesses = append(report.Accesses, a)
+			stack = &report.Accesses[len(report.Accesses)-1].Stack
+		} else if m := reRaceCreated.FindStringSubmatch(line); m != nil {
+			flush()
+			creating, _ = strconv.Atoi(m[1])
+			stack = &Stack{}
+		} else if stack == nil {
+			continue
+		} else if m := reRaceFunc.FindStringSubmatch(line); m != nil {
+			stack.Calls = append(stack.Calls, Call{Func: Function{m[1]}})
+		} else if m := reRaceFile.FindStringSubmatch(line); m != nil && len(stack.Calls) != 0 {
+			c := &stack.Calls[len(stack.Calls)-1]
+			c.SourcePath, c.PathSeparator = normalizePath(m[1])
+			c.Line, _ = strconv.Atoi(m[2])
+			if m[3] != "" {
+				c.Offset, _ = strconv.ParseUint(m[3], 16, 64)
+			}
+		}
+	}
+	if separator {
+		if _, err := io.WriteString(out, raceSeparator+"\n"); err != nil {
+			return reports, err
+		}
+	}
+	return reports, scanner.Err()
+}
+
+// Private stuff.
+
+const (
+	raceHeader    = "WARNING: DATA RACE"
+	raceSeparator = "=================="
+)
+
+var (
+	reRaceAccess  = regexp.MustCompile("^((?:Previous )?(?:[Aa]tomic )?(?:[Rr]ead|[Ww]rite)) at 0x([0-9a-f]+) by (?:main goroutine|goroutine (\\d+)):$")
+	reRaceCreated = regexp.MustCompile("^Goroutine (\\d+) \\((?:running|finished)\\) created at:$")
+	reRaceFunc    = regexp.MustCompile("^  (\\S.*)\\(\\)$")
+	reRaceFile    = regexp.MustCompile("^      (.+):(\\d+)(?: \\+0x([0-9a-f]+))?$")
+)
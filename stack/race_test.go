@@ -0,0 +1,92 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+var raceData = []string{
+	"=== RUN   TestFoo",
+	"==================",
+	"WARNING: DATA RACE",
+	"Read at 0x00c000018168 by main goroutine:",
+	"  main.main()",
+	"      /tmp/race/r.go:11 +0xb8",
+	"",
+	"Previous write at 0x00c000018168 by goroutine 7:",
+	"  main.main.func1()",
+	"      /tmp/race/r.go:8 +0x2e",
+	"",
+	"Goroutine 7 (finished) created at:",
+	"  main.main()",
+	"      /tmp/race/r.go:7 +0xa4",
+	"==================",
+	"Found 1 data race(s)",
+	"",
+}
+
+func TestParseRaceReports(t *testing.T) {
+	t.Parallel()
+	out := &bytes.Buffer{}
+	reports, err := ParseRaceReports(bytes.NewBufferString(strings.Join(raceData, "\n")), out)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "=== RUN   TestFoo\nFound 1 data race(s)\n", out.String())
+	expected := []RaceReport{
+		{
+			Accesses: []RaceAccess{
+				{
+					Op:        "Read",
+					Addr:      0xc000018168,
+					Goroutine: 1,
+					Stack:     Stack{Calls: []Call{{SourcePath: "/tmp/race/r.go", Line: 11, Offset: 0xb8, Func: Function{"main.main"}}}},
+				},
+				{
+					Op:        "Previous write",
+					Addr:      0xc000018168,
+					Goroutine: 7,
+					Stack:     Stack{Calls: []Call{{SourcePath: "/tmp/race/r.go", Line: 8, Offset: 0x2e, Func: Function{"main.main.func1"}}}},
+				},
+			},
+			CreatedBy: map[int]Stack{
+				7: {Calls: []Call{{SourcePath: "/tmp/race/r.go", Line: 7, Offset: 0xa4, Func: Function{"main.main"}}}},
+			},
+		},
+	}
+	ut.AssertEqual(t, expected, reports)
+	ut.AssertEqual(t, false, reports[0].Accesses[0].IsWrite())
+	ut.AssertEqual(t, true, reports[0].Accesses[1].IsWrite())
+
+	goroutines := reports[0].Goroutines()
+	ut.AssertEqual(t, 2, len(goroutines))
+	ut.AssertEqual(t, "previous write", goroutines[1].State)
+	ut.AssertEqual(t, 7, goroutines[1].ID)
+	ut.AssertEqual(t, "main.main", goroutines[1].CreatedBy.Func.Raw)
+}
+
+func TestParseRaceReportsCRLF(t *testing.T) {
+	t.Parallel()
+	expected, err := ParseRaceReports(bytes.NewBufferString(strings.Join(raceData, "\n")), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	out := &bytes.Buffer{}
+	reports, err := ParseRaceReports(bytes.NewBufferString(strings.Join(raceData, "\r\n")), out)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, expected, reports)
+	ut.AssertEqual(t, "=== RUN   TestFoo\nFound 1 data race(s)\n", out.String())
+}
+
+func TestParseRaceReportsNone(t *testing.T) {
+	t.Parallel()
+	out := &bytes.Buffer{}
+	reports, err := ParseRaceReports(bytes.NewBufferString("==================\nfoo\n"), out)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 0, len(reports))
+	ut.AssertEqual(t, "==================\nfoo\n", out.String())
+}
@@ -0,0 +1,73 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+// Recursion is a cycle of calls repeated in a stack, e.g. in the dump of a
+// "fatal error: stack overflow" caused by an infinite recursion.
+type Recursion struct {
+	// Start is the index in Stack.Calls of the first call of the first cycle.
+	Start int
+	// Calls are the calls of one cycle.
+	Calls []Call
+	// Count is the number of times the cycle is repeated in the dump. The
+	// runtime elides the middle of deep stacks, so the actual recursion is
+	// deeper.
+	Count int
+}
+
+// MaxRecursionPeriod is the longest cycle of calls detected by
+// Stack.Recursion.
+var MaxRecursionPeriod = 16
+
+// Recursion returns the longest cycle of calls repeated at least three times
+// in the stack, or nil if there is none.
+//
+// The calls are compared by function and line, not by arguments.
+func (s *Stack) Recursion() *Recursion {
+	var best *Recursion
+	covered := 0
+	for p := 1; p <= MaxRecursionPeriod && 3*p <= len(s.Calls); p++ {
+		// run is the number of consecutive calls equal to the one p calls
+		// later.
+		run := 0
+		for i := 0; i+p <= len(s.Calls); i++ {
+			if i+p < len(s.Calls) && sameFrame(&s.Calls[i], &s.Calls[i+p]) {
+				run++
+				continue
+			}
+			if count := run/p + 1; count >= 3 && run+p > covered {
+				start := i - run
+				best = &Recursion{Start: start, Calls: s.Calls[start : start+p], Count: count}
+				covered = run + p
+			}
+			run = 0
+		}
+	}
+	return best
+}
+
+// Private stuff.
+
+// collapse removes all the repetitions of the cycle r but the first one from
+// the stack and counts them in MiddleElided, so the stack of a stack overflow
+// isn't kept thousands of frames deep. The stack is left alone if it has
+// frames elided outside of the repetitions.
+func (s *Stack) collapse(r *Recursion) {
+	keep := r.Start + len(r.Calls)
+	end := r.Start + r.Count*len(r.Calls)
+	if s.MiddleElided != 0 && (s.MiddleIndex < keep || s.MiddleIndex > end) {
+		return
+	}
+	calls := make([]Call, 0, len(s.Calls)-end+keep)
+	calls = append(calls, s.Calls[:keep]...)
+	s.Calls = append(calls, s.Calls[end:]...)
+	s.MiddleElided += end - keep
+	s.MiddleIndex = keep
+	r.Calls = s.Calls[r.Start:keep]
+}
+
+func sameFrame(l, r *Call) bool {
+	return l.Func == r.Func && l.Line == r.Line && l.SourcePath == r.SourcePath
+}
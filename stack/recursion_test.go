@@ -0,0 +1,93 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestStackRecursion(t *testing.T) {
+	t.Parallel()
+	a := Call{SourcePath: "/home/user/src/app/main.go", Line: 10, Func: Function{"main.a"}}
+	b := Call{SourcePath: "/home/user/src/app/main.go", Line: 20, Func: Function{"main.b"}}
+	main := Call{SourcePath: "/home/user/src/app/main.go", Line: 30, Func: Function{"main.main"}}
+	// Arguments are ignored.
+	a2 := a
+	a2.Args = Args{Values: []Arg{{Value: 1}}}
+	s := Stack{Calls: []Call{a, b, a2, b, a, b, a, main}}
+	ut.AssertEqual(t, &Recursion{Start: 0, Calls: []Call{a, b}, Count: 3}, s.Recursion())
+
+	s = Stack{Calls: []Call{b, a, a, a, a, main}}
+	ut.AssertEqual(t, &Recursion{Start: 1, Calls: []Call{a}, Count: 4}, s.Recursion())
+
+	s = Stack{Calls: []Call{a, b, a, b, main}}
+	ut.AssertEqual(t, (*Recursion)(nil), s.Recursion())
+}
+
+func TestParseSnapshotStackOverflow(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"runtime: goroutine stack exceeds 1000000000-byte limit",
+		"runtime: sp=0xc020160398 stack=[0xc020160000, 0xc040160000]",
+		"fatal error: stack overflow",
+		"",
+		"runtime stack:",
+		"runtime.throw({0x4a3e5e?, 0x0?})",
+		"	/usr/local/go/src/runtime/panic.go:1047 +0x5d",
+		"",
+		"goroutine 1 [running]:",
+		"main.f(0x1)",
+		"	/home/user/src/app/main.go:8 +0x2a",
+		"main.f(0x2)",
+		"	/home/user/src/app/main.go:8 +0x2a",
+		"main.f(0x3)",
+		"	/home/user/src/app/main.go:8 +0x2a",
+		"...2000 frames elided...",
+		"main.f(0x7)",
+		"	/home/user/src/app/main.go:8 +0x2a",
+		"main.main()",
+		"	/home/user/src/app/main.go:12 +0x17",
+		"",
+	}
+	s, err := ParseSnapshot(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, &FatalError{Kind: FatalStackOverflow, Message: "stack overflow", StackLimit: 1000000000}, s.Fatal)
+	ut.AssertEqual(t, 1, len(s.Goroutines))
+	// The cycle is kept once; the 3 other repetitions are counted with the
+	// frames elided by the runtime.
+	stack := s.Goroutines[0].Stack
+	ut.AssertEqual(t, false, stack.Elided)
+	ut.AssertEqual(t, 2003, stack.MiddleElided)
+	ut.AssertEqual(t, 1, stack.MiddleIndex)
+	ut.AssertEqual(t, 2, len(stack.Calls))
+	ut.AssertEqual(t, "0x1", stack.Calls[0].Args.Values[0].String())
+	ut.AssertEqual(t, "main.main", stack.Calls[1].Func.Raw)
+	ut.AssertEqual(t, 0, s.Recursion.Start)
+	ut.AssertEqual(t, 4, s.Recursion.Count)
+	ut.AssertEqual(t, []Call{stack.Calls[0]}, s.Recursion.Calls)
+}
+
+func TestStackCollapse(t *testing.T) {
+	t.Parallel()
+	a := Call{SourcePath: "/home/user/src/app/main.go", Line: 10, Func: Function{"main.a"}}
+	b := Call{SourcePath: "/home/user/src/app/main.go", Line: 20, Func: Function{"main.b"}}
+	main := Call{SourcePath: "/home/user/src/app/main.go", Line: 30, Func: Function{"main.main"}}
+	s := Stack{Calls: []Call{b, a, a, a, a, main}}
+	r := s.Recursion()
+	s.collapse(r)
+	ut.AssertEqual(t, Stack{Calls: []Call{b, a, main}, MiddleElided: 3, MiddleIndex: 2}, s)
+	ut.AssertEqual(t, &Recursion{Start: 1, Calls: []Call{a}, Count: 4}, r)
+
+	// Frames elided outside of the repetitions can't be represented.
+	s = Stack{Calls: []Call{b, a, a, a, main, main}, MiddleElided: 10, MiddleIndex: 5}
+	s.collapse(s.Recursion())
+	ut.AssertEqual(t, 6, len(s.Calls))
+	ut.AssertEqual(t, 10, s.MiddleElided)
+}
@@ -0,0 +1,136 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// Rule attaches tags and an explanation to the buckets it matches, e.g. a
+// pointer to the runbook of a known failure mode.
+//
+// Func, Package and State are regexps matched anywhere in the value. An empty
+// one matches everything; a rule needs at least one of them.
+type Rule struct {
+	// Func matches the function of any call of the stack, e.g.
+	// "database/sql\.\(\*DB\)\.conn$".
+	Func string `json:"func,omitempty"`
+	// Package matches the import path of any call of the stack.
+	Package string `json:"package,omitempty"`
+	// State matches the state of the bucket, e.g. "^select$".
+	State string `json:"state,omitempty"`
+	// Tags are added as annotations without value.
+	Tags []string `json:"tags,omitempty"`
+	// Explanation is added as the "explanation" annotation.
+	Explanation string `json:"explanation,omitempty"`
+
+	fn    *regexp.Regexp
+	pkg   *regexp.Regexp
+	state *regexp.Regexp
+}
+
+// Rules are the rules of a rules file, in order.
+type Rules []Rule
+
+// ParseRules reads a JSON list of Rule, e.g.:
+//
+//	[{"func": "database/sql\\.\\(\\*DB\\)\\.conn$", "tags": ["db"],
+//	  "explanation": "database pool exhausted, see runbook X"}]
+func ParseRules(r io.Reader) (Rules, error) {
+	var out Rules
+	if err := json.NewDecoder(r).Decode(&out); err != nil {
+		return nil, err
+	}
+	if err := out.Compile(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Compile compiles the regexps of the rules. ParseRules calls it; rules
+// created otherwise must be compiled before use.
+func (r Rules) Compile() error {
+	for i := range r {
+		if err := r[i].compile(); err != nil {
+			return fmt.Errorf("rule %d: %s", i+1, err)
+		}
+	}
+	return nil
+}
+
+// Match returns true if the rule matches the bucket. A rule not compiled
+// matches nothing.
+func (r *Rule) Match(b *Bucket) bool {
+	if r.fn == nil && r.pkg == nil && r.state == nil {
+		return false
+	}
+	if r.state != nil && !r.state.MatchString(b.State) {
+		return false
+	}
+	if r.fn != nil && !b.Stack.anyCall(func(c *Call) bool { return r.fn.MatchString(c.Func.Raw) }) {
+		return false
+	}
+	if r.pkg != nil && !b.Stack.anyCall(func(c *Call) bool { return r.pkg.MatchString(c.Func.ImportPath()) }) {
+		return false
+	}
+	return true
+}
+
+// Apply annotates the buckets matched by the rules. The explanations of the
+// rules matching the same bucket are joined with "; ".
+func (r Rules) Apply(buckets Buckets) {
+	for i := range buckets {
+		b := &buckets[i]
+		for j := range r {
+			if !r[j].Match(b) {
+				continue
+			}
+			for _, t := range r[j].Tags {
+				b.Annotate(t, "")
+			}
+			if e := r[j].Explanation; e != "" {
+				if prev := b.Annotations["explanation"]; prev != "" && prev != e {
+					e = prev + "; " + e
+				}
+				b.Annotate("explanation", e)
+			}
+		}
+	}
+}
+
+// Private stuff.
+
+// compile compiles the regexps of the rule.
+func (r *Rule) compile() error {
+	if r.Func == "" && r.Package == "" && r.State == "" {
+		return fmt.Errorf("rule matches everything; set func, package or state")
+	}
+	var err error
+	for _, x := range []struct {
+		expr string
+		re   **regexp.Regexp
+	}{{r.Func, &r.fn}, {r.Package, &r.pkg}, {r.State, &r.state}} {
+		if x.expr == "" {
+			continue
+		}
+		if *x.re, err = regexp.Compile(x.expr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// anyCall returns true if fn returns true for any call of the stack.
+func (s *Stack) anyCall(fn func(c *Call) bool) bool {
+	for i := range s.Calls {
+		if fn(&s.Calls[i]) {
+			return true
+		}
+	}
+	return false
+}
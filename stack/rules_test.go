@@ -0,0 +1,47 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestRules(t *testing.T) {
+	t.Parallel()
+	data := `[
+  {"func": "database/sql\\.\\(\\*DB\\)\\.conn$", "tags": ["db"], "explanation": "database pool exhausted, see runbook X"},
+  {"package": "^github\\.com/acme/", "state": "^select$", "tags": ["acme"]},
+  {"state": "chan", "explanation": "check the producer"}
+]`
+	rules, err := ParseRules(bytes.NewBufferString(data))
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 3, len(rules))
+
+	call := func(fn string) Call {
+		return Call{SourcePath: "/src/main.go", Line: 10, Func: Function{fn}}
+	}
+	buckets := Buckets{
+		{Signature: Signature{State: "select", Stack: Stack{Calls: []Call{call("database/sql.(*DB).conn"), call("github.com/acme/store.Get")}}}},
+		{Signature: Signature{State: "chan receive", Stack: Stack{Calls: []Call{call("database/sql.(*DB).conn")}}}},
+		{Signature: Signature{State: "chan receive", Stack: Stack{Calls: []Call{call("github.com/acme/store.Get")}}}},
+		{Signature: Signature{State: "IO wait", Stack: Stack{Calls: []Call{call("main.main")}}}},
+	}
+	rules.Apply(buckets)
+	ut.AssertEqual(t, Annotations{"db": "", "acme": "", "explanation": "database pool exhausted, see runbook X"}, buckets[0].Annotations)
+	ut.AssertEqual(t, Annotations{"db": "", "explanation": "database pool exhausted, see runbook X; check the producer"}, buckets[1].Annotations)
+	ut.AssertEqual(t, Annotations{"explanation": "check the producer"}, buckets[2].Annotations)
+	ut.AssertEqual(t, Annotations(nil), buckets[3].Annotations)
+
+	// Not compiled.
+	ut.AssertEqual(t, false, (&Rule{State: "select"}).Match(&buckets[0]))
+
+	_, err = ParseRules(bytes.NewBufferString(`[{"tags": ["all"]}]`))
+	ut.AssertEqual(t, "rule 1: rule matches everything; set func, package or state", err.Error())
+	_, err = ParseRules(bytes.NewBufferString(`[{"state": "select"}, {"func": "("}]`))
+	ut.AssertEqual(t, "rule 2: error parsing regexp: missing closing ): `(`", err.Error())
+}
@@ -0,0 +1,143 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SchedTrace is a scheduler trace printed with GODEBUG=schedtrace=X, along
+// the details of the processors, threads and goroutines printed with
+// GODEBUG=scheddetail=1.
+//
+// See schedtrace() in src/runtime/proc.go.
+type SchedTrace struct {
+	// Time is the time since the process started.
+	Time time.Duration
+	// GOMAXPROCS is the number of processors (P).
+	GOMAXPROCS int
+	// IdleProcs is the number of processors not running Go code.
+	IdleProcs int
+	// Threads is the number of threads (M).
+	Threads int
+	// IdleThreads is the number of threads waiting for work.
+	IdleThreads int
+	// RunQueue is the length of the global run queue.
+	RunQueue int
+	// LocalRunQueues is the length of the run queue of each processor. It is
+	// only printed without scheddetail.
+	LocalRunQueues []int
+	// Values are all the key=value pairs of the summary line, including the
+	// ones above, e.g. "spinningthreads": "0".
+	Values map[string]string
+	// Procs, Ms and Goroutines are the details printed with scheddetail=1.
+	Procs      []SchedDetail
+	Ms         []SchedDetail
+	Goroutines []SchedDetail
+}
+
+// SchedDetail is a processor, a thread or a goroutine line of a
+// GODEBUG=scheddetail=1 trace, e.g. "P0: status=1 schedtick=5 m=3".
+type SchedDetail struct {
+	ID int
+	// Values are the key=value pairs of the line, e.g. "status": "1". The value
+	// of a goroutine status includes the wait reason, e.g. "4(chan receive)".
+	Values map[string]string
+}
+
+// ParseSchedTrace returns the scheduler traces found in r. The other lines
+// are ignored.
+func ParseSchedTrace(r io.Reader) ([]SchedTrace, error) {
+	var out []SchedTrace
+	scanner := newScanner(r)
+	for scanner.Scan() {
+		out, _ = parseSchedLine(out, scanner.Text())
+	}
+	return out, scanner.Err()
+}
+
+// Private stuff.
+
+var (
+	// reSchedTrace matches "SCHED 1004ms: gomaxprocs=8 idleprocs=8 ...".
+	reSchedTrace = regexp.MustCompile(`^SCHED (\d+)ms: (.*?)\r?\n?$`)
+	// reSchedDetail matches "  P0: status=1 ...", "  M3: p=0 ..." and
+	// "  G1: status=4(chan receive) ...".
+	reSchedDetail = regexp.MustCompile(`^  ([PMG])(\d+): (.*?)\r?\n?$`)
+)
+
+// parseSchedLine adds the line to the traces if it is part of one. It returns
+// true if it was.
+func parseSchedLine(traces []SchedTrace, line string) ([]SchedTrace, bool) {
+	if m := reSchedTrace.FindStringSubmatch(line); m != nil {
+		ms, _ := strconv.Atoi(m[1])
+		t := SchedTrace{Time: time.Duration(ms) * time.Millisecond, Values: map[string]string{}}
+		rest := m[2]
+		// The local run queues are printed last between brackets.
+		if i := strings.IndexByte(rest, '['); i != -1 && strings.HasSuffix(rest, "]") {
+			for _, f := range strings.Fields(rest[i+1 : len(rest)-1]) {
+				n, _ := strconv.Atoi(f)
+				t.LocalRunQueues = append(t.LocalRunQueues, n)
+			}
+			rest = rest[:i]
+		}
+		t.Values = parseSchedValues(rest)
+		t.GOMAXPROCS, _ = strconv.Atoi(t.Values["gomaxprocs"])
+		t.IdleProcs, _ = strconv.Atoi(t.Values["idleprocs"])
+		t.Threads, _ = strconv.Atoi(t.Values["threads"])
+		t.IdleThreads, _ = strconv.Atoi(t.Values["idlethreads"])
+		t.RunQueue, _ = strconv.Atoi(t.Values["runqueue"])
+		return append(traces, t), true
+	}
+	if len(traces) == 0 {
+		return traces, false
+	}
+	m := reSchedDetail.FindStringSubmatch(line)
+	if m == nil {
+		return traces, false
+	}
+	d := SchedDetail{Values: parseSchedValues(m[3])}
+	d.ID, _ = strconv.Atoi(m[2])
+	t := &traces[len(traces)-1]
+	switch m[1] {
+	case "P":
+		t.Procs = append(t.Procs, d)
+	case "M":
+		t.Ms = append(t.Ms, d)
+	default:
+		t.Goroutines = append(t.Goroutines, d)
+	}
+	return traces, true
+}
+
+// parseSchedValues parses space separated key=value pairs. A value may contain
+// spaces between parenthesis, e.g. "status=4(chan receive)".
+func parseSchedValues(s string) map[string]string {
+	out := map[string]string{}
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		end := len(s)
+		depth := 0
+		for i := 0; i < len(s); i++ {
+			if s[i] == '(' {
+				depth++
+			} else if s[i] == ')' {
+				depth--
+			} else if s[i] == ' ' && depth == 0 {
+				end = i
+				break
+			}
+		}
+		kv := s[:end]
+		s = s[end:]
+		if i := strings.IndexByte(kv, '='); i != -1 {
+			out[kv[:i]] = kv[i+1:]
+		}
+	}
+	return out
+}
@@ -0,0 +1,83 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maruel/ut"
+)
+
+func TestParseSchedTrace(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"SCHED 1004ms: gomaxprocs=4 idleprocs=3 threads=6 spinningthreads=0 needspinning=0 idlethreads=2 runqueue=1 [0 2 0 0]",
+		"unrelated",
+		"SCHED 2009ms: gomaxprocs=2 idleprocs=1 threads=5 spinningthreads=0 idlethreads=2 runqueue=0 gcwaiting=false nmidlelocked=0 stopwait=0 sysmonwait=false",
+		"  P0: status=1 schedtick=12 syscalltick=3 m=3 runqsize=0 gfreecnt=0 timerslen=1",
+		"  P1: status=0 schedtick=4 syscalltick=0 m=nil runqsize=0 gfreecnt=0 timerslen=0",
+		"  M3: p=0 curg=1 mallocing=0 throwing=0 preemptoff= locks=0 dying=0 spinning=false blocked=false lockedg=nil",
+		"  G1: status=4(chan receive) m=nil lockedm=nil",
+		"",
+	}
+	traces, err := ParseSchedTrace(bytes.NewBufferString(strings.Join(data, "\n")))
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 2, len(traces))
+	ut.AssertEqual(t, 1004*time.Millisecond, traces[0].Time)
+	ut.AssertEqual(t, 4, traces[0].GOMAXPROCS)
+	ut.AssertEqual(t, 3, traces[0].IdleProcs)
+	ut.AssertEqual(t, 6, traces[0].Threads)
+	ut.AssertEqual(t, 2, traces[0].IdleThreads)
+	ut.AssertEqual(t, 1, traces[0].RunQueue)
+	ut.AssertEqual(t, []int{0, 2, 0, 0}, traces[0].LocalRunQueues)
+	ut.AssertEqual(t, "0", traces[0].Values["needspinning"])
+	ut.AssertEqual(t, 0, len(traces[0].Procs))
+
+	ut.AssertEqual(t, "false", traces[1].Values["gcwaiting"])
+	ut.AssertEqual(t, []int(nil), traces[1].LocalRunQueues)
+	expectedProcs := []SchedDetail{
+		{ID: 0, Values: map[string]string{"status": "1", "schedtick": "12", "syscalltick": "3", "m": "3", "runqsize": "0", "gfreecnt": "0", "timerslen": "1"}},
+		{ID: 1, Values: map[string]string{"status": "0", "schedtick": "4", "syscalltick": "0", "m": "nil", "runqsize": "0", "gfreecnt": "0", "timerslen": "0"}},
+	}
+	ut.AssertEqual(t, expectedProcs, traces[1].Procs)
+	ut.AssertEqual(t, 1, len(traces[1].Ms))
+	ut.AssertEqual(t, "", traces[1].Ms[0].Values["preemptoff"])
+	ut.AssertEqual(t, []SchedDetail{{ID: 1, Values: map[string]string{"status": "4(chan receive)", "m": "nil", "lockedm": "nil"}}}, traces[1].Goroutines)
+}
+
+func TestParseSchedTraceLongLine(t *testing.T) {
+	t.Parallel()
+	// With GOMAXPROCS in the thousands, the local run queues make a line
+	// longer than bufio.MaxScanTokenSize.
+	queues := strings.Repeat(" 0", 40000)
+	data := "SCHED 0ms: gomaxprocs=40000 idleprocs=40000 threads=5 spinningthreads=0 idlethreads=2 runqueue=0 [" + queues[1:] + "]\n"
+	traces, err := ParseSchedTrace(bytes.NewBufferString(data))
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 1, len(traces))
+	ut.AssertEqual(t, 40000, len(traces[0].LocalRunQueues))
+}
+
+func TestParseSnapshotSched(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"SCHED 1004ms: gomaxprocs=4 idleprocs=3 threads=6 spinningthreads=0 idlethreads=2 runqueue=0 [0 0 0 0]",
+		"SIGQUIT: quit",
+		"PC=0x46b9a1 m=0 sigcode=0",
+		"",
+		"goroutine 1 [chan receive, 2 minutes]:",
+		"main.main()",
+		"	/home/user/src/app/main.go:12 +0x17",
+		"",
+	}
+	s, err := ParseSnapshot(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 1, len(s.Goroutines))
+	ut.AssertEqual(t, 1, len(s.Sched))
+	ut.AssertEqual(t, 4, s.Sched[0].GOMAXPROCS)
+}
@@ -0,0 +1,866 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format is the traceback format version detected in a dump.
+type Format int
+
+// Formats detected in dumps, ordered by age.
+const (
+	// FormatUnknown is when no goroutine was found.
+	FormatUnknown Format = iota
+	// FormatGo1 is the format up to Go 1.16; arguments are raw words.
+	FormatGo1
+	// FormatGo117 is the format since Go 1.17; arguments are printed per
+	// parameter with {} for aggregates and ? for imprecise values.
+	FormatGo117
+	// FormatGo121 is the format since Go 1.21; "created by" lines have the ID
+	// of the creator goroutine.
+	FormatGo121
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatGo1:
+		return "go1"
+	case FormatGo117:
+		return "go1.17"
+	case FormatGo121:
+		return "go1.21"
+	default:
+		return "unknown"
+	}
+}
+
+// Toolchain is the compiler toolchain that built the executable, detected from
+// the dialect of the dump.
+type Toolchain int
+
+// Toolchains.
+const (
+	// ToolchainGc is the standard Go toolchain.
+	ToolchainGc Toolchain = iota
+	// ToolchainGccgo prints the functions without their arguments and the
+	// source lines without the PC offset.
+	ToolchainGccgo
+	// ToolchainTinyGo prints the PC in the runtime errors, e.g. "panic:
+	// runtime error at 0x000102a4: nil pointer dereference", and no goroutine.
+	ToolchainTinyGo
+)
+
+func (t Toolchain) String() string {
+	switch t {
+	case ToolchainGccgo:
+		return "gccgo"
+	case ToolchainTinyGo:
+		return "tinygo"
+	default:
+		return "gc"
+	}
+}
+
+// FatalKind is the kind of an unrecoverable runtime error.
+type FatalKind int
+
+// Fatal error kinds.
+const (
+	// FatalOther is a fatal error not otherwise classified.
+	FatalOther FatalKind = iota
+	// FatalDeadlock is when all goroutines are asleep.
+	FatalDeadlock
+	// FatalConcurrentMap is a concurrent map access detected by the runtime.
+	FatalConcurrentMap
+	// FatalOutOfMemory is when the runtime failed to allocate memory.
+	FatalOutOfMemory
+	// FatalStackOverflow is when a goroutine stack exceeded the maximum size.
+	FatalStackOverflow
+	// FatalUnlock is an unlock of an unlocked sync.Mutex or sync.RWMutex.
+	FatalUnlock
+	// FatalSignal is a signal received while running runtime code or cgo.
+	FatalSignal
+)
+
+func (k FatalKind) String() string {
+	switch k {
+	case FatalDeadlock:
+		return "deadlock"
+	case FatalConcurrentMap:
+		return "concurrent map access"
+	case FatalOutOfMemory:
+		return "out of memory"
+	case FatalStackOverflow:
+		return "stack overflow"
+	case FatalUnlock:
+		return "unlock of unlocked mutex"
+	case FatalSignal:
+		return "unexpected signal"
+	default:
+		return "other"
+	}
+}
+
+// FatalError is a "fatal error: " line preceding the dump.
+type FatalError struct {
+	Kind FatalKind
+	// Message is the message as printed by the runtime.
+	Message string
+	// StackLimit is the maximum goroutine stack size in bytes printed by the
+	// runtime before a stack overflow, e.g. 1000000000. It is 0 otherwise.
+	StackLimit int64
+}
+
+// ParseFatalError parses the message following "fatal error: ".
+func ParseFatalError(msg string) FatalError {
+	f := FatalError{Message: msg}
+	switch {
+	case strings.HasPrefix(msg, "all goroutines are asleep"):
+		f.Kind = FatalDeadlock
+	case strings.HasPrefix(msg, "concurrent map "):
+		f.Kind = FatalConcurrentMap
+	case msg == "out of memory" || strings.HasPrefix(msg, "out of memory "):
+		f.Kind = FatalOutOfMemory
+	case msg == "stack overflow":
+		f.Kind = FatalStackOverflow
+	case strings.HasPrefix(msg, "sync: ") && strings.Contains(msg, "nlock of unlocked"):
+		f.Kind = FatalUnlock
+	case strings.HasPrefix(msg, "unexpected signal"):
+		f.Kind = FatalSignal
+	}
+	return f
+}
+
+// Signal is a "[signal ...]" line printed when the process died of a signal,
+// e.g. a nil pointer dereference.
+type Signal struct {
+	// Name is the name of the signal, e.g. "SIGSEGV", or its number on
+	// Windows, e.g. "0xc0000005".
+	Name string
+	// Description is the description of the signal, e.g. "segmentation
+	// violation". It is empty on Windows.
+	Description string
+	// Code is the signal code, e.g. SEGV_MAPERR (1).
+	Code uint64
+	// Addr is the faulting address.
+	Addr uint64
+	// PC is the address of the faulting instruction.
+	PC uint64
+}
+
+// Register is a CPU register value.
+type Register struct {
+	Name  string
+	Value uint64
+}
+
+// OSThread is the section printed for each thread (M) when the process
+// crashes with GOTRACEBACK=crash.
+//
+// The goroutines running on the thread have their Thread set to ID.
+type OSThread struct {
+	// ID is the runtime thread (M) ID.
+	ID int
+	// Signal is the signal line, e.g. "SIGQUIT: quit".
+	Signal string
+	// PC is the address of the instruction the thread was executing.
+	PC uint64
+	// SigCode is the signal code.
+	SigCode uint64
+	// Registers are the registers of the thread, in the printed order.
+	Registers []Register
+}
+
+// Snapshot is a goroutine dump along the information found around it.
+//
+// It is the result of parsing a dump; new information about a dump is added
+// here.
+type Snapshot struct {
+	// Goroutines are the goroutines in the dump, as returned by ParseDump.
+	Goroutines []Goroutine
+	// Panic is the message of the "panic: " line preceding the dump, if any.
+	// A multi-line panic value, e.g. a wrapped error, is kept whole with its
+	// lines separated by "\n".
+	Panic string
+	// Reason is Panic parsed. It is nil when there is no panic message.
+	Reason *PanicReason
+	// NestedPanic is set when a deferred function panicked while the process
+	// was panicking, so the last panic masked the original one, or when the
+	// runtime printed "panic during panic".
+	NestedPanic bool
+	// RuntimeStack is the stack of the system stack printed after "runtime
+	// stack:" when the runtime crashed, e.g. on a panic during panic. It is
+	// nil when not printed.
+	RuntimeStack *Stack
+	// Panics is the chain of panics when a panic was recovered then another
+	// one raised, e.g. "panic: X [recovered]" followed by "\tpanic: Y", from
+	// the original cause to the last one. Panics[0] is Reason. It is nil when
+	// there is no panic message.
+	Panics []PanicReason
+	// Signal is the signal that killed the process, if any.
+	Signal *Signal
+	// Threads are the per thread sections of a GOTRACEBACK=crash dump.
+	Threads []OSThread
+	// Fatal is the "fatal error: " line preceding the dump. It is nil when the
+	// process didn't die of a fatal error, e.g. a panic or a SIGQUIT.
+	Fatal *FatalError
+	// Recursion is the cycle of calls repeated in the stack of the goroutine
+	// that overflowed its stack. It is nil unless Fatal is a stack overflow
+	// caused by a recursion. The stack of that goroutine keeps only the first
+	// cycle; the other repetitions are counted in Stack.MiddleElided.
+	Recursion *Recursion
+	// Format is the traceback format version detected.
+	Format Format
+	// Toolchain is the toolchain that built the executable, detected from the
+	// dialect of the dump.
+	Toolchain Toolchain
+	// GOROOT is the GOROOT of the machine that built the executable, inferred
+	// from the path of the runtime package sources. It is empty if the dump
+	// has no runtime frame.
+	GOROOT string
+	// GOPATHs are the GOPATH or module cache roots inferred from the path of
+	// the sources outside GOROOT, sorted.
+	GOPATHs []string
+	// Time is the timestamp of the last log line before the dump or of the
+	// first one after it, whichever is the fewest lines away, the one before on
+	// a tie. It is the zero value when no log line around the dump has a
+	// timestamp, e.g. when the dump was printed to a raw stderr.
+	Time time.Time
+	// StartLine and EndLine are the first and last line of the dump in the
+	// input, starting at 1, including the panic message. They are 0 when no
+	// goroutine was found.
+	StartLine int
+	EndLine   int
+	// Test is the name of the test that crashed when the dump is in the output
+	// of "go test", e.g. "TestFoo" or "TestFoo/subtest". TestPackage is the
+	// import path of its package. They are empty otherwise.
+	Test        string
+	TestPackage string
+	// Sched are the scheduler traces printed with GODEBUG=schedtrace=X around
+	// the dump, in order.
+	Sched []SchedTrace
+	// Incomplete is set when the dump was cut, e.g. by a log rotation or a
+	// process killed while printing it. The goroutines that were cut have
+	// their Incomplete set and the ones after are missing.
+	Incomplete bool
+	// Warnings are the problems found while parsing that didn't stop it, e.g.
+	// an argument list that couldn't be parsed and was kept as is.
+	Warnings []string
+}
+
+// ParseSnapshot parses a dump and returns its goroutines along what can be
+// inferred from the lines around them.
+//
+// It supports piping from another command and assumes there is junk before
+// the actual stack trace. The junk is streamed to out.
+func ParseSnapshot(r io.Reader, out io.Writer) (*Snapshot, error) {
+	return (&Parser{}).ParseSnapshot(r, out)
+}
+
+// ParseSnapshot is ParseSnapshot with the options of p.
+func (p *Parser) ParseSnapshot(r io.Reader, out io.Writer) (*Snapshot, error) {
+	o := &observer{p: *p}
+	goroutines, err := parseDump(r, out, o)
+	s := &Snapshot{
+		Goroutines: goroutines,
+		Panic:      o.panic,
+		Format:     o.format,
+		Toolchain:  o.toolchain,
+		Time:       o.nearest(),
+	}
+	if o.panic != "" {
+		r := ParsePanicReason(o.panic)
+		s.Reason = &r
+		if reTinyGoRuntimeError.MatchString(o.panic) {
+			s.Toolchain = ToolchainTinyGo
+		}
+		s.Panics = []PanicReason{r}
+		for _, p := range o.panics {
+			s.Panics = append(s.Panics, ParsePanicReason(p))
+		}
+		for i := 0; i < len(s.Panics)-1; i++ {
+			if !s.Panics[i].Recovered {
+				s.NestedPanic = true
+			}
+		}
+	}
+	if o.panicDuringPanic {
+		s.NestedPanic = true
+	}
+	s.RuntimeStack = o.runtimeStack
+	s.Signal = o.signal
+	s.Threads = o.threads
+	s.Warnings = o.warnings
+	s.Incomplete = o.incomplete
+	s.Sched = o.sched
+	if o.fatal != "" {
+		f := ParseFatalError(o.fatal)
+		f.StackLimit = o.stackLimit
+		s.Fatal = &f
+		// The goroutine that overflowed its stack is printed first.
+		if f.Kind == FatalStackOverflow && len(goroutines) != 0 {
+			if s.Recursion = goroutines[0].Stack.Recursion(); s.Recursion != nil {
+				goroutines[0].Stack.collapse(s.Recursion)
+			}
+		}
+	}
+	if o.header {
+		s.StartLine = o.start
+		s.EndLine = o.end
+		if s.EndLine == 0 {
+			s.EndLine = o.line
+		}
+	}
+	s.GOROOT, s.GOPATHs = inferRoots(goroutines)
+	s.Test, s.TestPackage = o.test, o.testPkg
+	if s.Test == "" || s.TestPackage == "" {
+		// Fallback to the function called by the testing package.
+		if name, pkg := findTest(goroutines); name != "" {
+			if s.Test == "" {
+				s.Test = name
+			}
+			if s.TestPackage == "" {
+				s.TestPackage = pkg
+			}
+		}
+	}
+	return s, err
+}
+
+// PanicReason is the value passed to panic() as printed by the runtime.
+type PanicReason struct {
+	// Value is the panic value without the decorations added by the runtime.
+	Value string
+	// Type is the type of the value when the runtime prints it as
+	// "(type) address", e.g. for a struct. It is empty otherwise.
+	Type string
+	// RuntimeError is set when the panic was raised by the runtime, e.g. a nil
+	// pointer dereference or an index out of range.
+	RuntimeError bool
+	// Recovered is set when the panic was recovered then the process died for
+	// another reason, e.g. a panic in the deferred function.
+	Recovered bool
+	// Repanicked is set when the recovered value was passed to panic() again.
+	Repanicked bool
+}
+
+// ParsePanicReason parses the message following "panic: ".
+func ParsePanicReason(msg string) PanicReason {
+	r := PanicReason{}
+	if strings.HasSuffix(msg, " [recovered, repanicked]") {
+		r.Recovered, r.Repanicked = true, true
+		msg = msg[:len(msg)-len(" [recovered, repanicked]")]
+	} else if strings.HasSuffix(msg, " [recovered]") {
+		r.Recovered = true
+		msg = msg[:len(msg)-len(" [recovered]")]
+	}
+	if m := reTinyGoRuntimeError.FindStringSubmatch(msg); m != nil {
+		msg = "runtime error: " + m[1]
+	}
+	r.Value = msg
+	r.RuntimeError = strings.HasPrefix(msg, "runtime error: ")
+	if m := rePanicType.FindStringSubmatch(msg); m != nil {
+		r.Type = m[1]
+	}
+	return r
+}
+
+// SpawnRate estimates the number of goroutines created per second between two
+// snapshots of the same process.
+//
+// Goroutine IDs are allocated in increasing order so the difference between
+// the highest ID of each snapshot is the number of goroutines created in
+// between, including the ones that already exited. Compared to the change in
+// goroutine count, it distinguishes a leak from a high but stable churn. The
+// runtime hands out IDs in small batches per processor so it is an estimate.
+//
+// It returns false when a snapshot has no timestamp or no goroutine, or newer
+// is not after old.
+func SpawnRate(old, newer *Snapshot) (float64, bool) {
+	if old.Time.IsZero() || !newer.Time.After(old.Time) || len(old.Goroutines) == 0 || len(newer.Goroutines) == 0 {
+		return 0, false
+	}
+	created := newer.maxID() - old.maxID()
+	if created < 0 {
+		// Not the same process.
+		return 0, false
+	}
+	return float64(created) / newer.Time.Sub(old.Time).Seconds(), true
+}
+
+// Thread returns the thread section of the thread the goroutine was running
+// on, if any.
+func (s *Snapshot) Thread(g *Goroutine) *OSThread {
+	if g.M == nil {
+		return nil
+	}
+	for i := range s.Threads {
+		if s.Threads[i].ID == *g.M {
+			return &s.Threads[i]
+		}
+	}
+	return nil
+}
+
+// Goroutine returns the goroutine with the ID, or nil if it is not in the
+// dump.
+func (s *Snapshot) Goroutine(id int) *Goroutine {
+	for i := range s.Goroutines {
+		if s.Goroutines[i].ID == id {
+			return &s.Goroutines[i]
+		}
+	}
+	return nil
+}
+
+// Parent returns the goroutine that created g. It returns nil when the dump
+// predates Go 1.21, which doesn't print the creator ID, or when the creator
+// already exited.
+func (s *Snapshot) Parent(g *Goroutine) *Goroutine {
+	if g.CreatedByID == 0 {
+		return nil
+	}
+	return s.Goroutine(g.CreatedByID)
+}
+
+// Children returns the goroutines created by g that are still alive, in dump
+// order.
+func (s *Snapshot) Children(g *Goroutine) []*Goroutine {
+	var out []*Goroutine
+	for i := range s.Goroutines {
+		if s.Goroutines[i].CreatedByID == g.ID && s.Goroutines[i].ID != g.ID {
+			out = append(out, &s.Goroutines[i])
+		}
+	}
+	return out
+}
+
+// Private stuff.
+
+// maxID returns the highest goroutine ID.
+func (s *Snapshot) maxID() int {
+	out := 0
+	for i := range s.Goroutines {
+		if s.Goroutines[i].ID > out {
+			out = s.Goroutines[i].ID
+		}
+	}
+	return out
+}
+
+// reSignal matches the signal line following the panic message, e.g.
+// "[signal SIGSEGV: segmentation violation code=0x1 addr=0x0 pc=0x45fd1a]".
+var reSignal = regexp.MustCompile(`^\[signal ([^: ]+)(?:: ([^=]+))? code=0x([0-9a-f]+) addr=0x([0-9a-f]+) pc=0x([0-9a-f]+)\]`)
+
+// "go test" output.
+var (
+	// reTestFail matches "--- FAIL: TestFoo (0.00s)", printed before the panic
+	// of a test.
+	reTestFail = regexp.MustCompile(`^ *--- FAIL: (\S+) \(`)
+	// reTestRun matches "=== RUN   TestFoo", printed with -v.
+	reTestRun = regexp.MustCompile(`^=== (?:RUN|CONT) +(\S+)\r?\n$`)
+	// reTestPkgFail matches "FAIL	example.com/foo	0.005s", printed after the
+	// output of a package.
+	reTestPkgFail = regexp.MustCompile(`^FAIL\t(\S+)\t`)
+)
+
+// GOTRACEBACK=crash thread sections.
+var (
+	reThreadSignal = regexp.MustCompile(`^(SIG[A-Z0-9]+: .+?)\r?\n$`)
+	reThreadPC     = regexp.MustCompile(`^PC=0x([0-9a-f]+) m=(\d+) sigcode=(\d+)`)
+	reRegister     = regexp.MustCompile(`^([a-z][a-z0-9]*) +0x([0-9a-f]+)\r?\n$`)
+)
+
+// reNestedPanic matches the panics printed after the first one of a chain,
+// e.g. "\tpanic: second".
+var reNestedPanic = regexp.MustCompile(`^\t+panic: (.*?)\r?\n?$`)
+
+// reTinyGoRuntimeError matches a runtime error printed by TinyGo, which
+// includes the PC, e.g. "runtime error at 0x000102a4: nil pointer
+// dereference".
+var reTinyGoRuntimeError = regexp.MustCompile(`^runtime error at 0x[0-9a-f]+: (.*)$`)
+
+// reStackLimit matches the line printed by newstack() in
+// src/runtime/stack.go before "fatal error: stack overflow".
+var reStackLimit = regexp.MustCompile(`^runtime: goroutine stack exceeds (\d+)-byte limit\r?\n?$`)
+
+// rePanicType matches a panic value the runtime doesn't know how to print.
+var rePanicType = regexp.MustCompile(`^\((.+)\) 0x[0-9a-f]+$`)
+
+// timestamps are the supported log timestamp formats and the matching layouts
+// for time.Parse. A timestamp without a time zone is assumed to be UTC.
+var timestamps = []struct {
+	re     *regexp.Regexp
+	layout string
+}{
+	{
+		regexp.MustCompile(`\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:\d{2})`),
+		time.RFC3339Nano,
+	},
+	{
+		regexp.MustCompile(`\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(?:\.\d+)?`),
+		"2006-01-02T15:04:05.999999999",
+	},
+	{
+		regexp.MustCompile(`\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)?`),
+		"2006-01-02 15:04:05.999999999",
+	},
+	{
+		// Go's log package.
+		regexp.MustCompile(`\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)?`),
+		"2006/01/02 15:04:05.999999999",
+	},
+}
+
+// parseTimestamp returns the first timestamp found in line, if any.
+func parseTimestamp(line string) (time.Time, bool) {
+	for _, ts := range timestamps {
+		if m := ts.re.FindString(line); m != "" {
+			if t, err := time.Parse(ts.layout, m); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// observer keeps track of what is found around and in a dump while it is
+// parsed.
+type observer struct {
+	p          Parser     // p are the options of the parser.
+	line       int        // line is the current line number, starting at 1.
+	start      int        // start is the line of the panic message or of the first goroutine header.
+	header     bool       // header is set once a goroutine header was seen.
+	end        int        // end is the last line of the dump.
+	panic      string     // panic is the panic message.
+	panics     []string   // panics are the messages of the panics following the first one.
+	fatal      string     // fatal is the fatal error message.
+	signal     *Signal    // signal is the signal line.
+	threads    []OSThread // threads are the GOTRACEBACK=crash thread sections.
+	sigLine    string     // sigLine is the last "SIGxxx: " line, for the next thread.
+	format     Format     // format is the newest format detected.
+	before     time.Time  // before is the last timestamp before the dump.
+	beforeLine int
+	after      time.Time // after is the first timestamp after the dump.
+	afterLine  int
+	warnings   []string // warnings are the problems found, prefixed with the line number.
+	incomplete bool     // incomplete is set when a goroutine was cut.
+	test       string   // test is the test reported as failed or last started by "go test".
+	testPkg    string   // testPkg is the package reported as failed by "go test".
+	sched      []SchedTrace
+	// panicDuringPanic is set on a "panic during panic" line.
+	panicDuringPanic bool
+	// runtimeStack is the "runtime stack:" section. inRuntimeStack is set
+	// while it is parsed.
+	runtimeStack   *Stack
+	inRuntimeStack bool
+	// stackLimit is the limit printed before a stack overflow.
+	stackLimit int64
+	// inPanic is set after a panic line until the empty line ending the
+	// message, since a panic value may span multiple lines.
+	inPanic bool
+	// toolchain is set when a frame in a dialect other than gc's is parsed.
+	toolchain Toolchain
+	// goroot is the GOROOT inferred from the first goroutine with a runtime
+	// frame.
+	goroot string
+}
+
+// next is called for every line. inGoroutine is true if the line follows a
+// goroutine header.
+func (o *observer) next(line string, inGoroutine bool) {
+	o.line++
+	if !inGoroutine {
+		return
+	}
+	f := FormatGo1
+	if strings.HasPrefix(line, "created by ") && strings.Contains(line, " in goroutine ") {
+		f = FormatGo121
+	} else if strings.HasSuffix(line, ")\n") && (strings.Contains(line, "?") || strings.Contains(line, "{")) {
+		f = FormatGo117
+	}
+	if f > o.format {
+		o.format = f
+	}
+}
+
+// goroutine is called on each goroutine header line.
+func (o *observer) goroutine() {
+	if o.start == 0 {
+		o.start = o.line
+	}
+	o.header = true
+	if o.format == FormatUnknown {
+		o.format = FormatGo1
+	}
+}
+
+// warn records a problem on the current line that didn't stop the parsing.
+func (o *observer) warn(msg string) {
+	o.warnings = append(o.warnings, "line "+strconv.Itoa(o.line)+": "+msg)
+}
+
+// junk processes a line that is not part of the dump.
+func (o *observer) junk(line string) {
+	if o.thread(line) {
+		return
+	}
+	if sched, ok := parseSchedLine(o.sched, line); ok {
+		o.sched = sched
+		return
+	}
+	if o.systemStack(line) {
+		return
+	}
+	if o.header && o.end == 0 {
+		o.end = o.line - 1
+	}
+	if o.afterLine != 0 {
+		return
+	}
+	if o.testLine(line) {
+		return
+	}
+	if !o.header {
+		if o.panicLine(line) {
+			return
+		}
+		if strings.HasPrefix(line, "panic: ") {
+			o.start = o.line
+			o.panic = strings.TrimRight(line[len("panic: "):], "\r\n")
+			o.panics = nil
+			o.inPanic = true
+			return
+		}
+		if line == "panic during panic\n" {
+			o.panicDuringPanic = true
+			return
+		}
+		if m := reNestedPanic.FindStringSubmatch(line); m != nil && o.panic != "" {
+			o.panics = append(o.panics, m[1])
+			o.inPanic = true
+			return
+		}
+		if m := reSignal.FindStringSubmatch(line); m != nil {
+			o.signal = &Signal{Name: m[1], Description: m[2]}
+			o.signal.Code, _ = strconv.ParseUint(m[3], 16, 64)
+			o.signal.Addr, _ = strconv.ParseUint(m[4], 16, 64)
+			o.signal.PC, _ = strconv.ParseUint(m[5], 16, 64)
+			return
+		}
+		if m := reStackLimit.FindStringSubmatch(line); m != nil {
+			o.stackLimit, _ = strconv.ParseInt(m[1], 10, 64)
+			return
+		}
+		if strings.HasPrefix(line, "fatal error: ") {
+			o.start = o.line
+			o.fatal = strings.TrimRight(line[len("fatal error: "):], "\r\n")
+			return
+		}
+	}
+	t, ok := parseTimestamp(line)
+	if !ok {
+		return
+	}
+	if !o.header {
+		o.before, o.beforeLine, o.start, o.panic, o.panics, o.fatal, o.signal = t, o.line, 0, "", nil, "", nil
+		o.stackLimit = 0
+	} else {
+		o.after, o.afterLine = t, o.line
+	}
+}
+
+// panicLine appends the line to the panic message being printed when it is a
+// continuation of a multi-line panic value, e.g. a wrapped error or a
+// pretty-printed struct. It returns true if it was.
+func (o *observer) panicLine(line string) bool {
+	if !o.inPanic {
+		return false
+	}
+	msg := strings.TrimRight(line, "\r\n")
+	if msg == "" || strings.HasPrefix(line, "panic: ") || strings.HasPrefix(line, "fatal error: ") ||
+		line == "panic during panic\n" || reNestedPanic.MatchString(line) || reSignal.MatchString(line) {
+		o.inPanic = false
+		return false
+	}
+	if _, ok := parseTimestamp(line); ok {
+		o.inPanic = false
+		return false
+	}
+	if n := len(o.panics); n != 0 {
+		o.panics[n-1] += "\n" + msg
+	} else {
+		o.panic += "\n" + msg
+	}
+	return true
+}
+
+// testLine processes the lines printed by "go test". It returns true if the
+// line was one.
+func (o *observer) testLine(line string) bool {
+	if !o.header {
+		if m := reTestFail.FindStringSubmatch(line); m != nil {
+			o.test = m[1]
+			return true
+		}
+		if m := reTestRun.FindStringSubmatch(line); m != nil {
+			o.test = m[1]
+			return true
+		}
+		return false
+	}
+	if m := reTestPkgFail.FindStringSubmatch(line); m != nil && o.test != "" && o.testPkg == "" {
+		o.testPkg = m[1]
+		return true
+	}
+	return false
+}
+
+// systemStack processes the "runtime stack:" section printed when the runtime
+// crashes on the system stack. It returns true if the line was part of it.
+func (o *observer) systemStack(line string) bool {
+	if line == "runtime stack:\n" {
+		o.runtimeStack = &Stack{}
+		o.inRuntimeStack = true
+		return true
+	}
+	if !o.inRuntimeStack {
+		return false
+	}
+	if line == "\n" {
+		o.inRuntimeStack = false
+		return true
+	}
+	if m := reFunc.FindStringSubmatch(line); m != nil {
+		args, err := parseArgs(m[2])
+		if err != nil {
+			args = Args{Values: []Arg{{Raw: m[2]}}}
+		}
+		o.runtimeStack.Calls = append(o.runtimeStack.Calls, Call{Func: Function{m[1]}, Args: args})
+		return true
+	}
+	if m := reFile.FindStringSubmatch(line); m != nil && len(o.runtimeStack.Calls) != 0 {
+		c := &o.runtimeStack.Calls[len(o.runtimeStack.Calls)-1]
+		c.SourcePath, c.PathSeparator = normalizePath(m[1])
+		c.Line, _ = strconv.Atoi(m[2])
+		c.Offset, _ = strconv.ParseUint(m[3], 16, 64)
+		return true
+	}
+	o.inRuntimeStack = false
+	return false
+}
+
+// thread processes the lines of a GOTRACEBACK=crash thread section. It
+// returns true if the line was part of it.
+func (o *observer) thread(line string) bool {
+	if m := reThreadSignal.FindStringSubmatch(line); m != nil {
+		o.sigLine = m[1]
+		if !o.header && o.start == 0 {
+			o.start = o.line
+		}
+		return true
+	}
+	if m := reThreadPC.FindStringSubmatch(line); m != nil {
+		t := OSThread{Signal: o.sigLine}
+		t.PC, _ = strconv.ParseUint(m[1], 16, 64)
+		t.ID, _ = strconv.Atoi(m[2])
+		t.SigCode, _ = strconv.ParseUint(m[3], 10, 64)
+		o.threads = append(o.threads, t)
+		o.sigLine = ""
+		return true
+	}
+	if len(o.threads) == 0 {
+		return false
+	}
+	if m := reRegister.FindStringSubmatch(line); m != nil {
+		v, _ := strconv.ParseUint(m[2], 16, 64)
+		t := &o.threads[len(o.threads)-1]
+		t.Registers = append(t.Registers, Register{m[1], v})
+		return true
+	}
+	// The registers are followed by an empty line and by a separator if
+	// another thread follows.
+	l := strings.TrimRight(line, "\r\n")
+	return l == "" || l == "-----"
+}
+
+// nearest returns the timestamp of the line before or after the dump that is
+// the fewest lines away from it.
+func (o *observer) nearest() time.Time {
+	if o.afterLine == 0 || (o.beforeLine != 0 && o.start-o.beforeLine <= o.afterLine-o.end) {
+		return o.before
+	}
+	return o.after
+}
+
+// findTest returns the test function and its package from the call made by
+// the testing package in the first goroutine, if any.
+func findTest(goroutines []Goroutine) (string, string) {
+	for i := range goroutines {
+		if !goroutines[i].First {
+			continue
+		}
+		calls := goroutines[i].Stack.Calls
+		for j := 0; j+1 < len(calls); j++ {
+			if calls[j+1].Func.Raw != "testing.tRunner" {
+				continue
+			}
+			f := calls[j].Func
+			name := f.Name()
+			if k := strings.IndexByte(name, '.'); k != -1 {
+				// A subtest closure, e.g. "TestFoo.func1".
+				name = name[:k]
+			}
+			pkg := f.PkgName()
+			if d := path.Dir(f.BaseName()); d != "." {
+				pkg = d + "/" + pkg
+			}
+			return name, strings.TrimSuffix(pkg, "_test")
+		}
+	}
+	return "", ""
+}
+
+// inferRoots returns the GOROOT and GOPATHs inferred from the source paths.
+func inferRoots(goroutines []Goroutine) (string, []string) {
+	goroot := ""
+	for i := range goroutines {
+		if goroot = inferGOROOT(&goroutines[i]); goroot != "" {
+			break
+		}
+	}
+	roots := map[string]bool{}
+	add := func(c *Call) {
+		if c.SourcePath == "" || c.IsStdlib() || (goroot != "" && strings.HasPrefix(c.SourcePath, goroot+"/")) {
+			return
+		}
+		if j := strings.Index(c.SourcePath, "/pkg/mod/"); j > 0 {
+			roots[c.SourcePath[:j]] = true
+		} else if j := strings.Index(c.SourcePath, "/src/"); j > 0 {
+			roots[c.SourcePath[:j]] = true
+		}
+	}
+	for i := range goroutines {
+		g := &goroutines[i]
+		for j := range g.Stack.Calls {
+			add(&g.Stack.Calls[j])
+		}
+		add(&g.CreatedBy)
+	}
+	var gopaths []string
+	for r := range roots {
+		gopaths = append(gopaths, r)
+	}
+	sort.Strings(gopaths)
+	return goroot, gopaths
+}
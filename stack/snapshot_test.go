@@ -0,0 +1,526 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maruel/ut"
+)
+
+func TestParseSnapshotTime(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"2016/03/01 10:00:00 starting",
+		"2016/03/01 11:59:58 about to crash",
+		"panic: oh no",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"	/gopath/src/github.com/foo/bar/baz.go:428 +0x27",
+		"",
+		"2016-03-01T12:30:00Z restarted",
+		"",
+	}
+	s, err := ParseSnapshot(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 1, len(s.Goroutines))
+	ut.AssertEqual(t, time.Date(2016, 3, 1, 11, 59, 58, 0, time.UTC), s.Time)
+}
+
+func TestParseSnapshotTimeAfter(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"panic: oh no",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"	/gopath/src/github.com/foo/bar/baz.go:428 +0x27",
+		"",
+		"2016-03-01T12:30:00.5+01:00 exit status 2",
+		"2016-03-01T12:31:00Z restarted",
+		"",
+	}
+	s, err := ParseSnapshot(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, true, s.Time.Equal(time.Date(2016, 3, 1, 11, 30, 0, 500000000, time.UTC)))
+}
+
+func TestParseSnapshotNoTime(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"panic: oh no",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"	/gopath/src/github.com/foo/bar/baz.go:428 +0x27",
+		"",
+	}
+	s, err := ParseSnapshot(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, true, s.Time.IsZero())
+}
+
+func TestSpawnRate(t *testing.T) {
+	t.Parallel()
+	old := &Snapshot{
+		Goroutines: []Goroutine{{ID: 1}, {ID: 20}},
+		Time:       time.Date(2016, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+	newer := &Snapshot{
+		Goroutines: []Goroutine{{ID: 1}, {ID: 620}},
+		Time:       time.Date(2016, 3, 1, 12, 1, 0, 0, time.UTC),
+	}
+	rate, ok := SpawnRate(old, newer)
+	ut.AssertEqual(t, true, ok)
+	ut.AssertEqual(t, 10., rate)
+
+	// Reversed.
+	_, ok = SpawnRate(newer, old)
+	ut.AssertEqual(t, false, ok)
+	// No timestamp.
+	_, ok = SpawnRate(&Snapshot{Goroutines: old.Goroutines}, newer)
+	ut.AssertEqual(t, false, ok)
+}
+
+func TestParseSnapshot(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"junk",
+		"panic: oh no",
+		"",
+		"goroutine 1 [running]:",
+		"runtime.panic(0x4d4b00, 0xc208010000)",
+		"	/usr/local/go/src/runtime/panic.go:464 +0x3e6",
+		"main.main()",
+		"	/home/user/go/src/github.com/foo/bar/baz.go:428 +0x27",
+		"",
+		"goroutine 2 [chan receive]:",
+		"github.com/foo/bar.worker()",
+		"	/home/user/go/pkg/mod/github.com/foo/bar@v1.0.0/bar.go:10 +0x27",
+		"created by main.main",
+		"	/home/user/go/src/github.com/foo/bar/baz.go:427 +0x35",
+		"",
+		"exit status 2",
+		"",
+	}
+	s, err := ParseSnapshot(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 2, len(s.Goroutines))
+	ut.AssertEqual(t, "oh no", s.Panic)
+	ut.AssertEqual(t, &PanicReason{Value: "oh no"}, s.Reason)
+	ut.AssertEqual(t, FormatGo1, s.Format)
+	ut.AssertEqual(t, "/usr/local/go", s.GOROOT)
+	ut.AssertEqual(t, []string{"/home/user/go"}, s.GOPATHs)
+	ut.AssertEqual(t, 2, s.StartLine)
+	ut.AssertEqual(t, 15, s.EndLine)
+}
+
+func TestParseSnapshotGoTest(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"=== RUN   TestOk",
+		"--- PASS: TestOk (0.00s)",
+		"=== RUN   TestCrash",
+		"--- FAIL: TestCrash (0.00s)",
+		"panic: boom [recovered]",
+		"	panic: boom",
+		"",
+		"goroutine 7 [running]:",
+		"testing.tRunner.func1.2({0x5195b0, 0x585f50})",
+		"	/usr/local/go/src/testing/testing.go:1545 +0x238",
+		"example.com/foo_test.TestCrash(0xc000007860)",
+		"	/home/user/src/foo/foo_test.go:12 +0x25",
+		"testing.tRunner(0xc000007860, 0x56b2f0)",
+		"	/usr/local/go/src/testing/testing.go:1595 +0xff",
+		"created by testing.(*T).Run in goroutine 1",
+		"	/usr/local/go/src/testing/testing.go:1648 +0x3ad",
+		"FAIL	example.com/foo	0.005s",
+		"FAIL",
+		"",
+	}
+	s, err := ParseSnapshot(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "TestCrash", s.Test)
+	ut.AssertEqual(t, "example.com/foo", s.TestPackage)
+
+	// Without the go test lines, the test is found in the stack.
+	s, err = ParseSnapshot(bytes.NewBufferString(strings.Join(data[4:17], "\n")), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "TestCrash", s.Test)
+	ut.AssertEqual(t, "example.com/foo", s.TestPackage)
+}
+
+func TestParseSnapshotPanicChain(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"panic: connection reset [recovered]",
+		"	panic: failed to close: invalid state [recovered]",
+		"	panic: runtime error: invalid memory address or nil pointer dereference",
+		"[signal SIGSEGV: segmentation violation code=0x1 addr=0x0 pc=0x45fd1a]",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"	/home/user/src/app/main.go:12 +0x17",
+		"",
+	}
+	s, err := ParseSnapshot(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	expected := []PanicReason{
+		{Value: "connection reset", Recovered: true},
+		{Value: "failed to close: invalid state", Recovered: true},
+		{Value: "runtime error: invalid memory address or nil pointer dereference", RuntimeError: true},
+	}
+	ut.AssertEqual(t, expected, s.Panics)
+	ut.AssertEqual(t, &expected[0], s.Reason)
+	ut.AssertEqual(t, "SIGSEGV", s.Signal.Name)
+}
+
+func TestParseSnapshotMultiLinePanic(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"2024/05/01 12:00:00 serving",
+		"panic: request failed:",
+		"    dial tcp: connection refused",
+		"    retry 3/3 [recovered]",
+		"	panic: main.Config{",
+		"  Name: \"a\",",
+		"}",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"	/home/user/src/app/main.go:12 +0x17",
+		"",
+	}
+	extra := &bytes.Buffer{}
+	s, err := ParseSnapshot(bytes.NewBufferString(strings.Join(data, "\n")), extra)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "request failed:\n    dial tcp: connection refused\n    retry 3/3 [recovered]", s.Panic)
+	expected := []PanicReason{
+		{Value: "request failed:\n    dial tcp: connection refused\n    retry 3/3", Recovered: true},
+		{Value: "main.Config{\n  Name: \"a\",\n}"},
+	}
+	ut.AssertEqual(t, expected, s.Panics)
+	ut.AssertEqual(t, 2, s.StartLine)
+	// The lines are still passed through.
+	ut.AssertEqual(t, strings.Join(data[:8], "\n")+"\n", extra.String())
+}
+
+func TestParseSnapshotNestedPanic(t *testing.T) {
+	t.Parallel()
+	// A deferred function panicked while panicking.
+	data := []string{
+		"panic: first",
+		"	panic: second",
+		"",
+		"goroutine 1 [running]:",
+		"main.main.func1()",
+		"	/home/user/src/app/main.go:8 +0x25",
+		"panic({0x45e3a0?, 0x4a1d38?})",
+		"	/usr/local/go/src/runtime/panic.go:770 +0x132",
+		"main.main()",
+		"	/home/user/src/app/main.go:12 +0x17",
+		"",
+	}
+	s, err := ParseSnapshot(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, true, s.NestedPanic)
+	ut.AssertEqual(t, []PanicReason{{Value: "first"}, {Value: "second"}}, s.Panics)
+	ut.AssertEqual(t, (*Stack)(nil), s.RuntimeStack)
+
+	// The runtime crashed while panicking.
+	data = []string{
+		"panic: first",
+		"panic during panic",
+		"",
+		"runtime stack:",
+		"runtime.throw({0x4a0e2f, 0x12})",
+		"	/usr/local/go/src/runtime/panic.go:1023 +0x5c fp=0x7ffc5b8e0e40 sp=0x7ffc5b8e0e10 pc=0x43315c",
+		"runtime.fatalpanic(0xc000006000)",
+		"	/usr/local/go/src/runtime/panic.go:1150 +0x7e",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"	/home/user/src/app/main.go:12 +0x17",
+		"",
+	}
+	s, err = ParseSnapshot(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, true, s.NestedPanic)
+	ut.AssertEqual(t, 1, len(s.Goroutines))
+	ut.AssertEqual(t, 2, len(s.RuntimeStack.Calls))
+	ut.AssertEqual(t, "runtime.fatalpanic", s.RuntimeStack.Calls[1].Func.Raw)
+	ut.AssertEqual(t, 1150, s.RuntimeStack.Calls[1].Line)
+
+	// A recovered panic doesn't mask the next one.
+	data = []string{
+		"panic: first [recovered]",
+		"	panic: second",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"	/home/user/src/app/main.go:12 +0x17",
+		"",
+	}
+	s, err = ParseSnapshot(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, false, s.NestedPanic)
+}
+
+func TestParsePanicReason(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		in       string
+		expected PanicReason
+	}{
+		{"oh no", PanicReason{Value: "oh no"}},
+		{"runtime error: index out of range [3] with length 2", PanicReason{Value: "runtime error: index out of range [3] with length 2", RuntimeError: true}},
+		{"oh no [recovered]", PanicReason{Value: "oh no", Recovered: true}},
+		{"oh no [recovered, repanicked]", PanicReason{Value: "oh no", Recovered: true, Repanicked: true}},
+		{"(main.T) 0xc000012345", PanicReason{Value: "(main.T) 0xc000012345", Type: "main.T"}},
+		{`main.MyString("oh no")`, PanicReason{Value: `main.MyString("oh no")`}},
+		// TinyGo.
+		{"runtime error at 0x000102a4: nil pointer dereference", PanicReason{Value: "runtime error: nil pointer dereference", RuntimeError: true}},
+	}
+	for i, line := range data {
+		ut.AssertEqualIndex(t, i, line.expected, ParsePanicReason(line.in))
+	}
+}
+
+func TestParseSnapshotGccgo(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"panic: boom",
+		"",
+		"goroutine 1 [running]:",
+		"runtime.gopanic",
+		"	/opt/gcc/src/libgo/go/runtime/panic.go:588",
+		"main.main..func1",
+		"	/home/user/src/app/main.go:8",
+		"main.main",
+		"	/home/user/src/app/main.go:12",
+		"",
+		"goroutine 18 [chan receive]:",
+		"main.worker",
+		"	/home/user/src/app/main.go:20",
+		"created by main.main",
+		"	/home/user/src/app/main.go:10",
+		"",
+	}
+	s, err := ParseSnapshot(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, ToolchainGccgo, s.Toolchain)
+	ut.AssertEqual(t, "gccgo", s.Toolchain.String())
+	ut.AssertEqual(t, 2, len(s.Goroutines))
+	expected := []Call{
+		{SourcePath: "/opt/gcc/src/libgo/go/runtime/panic.go", Line: 588, Func: Function{"runtime.gopanic"}, Stdlib: true},
+		{SourcePath: "/home/user/src/app/main.go", Line: 8, Func: Function{"main.main..func1"}},
+		{SourcePath: "/home/user/src/app/main.go", Line: 12, Func: Function{"main.main"}},
+	}
+	ut.AssertEqual(t, expected, s.Goroutines[0].Stack.Calls)
+	ut.AssertEqual(t, false, s.Goroutines[0].Incomplete)
+	ut.AssertEqual(t, true, s.Goroutines[0].Stack.Calls[0].IsStdlib())
+	ut.AssertEqual(t, "main.main", s.Goroutines[1].CreatedBy.Func.Raw)
+	ut.AssertEqual(t, 10, s.Goroutines[1].CreatedBy.Line)
+}
+
+func TestParseSnapshotTinyGo(t *testing.T) {
+	t.Parallel()
+	data := "panic: runtime error at 0x000102a4: nil pointer dereference\n"
+	s, err := ParseSnapshot(bytes.NewBufferString(data), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, ToolchainTinyGo, s.Toolchain)
+	ut.AssertEqual(t, true, s.Reason.RuntimeError)
+}
+
+func TestParseFatalError(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		in       string
+		expected FatalKind
+	}{
+		{"all goroutines are asleep - deadlock!", FatalDeadlock},
+		{"concurrent map writes", FatalConcurrentMap},
+		{"concurrent map read and map write", FatalConcurrentMap},
+		{"out of memory", FatalOutOfMemory},
+		{"stack overflow", FatalStackOverflow},
+		{"sync: unlock of unlocked mutex", FatalUnlock},
+		{"sync: RUnlock of unlocked RWMutex", FatalUnlock},
+		{"unexpected signal during runtime execution", FatalSignal},
+		{"runtime: bad pointer in frame", FatalOther},
+	}
+	for i, line := range data {
+		f := ParseFatalError(line.in)
+		ut.AssertEqualIndex(t, i, line.expected, f.Kind)
+		ut.AssertEqualIndex(t, i, line.in, f.Message)
+	}
+	ut.AssertEqual(t, "deadlock", FatalDeadlock.String())
+	ut.AssertEqual(t, "other", FatalKind(100).String())
+}
+
+func TestParseSnapshotFatal(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"fatal error: all goroutines are asleep - deadlock!",
+		"",
+		"goroutine 1 [chan receive]:",
+		"main.main()",
+		"	/home/user/go/src/github.com/foo/bar/baz.go:428 +0x27",
+		"",
+	}
+	s, err := ParseSnapshot(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, &FatalError{Kind: FatalDeadlock, Message: "all goroutines are asleep - deadlock!"}, s.Fatal)
+	ut.AssertEqual(t, (*PanicReason)(nil), s.Reason)
+	ut.AssertEqual(t, 1, s.StartLine)
+}
+
+func TestParseSnapshotSignal(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"panic: runtime error: invalid memory address or nil pointer dereference",
+		"[signal SIGSEGV: segmentation violation code=0x1 addr=0x0 pc=0x45fd1a]",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"	/home/user/go/src/github.com/foo/bar/baz.go:428 +0x27",
+		"",
+	}
+	s, err := ParseSnapshot(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, &Signal{Name: "SIGSEGV", Description: "segmentation violation", Code: 1, PC: 0x45fd1a}, s.Signal)
+	ut.AssertEqual(t, true, s.Reason.RuntimeError)
+
+	// Windows.
+	data[1] = "[signal 0xc0000005 code=0x0 addr=0x18 pc=0x4a2b3c]"
+	s, err = ParseSnapshot(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, &Signal{Name: "0xc0000005", Addr: 0x18, PC: 0x4a2b3c}, s.Signal)
+}
+
+func TestParseSnapshotThreads(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"SIGQUIT: quit",
+		"PC=0x47f800 m=0 sigcode=0",
+		"",
+		"goroutine 8 gp=0x2e83a2c5d680 m=0 mp=0x532200 [running]:",
+		"main.main.func1()",
+		"	/tmp/crash/q.go:8 fp=0x2e83a2c90fe0 sp=0x2e83a2c90fd8 pc=0x47f800",
+		"created by main.main in goroutine 1",
+		"	/tmp/crash/q.go:7 +0x25",
+		"",
+		"goroutine 1 gp=0x2e83a2c5c1e0 m=nil [sleep]:",
+		"main.main()",
+		"	/tmp/crash/q.go:12 +0x4b fp=0x2e83a2c4df50 sp=0x2e83a2c4df20 pc=0x47f7cb",
+		"",
+		"rax    0x2e83a2c5d6b8",
+		"rip    0x47f800",
+		"rflags 0x246",
+		"",
+		"-----",
+		"",
+		"SIGQUIT: quit",
+		"PC=0x47d2a3 m=1 sigcode=0",
+		"",
+		"goroutine 0 gp=0x2e83a2c5c5a0 m=1 mp=0x2e83a2c92008 [idle]:",
+		"runtime.sysmon()",
+		"	/usr/local/go/src/runtime/proc.go:6593 +0x1d2 fp=0x2e83a2c81fa0 sp=0x2e83a2c81f20 pc=0x451bb2",
+		"rax    0xfffffffffffffffc",
+		"",
+	}
+	s, err := ParseSnapshot(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 3, len(s.Goroutines))
+	ut.AssertEqual(t, 8, s.Goroutines[0].Stack.Calls[0].Line)
+	ut.AssertEqual(t, 0, *s.Goroutines[0].M)
+	expected := []OSThread{
+		{
+			ID:        0,
+			Signal:    "SIGQUIT: quit",
+			PC:        0x47f800,
+			Registers: []Register{{"rax", 0x2e83a2c5d6b8}, {"rip", 0x47f800}, {"rflags", 0x246}},
+		},
+		{
+			ID:        1,
+			Signal:    "SIGQUIT: quit",
+			PC:        0x47d2a3,
+			Registers: []Register{{"rax", 0xfffffffffffffffc}},
+		},
+	}
+	ut.AssertEqual(t, expected, s.Threads)
+	ut.AssertEqual(t, 1, *s.Goroutines[2].M)
+	ut.AssertEqual(t, &s.Threads[0], s.Thread(&s.Goroutines[0]))
+	ut.AssertEqual(t, (*OSThread)(nil), s.Thread(&s.Goroutines[1]))
+	ut.AssertEqual(t, 1, s.StartLine)
+	ut.AssertEqual(t, len(data)-1, s.EndLine)
+}
+
+func TestParseSnapshotFormat(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"goroutine 6 [chan receive]:",
+		"main.worker()",
+		"	/home/user/src/main.go:10 +0x27",
+		"created by main.main in goroutine 1",
+		"	/home/user/src/main.go:20 +0x35",
+		"",
+	}
+	s, err := ParseSnapshot(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, FormatGo121, s.Format)
+	ut.AssertEqual(t, "go1.21", s.Format.String())
+	s, err = ParseSnapshot(bytes.NewBufferString("nothing"), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, FormatUnknown, s.Format)
+	ut.AssertEqual(t, 0, s.StartLine)
+}
+
+func TestSnapshotParent(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"goroutine 1 [select]:",
+		"main.main()",
+		"	/home/user/src/main.go:22 +0x40",
+		"",
+		"goroutine 6 [chan receive]:",
+		"main.worker()",
+		"	/home/user/src/main.go:10 +0x27",
+		"created by main.main in goroutine 1",
+		"	/home/user/src/main.go:20 +0x35",
+		"",
+		"goroutine 7 [chan receive]:",
+		"main.worker()",
+		"	/home/user/src/main.go:10 +0x27",
+		"created by main.main in goroutine 1",
+		"	/home/user/src/main.go:20 +0x35",
+		"",
+		"goroutine 9 [sleep]:",
+		"main.poll()",
+		"	/home/user/src/main.go:30 +0x11",
+		"created by main.start in goroutine 4",
+		"	/home/user/src/main.go:35 +0x12",
+		"",
+	}
+	s, err := ParseSnapshot(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 4, len(s.Goroutines))
+	ut.AssertEqual(t, "main.main", s.Goroutines[1].CreatedBy.Func.Raw)
+	ut.AssertEqual(t, 1, s.Goroutines[1].CreatedByID)
+	ut.AssertEqual(t, &s.Goroutines[0], s.Parent(&s.Goroutines[1]))
+	ut.AssertEqual(t, (*Goroutine)(nil), s.Parent(&s.Goroutines[0]))
+	// Goroutine 4 exited.
+	ut.AssertEqual(t, (*Goroutine)(nil), s.Parent(&s.Goroutines[3]))
+	ut.AssertEqual(t, []*Goroutine{&s.Goroutines[1], &s.Goroutines[2]}, s.Children(&s.Goroutines[0]))
+	ut.AssertEqual(t, 0, len(s.Children(&s.Goroutines[1])))
+
+	// Both goroutines are in the same bucket with the same creator.
+	buckets := (&Criteria{Similarity: ExactLines}).Bucketize(s.Goroutines)
+	ut.AssertEqual(t, 3, len(buckets))
+}
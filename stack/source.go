@@ -226,10 +226,14 @@ func extractArgumentsType(f *ast.FuncDecl) ([]string, bool) {
 }
 
 // processCall walks the function and populate call accordingly.
+//
+// Since Go 1.17, aggregates are printed as their words between braces. They are
+// flattened so the words are processed like the ones printed by older runtimes.
 func processCall(call *Call, f *ast.FuncDecl) {
-	values := make([]uint64, len(call.Args.Values))
-	for i := range call.Args.Values {
-		values[i] = call.Args.Values[i].Value
+	flat := call.Args.flatten()
+	values := make([]uint64, len(flat))
+	for i := range flat {
+		values[i] = flat[i].Value
 	}
 	index := 0
 	pop := func() uint64 {
@@ -242,7 +246,7 @@ func processCall(call *Call, f *ast.FuncDecl) {
 		return 0
 	}
 	popName := func() string {
-		n := call.Args.Values[index].Name
+		n := flat[index].Name
 		v := pop()
 		if len(n) == 0 {
 			return fmt.Sprintf("0x%x", v)
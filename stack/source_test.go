@@ -35,7 +35,9 @@ func getCrash(t *testing.T, content string) (string, []byte) {
 	defer os.RemoveAll(name)
 	main := filepath.Join(name, "main.go")
 	ut.AssertEqual(t, nil, ioutil.WriteFile(main, []byte(content), 0500))
-	cmd := exec.Command("go", "run", main)
+	// Disable inlining, otherwise the arguments of most calls are not printed
+	// since Go 1.17.
+	cmd := exec.Command("go", "run", "-gcflags", "-N -l", main)
 	// Use the Go 1.4 compatible format.
 	cmd.Env = overrideEnv(os.Environ(), "GOTRACEBACK", "2")
 	out, _ := cmd.CombinedOutput()
@@ -45,8 +47,9 @@ func getCrash(t *testing.T, content string) (string, []byte) {
 func TestAugment(t *testing.T) {
 	extra := &bytes.Buffer{}
 	main, content := getCrash(t, mainSource)
-	goroutines, err := ParseDump(bytes.NewBuffer(content), extra)
+	snapshot, err := ParseSnapshot(bytes.NewBuffer(content), extra)
 	ut.AssertEqual(t, nil, err)
+	goroutines := snapshot.Goroutines
 	// On go1.4, there's one less space.
 	actual := extra.String()
 	if actual != "panic: ooh\n\nexit status 2\n" && actual != "panic: ooh\nexit status 2\n" {
@@ -162,6 +165,19 @@ func TestAugment(t *testing.T) {
 		},
 	}
 	s := goroutines[0].Signature.Stack
+	if snapshot.Format >= FormatGo117 {
+		// The words are the same once the aggregates are flattened.
+		for i := range s.Calls {
+			s.Calls[i].Args = legacyArgs(&s.Calls[i].Args)
+		}
+	}
+	for i := range s.Calls {
+		// Not relevant to this test.
+		s.Calls[i].Offset = 0
+		s.Calls[i].FP = 0
+		s.Calls[i].SP = 0
+		s.Calls[i].PC = 0
+	}
 	// On Travis, runtime.GOROOT() != what is dumped when running a command via
 	// "go run". E.g. GOROOT() were "/usr/local/go" yet the path output via a
 	// subcommand is "/home/travis/.gimme/versions/go1.4.linux.amd64". Kidding
@@ -218,6 +234,25 @@ func TestAugment(t *testing.T) {
 	ut.AssertEqual(t, expected, s)
 }
 
+// legacyArgs returns the arguments as they were printed before Go 1.17.
+func legacyArgs(a *Args) Args {
+	out := Args{Processed: a.Processed, Elided: a.Elided}
+	for _, v := range a.flatten() {
+		out.Values = append(out.Values, Arg{Value: v.Value, Name: v.Name})
+	}
+	var elided func(a *Args) bool
+	elided = func(a *Args) bool {
+		for i := range a.Values {
+			if a.Values[i].IsAggregate && (a.Values[i].Fields.Elided || elided(&a.Values[i].Fields)) {
+				return true
+			}
+		}
+		return false
+	}
+	out.Elided = out.Elided || elided(a)
+	return out
+}
+
 func TestAugmentDummy(t *testing.T) {
 	goroutines := []Goroutine{
 		{
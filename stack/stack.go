@@ -16,8 +16,7 @@ import (
 	"io"
 	"math"
 	"net/url"
-	"os"
-	"path/filepath"
+	"path"
 	"regexp"
 	"runtime"
 	"sort"
@@ -35,7 +34,10 @@ var (
 	// - found next stack barrier at 0x123; expected
 	// - runtime: unexpected return pc for FUNC_NAME called from 0x123
 
-	reRoutineHeader = regexp.MustCompile("^goroutine (\\d+) \\[([^\\]]+)\\]\\:\n$")
+	// The gp and m decorations are printed when the runtime crashes or with
+	// GOTRACEBACK=system. The pprof labels are printed with
+	// GODEBUG=tracebacklabels=1.
+	reRoutineHeader = regexp.MustCompile("^goroutine (\\d+)(?: gp=0x[0-9a-f]+ m=(?:(\\d+) mp=0x[0-9a-f]+|nil))? \\[([^\\]]+)\\](?: \\{(.*)\\})?\\:\n$")
 	reMinutes       = regexp.MustCompile("^(\\d+) minutes$")
 	reUnavail       = regexp.MustCompile("^(?:\t| +)goroutine running on other thread; stack unavailable")
 	// See gentraceback() in src/runtime/traceback.go for more information.
@@ -52,20 +54,30 @@ var (
 	//   _func.entry is not set.
 	// - C calls may have fp=0x123 sp=0x123 appended. I think it normally happens
 	//   when a signal is not correctly handled. It is printed with m.throwing>0.
-	//   These are discarded.
+	//   Newer runtimes also append pc=0x123.
 	// - For cgo, the source file may be "??".
-	reFile = regexp.MustCompile("^(?:\t| +)(\\?\\?|\\<autogenerated\\>|.+\\.(?:c|go|s))\\:(\\d+)(?:| \\+0x[0-9a-f]+)(?:| fp=0x[0-9a-f]+ sp=0x[0-9a-f]+)\n$")
-	// Sadly, it doesn't note the goroutine number so we could cascade them per
-	// parenthood.
-	reCreated = regexp.MustCompile("^created by (.+)\n$")
+	reFile = regexp.MustCompile("^(?:\t| +)(\\?\\?|\\<autogenerated\\>|.+\\.(?:c|go|s))\\:(\\d+)(?:| \\+0x([0-9a-f]+))(?:| fp=0x([0-9a-f]+) sp=0x([0-9a-f]+)(?:| pc=0x([0-9a-f]+)))\n$")
+	// Go 1.21+ appends the ID of the creator goroutine, so they can be
+	// cascaded per parenthood.
+	reCreated = regexp.MustCompile("^created by (.+?)(?: in goroutine (\\d+))?\n$")
 	reFunc    = regexp.MustCompile("^(.+)\\((.*)\\)\n$")
-	reElided  = regexp.MustCompile("^\\.\\.\\.additional frames elided\\.\\.\\.\n$")
+	// Since Go 1.21, the middle of a deep stack is elided with
+	// "...1000 frames elided..." and the bottom frames follow.
+	reElided = regexp.MustCompile("^\\.\\.\\.(additional|\\d+) frames elided\\.\\.\\.\n$")
+	// With GODEBUG=tracebackancestors=N, the stack of the goroutines that
+	// created the goroutine, as it was when they created it, follows the
+	// goroutine. See printAncestorTraceback() in src/runtime/traceback.go.
+	reAncestor = regexp.MustCompile("^\\[originating from goroutine (\\d+)\\]:\n$")
+	// C frames are printed by the cgo traceback function set with
+	// runtime.SetCgoTraceback, e.g. "crash" then "\t/src/crash.c:5 pc=0x4a1b2c".
+	// The name is "non-Go function" and the file is omitted when they can't be
+	// symbolized. See printOneCgoTraceback() in src/runtime/traceback.go.
+	reCFunc = regexp.MustCompile("^([^\\s()]+|non-Go function)\n$")
+	reCFile = regexp.MustCompile("^(?:\t| +)(?:(.+):(\\d+) )?pc=0x([0-9a-f]+)\n$")
 	// Include frequent GOROOT value on Windows, distro provided and user
 	// installed path. This simplifies the user's life when processing a trace
-	// generated on another VM.
-	// TODO(maruel): Guess the path automatically via traces containing the
-	// 'runtime' package, which is very frequent. This would be "less bad" than
-	// throwing up random values at the parser.
+	// generated on another VM. The GOROOT of the machine that built the
+	// executable is inferred from each dump, see Call.Stdlib.
 	goroots = []string{runtime.GOROOT(), "c:/go", "/usr/lib/go", "/usr/local/go"}
 )
 
@@ -84,6 +96,39 @@ const (
 	AnyValue
 )
 
+func (s Similarity) String() string {
+	switch s {
+	case ExactFlags:
+		return "exactflags"
+	case ExactLines:
+		return "exactlines"
+	case AnyPointer:
+		return "anypointer"
+	case AnyValue:
+		return "anyvalue"
+	default:
+		return fmt.Sprintf("Similarity(%d)", int(s))
+	}
+}
+
+// ParseSimilarity parses the name of a Similarity as returned by String, e.g.
+// "anypointer". "exact", "pointer" and "value" are accepted as the short names
+// of ExactLines, AnyPointer and AnyValue.
+func ParseSimilarity(s string) (Similarity, error) {
+	switch strings.ToLower(s) {
+	case "exactflags":
+		return ExactFlags, nil
+	case "exactlines", "exact":
+		return ExactLines, nil
+	case "anypointer", "pointer":
+		return AnyPointer, nil
+	case "anyvalue", "value":
+		return AnyValue, nil
+	default:
+		return 0, fmt.Errorf("invalid similarity %q; use exactflags, exactlines, anypointer or anyvalue", s)
+	}
+}
+
 // Function is a function call.
 //
 // Go stack traces print a mangled function call, this wrapper unmangle the
@@ -104,39 +149,50 @@ func (f Function) String() string {
 
 // Name is the naked function name.
 func (f Function) Name() string {
-	parts := strings.SplitN(filepath.Base(f.Raw), ".", 2)
-	if len(parts) == 1 {
-		return parts[0]
+	pkg, name := f.split()
+	if name == "" {
+		return pkg
 	}
-	return parts[1]
+	return name
 }
 
 // PkgName is the package name for this function reference.
 func (f Function) PkgName() string {
-	parts := strings.SplitN(filepath.Base(f.Raw), ".", 2)
-	if len(parts) == 1 {
+	pkg, name := f.split()
+	if name == "" {
 		return ""
 	}
-	s, _ := url.QueryUnescape(parts[0])
+	s, _ := url.QueryUnescape(pkg)
 	return s
 }
 
 // PkgDotName returns "<package>.<func>" format.
 func (f Function) PkgDotName() string {
-	parts := strings.SplitN(filepath.Base(f.Raw), ".", 2)
-	s, _ := url.QueryUnescape(parts[0])
-	if len(parts) == 1 {
-		return parts[0]
+	pkg, name := f.split()
+	s, _ := url.QueryUnescape(pkg)
+	if name == "" {
+		return pkg
 	}
-	if s != "" || parts[1] != "" {
-		return s + "." + parts[1]
+	if s != "" || name != "" {
+		return s + "." + name
 	}
 	return ""
 }
 
+// ImportPath returns the import path of the package of the function, e.g.
+// "github.com/maruel/panicparse/stack". It is empty if there is no package.
+func (f Function) ImportPath() string {
+	_, name := f.split()
+	if name == "" {
+		return ""
+	}
+	s, _ := url.QueryUnescape(f.Raw[:len(f.Raw)-len(name)-1])
+	return s
+}
+
 // IsExported returns true if the function is exported.
 func (f Function) IsExported() bool {
-	name := f.Name()
+	name := stripTypeArgs(f.Name())
 	parts := strings.Split(name, ".")
 	r, _ := utf8.DecodeRuneInString(parts[len(parts)-1])
 	if unicode.ToUpper(r) == r {
@@ -145,10 +201,59 @@ func (f Function) IsExported() bool {
 	return f.PkgName() == "main" && name == "main"
 }
 
+// IsGeneric returns true if the function is a generic function or a method of
+// a generic type, e.g. "pkg.Map[...]" or "pkg.(*List[...]).Push".
+func (f Function) IsGeneric() bool {
+	return f.TypeArgs() != ""
+}
+
+// BaseName returns the fully qualified function name without the type
+// arguments, e.g. "pkg.(*List).Push" for "pkg.(*List[...]).Push".
+func (f Function) BaseName() string {
+	return stripTypeArgs(f.Raw)
+}
+
+// TypeArgs returns the type arguments of the instantiation, without the
+// brackets. It is "..." since Go 1.21, as the runtime elides them, and the
+// GC shapes before, e.g. "go.shape.int". It is empty if the function is not
+// generic.
+func (f Function) TypeArgs() string {
+	start := strings.IndexByte(f.Raw, '[')
+	if start == -1 {
+		return ""
+	}
+	depth := 0
+	for i := start; i < len(f.Raw); i++ {
+		switch f.Raw[i] {
+		case '[':
+			depth++
+		case ']':
+			if depth--; depth == 0 {
+				return f.Raw[start+1 : i]
+			}
+		}
+	}
+	return ""
+}
+
 // Arg is an argument on a Call.
 type Arg struct {
 	Value uint64 // Value is the raw value as found in the stack trace
 	Name  string // Name is a pseudo name given to the argument
+	// IsAggregate is set when the argument is a struct, an array, a string, a
+	// slice or an interface, printed as {...} since Go 1.17. Its words are in
+	// Fields and Value is 0.
+	IsAggregate bool
+	Fields      Args
+	// IsInaccurate is set when the value is followed by '?' since Go 1.17. The
+	// argument was passed in a register and the value printed may be stale.
+	IsInaccurate bool
+	// IsOffsetTooLarge is set when the argument is printed as '_' since Go
+	// 1.17, because it is too far in the frame to be printed.
+	IsOffsetTooLarge bool
+	// Raw is the text of the argument when it couldn't be parsed, e.g. a
+	// mangled value or argument list. Value is 0 then.
+	Raw string
 }
 
 // IsPtr returns true if we guess it's a pointer. It's only a guess, it can be
@@ -162,10 +267,31 @@ func (a Arg) String() string {
 	if a.Name != "" {
 		return a.Name
 	}
-	if a.Value == 0 {
-		return "0"
+	if a.IsAggregate {
+		return "{" + a.Fields.String() + "}"
 	}
-	return fmt.Sprintf("0x%x", a.Value)
+	if a.IsOffsetTooLarge {
+		return "_"
+	}
+	if a.Raw != "" {
+		return a.Raw
+	}
+	out := "0"
+	if a.Value != 0 {
+		out = fmt.Sprintf("0x%x", a.Value)
+	}
+	if a.IsInaccurate {
+		out += "?"
+	}
+	return out
+}
+
+// Equal returns true only if both arguments are exactly equal.
+func (a *Arg) Equal(r *Arg) bool {
+	if a.Value != r.Value || a.Name != r.Name || a.IsAggregate != r.IsAggregate || a.IsInaccurate != r.IsInaccurate || a.IsOffsetTooLarge != r.IsOffsetTooLarge || a.Raw != r.Raw {
+		return false
+	}
+	return a.Fields.Equal(&r.Fields)
 }
 
 // Args is a series of function call arguments.
@@ -199,8 +325,8 @@ func (a *Args) Equal(r *Args) bool {
 	if a.Elided != r.Elided || len(a.Values) != len(r.Values) {
 		return false
 	}
-	for i, l := range a.Values {
-		if l != r.Values[i] {
+	for i := range a.Values {
+		if !a.Values[i].Equal(&r.Values[i]) {
 			return false
 		}
 	}
@@ -216,14 +342,21 @@ func (a *Args) Similar(r *Args, similar Similarity) bool {
 	if similar == AnyValue {
 		return true
 	}
-	for i, l := range a.Values {
+	for i := range a.Values {
+		l := &a.Values[i]
 		switch similar {
 		case ExactFlags, ExactLines:
-			if l != r.Values[i] {
+			if !l.Equal(&r.Values[i]) {
 				return false
 			}
 		default:
-			if l.IsPtr() != r.Values[i].IsPtr() || (!l.IsPtr() && l != r.Values[i]) {
+			if l.IsAggregate || r.Values[i].IsAggregate {
+				if l.IsAggregate != r.Values[i].IsAggregate || !l.Fields.Similar(&r.Values[i].Fields, similar) {
+					return false
+				}
+				continue
+			}
+			if l.IsPtr() != r.Values[i].IsPtr() || (!l.IsPtr() && !l.Equal(&r.Values[i])) {
 				return false
 			}
 		}
@@ -238,7 +371,9 @@ func (a *Args) Merge(r *Args) Args {
 		Elided: a.Elided,
 	}
 	for i, l := range a.Values {
-		if l != r.Values[i] {
+		if l.IsAggregate && r.Values[i].IsAggregate && len(l.Fields.Values) == len(r.Values[i].Fields.Values) {
+			out.Values[i] = Arg{IsAggregate: true, Fields: l.Fields.Merge(&r.Values[i].Fields)}
+		} else if !l.Equal(&r.Values[i]) {
 			out.Values[i].Name = "*"
 			out.Values[i].Value = l.Value
 		} else {
@@ -248,38 +383,134 @@ func (a *Args) Merge(r *Args) Args {
 	return out
 }
 
+// opaque returns true if an argument couldn't be parsed.
+func (a *Args) opaque() bool {
+	for i := range a.Values {
+		if a.Values[i].Raw != "" || a.Values[i].Fields.opaque() {
+			return true
+		}
+	}
+	return false
+}
+
+// flatten returns the words of the arguments, with the fields of aggregates
+// inlined.
+func (a *Args) flatten() []Arg {
+	out := make([]Arg, 0, len(a.Values))
+	for i := range a.Values {
+		if a.Values[i].IsAggregate {
+			out = append(out, a.Values[i].Fields.flatten()...)
+		} else {
+			out = append(out, a.Values[i])
+		}
+	}
+	return out
+}
+
+// FrameKind is the kind of code of a call.
+type FrameKind int
+
+// Frame kinds.
+const (
+	// FrameGo is Go code.
+	FrameGo FrameKind = iota
+	// FrameC is C code called through cgo.
+	FrameC
+	// FrameAsm is assembly, e.g. the runtime's trampolines.
+	FrameAsm
+)
+
+func (k FrameKind) String() string {
+	switch k {
+	case FrameGo:
+		return "Go"
+	case FrameC:
+		return "C"
+	case FrameAsm:
+		return "asm"
+	default:
+		return "unknown"
+	}
+}
+
 // Call is an item in the stack trace.
 type Call struct {
-	SourcePath string   // Full path name of the source file
-	Line       int      // Line number
-	Func       Function // Fully qualified function name (encoded).
-	Args       Args     // Call arguments
+	SourcePath    string   // Full path name of the source file
+	Line          int      // Line number
+	Func          Function // Fully qualified function name (encoded).
+	Args          Args     // Call arguments
+	Offset        uint64   // Offset of the return address from the function entry, 0 when not printed
+	Reconstructed bool     // Reconstructed is set when the call was not in the dump but recovered from the executable.
+	Inlined       bool     // Inlined is set when the call was inlined in its caller and expanded from the executable.
+	Kind          FrameKind
+	// PathSeparator is the separator of the source path as printed in the dump.
+	// SourcePath always uses '/' so it doesn't depend on the OS of the host
+	// analyzing the dump. 0 means '/'.
+	PathSeparator byte
+	// FP and SP are the frame and stack pointers of the frame. They are only
+	// printed with GOTRACEBACK=system or crash, 0 otherwise.
+	FP uint64
+	SP uint64
+	// PC is the program counter of the frame. It is printed along FP and SP
+	// and for C frames, 0 otherwise.
+	PC uint64
+	// Stdlib is set when the source file is in the GOROOT inferred from the
+	// runtime frames of the dump, so the standard library is detected in
+	// traces built in any environment.
+	Stdlib bool
+	// Framework is set by Criteria.Bucketize when the call is in one of the
+	// Criteria.FrameworkPrefixes.
+	Framework bool
 }
 
-// Equal returns true only if both calls are exactly equal.
+// Equal returns true only if both calls are exactly equal, including the
+// offset and the registers.
 func (c *Call) Equal(r *Call) bool {
-	return c.SourcePath == r.SourcePath && c.Line == r.Line && c.Func == r.Func && c.Args.Equal(&r.Args)
+	return c.SourcePath == r.SourcePath && c.Line == r.Line && c.Func == r.Func && c.Offset == r.Offset && c.PC == r.PC && c.FP == r.FP && c.SP == r.SP && c.Args.Equal(&r.Args)
 }
 
 // Similar returns true if the two Call are equal or almost but not quite
-// equal.
+// equal. The offset and the registers are ignored.
 func (c *Call) Similar(r *Call, similar Similarity) bool {
-	return c.SourcePath == r.SourcePath && c.Line == r.Line && c.Func == r.Func && c.Args.Similar(&r.Args, similar)
+	return c.similar(r, &Criteria{Similarity: similar})
 }
 
 // Merge merges two similar Call, zapping out differences.
+//
+// The offset and the registers are kept only when both are the same, since
+// the same line may be compiled to more than one return address and each
+// goroutine has its own stack.
 func (c *Call) Merge(r *Call) Call {
 	return Call{
-		SourcePath: c.SourcePath,
-		Line:       c.Line,
-		Func:       c.Func,
-		Args:       c.Args.Merge(&r.Args),
+		SourcePath:    c.SourcePath,
+		Line:          c.Line,
+		Func:          c.Func,
+		Args:          c.Args.Merge(&r.Args),
+		Offset:        sameOr0(c.Offset, r.Offset),
+		Reconstructed: c.Reconstructed,
+		Inlined:       c.Inlined,
+		Kind:          c.Kind,
+		PathSeparator: c.PathSeparator,
+		FP:            sameOr0(c.FP, r.FP),
+		SP:            sameOr0(c.SP, r.SP),
+		PC:            sameOr0(c.PC, r.PC),
+		Stdlib:        c.Stdlib,
+		Framework:     c.Framework,
 	}
 }
 
 // SourceName returns the base file name of the source file.
 func (c *Call) SourceName() string {
-	return filepath.Base(c.SourcePath)
+	return path.Base(c.SourcePath)
+}
+
+// OriginalSourcePath returns the source path with the separator used in the
+// dump.
+func (c *Call) OriginalSourcePath() string {
+	if c.PathSeparator == 0 || c.PathSeparator == '/' {
+		return c.SourcePath
+	}
+	return strings.Replace(c.SourcePath, "/", string(c.PathSeparator), -1)
 }
 
 // SourceLine returns "source.go:line", including only the base file name.
@@ -287,23 +518,37 @@ func (c *Call) SourceLine() string {
 	return fmt.Sprintf("%s:%d", c.SourceName(), c.Line)
 }
 
-// FullSourceLine returns "/path/to/source.go:line".
+// FullSourceLine returns "/path/to/source.go:line", with the separator used
+// in the dump.
 func (c *Call) FullSourceLine() string {
-	return fmt.Sprintf("%s:%d", c.SourcePath, c.Line)
+	return fmt.Sprintf("%s:%d", c.OriginalSourcePath(), c.Line)
 }
 
 // PkgSource is one directory plus the file name of the source file.
 func (c *Call) PkgSource() string {
-	return filepath.Join(filepath.Base(filepath.Dir(c.SourcePath)), c.SourceName())
+	return path.Join(path.Base(path.Dir(c.SourcePath)), c.SourceName())
 }
 
-const testMainSource = "_test" + string(os.PathSeparator) + "_testmain.go"
+const testMainSource = "_test/_testmain.go"
 
 // IsStdlib returns true if it is a Go standard library function. This includes
 // the 'go test' generated main executable.
 func (c *Call) IsStdlib() bool {
+	if c.Stdlib {
+		return true
+	}
+	src := c.SourcePath
+	// Windows paths are case insensitive.
+	drive := len(src) >= 2 && src[1] == ':'
+	if drive {
+		src = strings.ToLower(src)
+	}
 	for _, goroot := range goroots {
-		if strings.HasPrefix(c.SourcePath, goroot) {
+		goroot = strings.Replace(goroot, "\\", "/", -1)
+		if drive {
+			goroot = strings.ToLower(goroot)
+		}
+		if strings.HasPrefix(src, goroot) {
 			return true
 		}
 	}
@@ -311,6 +556,12 @@ func (c *Call) IsStdlib() bool {
 	return c.PkgSource() == testMainSource
 }
 
+// IsFramework returns true if the function is in one of the
+// Criteria.FrameworkPrefixes, see Call.Framework.
+func (c *Call) IsFramework() bool {
+	return c.Framework
+}
+
 // IsPkgMain returns true if it is in the main package.
 func (c *Call) IsPkgMain() bool {
 	return c.Func.PkgName() == "main"
@@ -318,13 +569,15 @@ func (c *Call) IsPkgMain() bool {
 
 // Stack is a call stack.
 type Stack struct {
-	Calls  []Call // Call stack. First is original function, last is leaf function.
-	Elided bool   // Happens when there's >100 items in Stack, currently hardcoded in package runtime.
+	Calls        []Call // Call stack. First is original function, last is leaf function.
+	Elided       bool   // Happens when there's >100 items in Stack, currently hardcoded in package runtime. The bottom frames are cut.
+	MiddleElided int    // Number of frames elided before Calls[MiddleIndex]. Since Go 1.21 the runtime keeps the top and the bottom of deep stacks.
+	MiddleIndex  int    // Index in Calls of the first frame after the MiddleElided ones.
 }
 
 // Equal returns true on if both call stacks are exactly equal.
 func (s *Stack) Equal(r *Stack) bool {
-	if len(s.Calls) != len(r.Calls) || s.Elided != r.Elided {
+	if len(s.Calls) != len(r.Calls) || s.Elided != r.Elided || s.MiddleElided != r.MiddleElided || s.MiddleIndex != r.MiddleIndex {
 		return false
 	}
 	for i := range s.Calls {
@@ -338,23 +591,24 @@ func (s *Stack) Equal(r *Stack) bool {
 // Similar returns true if the two Stack are equal or almost but not quite
 // equal.
 func (s *Stack) Similar(r *Stack, similar Similarity) bool {
-	if len(s.Calls) != len(r.Calls) || s.Elided != r.Elided {
-		return false
-	}
-	for i := range s.Calls {
-		if !s.Calls[i].Similar(&r.Calls[i], similar) {
-			return false
-		}
-	}
-	return true
+	return s.similar(r, &Criteria{Similarity: similar})
 }
 
 // Merge merges two similar Stack, zapping out differences.
 func (s *Stack) Merge(r *Stack) *Stack {
 	// Assumes similar stacks have the same length.
 	out := &Stack{
-		Calls:  make([]Call, len(s.Calls)),
-		Elided: s.Elided,
+		Calls: make([]Call, len(s.Calls)),
+		// Only differs for stacks cut per Criteria.TopFrames, where one had
+		// more calls.
+		Elided:       s.Elided || r.Elided,
+		MiddleElided: s.MiddleElided,
+		MiddleIndex:  s.MiddleIndex,
+	}
+	if r.MiddleElided > out.MiddleElided {
+		// The number of elided frames varies with the depth of the recursion;
+		// keep the largest.
+		out.MiddleElided = r.MiddleElided
 	}
 	for i := range s.Calls {
 		out.Calls[i] = s.Calls[i].Merge(&r.Calls[i])
@@ -363,65 +617,55 @@ func (s *Stack) Merge(r *Stack) *Stack {
 }
 
 // Less compares two Stack, where the ones that are less are more
-// important, so they come up front. A Stack with more private functions is
-// 'less' so it is at the top. Inversely, a Stack with only public
-// functions is 'more' so it is at the bottom.
+// important, so they come up front.
+//
+// The order is:
+//   - more calls outside the standard library first
+//   - then fewer calls in the standard library first
+//   - then the calls from the top, compared by function name, source path
+//     and line number
+//
+// It is a strict weak order; two Stack are equivalent only if these fields
+// are all equal.
 func (s *Stack) Less(r *Stack) bool {
-	lStdlib := 0
-	lPrivate := 0
-	for _, c := range s.Calls {
-		if c.IsStdlib() {
-			lStdlib++
-		} else {
-			lPrivate++
-		}
-	}
-	rStdlib := 0
-	rPrivate := 0
-	for _, s := range r.Calls {
-		if s.IsStdlib() {
-			rStdlib++
-		} else {
-			rPrivate++
-		}
+	lPrivate, lStdlib := s.depths()
+	rPrivate, rStdlib := r.depths()
+	if lPrivate != rPrivate {
+		return lPrivate > rPrivate
 	}
-	if lPrivate > rPrivate {
-		return true
-	}
-	if lPrivate < rPrivate {
-		return false
-	}
-	if lStdlib > rStdlib {
-		return false
-	}
-	if lStdlib < rStdlib {
-		return true
+	if lStdlib != rStdlib {
+		return lStdlib < rStdlib
 	}
-
 	// Stack lengths are the same.
 	for x := range s.Calls {
-		if s.Calls[x].Func.Raw < r.Calls[x].Func.Raw {
-			return true
-		}
-		if s.Calls[x].Func.Raw > r.Calls[x].Func.Raw {
-			return true
-		}
-		if s.Calls[x].PkgSource() < r.Calls[x].PkgSource() {
-			return true
-		}
-		if s.Calls[x].PkgSource() > r.Calls[x].PkgSource() {
-			return true
+		l, r := &s.Calls[x], &r.Calls[x]
+		if l.Func.Raw != r.Func.Raw {
+			return l.Func.Raw < r.Func.Raw
 		}
-		if s.Calls[x].Line < r.Calls[x].Line {
-			return true
+		if l.SourcePath != r.SourcePath {
+			return l.SourcePath < r.SourcePath
 		}
-		if s.Calls[x].Line > r.Calls[x].Line {
-			return true
+		if l.Line != r.Line {
+			return l.Line < r.Line
 		}
 	}
 	return false
 }
 
+// depths returns the number of calls outside and inside the standard
+// library, including Criteria.FrameworkPrefixes.
+func (s *Stack) depths() (int, int) {
+	private, stdlib := 0, 0
+	for i := range s.Calls {
+		if s.Calls[i].IsStdlib() || s.Calls[i].IsFramework() {
+			stdlib++
+		} else {
+			private++
+		}
+	}
+	return private, stdlib
+}
+
 // Signature represents the signature of one or multiple goroutines.
 //
 // It is effectively the stack trace plus the goroutine internal bits, like
@@ -446,15 +690,20 @@ type Signature struct {
 	//      scanenqueue
 	State     string
 	CreatedBy Call // Which other goroutine which created this one.
-	SleepMin  int  // Wait time in minutes, if applicable.
-	SleepMax  int  // Wait time in minutes, if applicable.
+	SleepMin  int  // Wait time in minutes, if applicable. Merge keeps the shortest.
+	SleepMax  int  // Wait time in minutes, if applicable. Merge keeps the longest, the oldest waiter.
 	Stack     Stack
 	Locked    bool // Locked to an OS thread.
+	GCAssist  bool // Captured doing GC work, the runtime calls were trimmed by TrimGCAssist.
+	// CreatedByID is the ID of the goroutine that created this one, printed
+	// since Go 1.21. It is 0 when unknown. It is ignored by Equal, Similar and
+	// Less as it is different for each goroutine.
+	CreatedByID int
 }
 
 // Equal returns true only if both signatures are exactly equal.
 func (s *Signature) Equal(r *Signature) bool {
-	if s.State != r.State || !s.CreatedBy.Equal(&r.CreatedBy) || s.Locked != r.Locked || s.SleepMin != r.SleepMin || s.SleepMax != r.SleepMax {
+	if s.State != r.State || !s.CreatedBy.Equal(&r.CreatedBy) || s.Locked != r.Locked || s.GCAssist != r.GCAssist || s.SleepMin != r.SleepMin || s.SleepMax != r.SleepMax {
 		return false
 	}
 	return s.Stack.Equal(&r.Stack)
@@ -462,14 +711,11 @@ func (s *Signature) Equal(r *Signature) bool {
 
 // Similar returns true if the two Signature are equal or almost but not quite
 // equal.
+//
+// A goroutine captured doing GC work is only similar to the other ones
+// captured doing GC work.
 func (s *Signature) Similar(r *Signature, similar Similarity) bool {
-	if s.State != r.State || !s.CreatedBy.Similar(&r.CreatedBy, similar) {
-		return false
-	}
-	if similar == ExactFlags && s.Locked != r.Locked {
-		return false
-	}
-	return s.Stack.Similar(&r.Stack, similar)
+	return s.similar(r, &Criteria{Similarity: similar})
 }
 
 // Merge merges two similar Signature, zapping out differences.
@@ -482,40 +728,61 @@ func (s *Signature) Merge(r *Signature) *Signature {
 	if r.SleepMax > max {
 		max = r.SleepMax
 	}
+	createdByID := 0
+	if s.CreatedByID == r.CreatedByID {
+		createdByID = s.CreatedByID
+	}
 	return &Signature{
-		State:     s.State,     // Drop right side.
-		CreatedBy: s.CreatedBy, // Drop right side.
-		SleepMin:  min,
-		SleepMax:  max,
-		Stack:     *s.Stack.Merge(&r.Stack),
-		Locked:    s.Locked || r.Locked, // TODO(maruel): This is weirdo.
+		State:       s.State,     // Drop right side.
+		CreatedBy:   s.CreatedBy, // Drop right side.
+		CreatedByID: createdByID,
+		SleepMin:    min,
+		SleepMax:    max,
+		Stack:       *s.Stack.Merge(&r.Stack),
+		Locked:      s.Locked || r.Locked, // TODO(maruel): This is weirdo.
+		GCAssist:    s.GCAssist,           // Similar signatures have the same value.
 	}
 }
 
 // Less compares two Signature, where the ones that are less are more
-// important, so they come up front. A Signature with more private functions is
-// 'less' so it is at the top. Inversely, a Signature with only public
-// functions is 'more' so it is at the bottom.
+// important, so they come up front.
+//
+// The order is:
+//   - more calls outside the standard library first
+//   - then fewer calls in the standard library first
+//   - then State, alphabetically
+//   - then locked to a thread first
+//   - then Stack.Less for the function names
+//   - then CreatedBy, by function name then line number
+//   - then shorter SleepMax first
 func (s *Signature) Less(r *Signature) bool {
-	if s.Stack.Less(&r.Stack) {
-		return true
+	lPrivate, lStdlib := s.Stack.depths()
+	rPrivate, rStdlib := r.Stack.depths()
+	if lPrivate != rPrivate {
+		return lPrivate > rPrivate
 	}
-	if r.Stack.Less(&s.Stack) {
-		return false
+	if lStdlib != rStdlib {
+		return lStdlib < rStdlib
 	}
-	if s.Locked && !r.Locked {
-		return true
+	if s.State != r.State {
+		return s.State < r.State
 	}
-	if r.Locked && !s.Locked {
-		return false
+	if s.Locked != r.Locked {
+		return s.Locked
 	}
-	if s.State < r.State {
+	if s.Stack.Less(&r.Stack) {
 		return true
 	}
-	if s.State > r.State {
+	if r.Stack.Less(&s.Stack) {
 		return false
 	}
-	return false
+	if s.CreatedBy.Func.Raw != r.CreatedBy.Func.Raw {
+		return s.CreatedBy.Func.Raw < r.CreatedBy.Func.Raw
+	}
+	if s.CreatedBy.Line != r.CreatedBy.Line {
+		return s.CreatedBy.Line < r.CreatedBy.Line
+	}
+	return s.SleepMax < r.SleepMax
 }
 
 // Goroutine represents the state of one goroutine, including the stack trace.
@@ -523,22 +790,129 @@ type Goroutine struct {
 	Signature      // It's stack trace, internal bits, state, which call site created it, etc.
 	ID        int  // Goroutine ID.
 	First     bool // First is the goroutine first printed, normally the one that crashed.
+	// M is the ID of the runtime thread (M) running the goroutine, when
+	// printed. It is not the OS thread ID, which the runtime doesn't print; it
+	// matches the OSThread.ID of the thread sections of a GOTRACEBACK=crash
+	// dump.
+	M *int
+	// OSThreadID is the ID of the OS thread running the goroutine, e.g. the
+	// LWP listed by "top -H". Only Delve prints it.
+	OSThreadID *int
+	// Labels are the pprof labels of the goroutine. They are only printed with
+	// GODEBUG=tracebacklabels=1.
+	Labels map[string]string
+	// Ancestors are the stacks of the goroutine that created this one, then of
+	// the goroutine that created it and so on, as they were at creation time.
+	// They are only printed with GODEBUG=tracebackancestors=N. The ID of
+	// Ancestors[0] is CreatedByID, the ID of Ancestors[i+1] is
+	// Ancestors[i].CreatedByID.
+	Ancestors []Signature
+	// Incomplete is set when the stack of the goroutine was cut, e.g. when the
+	// log was rotated or the process was killed while printing the dump.
+	Incomplete bool
+	// Crashed is set when the goroutine is running a panic or a fatal error
+	// per its stack, e.g. runtime.gopanic or runtime.sigpanic. Unlike First,
+	// it doesn't depend on the order the goroutines were printed in so it is
+	// right for a dump fetched from pprof or whose panic header was lost. It is
+	// set by ParseDump, ParseLenient and ParseDelve.
+	Crashed bool
 }
 
-// Bucketize returns the number of similar goroutines.
-func Bucketize(goroutines []Goroutine, similar Similarity) map[*Signature][]Goroutine {
+// Criteria defines how goroutines are coalesced into buckets.
+//
+// Signature.Similar ignores the sleep duration and only considers Locked at
+// the ExactFlags level. Criteria permits to make these attributes significant
+// at any Similarity level, as these distinctions matter for some
+// investigations.
+type Criteria struct {
+	// Similarity is the level at which call arguments must match.
+	Similarity Similarity
+	// Locked puts goroutines locked to an OS thread in different buckets than
+	// the ones that are not, independent of Similarity.
+	Locked bool
+	// SleepRanges is a sorted list of boundaries in minutes. Goroutines that
+	// have been sleeping in different ranges are put in different buckets. For
+	// example, []int{30} separates goroutines sleeping for at least 30 minutes
+	// from the others.
+	SleepRanges []int
+	// Labels are pprof label keys. Goroutines with different values for any of
+	// these labels are put in different buckets, e.g. []string{"tenant"} to
+	// get the buckets of each tenant. Goroutines without the label are put
+	// together.
+	Labels []string
+	// AnyLine puts goroutines whose calls only differ by line number in the
+	// same bucket, e.g. to merge the dumps of slightly different builds. The
+	// bucket keeps the line numbers of its first goroutine.
+	AnyLine bool
+	// AnyClosure puts goroutines whose calls only differ by the number of an
+	// anonymous function in the same bucket, e.g. pkg.Worker.func1 and
+	// pkg.Worker.func2, as a refactor renumbers them. The bucket keeps the
+	// names of its first goroutine.
+	AnyClosure bool
+	// TopFrames, when non-zero, only compares the top, innermost, calls of the
+	// stacks, regardless of their callers and creator. For example 3 groups the
+	// goroutines blocked in the same place of database/sql whichever code
+	// called it. The bucket's stack is cut to these calls.
+	TopFrames int
+	// BottomFrames, when non-zero, only compares the bottom, outermost, calls
+	// of the stacks and the creator, regardless of where the goroutines are
+	// blocked. It is ignored when TopFrames is set. The stacks cut at the
+	// bottom by the runtime before Go 1.21 don't have their bottom calls so
+	// they are compared whole.
+	BottomFrames int
+	// Ignore are rules of goroutines Bucketize leaves out, e.g. the expected
+	// background goroutines.
+	Ignore []IgnoreRule
+	// FrameworkPrefixes are the import paths, e.g. "github.com/acme/kit", or
+	// source directories, e.g. "/src/vendor/sdk", of code to treat like the
+	// standard library, e.g. an internal framework or a vendored SDK.
+	//
+	// Bucketize sets Call.Framework on their calls, which are ranked like the
+	// standard library in Signature.Less and dimmed in the output, so the
+	// business code floats to the top.
+	FrameworkPrefixes []string
+	// Rules annotate the buckets returned by Buckets, e.g. with the runbook of
+	// a known failure mode.
+	Rules Rules
+}
+
+// Similar returns true if the two signatures fit in the same bucket.
+func (c *Criteria) Similar(l, r *Signature) bool {
+	l, r = c.frames(l), c.frames(r)
+	if c.Locked && l.Locked != r.Locked {
+		return false
+	}
+	if c.sleepRange(l.SleepMax) != c.sleepRange(r.SleepMax) {
+		return false
+	}
+	return l.similar(r, c)
+}
+
+// Bucketize returns the number of goroutines similar per the criteria.
+//
+// It sets Call.Framework on the calls of goroutines in FrameworkPrefixes.
+func (c *Criteria) Bucketize(goroutines []Goroutine) map[*Signature][]Goroutine {
 	out := map[*Signature][]Goroutine{}
+	if len(c.FrameworkPrefixes) != 0 {
+		for i := range goroutines {
+			c.markFramework(&goroutines[i].Signature)
+		}
+	}
 	// O(n²). Fix eventually.
 	for _, routine := range goroutines {
+		if ignored(&routine, c.Ignore) {
+			continue
+		}
+		sig := c.frames(&routine.Signature)
 		found := false
 		for key := range out {
 			// When a match is found, this effectively drops the other goroutine ID.
-			if key.Similar(&routine.Signature, similar) {
+			if c.Similar(key, sig) && c.sameLabels(out[key][0].Labels, routine.Labels) {
 				found = true
-				if !key.Equal(&routine.Signature) {
+				if !key.Equal(sig) {
 					// Almost but not quite equal. There's different pointers passed
 					// around but the same values. Zap out the different values.
-					newKey := key.Merge(&routine.Signature)
+					newKey := key.Merge(sig)
 					out[newKey] = append(out[key], routine)
 					delete(out, key)
 				} else {
@@ -549,18 +923,198 @@ func Bucketize(goroutines []Goroutine, similar Similarity) map[*Signature][]Goro
 		}
 		if !found {
 			key := &Signature{}
-			*key = routine.Signature
+			*key = *sig
 			out[key] = []Goroutine{routine}
 		}
 	}
 	return out
 }
 
+// frames returns the signature with only the calls compared per TopFrames
+// or BottomFrames. It returns s itself when there is nothing to cut.
+func (c *Criteria) frames(s *Signature) *Signature {
+	switch {
+	case c.TopFrames > 0:
+		if len(s.Stack.Calls) <= c.TopFrames && s.CreatedBy.Func.Raw == "" {
+			return s
+		}
+		out := *s
+		out.CreatedBy = Call{}
+		if len(s.Stack.Calls) > c.TopFrames {
+			out.Stack = Stack{Calls: s.Stack.Calls[:c.TopFrames], Elided: true}
+			if s.Stack.MiddleElided != 0 && s.Stack.MiddleIndex < c.TopFrames {
+				out.Stack.MiddleElided, out.Stack.MiddleIndex = s.Stack.MiddleElided, s.Stack.MiddleIndex
+			}
+		}
+		return &out
+	case c.BottomFrames > 0:
+		if len(s.Stack.Calls) <= c.BottomFrames || s.Stack.Elided {
+			return s
+		}
+		out := *s
+		start := len(s.Stack.Calls) - c.BottomFrames
+		out.Stack = Stack{Calls: s.Stack.Calls[start:], Elided: s.Stack.Elided}
+		if s.Stack.MiddleElided != 0 && s.Stack.MiddleIndex > start {
+			out.Stack.MiddleElided, out.Stack.MiddleIndex = s.Stack.MiddleElided, s.Stack.MiddleIndex-start
+		}
+		return &out
+	default:
+		return s
+	}
+}
+
+// Buckets returns the goroutines bucketized per the criteria, sorted with
+// SortBuckets and annotated with the Rules.
+func (c *Criteria) Buckets(goroutines []Goroutine) Buckets {
+	buckets := SortBuckets(c.Bucketize(goroutines))
+	c.Rules.Apply(buckets)
+	return buckets
+}
+
+// markFramework sets Call.Framework on the calls of the signature in
+// FrameworkPrefixes.
+func (c *Criteria) markFramework(s *Signature) {
+	mark := func(call *Call) {
+		call.Framework = false
+		for _, p := range c.FrameworkPrefixes {
+			p = strings.TrimRight(p, "/")
+			if hasPathPrefix(call.Func.Raw, p, "/.") || hasPathPrefix(call.SourcePath, p, "/") {
+				call.Framework = true
+				return
+			}
+		}
+	}
+	for i := range s.Stack.Calls {
+		mark(&s.Stack.Calls[i])
+	}
+	mark(&s.CreatedBy)
+}
+
+// sameLabels returns true if both label sets have the same values for the
+// label keys of the criteria.
+func (c *Criteria) sameLabels(l, r map[string]string) bool {
+	for _, k := range c.Labels {
+		lv, lok := l[k]
+		rv, rok := r[k]
+		if lok != rok || lv != rv {
+			return false
+		}
+	}
+	return true
+}
+
+// sleepRange returns the index of the sleep range the duration fits in.
+func (c *Criteria) sleepRange(minutes int) int {
+	for i, b := range c.SleepRanges {
+		if minutes < b {
+			return i
+		}
+	}
+	return len(c.SleepRanges)
+}
+
+// similar returns true if the two calls are similar per the criteria.
+func (c *Call) similar(r *Call, crit *Criteria) bool {
+	if c.Line != r.Line && !crit.AnyLine {
+		return false
+	}
+	if c.Func != r.Func && (!crit.AnyClosure || stripClosure(c.Func.Raw) != stripClosure(r.Func.Raw)) {
+		return false
+	}
+	return c.SourcePath == r.SourcePath && c.Args.Similar(&r.Args, crit.Similarity)
+}
+
+// reClosure matches the number of an anonymous function in a function name:
+// "func1", "func1.2" for a nested one, "gowrap1" and "deferwrap1" for the
+// wrappers of go and defer statements since Go 1.22, and "func·001" before
+// Go 1.5.
+var reClosure = regexp.MustCompile(`(\.func|\.gowrap|\.deferwrap|func·)[0-9]+(?:\.[0-9]+)*`)
+
+// stripClosure returns the function name without the anonymous function
+// numbers.
+func stripClosure(raw string) string {
+	return reClosure.ReplaceAllString(raw, "$1")
+}
+
+// similar returns true if the two stacks are similar per the criteria.
+func (s *Stack) similar(r *Stack, crit *Criteria) bool {
+	// Once cut per TopFrames, whether the stack had more calls doesn't matter.
+	if s.Elided != r.Elided && crit.TopFrames == 0 {
+		return false
+	}
+	if len(s.Calls) != len(r.Calls) || (s.MiddleElided == 0) != (r.MiddleElided == 0) || s.MiddleIndex != r.MiddleIndex {
+		return false
+	}
+	for i := range s.Calls {
+		if !s.Calls[i].similar(&r.Calls[i], crit) {
+			return false
+		}
+	}
+	return true
+}
+
+// similar returns true if the two signatures are similar per the criteria,
+// ignoring Criteria.Locked and Criteria.SleepRanges.
+func (s *Signature) similar(r *Signature, crit *Criteria) bool {
+	if s.State != r.State || s.GCAssist != r.GCAssist || !s.CreatedBy.similar(&r.CreatedBy, crit) {
+		return false
+	}
+	if crit.Similarity == ExactFlags && s.Locked != r.Locked {
+		return false
+	}
+	return s.Stack.similar(&r.Stack, crit)
+}
+
+// Bucketize returns the number of similar goroutines.
+func Bucketize(goroutines []Goroutine, similar Similarity) map[*Signature][]Goroutine {
+	c := Criteria{Similarity: similar}
+	return c.Bucketize(goroutines)
+}
+
+// Annotations is a set of arbitrary key/value pairs attached to a Bucket.
+//
+// They can be set by analyzers, ignore lists or user code and are carried
+// along by every output format so triage state isn't lost.
+type Annotations map[string]string
+
+// String returns the annotations as "key=value" pairs sorted by key. A key
+// with an empty value is printed alone, as a tag.
+//
+// Keys and values containing a separator, a bracket, a quote or spaces are
+// quoted so the output is never ambiguous.
+func (a Annotations) String() string {
+	keys := make([]string, 0, len(a))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if v := a[k]; v != "" {
+			out = append(out, quoteAnnotation(k)+"="+quoteAnnotation(v))
+		} else {
+			out = append(out, quoteAnnotation(k))
+		}
+	}
+	return strings.Join(out, ", ")
+}
+
 // Bucket is a stack trace signature and the list of goroutines that fits this
 // signature.
 type Bucket struct {
 	Signature
-	Routines []Goroutine
+	Routines    []Goroutine
+	Annotations Annotations // Annotations is optional triage data, e.g. "issue=FOO-123".
+}
+
+// Annotate sets the annotation key to value, overwriting any previous value.
+//
+// An empty value is valid and is used as a tag.
+func (b *Bucket) Annotate(key, value string) {
+	if b.Annotations == nil {
+		b.Annotations = Annotations{}
+	}
+	b.Annotations[key] = value
 }
 
 // First returns true if it contains the first goroutine, e.g. the ones that
@@ -574,15 +1128,48 @@ func (b *Bucket) First() bool {
 	return false
 }
 
-// Less does reverse sort.
+// Origins returns the goroutines of the bucket bucketized at the stricter
+// similar level.
+//
+// It recovers the signatures that were folded into the bucket when it was
+// bucketized at a more lenient level, e.g. with AnyValue, as Merge zaps out
+// the arguments that differ.
+func (b *Bucket) Origins(similar Similarity) Buckets {
+	return SortBuckets(Bucketize(b.Routines, similar))
+}
+
+// Less orders buckets so the most interesting ones come up front. It is a
+// total order for buckets of the same dump so sorting is deterministic.
+//
+// The order is:
+//   - the bucket with a Crashed goroutine
+//   - then the bucket with the first goroutine, normally the one that crashed
+//   - then more calls outside the standard library first
+//   - then more goroutines first
+//   - then Signature.Less
+//   - then the lowest goroutine ID first
 func (b *Bucket) Less(r *Bucket) bool {
-	if b.First() {
+	if lCrashed, rCrashed := b.Crashed(), r.Crashed(); lCrashed != rCrashed {
+		return lCrashed
+	}
+	if lFirst, rFirst := b.First(), r.First(); lFirst != rFirst {
+		return lFirst
+	}
+	lPrivate, _ := b.Stack.depths()
+	rPrivate, _ := r.Stack.depths()
+	if lPrivate != rPrivate {
+		return lPrivate > rPrivate
+	}
+	if len(b.Routines) != len(r.Routines) {
+		return len(b.Routines) > len(r.Routines)
+	}
+	if b.Signature.Less(&r.Signature) {
 		return true
 	}
-	if r.First() {
+	if r.Signature.Less(&b.Signature) {
 		return false
 	}
-	return b.Signature.Less(&r.Signature)
+	return b.minID() < r.minID()
 }
 
 // Buckets is a list of Bucket sorted by repeation count.
@@ -604,16 +1191,35 @@ func (b Buckets) Swap(i, j int) {
 func SortBuckets(buckets map[*Signature][]Goroutine) Buckets {
 	out := make(Buckets, 0, len(buckets))
 	for signature, count := range buckets {
-		out = append(out, Bucket{*signature, count})
+		out = append(out, Bucket{Signature: *signature, Routines: count})
 	}
 	sort.Sort(out)
 	return out
 }
 
+// MaxLineSize is the longest line of a dump that is parsed.
+//
+// Longer lines before or between goroutines are passed through to out in
+// pieces. A longer line in a goroutine, e.g. a huge argument list, is an
+// error instead of silently truncating the stack.
+var MaxLineSize = 16 * 1024 * 1024
+
+// newScanner returns a scanner returning the lines of r per scanLines.
+func newScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	size := bufio.MaxScanTokenSize
+	if size > MaxLineSize {
+		size = MaxLineSize
+	}
+	scanner.Buffer(make([]byte, 0, size), MaxLineSize)
+	scanner.Split(scanLines)
+	return scanner
+}
+
 // scanLines is similar to bufio.ScanLines except that it:
 //     - doesn't drop '\n'
-//     - doesn't strip '\r'
-//     - returns when the data is bufio.MaxScanTokenSize bytes
+//     - doesn't strip '\r', see trimCR
+//     - returns when the data is MaxLineSize bytes
 func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
 	if atEOF && len(data) == 0 {
 		return 0, nil, nil
@@ -624,7 +1230,7 @@ func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
 	if atEOF {
 		return len(data), data, nil
 	}
-	if len(data) >= bufio.MaxScanTokenSize {
+	if len(data) >= MaxLineSize {
 		// Returns the line even if it is not at EOF nor has a '\n', otherwise the
 		// scanner will return bufio.ErrTooLong which is definitely not what we
 		// want.
@@ -633,15 +1239,144 @@ func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
 	return 0, nil, nil
 }
 
+// trimCR returns the line with a "\r\n" ending replaced with "\n", so dumps
+// captured on Windows are matched the same.
+func trimCR(line string) string {
+	if strings.HasSuffix(line, "\r\n") {
+		return line[:len(line)-2] + "\n"
+	}
+	return line
+}
+
+// Parser holds the options of the parsers. The zero value is the default used
+// by the package level functions, e.g. ParseSnapshot.
+type Parser struct {
+	// KeepANSI keeps the ANSI escape sequences, e.g. the colors in a dump
+	// copied from a terminal or a CI log, instead of removing them from the
+	// lines before they are parsed. The junk lines are passed through to out
+	// as is either way.
+	KeepANSI bool
+}
+
+// reANSI matches the CSI sequences, e.g. "\x1b[31m", and the OSC sequences,
+// e.g. the hyperlinks "\x1b]8;;url\x1b\\".
+var reANSI = regexp.MustCompile("\x1b(?:\\[[0-?]*[ -/]*[@-~]|\\][^\x07\x1b]*(?:\x07|\x1b\\\\))")
+
+// clean returns the line to parse: "\r\n" is replaced with "\n" and the
+// ANSI escape sequences are removed unless KeepANSI is set.
+func (p *Parser) clean(raw string) string {
+	line := trimCR(raw)
+	if !p.KeepANSI {
+		line = stripANSI(line)
+	}
+	return line
+}
+
+// stripANSI returns the line without its ANSI escape sequences.
+func stripANSI(line string) string {
+	if strings.IndexByte(line, 0x1b) == -1 {
+		return line
+	}
+	return reANSI.ReplaceAllString(line, "")
+}
+
 // ParseDump processes the output from runtime.Stack().
 //
 // It supports piping from another command and assumes there is junk before the
 // actual stack trace. The junk is streamed to out.
+//
+// It is a shorthand for ParseSnapshot when only the goroutines are needed.
 func ParseDump(r io.Reader, out io.Writer) ([]Goroutine, error) {
+	return (&Parser{}).ParseDump(r, out)
+}
+
+// ParseDump is ParseDump with the options of p.
+func (p *Parser) ParseDump(r io.Reader, out io.Writer) ([]Goroutine, error) {
+	return parseDump(r, out, &observer{p: *p})
+}
+
+// ParseStream processes the output from runtime.Stack() like ParseDump but
+// calls fn with each goroutine as soon as it is parsed instead of returning
+// them all, so a dump of any size is processed with bounded memory.
+//
+// Parsing stops at the first error returned by fn, which is returned. The
+// arguments are not named, since it requires the whole dump. On a parse
+// error, the goroutine being parsed is passed to fn before the error is
+// returned.
+func ParseStream(r io.Reader, out io.Writer, fn func(Goroutine) error) error {
+	return (&Parser{}).ParseStream(r, out, fn)
+}
+
+// ParseStream is ParseStream with the options of p.
+func (p *Parser) ParseStream(r io.Reader, out io.Writer, fn func(Goroutine) error) error {
+	return parseStream(r, out, &observer{p: *p}, func(g *Goroutine) error {
+		return fn(*g)
+	})
+}
+
+// parseDump implements ParseDump. Every line is reported to o.
+func parseDump(r io.Reader, out io.Writer, o *observer) ([]Goroutine, error) {
 	goroutines := make([]Goroutine, 0, 16)
+	err := parseStream(r, out, o, func(g *Goroutine) error {
+		goroutines = append(goroutines, *g)
+		return nil
+	})
+	// The goroutines printed before the first runtime frame.
+	for i := range goroutines {
+		markStdlib(&goroutines[i], o.goroot)
+	}
+	nameArguments(goroutines)
+	return goroutines, err
+}
+
+// parseStream implements ParseStream.
+func parseStream(r io.Reader, out io.Writer, o *observer, fn func(g *Goroutine) error) error {
+	r, err := Decompress(r)
+	if err != nil {
+		return err
+	}
 	var goroutine *Goroutine
-	scanner := bufio.NewScanner(r)
-	scanner.Split(scanLines)
+	// n is the number of goroutines found so far.
+	n := 0
+	// created is set after a reCreated line, until its reFile line.
+	created := false
+	// ancestor is the index in Ancestors of the ancestor being parsed, -1 when
+	// parsing the goroutine itself.
+	ancestor := -1
+	// flush passes the goroutine being parsed, if any, to fn.
+	flush := func() error {
+		if goroutine == nil {
+			return nil
+		}
+		g := goroutine
+		goroutine = nil
+		sig := &g.Signature
+		if ancestor >= 0 {
+			sig = &g.Ancestors[ancestor]
+		}
+		if created || sig.truncated() {
+			g.Incomplete = true
+		}
+		created = false
+		if g.Incomplete {
+			o.incomplete = true
+		}
+		g.Crashed = g.crashed()
+		if o.goroot == "" {
+			o.goroot = inferGOROOT(g)
+		}
+		markStdlib(g, o.goroot)
+		return fn(g)
+	}
+	// fail returns a parse error after passing the partial goroutine to fn.
+	fail := func(err error) error {
+		if goroutine != nil {
+			goroutine.Incomplete = true
+		}
+		_ = flush()
+		return err
+	}
+	scanner := newScanner(r)
 	// TODO(maruel): Use a formal state machine. Patterns follows:
 	// - reRoutineHeader
 	//   Either:
@@ -650,15 +1385,62 @@ func ParseDump(r io.Reader, out io.Writer) ([]Goroutine, error) {
 	//     - reElided
 	//   Optionally ends with:
 	//     - reCreated + reFile
+	//   Optionally followed by ancestors, each:
+	//     - reAncestor
+	//     - reFunc + reFile in a loop
+	//     - reCreated + reFile
 	// Between each goroutine stack dump: an empty line
-	created := false
+	// cFunc is a line that may be a C function name, it is confirmed by the
+	// next line.
+	cFunc := ""
+	cFuncRaw := ""
 	// firstLine is the first line after the reRoutineHeader header line.
 	firstLine := false
 	for scanner.Scan() {
-		line := scanner.Text()
+		// raw is the line as read, written to out when it is junk.
+		raw := scanner.Text()
+		line := o.p.clean(raw)
+		o.next(line, goroutine != nil)
+		if goroutine != nil && len(raw) >= MaxLineSize && raw[len(raw)-1] != '\n' {
+			return fail(fmt.Errorf("line longer than %d bytes in goroutine %d; increase MaxLineSize", MaxLineSize, goroutine.ID))
+		}
+		if cFunc != "" {
+			pending, pendingRaw := cFunc, cFuncRaw
+			cFunc, cFuncRaw = "", ""
+			if match := reCFile.FindStringSubmatch(line); match != nil {
+				c := Call{Func: Function{pending[:len(pending)-1]}, Kind: FrameC}
+				c.PC, _ = strconv.ParseUint(match[3], 16, 64)
+				if match[1] != "" {
+					c.SourcePath, c.PathSeparator = normalizePath(match[1])
+					c.Line, _ = strconv.Atoi(match[2])
+				}
+				goroutine.Stack.Calls = append(goroutine.Stack.Calls, c)
+				continue
+			}
+			if match := reFile.FindStringSubmatch(line); match != nil && pending != "non-Go function\n" {
+				// gccgo prints the function without its arguments.
+				c := Call{Func: Function{pending[:len(pending)-1]}}
+				c.SourcePath, c.PathSeparator = normalizePath(match[1])
+				c.Line, _ = strconv.Atoi(match[2])
+				c.Offset, _ = strconv.ParseUint(match[3], 16, 64)
+				goroutine.Stack.Calls = append(goroutine.Stack.Calls, c)
+				o.toolchain = ToolchainGccgo
+				continue
+			}
+			// It was not a C frame, the goroutine ended on the previous line.
+			o.line--
+			o.junk(pending)
+			o.line++
+			_, _ = io.WriteString(out, pendingRaw)
+			if err := flush(); err != nil {
+				return err
+			}
+		}
 		if line == "\n" {
 			if goroutine != nil {
-				goroutine = nil
+				if err := flush(); err != nil {
+					return err
+				}
 				continue
 			}
 		} else if line[len(line)-1] == '\n' {
@@ -667,7 +1449,7 @@ func ParseDump(r io.Reader, out io.Writer) ([]Goroutine, error) {
 					if id, err := strconv.Atoi(match[1]); err == nil {
 						// See runtime/traceback.go.
 						// "<state>, \d+ minutes, locked to thread"
-						items := strings.Split(match[2], ", ")
+						items := strings.Split(match[3], ", ")
 						sleep := 0
 						locked := false
 						for i := 1; i < len(items); i++ {
@@ -680,7 +1462,7 @@ func ParseDump(r io.Reader, out io.Writer) ([]Goroutine, error) {
 								sleep, _ = strconv.Atoi(match2[1])
 							}
 						}
-						goroutines = append(goroutines, Goroutine{
+						goroutine = &Goroutine{
 							Signature: Signature{
 								State:    items[0],
 								SleepMin: sleep,
@@ -688,14 +1470,40 @@ func ParseDump(r io.Reader, out io.Writer) ([]Goroutine, error) {
 								Locked:   locked,
 							},
 							ID:    id,
-							First: len(goroutines) == 0,
-						})
-						goroutine = &goroutines[len(goroutines)-1]
+							First: n == 0,
+						}
+						n++
+						ancestor = -1
+						if m, err := strconv.Atoi(match[2]); err == nil {
+							goroutine.M = &m
+						}
+						if match[4] != "" {
+							goroutine.Labels = parseLabels(match[4])
+						}
+						o.goroutine()
 						firstLine = true
 						continue
 					}
 				}
 			} else {
+				if match := reAncestor.FindStringSubmatch(line); match != nil && !created {
+					// The ancestor is the creator of the previous signature, which
+					// only has its ID since Go 1.21.
+					prev := &goroutine.Signature
+					if ancestor >= 0 {
+						prev = &goroutine.Ancestors[ancestor]
+					}
+					if prev.CreatedByID == 0 {
+						prev.CreatedByID, _ = strconv.Atoi(match[1])
+					}
+					goroutine.Ancestors = append(goroutine.Ancestors, Signature{})
+					ancestor = len(goroutine.Ancestors) - 1
+					continue
+				}
+				sig := &goroutine.Signature
+				if ancestor >= 0 {
+					sig = &goroutine.Ancestors[ancestor]
+				}
 				if firstLine {
 					firstLine = false
 					if match := reUnavail.FindStringSubmatch(line); match != nil {
@@ -709,65 +1517,339 @@ func ParseDump(r io.Reader, out io.Writer) ([]Goroutine, error) {
 					// Triggers after a reFunc or a reCreated.
 					num, err := strconv.Atoi(match[2])
 					if err != nil {
-						return goroutines, fmt.Errorf("failed to parse int on line: \"%s\"", line)
+						return fail(fmt.Errorf("failed to parse int on line: \"%s\"", line))
 					}
+					var offset uint64
+					if match[3] != "" {
+						if offset, err = strconv.ParseUint(match[3], 16, 64); err != nil {
+							return fail(fmt.Errorf("failed to parse int on line: \"%s\"", line))
+						}
+					}
+					src, sep := normalizePath(match[1])
 					if created {
 						created = false
-						goroutine.CreatedBy.SourcePath = match[1]
-						goroutine.CreatedBy.Line = num
+						sig.CreatedBy.SourcePath = src
+						sig.CreatedBy.PathSeparator = sep
+						sig.CreatedBy.Line = num
+						sig.CreatedBy.Offset = offset
 					} else {
-						i := len(goroutine.Stack.Calls) - 1
+						i := len(sig.Stack.Calls) - 1
 						if i < 0 {
-							return goroutines, errors.New("unexpected order")
+							return fail(errors.New("unexpected order"))
+						}
+						c := &sig.Stack.Calls[i]
+						c.SourcePath = src
+						c.PathSeparator = sep
+						c.Line = num
+						c.Offset = offset
+						if match[4] != "" {
+							c.FP, _ = strconv.ParseUint(match[4], 16, 64)
+							c.SP, _ = strconv.ParseUint(match[5], 16, 64)
+						}
+						if match[6] != "" {
+							c.PC, _ = strconv.ParseUint(match[6], 16, 64)
+						}
+						if strings.HasSuffix(match[1], ".c") {
+							c.Kind = FrameC
+						} else if strings.HasSuffix(match[1], ".s") {
+							c.Kind = FrameAsm
 						}
-						goroutine.Stack.Calls[i].SourcePath = match[1]
-						goroutine.Stack.Calls[i].Line = num
 					}
 					continue
 				}
 
 				if match := reCreated.FindStringSubmatch(line); match != nil {
 					created = true
-					goroutine.CreatedBy.Func.Raw = match[1]
+					sig.CreatedBy.Func.Raw = match[1]
+					if match[2] != "" {
+						sig.CreatedByID, _ = strconv.Atoi(match[2])
+					}
 					continue
 				}
 
 				if match := reFunc.FindStringSubmatch(line); match != nil {
-					args := Args{}
-					for _, a := range strings.Split(match[2], ", ") {
-						if a == "..." {
-							args.Elided = true
-							continue
-						}
-						if a == "" {
-							// Remaining values were dropped.
-							break
-						}
-						v, err := strconv.ParseUint(a, 0, 64)
-						if err != nil {
-							return goroutines, fmt.Errorf("failed to parse int on line: \"%s\"", line)
-						}
-						args.Values = append(args.Values, Arg{Value: v})
+					args, err := parseArgs(match[2])
+					if err != nil {
+						o.warn(fmt.Sprintf("failed to parse arguments %q: %s", match[2], err))
+						args = Args{Values: []Arg{{Raw: match[2]}}}
+					} else if args.opaque() {
+						o.warn(fmt.Sprintf("failed to parse values in arguments %q", match[2]))
 					}
-					goroutine.Stack.Calls = append(goroutine.Stack.Calls, Call{Func: Function{match[1]}, Args: args})
+					sig.Stack.Calls = append(sig.Stack.Calls, Call{Func: Function{match[1]}, Args: args})
 					continue
 				}
 
 				if match := reElided.FindStringSubmatch(line); match != nil {
-					goroutine.Stack.Elided = true
+					if match[1] == "additional" {
+						sig.Stack.Elided = true
+					} else {
+						// Go 1.21+ elides the middle of the stack.
+						sig.Stack.MiddleElided, _ = strconv.Atoi(match[1])
+						sig.Stack.MiddleIndex = len(sig.Stack.Calls)
+					}
+					continue
+				}
+
+				if !created && ancestor < 0 && reCFunc.MatchString(line) {
+					cFunc, cFuncRaw = line, raw
 					continue
 				}
 			}
 		}
-		_, _ = io.WriteString(out, line)
-		goroutine = nil
+		if goroutine != nil && line[len(line)-1] != '\n' {
+			// The dump was cut in the middle of a line.
+			goroutine.Incomplete = true
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+		o.junk(line)
+		_, _ = io.WriteString(out, raw)
 	}
-	nameArguments(goroutines)
-	return goroutines, scanner.Err()
+	if err := flush(); err != nil {
+		return err
+	}
+	if cFunc != "" {
+		o.junk(cFunc)
+		_, _ = io.WriteString(out, cFuncRaw)
+	}
+	return scanner.Err()
 }
 
 // Private stuff.
 
+// hasPathPrefix returns true if s starts with prefix followed by one of seps.
+func hasPathPrefix(s, prefix, seps string) bool {
+	return prefix != "" && len(s) > len(prefix) && strings.HasPrefix(s, prefix) && strings.IndexByte(seps, s[len(prefix)]) != -1
+}
+
+// inferGOROOT returns the GOROOT of the machine that built the executable from
+// the source path of a runtime frame of the goroutine. It returns "" if it has
+// none.
+func inferGOROOT(g *Goroutine) string {
+	for _, c := range g.Stack.Calls {
+		if strings.HasPrefix(c.Func.Raw, "runtime.") {
+			if j := strings.LastIndex(c.SourcePath, "/src/runtime/"); j > 0 {
+				return c.SourcePath[:j]
+			}
+			// gccgo's standard library is in libgo.
+			if j := strings.LastIndex(c.SourcePath, "/libgo/go/runtime/"); j > 0 {
+				return c.SourcePath[:j+len("/libgo/go")]
+			}
+		}
+	}
+	return ""
+}
+
+// markStdlib sets Call.Stdlib on the calls of the goroutine in goroot.
+// It does nothing when goroot is one of the well known ones, which IsStdlib
+// already considers.
+func markStdlib(g *Goroutine, goroot string) {
+	if goroot == "" {
+		return
+	}
+	for _, r := range goroots {
+		if r == goroot {
+			return
+		}
+	}
+	// The trailing '/' prevents matching a sibling directory, e.g. "/go"
+	// versus "/gopath".
+	goroot += "/"
+	mark := func(sig *Signature) {
+		for i := range sig.Stack.Calls {
+			c := &sig.Stack.Calls[i]
+			c.Stdlib = strings.HasPrefix(c.SourcePath, goroot)
+		}
+		sig.CreatedBy.Stdlib = strings.HasPrefix(sig.CreatedBy.SourcePath, goroot)
+	}
+	mark(&g.Signature)
+	for i := range g.Ancestors {
+		mark(&g.Ancestors[i])
+	}
+}
+
+// truncated returns true if the stack has no call or its last call has no
+// source line, which means the dump was cut.
+func (s *Signature) truncated() bool {
+	if len(s.Stack.Calls) == 0 {
+		return true
+	}
+	c := &s.Stack.Calls[len(s.Stack.Calls)-1]
+	return c.SourcePath == "" && c.Kind != FrameC
+}
+
+// normalizePath returns the path with '/' as the separator and the separator
+// it used, 0 if it was already '/'.
+func normalizePath(p string) (string, byte) {
+	if !strings.Contains(p, "\\") {
+		return p, 0
+	}
+	return strings.Replace(p, "\\", "/", -1), '\\'
+}
+
+// parseArgs parses the arguments of a call.
+//
+// Before Go 1.17, they are the raw words on the stack, e.g. "0x4b9d1c, 0x3".
+// Since Go 1.17, each parameter is printed with its words between braces when
+// it is an aggregate, '?' after values that may be inaccurate and '_' for
+// values too far in the frame, e.g. "{0x4b9d1c?, 0x3}, 0x1?, _". "..." means
+// the remaining arguments or fields were not printed.
+func parseArgs(s string) (Args, error) {
+	args, rest, err := parseArgList(s, 0)
+	if err == nil && rest != "" {
+		err = errors.New("unexpected '}'")
+	}
+	return args, err
+}
+
+// parseArgList parses arguments up to the end of s or an unmatched '}' and
+// returns the remainder.
+func parseArgList(s string, depth int) (Args, string, error) {
+	out := Args{}
+	for s != "" && s[0] != '}' {
+		switch {
+		case strings.HasPrefix(s, "..."):
+			out.Elided = true
+			s = s[3:]
+		case s[0] == '{':
+			if depth == maxArgDepth {
+				return out, s, errors.New("too deep")
+			}
+			fields, rest, err := parseArgList(s[1:], depth+1)
+			if err != nil {
+				return out, rest, err
+			}
+			if rest == "" {
+				return out, rest, errors.New("missing '}'")
+			}
+			out.Values = append(out.Values, Arg{IsAggregate: true, Fields: fields})
+			s = rest[1:]
+		case s[0] == '_':
+			out.Values = append(out.Values, Arg{IsOffsetTooLarge: true})
+			s = s[1:]
+		default:
+			i := strings.IndexAny(s, ",}")
+			if i == -1 {
+				i = len(s)
+			}
+			a := Arg{}
+			token := s[:i]
+			if strings.HasSuffix(token, "?") {
+				a.IsInaccurate = true
+				token = token[:len(token)-1]
+			}
+			if v, err := strconv.ParseUint(token, 0, 64); err == nil {
+				a.Value = v
+			} else {
+				// Keep the token as is instead of losing the whole dump.
+				a = Arg{Raw: s[:i]}
+			}
+			out.Values = append(out.Values, a)
+			s = s[i:]
+		}
+		if strings.HasPrefix(s, ", ") {
+			s = s[2:]
+		} else if s != "" && s[0] != '}' {
+			return out, s, errors.New("expected ', '")
+		}
+	}
+	return out, s, nil
+}
+
+// maxArgDepth is the maximum nesting of aggregates. The runtime stops at 5 but
+// a copy-pasted dump may be mangled.
+const maxArgDepth = 10
+
+// split returns the package name and the function name. The '/' and '.' in
+// type arguments, e.g. "main.F[example.com/pkg.T]", are ignored. name is empty
+// if there is no package.
+func (f Function) split() (string, string) {
+	depth := 0
+	start := 0
+	for i := 0; i < len(f.Raw); i++ {
+		switch f.Raw[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case '/':
+			if depth == 0 {
+				start = i + 1
+			}
+		}
+	}
+	depth = 0
+	for i := start; i < len(f.Raw); i++ {
+		switch f.Raw[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case '.':
+			if depth == 0 {
+				return f.Raw[start:i], f.Raw[i+1:]
+			}
+		}
+	}
+	return f.Raw[start:], ""
+}
+
+// stripTypeArgs removes the type arguments between brackets.
+func stripTypeArgs(s string) string {
+	if strings.IndexByte(s, '[') == -1 {
+		return s
+	}
+	out := make([]byte, 0, len(s))
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		default:
+			if depth == 0 {
+				out = append(out, s[i])
+			}
+		}
+	}
+	return string(out)
+}
+
+// hasSource returns true if the call is outside the standard library and has
+// a known source file.
+func (c *Call) hasSource() bool {
+	return c.Line > 0 && c.SourcePath != "??" && c.SourcePath != "<autogenerated>" && c.SourcePath != "<unavailable>" && !c.IsStdlib()
+}
+
+// minID returns the lowest goroutine ID in the bucket, -1 if empty.
+func (b *Bucket) minID() int {
+	out := -1
+	for i, r := range b.Routines {
+		if i == 0 || r.ID < out {
+			out = r.ID
+		}
+	}
+	return out
+}
+
+// sameOr0 returns l if both values are the same, 0 otherwise.
+func sameOr0(l, r uint64) uint64 {
+	if l != r {
+		return 0
+	}
+	return l
+}
+
+// quoteAnnotation quotes s if it would make Annotations.String() ambiguous.
+func quoteAnnotation(s string) string {
+	if s == "" || strings.ContainsAny(s, ",=[]\"' \t\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
 func nameArguments(goroutines []Goroutine) {
 	// Set a name for any pointer occuring more than once.
 	type object struct {
@@ -776,19 +1858,25 @@ func nameArguments(goroutines []Goroutine) {
 		id        int
 	}
 	objects := map[uint64]object{}
-	// Enumerate all the arguments.
-	for i := range goroutines {
-		for j := range goroutines[i].Stack.Calls {
-			for k := range goroutines[i].Stack.Calls[j].Args.Values {
-				arg := goroutines[i].Stack.Calls[j].Args.Values[k]
-				if arg.IsPtr() {
-					objects[arg.Value] = object{
-						args:      append(objects[arg.Value].args, &goroutines[i].Stack.Calls[j].Args.Values[k]),
-						inPrimary: objects[arg.Value].inPrimary || i == 0,
-					}
+	// Enumerate all the arguments, including the fields of aggregates.
+	var walk func(args *Args, primary bool)
+	walk = func(args *Args, primary bool) {
+		for k := range args.Values {
+			arg := &args.Values[k]
+			if arg.IsAggregate {
+				walk(&arg.Fields, primary)
+			} else if arg.IsPtr() {
+				objects[arg.Value] = object{
+					args:      append(objects[arg.Value].args, arg),
+					inPrimary: objects[arg.Value].inPrimary || primary,
 				}
 			}
 		}
+	}
+	for i := range goroutines {
+		for j := range goroutines[i].Stack.Calls {
+			walk(&goroutines[i].Stack.Calls[j].Args, i == 0)
+		}
 		// CreatedBy.Args is never set.
 	}
 	order := uint64Slice{}
@@ -10,7 +10,7 @@ import (
 	"errors"
 	"io"
 	"os"
-	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
 
@@ -89,23 +89,27 @@ func TestParseDump1(t *testing.T) {
 					Calls: []Call{
 						{
 							SourcePath: "??",
+							Offset:     0x6d,
 							Func:       Function{"github.com/cockroachdb/cockroach/storage/engine._Cfunc_DBIterSeek"},
 						},
 						{
 							SourcePath: "/gopath/src/gopkg.in/yaml.v2/yaml.go",
 							Line:       153,
+							Offset:     0xc6,
 							Func:       Function{"gopkg.in/yaml%2ev2.handleErr"},
 							Args:       Args{Values: []Arg{{Value: 0xc208033b20}}},
 						},
 						{
 							SourcePath: goroot + "/src/reflect/value.go",
 							Line:       2125,
+							Offset:     0x368,
 							Func:       Function{"reflect.Value.assignTo"},
 							Args:       Args{Values: []Arg{{Value: 0x570860}, {Value: 0xc20803f3e0}, {Value: 0x15}}},
 						},
 						{
 							SourcePath: "/gopath/src/github.com/foo/bar/baz.go",
 							Line:       428,
+							Offset:     0x27,
 							Func:       Function{"main.main"},
 						},
 					},
@@ -151,6 +155,7 @@ func TestParseDumpLongWait(t *testing.T) {
 						{
 							SourcePath: "/gopath/src/gopkg.in/yaml.v2/yaml.go",
 							Line:       153,
+							Offset:     0xc6,
 							Func:       Function{"gopkg.in/yaml%2ev2.handleErr"},
 							Args:       Args{Values: []Arg{{Value: 0xc208033b20}}},
 						},
@@ -169,6 +174,7 @@ func TestParseDumpLongWait(t *testing.T) {
 						{
 							SourcePath: "/gopath/src/gopkg.in/yaml.v2/yaml.go",
 							Line:       153,
+							Offset:     0xc6,
 							Func:       Function{"gopkg.in/yaml%2ev2.handleErr"},
 							Args:       Args{Values: []Arg{{Value: 0xc208033b21, Name: "#1"}}},
 						},
@@ -187,6 +193,7 @@ func TestParseDumpLongWait(t *testing.T) {
 						{
 							SourcePath: "/gopath/src/gopkg.in/yaml.v2/yaml.go",
 							Line:       153,
+							Offset:     0xc6,
 							Func:       Function{"gopkg.in/yaml%2ev2.handleErr"},
 							Args:       Args{Values: []Arg{{Value: 0xc208033b22, Name: "#2"}}},
 						},
@@ -200,6 +207,95 @@ func TestParseDumpLongWait(t *testing.T) {
 	ut.AssertEqual(t, expected, goroutines)
 }
 
+func TestParseDumpThread(t *testing.T) {
+	data := []string{
+		"panic: bleh",
+		"",
+		"goroutine 1 gp=0xc000002380 m=0 mp=0x5a1d40 [running, locked to thread]:",
+		"main.main()",
+		"	/gopath/src/github.com/foo/bar/baz.go:74 +0x1d",
+		"",
+		"goroutine 2 gp=0xc000002e00 m=nil [force gc (idle)]:",
+		"runtime.gopark()",
+		"	/goroot/src/runtime/proc.go:435 +0xce",
+		"",
+	}
+	goroutines, err := ParseDump(bytes.NewBufferString(strings.Join(data, "\n")), &bytes.Buffer{})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 2, len(goroutines))
+	ut.AssertEqual(t, "running", goroutines[0].State)
+	ut.AssertEqual(t, true, goroutines[0].Locked)
+	ut.AssertEqual(t, 0, *goroutines[0].M)
+	ut.AssertEqual(t, "force gc (idle)", goroutines[1].State)
+	ut.AssertEqual(t, (*int)(nil), goroutines[1].M)
+}
+
+func TestParseDumpCgo(t *testing.T) {
+	data := []string{
+		"SIGSEGV: segmentation violation",
+		"PC=0x4a1b2c m=0 sigcode=1",
+		"signal arrived during cgo execution",
+		"",
+		"goroutine 1 [syscall]:",
+		"crash",
+		"	/gopath/src/github.com/foo/bar/crash.c:5 pc=0x4a1b2c",
+		"non-Go function",
+		"	pc=0x4a1b50",
+		"runtime.cgocall(0x4a1b00, 0xc000053f58)",
+		"	/goroot/src/runtime/cgocall.go:157 +0x4b fp=0xc000053f30 sp=0xc000053ef8 pc=0x40440b",
+		"main._Cfunc_crash()",
+		"	_cgo_gotypes.go:39 +0x45",
+		"main.main()",
+		"	/gopath/src/github.com/foo/bar/main.go:12 +0x17",
+		"FAIL",
+		"",
+	}
+	extra := &bytes.Buffer{}
+	goroutines, err := ParseDump(bytes.NewBufferString(strings.Join(data, "\n")), extra)
+	ut.AssertEqual(t, nil, err)
+	expected := []Call{
+		{
+			SourcePath: "/gopath/src/github.com/foo/bar/crash.c",
+			Line:       5,
+			Func:       Function{"crash"},
+			Kind:       FrameC,
+			PC:         0x4a1b2c,
+		},
+		{
+			Func: Function{"non-Go function"},
+			Kind: FrameC,
+			PC:   0x4a1b50,
+		},
+		{
+			SourcePath: "/goroot/src/runtime/cgocall.go",
+			Line:       157,
+			Offset:     0x4b,
+			Func:       Function{"runtime.cgocall"},
+			Args:       Args{Values: []Arg{{Value: 0x4a1b00}, {Value: 0xc000053f58}}},
+			FP:         0xc000053f30,
+			SP:         0xc000053ef8,
+			PC:         0x40440b,
+			Stdlib:     true,
+		},
+		{
+			SourcePath: "_cgo_gotypes.go",
+			Line:       39,
+			Offset:     0x45,
+			Func:       Function{"main._Cfunc_crash"},
+		},
+		{
+			SourcePath: "/gopath/src/github.com/foo/bar/main.go",
+			Line:       12,
+			Offset:     0x17,
+			Func:       Function{"main.main"},
+		},
+	}
+	ut.AssertEqual(t, 1, len(goroutines))
+	ut.AssertEqual(t, expected, goroutines[0].Stack.Calls)
+	// A word following the stack is not mistaken for a C function.
+	ut.AssertEqual(t, "SIGSEGV: segmentation violation\nPC=0x4a1b2c m=0 sigcode=1\nsignal arrived during cgo execution\n\nFAIL\n", extra.String())
+}
+
 func TestParseDumpAsm(t *testing.T) {
 	data := []string{
 		"panic: reflect.Set: value of type",
@@ -222,6 +318,9 @@ func TestParseDumpAsm(t *testing.T) {
 							SourcePath: goroot + "/src/runtime/asm_amd64.s",
 							Line:       198,
 							Func:       Function{Raw: "runtime.switchtoM"},
+							Kind:       FrameAsm,
+							FP:         0xc20cfb80d8,
+							SP:         0xc20cfb80d0,
 						},
 					},
 				},
@@ -252,8 +351,9 @@ func TestParseDumpLineErr(t *testing.T) {
 				State: "running",
 				Stack: Stack{Calls: []Call{{Func: Function{Raw: "github.com/foo/bar.recurseType"}}}},
 			},
-			ID:    1,
-			First: true,
+			ID:         1,
+			First:      true,
+			Incomplete: true,
 		},
 	}
 
@@ -265,22 +365,48 @@ func TestParseDumpValueErr(t *testing.T) {
 		"panic: reflect.Set: value of type",
 		"",
 		"goroutine 1 [running]:",
-		"github.com/foo/bar.recurseType(123456789012345678901)",
+		"github.com/foo/bar.recurseType(123456789012345678901, 0x1)",
 		"\t/gopath/src/github.com/foo/bar/baz.go:9",
+		"github.com/foo/bar.main({0x1, 0x2)",
+		"\t/gopath/src/github.com/foo/bar/baz.go:12",
 		"",
 	}
 	extra := &bytes.Buffer{}
-	goroutines, err := ParseDump(bytes.NewBufferString(strings.Join(data, "\n")), extra)
-	ut.AssertEqual(t, errors.New("failed to parse int on line: \"github.com/foo/bar.recurseType(123456789012345678901)\n\""), err)
+	s, err := ParseSnapshot(bytes.NewBufferString(strings.Join(data, "\n")), extra)
+	ut.AssertEqual(t, nil, err)
+	// The values that can't be parsed are kept as is.
 	expected := []Goroutine{
 		{
-			Signature: Signature{State: "running"},
-			ID:        1,
-			First:     true,
+			Signature: Signature{
+				State: "running",
+				Stack: Stack{
+					Calls: []Call{
+						{
+							SourcePath: "/gopath/src/github.com/foo/bar/baz.go",
+							Line:       9,
+							Func:       Function{Raw: "github.com/foo/bar.recurseType"},
+							Args:       Args{Values: []Arg{{Raw: "123456789012345678901"}, {Value: 1}}},
+						},
+						{
+							SourcePath: "/gopath/src/github.com/foo/bar/baz.go",
+							Line:       12,
+							Func:       Function{Raw: "github.com/foo/bar.main"},
+							Args:       Args{Values: []Arg{{Raw: "{0x1, 0x2"}}},
+						},
+					},
+				},
+			},
+			ID:    1,
+			First: true,
 		},
 	}
-
-	ut.AssertEqual(t, expected, goroutines)
+	ut.AssertEqual(t, expected, s.Goroutines)
+	ut.AssertEqual(t, "123456789012345678901, 0x1", s.Goroutines[0].Stack.Calls[0].Args.String())
+	expectedWarnings := []string{
+		"line 4: failed to parse values in arguments \"123456789012345678901, 0x1\"",
+		"line 6: failed to parse arguments \"{0x1, 0x2\": missing '}'",
+	}
+	ut.AssertEqual(t, expectedWarnings, s.Warnings)
 }
 
 func TestParseDumpOrderErr(t *testing.T) {
@@ -298,15 +424,233 @@ func TestParseDumpOrderErr(t *testing.T) {
 	ut.AssertEqual(t, errors.New("unexpected order"), err)
 	expected := []Goroutine{
 		{
-			Signature: Signature{State: "garbage collection"},
-			ID:        16,
-			First:     true,
+			Signature:  Signature{State: "garbage collection"},
+			ID:         16,
+			First:      true,
+			Incomplete: true,
 		},
 	}
 	ut.AssertEqual(t, expected, goroutines)
 	ut.AssertEqual(t, "panic: reflect.Set: value of type\n\n", extra.String())
 }
 
+func TestParseDumpGo117(t *testing.T) {
+	data := []string{
+		"panic: ooh",
+		"",
+		"goroutine 1 [running]:",
+		"panic({0x5195b0?, 0x485f50?})",
+		"\t/goroot/src/runtime/panic.go:1147 +0x3a8",
+		"main.f5(0x0, 0x1?, _, {0x0, ...}, ...)",
+		"\t/gopath/src/github.com/foo/bar/main.go:27 +0x4c",
+		"main.f9({{0xc000012345, 0x5}, {}}, {0x2, {0x3, {...}}})",
+		"\t/gopath/src/github.com/foo/bar/main.go:43 +0x32",
+		"",
+	}
+	extra := &bytes.Buffer{}
+	goroutines, err := ParseDump(bytes.NewBufferString(strings.Join(data, "\n")), extra)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "panic: ooh\n\n", extra.String())
+	ut.AssertEqual(t, 1, len(goroutines))
+	calls := goroutines[0].Stack.Calls
+	ut.AssertEqual(t, 3, len(calls))
+	expected := []Args{
+		{
+			Values: []Arg{
+				{IsAggregate: true, Fields: Args{Values: []Arg{{Value: 0x5195b0, IsInaccurate: true}, {Value: 0x485f50, IsInaccurate: true}}}},
+			},
+		},
+		{
+			Values: []Arg{
+				{},
+				{Value: 1, IsInaccurate: true},
+				{IsOffsetTooLarge: true},
+				{IsAggregate: true, Fields: Args{Values: []Arg{{}}, Elided: true}},
+			},
+			Elided: true,
+		},
+		{
+			Values: []Arg{
+				{
+					IsAggregate: true,
+					Fields: Args{
+						Values: []Arg{
+							{IsAggregate: true, Fields: Args{Values: []Arg{{Value: 0xc000012345}, {Value: 5}}}},
+							{IsAggregate: true},
+						},
+					},
+				},
+				{
+					IsAggregate: true,
+					Fields: Args{
+						Values: []Arg{
+							{Value: 2},
+							{IsAggregate: true, Fields: Args{Values: []Arg{{Value: 3}, {IsAggregate: true, Fields: Args{Elided: true}}}}},
+						},
+					},
+				},
+			},
+		},
+	}
+	for i := range expected {
+		ut.AssertEqualIndex(t, i, expected[i], calls[i].Args)
+	}
+	ut.AssertEqual(t, "{0x5195b0?, 0x485f50?}", calls[0].Args.String())
+	ut.AssertEqual(t, "0, 0x1?, _, {0, ...}, ...", calls[1].Args.String())
+	ut.AssertEqual(t, "{{0xc000012345, 0x5}, {}}, {0x2, {0x3, {...}}}", calls[2].Args.String())
+}
+
+func TestParseDumpGeneric(t *testing.T) {
+	data := []string{
+		"goroutine 1 [running]:",
+		"main.Map[...]({0xc000012345, 0x3, 0x3}, 0x4b8e28)",
+		"\t/gopath/src/github.com/foo/bar/main.go:12 +0x2a",
+		"github.com/foo/bar/list.(*List[...]).Push(0xc000010018, {0x1})",
+		"\t/gopath/src/github.com/foo/bar/list/list.go:20 +0x35",
+		"",
+	}
+	goroutines, err := ParseDump(bytes.NewBufferString(strings.Join(data, "\n")), &bytes.Buffer{})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 1, len(goroutines))
+	calls := goroutines[0].Stack.Calls
+	ut.AssertEqual(t, 2, len(calls))
+	ut.AssertEqual(t, "main.Map", calls[0].Func.BaseName())
+	ut.AssertEqual(t, "...", calls[0].Func.TypeArgs())
+	ut.AssertEqual(t, "list.(*List[...]).Push", calls[1].Func.PkgDotName())
+	ut.AssertEqual(t, "list", calls[1].Func.PkgName())
+	ut.AssertEqual(t, true, calls[1].Func.IsExported())
+}
+
+func TestParseStream(t *testing.T) {
+	data := []string{
+		"panic: ooh",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"\t/gopath/src/github.com/foo/bar/main.go:12 +0x17",
+		"",
+		"goroutine 2 [chan receive]:",
+		"main.worker(0xc000012345)",
+		"\t/gopath/src/github.com/foo/bar/main.go:20 +0x2a",
+		"created by main.main",
+		"\t/gopath/src/github.com/foo/bar/main.go:11 +0x3b",
+		"",
+	}
+	extra := &bytes.Buffer{}
+	ids := []int{}
+	err := ParseStream(bytes.NewBufferString(strings.Join(data, "\n")), extra, func(g Goroutine) error {
+		ids = append(ids, g.ID)
+		ut.AssertEqual(t, g.ID == 1, g.First)
+		ut.AssertEqual(t, 1, len(g.Stack.Calls))
+		return nil
+	})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, []int{1, 2}, ids)
+	ut.AssertEqual(t, "panic: ooh\n\n", extra.String())
+
+	// An error returned by the callback stops the parsing.
+	stop := errors.New("stop")
+	ids = nil
+	err = ParseStream(bytes.NewBufferString(strings.Join(data, "\n")), &bytes.Buffer{}, func(g Goroutine) error {
+		ids = append(ids, g.ID)
+		return stop
+	})
+	ut.AssertEqual(t, stop, err)
+	ut.AssertEqual(t, []int{1}, ids)
+}
+
+func TestParseArgsErr(t *testing.T) {
+	for _, s := range []string{"{0x1", "0x1}", "0x1,0x2", "{{{{{{{{{{{0x1}}}}}}}}}}}"} {
+		_, err := parseArgs(s)
+		ut.AssertEqual(t, true, err != nil)
+	}
+	// A value that is not a number is kept as is.
+	args, err := parseArgs("foo, 0x1?")
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, Args{Values: []Arg{{Raw: "foo"}, {Value: 1, IsInaccurate: true}}}, args)
+}
+
+func TestArgsSimilarAggregate(t *testing.T) {
+	l := Args{Values: []Arg{{IsAggregate: true, Fields: Args{Values: []Arg{{Value: 0xc000012345}, {Value: 5}}}}}}
+	r := Args{Values: []Arg{{IsAggregate: true, Fields: Args{Values: []Arg{{Value: 0xc000054321}, {Value: 5}}}}}}
+	ut.AssertEqual(t, false, l.Equal(&r))
+	ut.AssertEqual(t, true, l.Similar(&r, AnyPointer))
+	ut.AssertEqual(t, false, l.Similar(&r, ExactLines))
+	ut.AssertEqual(t, "{*, 0x5}", l.Merge(&r).String())
+	r.Values[0].Fields.Values[1].Value = 6
+	ut.AssertEqual(t, false, l.Similar(&r, AnyPointer))
+	ut.AssertEqual(t, true, l.Similar(&r, AnyValue))
+}
+
+func TestParseDumpAncestors(t *testing.T) {
+	data := []string{
+		"goroutine 19 [chan receive]:",
+		"main.worker()",
+		"\t/gopath/src/github.com/foo/bar/baz.go:10 +0x27",
+		"created by main.start",
+		"\t/gopath/src/github.com/foo/bar/baz.go:20 +0x35",
+		"[originating from goroutine 18]:",
+		"main.start(...)",
+		"\t/gopath/src/github.com/foo/bar/baz.go:20 +0x35",
+		"created by main.main",
+		"\t/gopath/src/github.com/foo/bar/baz.go:30 +0x12",
+		"[originating from goroutine 1]:",
+		"main.main(...)",
+		"\t/gopath/src/github.com/foo/bar/baz.go:30 +0x12",
+		"",
+		"goroutine 1 [select]:",
+		"main.main()",
+		"\t/gopath/src/github.com/foo/bar/baz.go:32 +0x40",
+		"",
+	}
+	extra := &bytes.Buffer{}
+	goroutines, err := ParseDump(bytes.NewBufferString(strings.Join(data, "\n")), extra)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "", extra.String())
+	ut.AssertEqual(t, 2, len(goroutines))
+	g := goroutines[0]
+	ut.AssertEqual(t, 1, len(g.Stack.Calls))
+	ut.AssertEqual(t, "main.start", g.CreatedBy.Func.Raw)
+	ut.AssertEqual(t, 18, g.CreatedByID)
+	expected := []Signature{
+		{
+			Stack: Stack{
+				Calls: []Call{
+					{
+						SourcePath: "/gopath/src/github.com/foo/bar/baz.go",
+						Line:       20,
+						Offset:     0x35,
+						Func:       Function{"main.start"},
+						Args:       Args{Elided: true},
+					},
+				},
+			},
+			CreatedBy: Call{
+				SourcePath: "/gopath/src/github.com/foo/bar/baz.go",
+				Line:       30,
+				Offset:     0x12,
+				Func:       Function{"main.main"},
+			},
+			CreatedByID: 1,
+		},
+		{
+			Stack: Stack{
+				Calls: []Call{
+					{
+						SourcePath: "/gopath/src/github.com/foo/bar/baz.go",
+						Line:       30,
+						Offset:     0x12,
+						Func:       Function{"main.main"},
+						Args:       Args{Elided: true},
+					},
+				},
+			},
+		},
+	}
+	ut.AssertEqual(t, expected, g.Ancestors)
+	ut.AssertEqual(t, 0, len(goroutines[1].Ancestors))
+}
+
 func TestParseDumpElided(t *testing.T) {
 	data := []string{
 		"panic: reflect.Set: value of type",
@@ -331,6 +675,7 @@ func TestParseDumpElided(t *testing.T) {
 						{
 							SourcePath: "/gopath/src/github.com/foo/bar/baz.go",
 							Line:       53,
+							Offset:     0x845,
 							Func:       Function{Raw: "github.com/foo/bar.recurseType"},
 							Args: Args{
 								Values: []Arg{
@@ -341,6 +686,8 @@ func TestParseDumpElided(t *testing.T) {
 									{Value: 0xc20803a8a0},
 								},
 							},
+							FP: 0xc20cfc66d8,
+							SP: 0xc20cfc6470,
 						},
 					},
 					Elided: true,
@@ -348,6 +695,7 @@ func TestParseDumpElided(t *testing.T) {
 				CreatedBy: Call{
 					SourcePath: goroot + "/src/testing/testing.go",
 					Line:       555,
+					Offset:     0xa8b,
 					Func:       Function{Raw: "testing.RunTests"},
 				},
 			},
@@ -388,6 +736,7 @@ func TestParseDumpSysCall(t *testing.T) {
 						{
 							SourcePath: goroot + "/src/runtime/lock_futex.go",
 							Line:       201,
+							Offset:     0x52,
 							Func:       Function{Raw: "runtime.notetsleepg"},
 							Args: Args{
 								Values: []Arg{
@@ -396,30 +745,43 @@ func TestParseDumpSysCall(t *testing.T) {
 									{Value: 0x1},
 								},
 							},
+							FP: 0xc208018f68,
+							SP: 0xc208018f40,
 						},
 						{
 							SourcePath: goroot + "/src/runtime/sigqueue.go",
 							Line:       109,
+							Offset:     0x135,
 							Func:       Function{Raw: "runtime.signal_recv"},
 							Args: Args{
 								Values: []Arg{{}},
 							},
+							FP: 0xc208018fa0,
+							SP: 0xc208018f68,
 						},
 						{
 							SourcePath: goroot + "/src/os/signal/signal_unix.go",
 							Line:       21,
+							Offset:     0x1f,
 							Func:       Function{Raw: "os/signal.loop"},
+							FP:         0xc208018fe0,
+							SP:         0xc208018fa0,
 						},
 						{
 							SourcePath: goroot + "/src/runtime/asm_amd64.s",
 							Line:       2232,
+							Offset:     0x1,
 							Func:       Function{Raw: "runtime.goexit"},
+							Kind:       FrameAsm,
+							FP:         0xc208018fe8,
+							SP:         0xc208018fe0,
 						},
 					},
 				},
 				CreatedBy: Call{
 					SourcePath: goroot + "/src/os/signal/signal_unix.go",
 					Line:       27,
+					Offset:     0x35,
 					Func:       Function{Raw: "os/signal.init·1"},
 				},
 			},
@@ -454,6 +816,7 @@ func TestParseDumpUnavail(t *testing.T) {
 				CreatedBy: Call{
 					SourcePath: "/gopath/src/github.com/foo/bar.go",
 					Line:       131,
+					Offset:     0x381,
 					Func:       Function{Raw: "github.com/foo.New"},
 				},
 			},
@@ -494,6 +857,7 @@ func TestParseDumpSameBucket(t *testing.T) {
 						{
 							SourcePath: "/gopath/src/github.com/foo/bar/baz.go",
 							Line:       72,
+							Offset:     0x49,
 							Func:       Function{"main.func·001"},
 						},
 					},
@@ -501,6 +865,7 @@ func TestParseDumpSameBucket(t *testing.T) {
 				CreatedBy: Call{
 					SourcePath: "/gopath/src/github.com/foo/bar/baz.go",
 					Line:       74,
+					Offset:     0xeb,
 					Func:       Function{"main.mainImpl"},
 				},
 			},
@@ -515,6 +880,7 @@ func TestParseDumpSameBucket(t *testing.T) {
 						{
 							SourcePath: "/gopath/src/github.com/foo/bar/baz.go",
 							Line:       72,
+							Offset:     0x49,
 							Func:       Function{"main.func·001"},
 						},
 					},
@@ -522,6 +888,7 @@ func TestParseDumpSameBucket(t *testing.T) {
 				CreatedBy: Call{
 					SourcePath: "/gopath/src/github.com/foo/bar/baz.go",
 					Line:       74,
+					Offset:     0xeb,
 					Func:       Function{"main.mainImpl"},
 				},
 			},
@@ -529,7 +896,7 @@ func TestParseDumpSameBucket(t *testing.T) {
 		},
 	}
 	ut.AssertEqual(t, expectedGR, goroutines)
-	expectedBuckets := Buckets{{expectedGR[0].Signature, []Goroutine{expectedGR[0], expectedGR[1]}}}
+	expectedBuckets := Buckets{{Signature: expectedGR[0].Signature, Routines: []Goroutine{expectedGR[0], expectedGR[1]}}}
 	ut.AssertEqual(t, expectedBuckets, SortBuckets(Bucketize(goroutines, ExactLines)))
 }
 
@@ -558,8 +925,9 @@ func TestBucketizeNotAggressive(t *testing.T) {
 						{
 							SourcePath: "/gopath/src/github.com/foo/bar/baz.go",
 							Line:       72,
+							Offset:     0x49,
 							Func:       Function{"main.func·001"},
-							Args:       Args{Values: []Arg{{0x11000000, ""}, {Value: 2}}},
+							Args:       Args{Values: []Arg{{Value: 0x11000000}, {Value: 2}}},
 						},
 					},
 				},
@@ -575,8 +943,9 @@ func TestBucketizeNotAggressive(t *testing.T) {
 						{
 							SourcePath: "/gopath/src/github.com/foo/bar/baz.go",
 							Line:       72,
+							Offset:     0x49,
 							Func:       Function{"main.func·001"},
-							Args:       Args{Values: []Arg{{0x21000000, "#1"}, {Value: 2}}},
+							Args:       Args{Values: []Arg{{Value: 0x21000000, Name: "#1"}, {Value: 2}}},
 						},
 					},
 				},
@@ -586,8 +955,8 @@ func TestBucketizeNotAggressive(t *testing.T) {
 	}
 	ut.AssertEqual(t, expectedGR, goroutines)
 	expectedBuckets := Buckets{
-		{expectedGR[0].Signature, []Goroutine{expectedGR[0]}},
-		{expectedGR[1].Signature, []Goroutine{expectedGR[1]}},
+		{Signature: expectedGR[0].Signature, Routines: []Goroutine{expectedGR[0]}},
+		{Signature: expectedGR[1].Signature, Routines: []Goroutine{expectedGR[1]}},
 	}
 	ut.AssertEqual(t, expectedBuckets, SortBuckets(Bucketize(goroutines, ExactLines)))
 }
@@ -623,8 +992,9 @@ func TestBucketizeAggressive(t *testing.T) {
 						{
 							SourcePath: "/gopath/src/github.com/foo/bar/baz.go",
 							Line:       72,
+							Offset:     0x49,
 							Func:       Function{"main.func·001"},
-							Args:       Args{Values: []Arg{{0x11000000, ""}, {Value: 2}}},
+							Args:       Args{Values: []Arg{{Value: 0x11000000}, {Value: 2}}},
 						},
 					},
 				},
@@ -642,8 +1012,9 @@ func TestBucketizeAggressive(t *testing.T) {
 						{
 							SourcePath: "/gopath/src/github.com/foo/bar/baz.go",
 							Line:       72,
+							Offset:     0x49,
 							Func:       Function{"main.func·001"},
-							Args:       Args{Values: []Arg{{0x21000000, "#1"}, {Value: 2}}},
+							Args:       Args{Values: []Arg{{Value: 0x21000000, Name: "#1"}, {Value: 2}}},
 						},
 					},
 				},
@@ -660,8 +1031,9 @@ func TestBucketizeAggressive(t *testing.T) {
 						{
 							SourcePath: "/gopath/src/github.com/foo/bar/baz.go",
 							Line:       72,
+							Offset:     0x49,
 							Func:       Function{"main.func·001"},
-							Args:       Args{Values: []Arg{{0x21000000, "#1"}, {Value: 2}}},
+							Args:       Args{Values: []Arg{{Value: 0x21000000, Name: "#1"}, {Value: 2}}},
 						},
 					},
 				},
@@ -679,16 +1051,274 @@ func TestBucketizeAggressive(t *testing.T) {
 				{
 					SourcePath: "/gopath/src/github.com/foo/bar/baz.go",
 					Line:       72,
+					Offset:     0x49,
 					Func:       Function{"main.func·001"},
-					Args:       Args{Values: []Arg{{0x11000000, "*"}, {Value: 2}}},
+					Args:       Args{Values: []Arg{{Value: 0x11000000, Name: "*"}, {Value: 2}}},
 				},
 			},
 		},
 	}
-	expectedBuckets := Buckets{{signature, []Goroutine{expectedGR[0], expectedGR[1], expectedGR[2]}}}
+	expectedBuckets := Buckets{{Signature: signature, Routines: []Goroutine{expectedGR[0], expectedGR[1], expectedGR[2]}}}
 	ut.AssertEqual(t, expectedBuckets, SortBuckets(Bucketize(goroutines, AnyPointer)))
 }
 
+func TestParseSimilarity(t *testing.T) {
+	for _, s := range []Similarity{ExactFlags, ExactLines, AnyPointer, AnyValue} {
+		actual, err := ParseSimilarity(s.String())
+		ut.AssertEqual(t, nil, err)
+		ut.AssertEqual(t, s, actual)
+	}
+	actual, err := ParseSimilarity("pointer")
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, AnyPointer, actual)
+	_, err = ParseSimilarity("fuzzy")
+	ut.AssertEqual(t, errors.New("invalid similarity \"fuzzy\"; use exactflags, exactlines, anypointer or anyvalue"), err)
+}
+
+func TestBucketizeCriteriaLocked(t *testing.T) {
+	t.Parallel()
+	calls := []Call{{SourcePath: "/src/main.go", Line: 72, Func: Function{"main.func·001"}}}
+	goroutines := []Goroutine{
+		{Signature: Signature{State: "chan receive", Stack: Stack{Calls: calls}}, ID: 1},
+		{Signature: Signature{State: "chan receive", Stack: Stack{Calls: calls}, Locked: true}, ID: 2},
+	}
+	// By default, Locked is ignored at AnyPointer.
+	ut.AssertEqual(t, 1, len(Bucketize(goroutines, AnyPointer)))
+	c := Criteria{Similarity: AnyPointer, Locked: true}
+	buckets := SortBuckets(c.Bucketize(goroutines))
+	ut.AssertEqual(t, 2, len(buckets))
+	ut.AssertEqual(t, true, buckets[0].Locked)
+	ut.AssertEqual(t, []Goroutine{goroutines[1]}, buckets[0].Routines)
+	ut.AssertEqual(t, false, buckets[1].Locked)
+	ut.AssertEqual(t, []Goroutine{goroutines[0]}, buckets[1].Routines)
+}
+
+func TestBucketizeCriteriaSleep(t *testing.T) {
+	t.Parallel()
+	calls := []Call{{SourcePath: "/src/main.go", Line: 72, Func: Function{"main.func·001"}}}
+	goroutines := []Goroutine{
+		{Signature: Signature{State: "chan receive", Stack: Stack{Calls: calls}, SleepMin: 1, SleepMax: 1}, ID: 1},
+		{Signature: Signature{State: "chan receive", Stack: Stack{Calls: calls}, SleepMin: 29, SleepMax: 29}, ID: 2},
+		{Signature: Signature{State: "chan receive", Stack: Stack{Calls: calls}, SleepMin: 30, SleepMax: 30}, ID: 3},
+		{Signature: Signature{State: "chan receive", Stack: Stack{Calls: calls}, SleepMin: 90, SleepMax: 90}, ID: 4},
+	}
+	ut.AssertEqual(t, 1, len(Bucketize(goroutines, AnyPointer)))
+	c := Criteria{Similarity: AnyPointer, SleepRanges: []int{30, 60}}
+	actual := c.Bucketize(goroutines)
+	ut.AssertEqual(t, 3, len(actual))
+	for key, routines := range actual {
+		switch key.SleepMax {
+		case 29:
+			ut.AssertEqual(t, 1, key.SleepMin)
+			ut.AssertEqual(t, []Goroutine{goroutines[0], goroutines[1]}, routines)
+		case 30:
+			ut.AssertEqual(t, []Goroutine{goroutines[2]}, routines)
+		case 90:
+			ut.AssertEqual(t, []Goroutine{goroutines[3]}, routines)
+		default:
+			t.Fatalf("unexpected bucket %#v", key)
+		}
+	}
+}
+
+func TestBucketizeCriteriaAnyLine(t *testing.T) {
+	t.Parallel()
+	calls := func(line, created int) Signature {
+		return Signature{
+			State:     "chan receive",
+			CreatedBy: Call{SourcePath: "/src/main.go", Line: created, Func: Function{"main.main"}},
+			Stack: Stack{Calls: []Call{
+				{SourcePath: "/src/main.go", Line: line, Func: Function{"main.worker"}},
+				{SourcePath: "/src/main.go", Line: 40, Func: Function{"main.run"}},
+			}},
+		}
+	}
+	goroutines := []Goroutine{
+		{Signature: calls(72, 10), ID: 1},
+		{Signature: calls(75, 12), ID: 2},
+	}
+	ut.AssertEqual(t, 2, len(Bucketize(goroutines, AnyPointer)))
+	c := Criteria{Similarity: AnyPointer, AnyLine: true}
+	buckets := SortBuckets(c.Bucketize(goroutines))
+	ut.AssertEqual(t, 1, len(buckets))
+	ut.AssertEqual(t, 2, len(buckets[0].Routines))
+	ut.AssertEqual(t, 72, buckets[0].Stack.Calls[0].Line)
+	// A different function is still a different bucket.
+	other := calls(72, 10)
+	other.Stack.Calls[1].Func.Raw = "main.other"
+	goroutines = append(goroutines, Goroutine{Signature: other, ID: 3})
+	ut.AssertEqual(t, 2, len(c.Bucketize(goroutines)))
+}
+
+func TestBucketizeCriteriaAnyClosure(t *testing.T) {
+	t.Parallel()
+	sig := func(fn string) Signature {
+		return Signature{
+			State: "chan receive",
+			Stack: Stack{Calls: []Call{{SourcePath: "/src/worker.go", Line: 72, Func: Function{fn}}}},
+		}
+	}
+	goroutines := []Goroutine{
+		{Signature: sig("pkg.(*Worker).Run.func1"), ID: 1},
+		{Signature: sig("pkg.(*Worker).Run.func2"), ID: 2},
+		{Signature: sig("pkg.(*Worker).Run.func1.3"), ID: 3},
+		{Signature: sig("pkg.(*Worker).Stop.func1"), ID: 4},
+		{Signature: sig("pkg.(*Worker).Run.gowrap1"), ID: 5},
+		{Signature: sig("pkg.(*Worker).Run.gowrap2"), ID: 6},
+	}
+	ut.AssertEqual(t, 6, len(Bucketize(goroutines, AnyPointer)))
+	c := Criteria{Similarity: AnyPointer, AnyClosure: true}
+	buckets := SortBuckets(c.Bucketize(goroutines))
+	ut.AssertEqual(t, 3, len(buckets))
+	names := map[string]int{}
+	for _, b := range buckets {
+		names[b.Stack.Calls[0].Func.Raw] = len(b.Routines)
+	}
+	expected := map[string]int{
+		"pkg.(*Worker).Run.func1":   3,
+		"pkg.(*Worker).Stop.func1":  1,
+		"pkg.(*Worker).Run.gowrap1": 2,
+	}
+	ut.AssertEqual(t, expected, names)
+	ut.AssertEqual(t, "main.func·", stripClosure("main.func·001"))
+}
+
+func TestBucketizeCriteriaFrames(t *testing.T) {
+	t.Parallel()
+	call := func(fn string, line int) Call {
+		return Call{SourcePath: "/src/" + fn + ".go", Line: line, Func: Function{"pkg." + fn}}
+	}
+	query := call("query", 10)
+	conn := call("conn", 20)
+	handler := call("handler", 30)
+	cron := call("cron", 40)
+	serve := call("serve", 50)
+	goroutines := []Goroutine{
+		{Signature: Signature{State: "select", Stack: Stack{Calls: []Call{query, conn, handler}}, CreatedBy: serve}, ID: 1},
+		{Signature: Signature{State: "select", Stack: Stack{Calls: []Call{query, conn, cron}}}, ID: 2},
+		{Signature: Signature{State: "select", Stack: Stack{Calls: []Call{query, handler}}, CreatedBy: serve}, ID: 3},
+		{Signature: Signature{State: "select", Stack: Stack{Calls: []Call{query}}}, ID: 4},
+	}
+	ut.AssertEqual(t, 4, len(Bucketize(goroutines, AnyPointer)))
+
+	c := Criteria{Similarity: AnyPointer, TopFrames: 2}
+	buckets := SortBuckets(c.Bucketize(goroutines))
+	ut.AssertEqual(t, 3, len(buckets))
+	ut.AssertEqual(t, Stack{Calls: []Call{query, conn}, Elided: true}, buckets[0].Stack)
+	ut.AssertEqual(t, Call{}, buckets[0].CreatedBy)
+	ut.AssertEqual(t, 2, len(buckets[0].Routines))
+	ut.AssertEqual(t, 3, len(buckets[0].Routines[0].Stack.Calls))
+
+	c = Criteria{Similarity: AnyPointer, BottomFrames: 1}
+	buckets = SortBuckets(c.Bucketize(goroutines))
+	ut.AssertEqual(t, 3, len(buckets))
+	ut.AssertEqual(t, Stack{Calls: []Call{handler}}, buckets[0].Stack)
+	ut.AssertEqual(t, serve, buckets[0].CreatedBy)
+	ut.AssertEqual(t, 2, len(buckets[0].Routines))
+	ut.AssertEqual(t, true, c.Similar(&goroutines[0].Signature, &goroutines[2].Signature))
+	ut.AssertEqual(t, false, c.Similar(&goroutines[0].Signature, &goroutines[1].Signature))
+}
+
+func TestBucketizeCriteriaFramesElided(t *testing.T) {
+	t.Parallel()
+	call := func(fn string, line int) Call {
+		return Call{SourcePath: "/src/" + fn + ".go", Line: line, Func: Function{"pkg." + fn}}
+	}
+	query := call("query", 10)
+	conn := call("conn", 20)
+	handler := call("handler", 30)
+	serve := call("serve", 50)
+	goroutines := []Goroutine{
+		{Signature: Signature{State: "select", Stack: Stack{Calls: []Call{query, conn}}}, ID: 1},
+		{Signature: Signature{State: "select", Stack: Stack{Calls: []Call{query, conn, handler}}}, ID: 2},
+		{Signature: Signature{State: "select", Stack: Stack{Calls: []Call{query, conn, handler}, Elided: true}, CreatedBy: serve}, ID: 3},
+	}
+	// The goroutines share their top 2 calls, whether they had more calls or
+	// not.
+	c := Criteria{Similarity: AnyPointer, TopFrames: 2}
+	buckets := SortBuckets(c.Bucketize(goroutines))
+	ut.AssertEqual(t, 1, len(buckets))
+	ut.AssertEqual(t, 2, len(buckets[0].Stack.Calls))
+	ut.AssertEqual(t, true, buckets[0].Stack.Elided)
+	ut.AssertEqual(t, 3, len(buckets[0].Routines))
+
+	// The bottom of a stack cut by the runtime is unknown; it is compared
+	// whole.
+	c = Criteria{Similarity: AnyPointer, BottomFrames: 1}
+	buckets = SortBuckets(c.Bucketize(goroutines))
+	ut.AssertEqual(t, 3, len(buckets))
+	ut.AssertEqual(t, false, c.Similar(&goroutines[1].Signature, &goroutines[2].Signature))
+}
+
+func TestStackLess(t *testing.T) {
+	t.Parallel()
+	user := Call{SourcePath: "/src/main.go", Line: 10, Func: Function{"main.a"}}
+	user2 := Call{SourcePath: "/src/main.go", Line: 20, Func: Function{"main.b"}}
+	std := Call{SourcePath: goroot + "/src/reflect/value.go", Line: 2125, Func: Function{"reflect.Value.assignTo"}}
+	// Sorted from the most important to the least.
+	stacks := []Stack{
+		{Calls: []Call{user, user2}},
+		{Calls: []Call{user}},
+		{Calls: []Call{user, std}},
+		{Calls: []Call{user2, std}},
+		{Calls: []Call{std}},
+	}
+	for i := range stacks {
+		ut.AssertEqualIndex(t, i, false, stacks[i].Less(&stacks[i]))
+		for j := i + 1; j < len(stacks); j++ {
+			ut.AssertEqualIndex(t, i, true, stacks[i].Less(&stacks[j]))
+			ut.AssertEqualIndex(t, i, false, stacks[j].Less(&stacks[i]))
+		}
+	}
+}
+
+func TestSignatureLess(t *testing.T) {
+	t.Parallel()
+	calls := []Call{{SourcePath: "/src/main.go", Line: 10, Func: Function{"main.a"}}}
+	// Sorted from the most important to the least.
+	signatures := []Signature{
+		{State: "chan receive", Locked: true, Stack: Stack{Calls: calls}},
+		{State: "chan receive", Stack: Stack{Calls: calls}},
+		{State: "chan receive", Stack: Stack{Calls: calls}, CreatedBy: Call{Func: Function{"main.main"}, Line: 1}},
+		{State: "chan receive", Stack: Stack{Calls: calls}, CreatedBy: Call{Func: Function{"main.main"}, Line: 2}},
+		{State: "chan receive", Stack: Stack{Calls: calls}, CreatedBy: Call{Func: Function{"main.main"}, Line: 2}, SleepMax: 5},
+		{State: "running", Stack: Stack{Calls: calls}},
+	}
+	for i := range signatures {
+		ut.AssertEqualIndex(t, i, false, signatures[i].Less(&signatures[i]))
+		for j := i + 1; j < len(signatures); j++ {
+			ut.AssertEqualIndex(t, i, true, signatures[i].Less(&signatures[j]))
+			ut.AssertEqualIndex(t, i, false, signatures[j].Less(&signatures[i]))
+		}
+	}
+}
+
+func TestBucketsSort(t *testing.T) {
+	t.Parallel()
+	user := []Call{{SourcePath: "/src/main.go", Line: 10, Func: Function{"main.a"}}}
+	deep := []Call{
+		{SourcePath: "/src/main.go", Line: 10, Func: Function{"main.a"}},
+		{SourcePath: "/src/main.go", Line: 20, Func: Function{"main.b"}},
+	}
+	std := []Call{{SourcePath: goroot + "/src/reflect/value.go", Line: 2125, Func: Function{"reflect.Value.assignTo"}}}
+	// Sorted from the most important to the least.
+	expected := Buckets{
+		{Signature: Signature{State: "running", Stack: Stack{Calls: std}}, Routines: []Goroutine{{ID: 9, First: true}}},
+		{Signature: Signature{State: "running", Stack: Stack{Calls: deep}}, Routines: []Goroutine{{ID: 8}}},
+		{Signature: Signature{State: "running", Stack: Stack{Calls: user}}, Routines: []Goroutine{{ID: 6}, {ID: 7}}},
+		{Signature: Signature{State: "chan receive", Stack: Stack{Calls: user}}, Routines: []Goroutine{{ID: 5}}},
+		{Signature: Signature{State: "running", Stack: Stack{Calls: user}}, Routines: []Goroutine{{ID: 3}}},
+		{Signature: Signature{State: "running", Stack: Stack{Calls: user}}, Routines: []Goroutine{{ID: 4}}},
+		{Signature: Signature{State: "running", Stack: Stack{Calls: std}}, Routines: []Goroutine{{ID: 1}, {ID: 2}}},
+	}
+	// Try all the rotations of the input; the result must always be the same.
+	for i := range expected {
+		actual := append(append(Buckets{}, expected[i:]...), expected[:i]...)
+		sort.Sort(actual)
+		ut.AssertEqualIndex(t, i, expected, actual)
+	}
+}
+
 func TestParseDumpNoOffset(t *testing.T) {
 	data := []string{
 		"panic: runtime error: index out of range",
@@ -718,6 +1348,7 @@ func TestParseDumpNoOffset(t *testing.T) {
 				CreatedBy: Call{
 					SourcePath: "/gopath/src/github.com/foo/bar.go",
 					Line:       113,
+					Offset:     0x43b,
 					Func:       Function{"github.com/foo.New"},
 				},
 			},
@@ -728,6 +1359,64 @@ func TestParseDumpNoOffset(t *testing.T) {
 	ut.AssertEqual(t, expectedGR, goroutines)
 }
 
+func TestParseDumpLongLine(t *testing.T) {
+	// A line longer than bufio.MaxScanTokenSize in a goroutine is parsed
+	// whole.
+	args := strings.TrimSuffix(strings.Repeat("0x1, ", bufio.MaxScanTokenSize/4), ", ")
+	data := []string{
+		"goroutine 1 [running]:",
+		"main.main(" + args + ")",
+		"\t/gopath/src/github.com/foo/bar/main.go:12 +0x17",
+		"",
+	}
+	goroutines, err := ParseDump(bytes.NewBufferString(strings.Join(data, "\n")), &bytes.Buffer{})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 1, len(goroutines))
+	ut.AssertEqual(t, bufio.MaxScanTokenSize/4, len(goroutines[0].Stack.Calls[0].Args.Values))
+	ut.AssertEqual(t, 12, goroutines[0].Stack.Calls[0].Line)
+
+	// A line longer than MaxLineSize is an error.
+	data[1] = "main.main(" + strings.Repeat("a", MaxLineSize) + ")"
+	goroutines, err = ParseDump(bytes.NewBufferString(strings.Join(data, "\n")), &bytes.Buffer{})
+	ut.AssertEqual(t, true, err != nil)
+	ut.AssertEqual(t, 1, len(goroutines))
+}
+
+func TestParseDumpTruncated(t *testing.T) {
+	data := []string{
+		"panic: ooh",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"\t/gopath/src/github.com/foo/bar/main.go:12 +0x17",
+		"",
+		"goroutine 2 [chan receive]:",
+		"main.worker(0xc000012345)",
+		"\t/gopath/src/github.com/foo/bar/main.go:20 +0x2a",
+		"main.run()",
+		"\t/gopath/src/github.com/fo",
+	}
+	s, err := ParseSnapshot(bytes.NewBufferString(strings.Join(data, "\n")), &bytes.Buffer{})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, true, s.Incomplete)
+	ut.AssertEqual(t, 2, len(s.Goroutines))
+	ut.AssertEqual(t, false, s.Goroutines[0].Incomplete)
+	ut.AssertEqual(t, true, s.Goroutines[1].Incomplete)
+	ut.AssertEqual(t, 2, len(s.Goroutines[1].Stack.Calls))
+
+	// Cut after a "created by" line.
+	data = append(data[:9], "created by main.main")
+	s, err = ParseSnapshot(bytes.NewBufferString(strings.Join(data, "\n")+"\n"), &bytes.Buffer{})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, true, s.Incomplete)
+	ut.AssertEqual(t, true, s.Goroutines[1].Incomplete)
+
+	// A complete dump.
+	s, err = ParseSnapshot(bytes.NewBufferString(strings.Join(data[:9], "\n")+"\n"), &bytes.Buffer{})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, false, s.Incomplete)
+}
+
 func TestParseDumpJunk(t *testing.T) {
 	// For coverage of scanLines.
 	data := []string{
@@ -740,9 +1429,10 @@ func TestParseDumpJunk(t *testing.T) {
 	ut.AssertEqual(t, nil, err)
 	expectedGR := []Goroutine{
 		{
-			Signature: Signature{State: "running"},
-			ID:        1,
-			First:     true,
+			Signature:  Signature{State: "running"},
+			ID:         1,
+			First:      true,
+			Incomplete: true,
 		},
 	}
 	ut.AssertEqual(t, expectedGR, goroutines)
@@ -779,6 +1469,7 @@ func TestParseCCode(t *testing.T) {
 						{
 							SourcePath: goroot + "/src/runtime/sys_linux_amd64.s",
 							Line:       400,
+							Offset:     0x19,
 							Func:       Function{"runtime.epollwait"},
 							Args: Args{
 								Values: []Arg{
@@ -795,35 +1486,45 @@ func TestParseCCode(t *testing.T) {
 								},
 								Elided: true,
 							},
+							Kind: FrameAsm,
 						},
 						{
 							SourcePath: goroot + "/src/runtime/netpoll_epoll.go",
 							Line:       68,
+							Offset:     0xa3,
 							Func:       Function{"runtime.netpoll"},
 							Args:       Args{Values: []Arg{{Value: 0x901b01}, {}}},
 						},
 						{
 							SourcePath: goroot + "/src/runtime/proc.c",
 							Line:       1472,
+							Offset:     0x485,
 							Func:       Function{"findrunnable"},
 							Args:       Args{Values: []Arg{{Value: 0xc208012000}}},
+							Kind:       FrameC,
 						},
 						{
 							SourcePath: goroot + "/src/runtime/proc.c",
 							Line:       1575,
+							Offset:     0x151,
 							Func:       Function{"schedule"},
+							Kind:       FrameC,
 						},
 						{
 							SourcePath: goroot + "/src/runtime/proc.c",
 							Line:       1654,
+							Offset:     0x113,
 							Func:       Function{"runtime.park_m"},
 							Args:       Args{Values: []Arg{{Value: 0xc2080017a0}}},
+							Kind:       FrameC,
 						},
 						{
 							SourcePath: goroot + "/src/runtime/asm_amd64.s",
 							Line:       186,
+							Offset:     0x5a,
 							Func:       Function{"runtime.mcall"},
 							Args:       Args{Values: []Arg{{Value: 0x432684}}},
+							Kind:       FrameAsm,
 						},
 					},
 				},
@@ -843,7 +1544,7 @@ func TestCallPkg1(t *testing.T) {
 		Args:       Args{Values: []Arg{{Value: 0xc208033b20}}},
 	}
 	ut.AssertEqual(t, "yaml.go", c.SourceName())
-	ut.AssertEqual(t, filepath.Join("yaml.v2", "yaml.go"), c.PkgSource())
+	ut.AssertEqual(t, "yaml.v2/yaml.go", c.PkgSource())
 	ut.AssertEqual(t, "gopkg.in/yaml.v2.handleErr", c.Func.String())
 	ut.AssertEqual(t, "handleErr", c.Func.Name())
 	// This is due to directory name not matching the package name.
@@ -853,6 +1554,171 @@ func TestCallPkg1(t *testing.T) {
 	ut.AssertEqual(t, false, c.IsPkgMain())
 }
 
+func TestCallWindowsPath(t *testing.T) {
+	data := []string{
+		"goroutine 1 [running]:",
+		"main.main()",
+		"	C:\\Users\\me\\go\\src\\foo\\main.go:12 +0x1d",
+		"created by runtime.main",
+		"	C:\\Go\\src\\runtime\\proc.go:250 +0x1d",
+		"",
+	}
+	goroutines, err := ParseDump(bytes.NewBufferString(strings.Join(data, "\n")), &bytes.Buffer{})
+	ut.AssertEqual(t, nil, err)
+	c := goroutines[0].Stack.Calls[0]
+	ut.AssertEqual(t, "C:/Users/me/go/src/foo/main.go", c.SourcePath)
+	ut.AssertEqual(t, byte('\\'), c.PathSeparator)
+	ut.AssertEqual(t, "C:\\Users\\me\\go\\src\\foo\\main.go", c.OriginalSourcePath())
+	ut.AssertEqual(t, "C:\\Users\\me\\go\\src\\foo\\main.go:12", c.FullSourceLine())
+	ut.AssertEqual(t, "main.go", c.SourceName())
+	ut.AssertEqual(t, "foo/main.go", c.PkgSource())
+	ut.AssertEqual(t, false, c.IsStdlib())
+	created := goroutines[0].CreatedBy
+	ut.AssertEqual(t, "C:/Go/src/runtime/proc.go", created.SourcePath)
+	ut.AssertEqual(t, true, created.IsStdlib())
+}
+
+func TestCallMergeOffset(t *testing.T) {
+	l := Call{SourcePath: "/gopath/src/foo/main.go", Line: 12, Func: Function{"main.main"}, Offset: 0x1d}
+	r := l
+	ut.AssertEqual(t, uint64(0x1d), l.Merge(&r).Offset)
+	r.Offset = 0x2a
+	ut.AssertEqual(t, true, l.Similar(&r, ExactLines))
+	ut.AssertEqual(t, uint64(0), l.Merge(&r).Offset)
+	ut.AssertEqual(t, false, l.Equal(&r))
+
+	r = l
+	l.FP, l.SP, l.PC = 0xc000050f88, 0xc000050f60, 0x4a1e28
+	r.FP, r.SP, r.PC = 0xc000052f88, 0xc000052f60, 0x4a1e28
+	m := l.Merge(&r)
+	ut.AssertEqual(t, uint64(0), m.FP)
+	ut.AssertEqual(t, uint64(0), m.SP)
+	ut.AssertEqual(t, uint64(0x4a1e28), m.PC)
+
+	// Through Bucketize.
+	data := []string{
+		"goroutine 1 [select]:",
+		"main.main()",
+		"	/gopath/src/foo/main.go:12 +0x1d",
+		"",
+		"goroutine 2 [select]:",
+		"main.main()",
+		"	/gopath/src/foo/main.go:12 +0x2a",
+		"",
+	}
+	goroutines, err := ParseDump(bytes.NewBufferString(strings.Join(data, "\n")), &bytes.Buffer{})
+	ut.AssertEqual(t, nil, err)
+	buckets := SortBuckets(Bucketize(goroutines, AnyPointer))
+	ut.AssertEqual(t, 1, len(buckets))
+	ut.AssertEqual(t, uint64(0), buckets[0].Stack.Calls[0].Offset)
+}
+
+func TestParseDumpCRLF(t *testing.T) {
+	data := []string{
+		"panic: ooh",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"	C:\\Users\\me\\go\\src\\foo\\main.go:12 +0x1d",
+		"created by runtime.main",
+		"	C:\\Go\\src\\runtime\\proc.go:250 +0x1d",
+		"",
+	}
+	lf := &bytes.Buffer{}
+	expected, err := ParseDump(bytes.NewBufferString(strings.Join(data, "\n")), lf)
+	ut.AssertEqual(t, nil, err)
+	crlf := &bytes.Buffer{}
+	goroutines, err := ParseDump(bytes.NewBufferString(strings.Join(data, "\r\n")), crlf)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, expected, goroutines)
+	ut.AssertEqual(t, "C:/Users/me/go/src/foo/main.go", goroutines[0].Stack.Calls[0].SourcePath)
+	// The junk is passed through as is.
+	ut.AssertEqual(t, "panic: ooh\n\n", lf.String())
+	ut.AssertEqual(t, "panic: ooh\r\n\r\n", crlf.String())
+}
+
+func TestParseDumpANSI(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"\x1b[31mpanic: ooh\x1b[0m",
+		"",
+		"\x1b[1mgoroutine 1 [running]:\x1b[0m",
+		"\x1b[36mmain.main\x1b[0m()",
+		"\t\x1b]8;;file:///home/me/src/foo/main.go\x1b\\/home/me/src/foo/main.go:12\x1b]8;;\x1b\\ +0x1d",
+		"",
+	}
+	extra := &bytes.Buffer{}
+	goroutines, err := ParseDump(bytes.NewBufferString(strings.Join(data, "\n")), extra)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 1, len(goroutines))
+	ut.AssertEqual(t, Call{SourcePath: "/home/me/src/foo/main.go", Line: 12, Offset: 0x1d, Func: Function{"main.main"}}, goroutines[0].Stack.Calls[0])
+	// The junk is passed through as is.
+	ut.AssertEqual(t, "\x1b[31mpanic: ooh\x1b[0m\n\n", extra.String())
+
+	goroutines, err = (&Parser{KeepANSI: true}).ParseDump(bytes.NewBufferString(strings.Join(data, "\n")), &bytes.Buffer{})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 0, len(goroutines))
+}
+
+func TestParseDumpInferGOROOT(t *testing.T) {
+	data := []string{
+		"goroutine 1 [running]:",
+		"net/http.(*conn).serve(0xc000012345)",
+		"\t/opt/build/go1.21/src/net/http/server.go:2009 +0x8f",
+		"",
+		"goroutine 2 [chan receive]:",
+		"runtime.gopark(0x0)",
+		"\t/opt/build/go1.21/src/runtime/proc.go:398 +0xce",
+		"main.main()",
+		"\t/opt/build/go1.21-src/main.go:12 +0x17",
+		"",
+	}
+	goroutines, err := ParseDump(bytes.NewBufferString(strings.Join(data, "\n")), &bytes.Buffer{})
+	ut.AssertEqual(t, nil, err)
+	// The GOROOT is inferred from the runtime frame, even for the goroutines
+	// printed before it.
+	ut.AssertEqual(t, true, goroutines[0].Stack.Calls[0].IsStdlib())
+	ut.AssertEqual(t, true, goroutines[1].Stack.Calls[0].IsStdlib())
+	ut.AssertEqual(t, false, goroutines[1].Stack.Calls[1].IsStdlib())
+
+	// The GOROOT of a dump doesn't apply to the next one.
+	goroutines, err = ParseDump(bytes.NewBufferString(strings.Join(data[:4], "\n")), &bytes.Buffer{})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, false, goroutines[0].Stack.Calls[0].IsStdlib())
+}
+
+func TestCallFramework(t *testing.T) {
+	t.Parallel()
+	c := Criteria{FrameworkPrefixes: []string{"github.com/acme/kit", "/src/vendor/sdk/"}}
+	data := []struct {
+		c        Call
+		expected bool
+	}{
+		{Call{SourcePath: "/gopath/src/github.com/acme/kit/log/log.go", Func: Function{"github.com/acme/kit/log.Info"}}, true},
+		{Call{SourcePath: "/gopath/src/github.com/acme/kit/kit.go", Func: Function{"github.com/acme/kit.Run"}}, true},
+		{Call{SourcePath: "/gopath/src/github.com/acme/kitchen/main.go", Func: Function{"github.com/acme/kitchen.Cook"}}, false},
+		{Call{SourcePath: "/src/vendor/sdk/client.go", Func: Function{"sdk.(*Client).Do"}}, true},
+		{Call{SourcePath: "/gopath/src/github.com/acme/server/main.go", Func: Function{"main.main"}}, false},
+	}
+	for i, line := range data {
+		s := Signature{Stack: Stack{Calls: []Call{line.c}}}
+		c.markFramework(&s)
+		ut.AssertEqualIndex(t, i, line.expected, s.Stack.Calls[0].IsFramework())
+	}
+	// Business code is ranked before the framework.
+	goroutines := []Goroutine{
+		{Signature: Signature{Stack: Stack{Calls: []Call{data[4].c, data[0].c}}}, ID: 1},
+		{Signature: Signature{Stack: Stack{Calls: []Call{data[0].c, data[1].c}}}, ID: 2},
+	}
+	buckets := SortBuckets(c.Bucketize(goroutines))
+	ut.AssertEqual(t, 2, len(buckets))
+	ut.AssertEqual(t, 1, buckets[0].Routines[0].ID)
+	ut.AssertEqual(t, true, buckets[1].Stack.Calls[0].IsFramework())
+	business, framework := goroutines[0].Signature, goroutines[1].Signature
+	ut.AssertEqual(t, true, business.Less(&framework))
+	ut.AssertEqual(t, false, framework.Less(&business))
+}
+
 func TestCallPkg2(t *testing.T) {
 	c := Call{
 		SourcePath: "/gopath/src/gopkg.in/yaml.v2/yaml.go",
@@ -861,7 +1727,7 @@ func TestCallPkg2(t *testing.T) {
 		Args:       Args{Values: []Arg{{Value: 0xc208033b20}}},
 	}
 	ut.AssertEqual(t, "yaml.go", c.SourceName())
-	ut.AssertEqual(t, filepath.Join("yaml.v2", "yaml.go"), c.PkgSource())
+	ut.AssertEqual(t, "yaml.v2/yaml.go", c.PkgSource())
 	// TODO(maruel): Using '/' for this function is inconsistent on Windows
 	// w.r.t. other functions.
 	ut.AssertEqual(t, "gopkg.in/yaml.v2.(*decoder).unmarshal", c.Func.String())
@@ -882,7 +1748,7 @@ func TestCallStdlib(t *testing.T) {
 	}
 	ut.AssertEqual(t, "value.go", c.SourceName())
 	ut.AssertEqual(t, "value.go:2125", c.SourceLine())
-	ut.AssertEqual(t, filepath.Join("reflect", "value.go"), c.PkgSource())
+	ut.AssertEqual(t, "reflect/value.go", c.PkgSource())
 	ut.AssertEqual(t, "reflect.Value.assignTo", c.Func.String())
 	ut.AssertEqual(t, "Value.assignTo", c.Func.Name())
 	ut.AssertEqual(t, "reflect", c.Func.PkgName())
@@ -899,7 +1765,7 @@ func TestCallMain(t *testing.T) {
 	}
 	ut.AssertEqual(t, "main.go", c.SourceName())
 	ut.AssertEqual(t, "main.go:428", c.SourceLine())
-	ut.AssertEqual(t, filepath.Join("bar", "main.go"), c.PkgSource())
+	ut.AssertEqual(t, "bar/main.go", c.PkgSource())
 	ut.AssertEqual(t, "main.main", c.Func.String())
 	ut.AssertEqual(t, "main", c.Func.Name())
 	ut.AssertEqual(t, "main", c.Func.PkgName())
@@ -917,7 +1783,7 @@ func TestCallC(t *testing.T) {
 	}
 	ut.AssertEqual(t, "proc.c", c.SourceName())
 	ut.AssertEqual(t, "proc.c:1472", c.SourceLine())
-	ut.AssertEqual(t, filepath.Join("runtime", "proc.c"), c.PkgSource())
+	ut.AssertEqual(t, "runtime/proc.c", c.PkgSource())
 	ut.AssertEqual(t, "findrunnable", c.Func.String())
 	ut.AssertEqual(t, "findrunnable", c.Func.Name())
 	ut.AssertEqual(t, "", c.Func.PkgName())
@@ -945,6 +1811,18 @@ func TestArgs(t *testing.T) {
 	ut.AssertEqual(t, "0x4, 0x7fff671c7118, 0xffffffff00000080, 0, 0xffffffff0028c1be, 0, 0, 0, 0, 0, ...", a.String())
 }
 
+func TestAnnotationsString(t *testing.T) {
+	ut.AssertEqual(t, "", Annotations{}.String())
+	a := Annotations{
+		"zeta":    "last",
+		"alpha":   "",
+		"issue":   "FOO-123",
+		"a=b":     "c, d",
+		"comment": "see [runbook]",
+	}
+	ut.AssertEqual(t, `"a=b"="c, d", alpha, comment="see [runbook]", issue=FOO-123, zeta=last`, a.String())
+}
+
 func TestFunctionAnonymous(t *testing.T) {
 	f := Function{"main.func·001"}
 	ut.AssertEqual(t, "main.func·001", f.String())
@@ -962,3 +1840,47 @@ func TestFunctionGC(t *testing.T) {
 	ut.AssertEqual(t, "", f.PkgName())
 	ut.AssertEqual(t, false, f.IsExported())
 }
+
+func TestFunctionGeneric(t *testing.T) {
+	data := []struct {
+		raw        string
+		pkgDotName string
+		name       string
+		pkgName    string
+		baseName   string
+		typeArgs   string
+		exported   bool
+	}{
+		{"main.Map[...]", "main.Map[...]", "Map[...]", "main", "main.Map", "...", true},
+		{"main.keys[go.shape.int,go.shape.string]", "main.keys[go.shape.int,go.shape.string]", "keys[go.shape.int,go.shape.string]", "main", "main.keys", "go.shape.int,go.shape.string", false},
+		{"github.com/a/b.(*List[...]).push", "b.(*List[...]).push", "(*List[...]).push", "b", "github.com/a/b.(*List).push", "...", false},
+		{"github.com/a/b.F[go.shape.struct { example.com/c.T }]", "b.F[go.shape.struct { example.com/c.T }]", "F[go.shape.struct { example.com/c.T }]", "b", "github.com/a/b.F", "go.shape.struct { example.com/c.T }", true},
+		{"main.F[go.shape.[]int]", "main.F[go.shape.[]int]", "F[go.shape.[]int]", "main", "main.F", "go.shape.[]int", true},
+		{"main.main", "main.main", "main", "main", "main.main", "", true},
+	}
+	for i, line := range data {
+		f := Function{line.raw}
+		ut.AssertEqualIndex(t, i, line.pkgDotName, f.PkgDotName())
+		ut.AssertEqualIndex(t, i, line.name, f.Name())
+		ut.AssertEqualIndex(t, i, line.pkgName, f.PkgName())
+		ut.AssertEqualIndex(t, i, line.baseName, f.BaseName())
+		ut.AssertEqualIndex(t, i, line.typeArgs, f.TypeArgs())
+		ut.AssertEqualIndex(t, i, line.typeArgs != "", f.IsGeneric())
+		ut.AssertEqualIndex(t, i, line.exported, f.IsExported())
+	}
+}
+
+func TestStackMergeMiddleElided(t *testing.T) {
+	t.Parallel()
+	a := Call{SourcePath: "/home/user/src/app/main.go", Line: 10, Func: Function{"main.a"}}
+	main := Call{SourcePath: "/home/user/src/app/main.go", Line: 30, Func: Function{"main.main"}}
+	l := Stack{Calls: []Call{a, main}, MiddleElided: 100, MiddleIndex: 1}
+	r := Stack{Calls: []Call{a, main}, MiddleElided: 200, MiddleIndex: 1}
+	ut.AssertEqual(t, false, l.Equal(&r))
+	ut.AssertEqual(t, true, l.Similar(&r, ExactLines))
+	m := l.Merge(&r)
+	ut.AssertEqual(t, 200, m.MiddleElided)
+	ut.AssertEqual(t, 1, m.MiddleIndex)
+	// Frames elided from the middle are not a cut stack.
+	ut.AssertEqual(t, false, l.Similar(&Stack{Calls: []Call{a, main}, Elided: true}, ExactLines))
+}
@@ -0,0 +1,61 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+// Summary is an overview of the goroutines of a dump, e.g. to print on one
+// screen or to export as metrics.
+type Summary struct {
+	// Total is the number of goroutines.
+	Total int
+	// States is the number of goroutines per state, e.g. "chan receive".
+	States map[string]int
+	// Packages is the number of goroutines per import path of their innermost
+	// call outside the standard library. The goroutines entirely in the
+	// standard library are counted under "".
+	Packages map[string]int
+	// LongestWait is the longest time a goroutine has been blocked, in
+	// minutes. The runtime only prints it from one minute.
+	LongestWait int
+	// LongestWaitID is the ID of the goroutine blocked the longest, 0 if none
+	// has been for at least a minute.
+	LongestWaitID int
+	// Locked is the number of goroutines locked to an OS thread.
+	Locked int
+}
+
+// Stats returns the overview of the goroutines.
+func Stats(goroutines []Goroutine) Summary {
+	out := Summary{
+		Total:    len(goroutines),
+		States:   map[string]int{},
+		Packages: map[string]int{},
+	}
+	for i := range goroutines {
+		g := &goroutines[i]
+		out.States[g.State]++
+		out.Packages[g.Stack.topPackage()]++
+		if g.SleepMax > out.LongestWait {
+			out.LongestWait = g.SleepMax
+			out.LongestWaitID = g.ID
+		}
+		if g.Locked {
+			out.Locked++
+		}
+	}
+	return out
+}
+
+// Private stuff.
+
+// topPackage returns the import path of the innermost call outside the
+// standard library, or "" if there is none.
+func (s *Stack) topPackage() string {
+	for i := range s.Calls {
+		if !s.Calls[i].IsStdlib() {
+			return s.Calls[i].Func.ImportPath()
+		}
+	}
+	return ""
+}
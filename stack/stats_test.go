@@ -0,0 +1,35 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestStats(t *testing.T) {
+	t.Parallel()
+	std := Call{SourcePath: goroot + "/src/net/http/server.go", Line: 3000, Func: Function{"net/http.(*Server).Serve"}}
+	user := Call{SourcePath: "/src/github.com/foo/bar/baz.go", Line: 10, Func: Function{"github.com/foo/bar.(*T).Run"}}
+	main := Call{SourcePath: "/src/main.go", Line: 20, Func: Function{"main.main"}}
+	goroutines := []Goroutine{
+		{Signature: Signature{State: "IO wait", Stack: Stack{Calls: []Call{std, main}}}, ID: 1},
+		{Signature: Signature{State: "chan receive", SleepMax: 30, Stack: Stack{Calls: []Call{user}}}, ID: 5},
+		{Signature: Signature{State: "chan receive", SleepMax: 3, Locked: true, Stack: Stack{Calls: []Call{user, main}}}, ID: 6},
+		{Signature: Signature{State: "IO wait", Stack: Stack{Calls: []Call{std}}}, ID: 7},
+	}
+	expected := Summary{
+		Total:         4,
+		States:        map[string]int{"IO wait": 2, "chan receive": 2},
+		Packages:      map[string]int{"": 1, "main": 1, "github.com/foo/bar": 2},
+		LongestWait:   30,
+		LongestWaitID: 5,
+		Locked:        1,
+	}
+	ut.AssertEqual(t, expected, Stats(goroutines))
+	ut.AssertEqual(t, "github.com/foo/bar", user.Func.ImportPath())
+	ut.AssertEqual(t, "", Function{"foo"}.ImportPath())
+}
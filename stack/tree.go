@@ -0,0 +1,143 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+// Node is a goroutine in the creation tree of a snapshot.
+type Node struct {
+	Goroutine *Goroutine
+	// Children are the goroutines created by this one that are still alive,
+	// in dump order.
+	Children []*Node
+}
+
+// Walk calls fn for n then for its descendants, depth first, with the depth
+// relative to n. fn returns false to skip the descendants of a node.
+func (n *Node) Walk(fn func(n *Node, depth int) bool) {
+	n.walk(fn, 0)
+}
+
+// Size returns the number of goroutines in the subtree, n included.
+func (n *Node) Size() int {
+	out := 0
+	n.Walk(func(*Node, int) bool {
+		out++
+		return true
+	})
+	return out
+}
+
+// Tree returns the goroutines as a forest of creation trees, in dump order.
+//
+// The creator of a goroutine is its Parent. The roots are the goroutines
+// whose creator is not in the dump, e.g. the main goroutine or the ones whose
+// creator exited. Before Go 1.21 the creator ID is not printed so all the
+// goroutines are roots.
+func (s *Snapshot) Tree() []*Node {
+	nodes := make([]*Node, len(s.Goroutines))
+	index := make(map[int]int, len(s.Goroutines))
+	for i := range s.Goroutines {
+		nodes[i] = &Node{Goroutine: &s.Goroutines[i]}
+		if _, ok := index[s.Goroutines[i].ID]; !ok {
+			index[s.Goroutines[i].ID] = i
+		}
+	}
+	// parents are the indexes of the creators, like Parent without its
+	// lookup.
+	parents := make([]int, len(s.Goroutines))
+	for i := range s.Goroutines {
+		parents[i] = -1
+		if id := s.Goroutines[i].CreatedByID; id != 0 {
+			if p, ok := index[id]; ok && p != i {
+				parents[i] = p
+			}
+		}
+	}
+	var roots []*Node
+	for i, p := range parents {
+		if p == -1 || inCycle(parents, i) {
+			roots = append(roots, nodes[i])
+			continue
+		}
+		nodes[p].Children = append(nodes[p].Children, nodes[i])
+	}
+	return roots
+}
+
+// TreeBucket is a bucket of goroutines created by the same bucket of
+// goroutines, with the buckets of the goroutines they created.
+type TreeBucket struct {
+	Bucket
+	Children []TreeBucket
+}
+
+// Size returns the number of goroutines in the bucket and its descendants.
+func (t *TreeBucket) Size() int {
+	out := len(t.Routines)
+	for i := range t.Children {
+		out += t.Children[i].Size()
+	}
+	return out
+}
+
+// BucketizeTree rolls the goroutines up under their creator: the nodes are
+// bucketized per the criteria, then the children of all the goroutines of
+// each bucket are bucketized together, recursively.
+//
+// For example a thousand workers created by a hundred connection handlers
+// created by the main goroutine are three buckets, nested.
+func (c *Criteria) BucketizeTree(nodes []*Node) []TreeBucket {
+	if len(nodes) == 0 {
+		return nil
+	}
+	goroutines := make([]Goroutine, len(nodes))
+	byID := make(map[int]*Node, len(nodes))
+	for i, n := range nodes {
+		goroutines[i] = *n.Goroutine
+		byID[n.Goroutine.ID] = n
+	}
+	buckets := c.Buckets(goroutines)
+	out := make([]TreeBucket, len(buckets))
+	for i := range buckets {
+		var children []*Node
+		for _, g := range buckets[i].Routines {
+			children = append(children, byID[g.ID].Children...)
+		}
+		out[i] = TreeBucket{Bucket: buckets[i], Children: c.BucketizeTree(children)}
+	}
+	return out
+}
+
+// BucketizeTree rolls the goroutines up under their creator, bucketized at
+// the similar level.
+func BucketizeTree(nodes []*Node, similar Similarity) []TreeBucket {
+	c := Criteria{Similarity: similar}
+	return c.BucketizeTree(nodes)
+}
+
+// Private stuff.
+
+func (n *Node) walk(fn func(n *Node, depth int) bool, depth int) {
+	if !fn(n, depth) {
+		return
+	}
+	for _, c := range n.Children {
+		c.walk(fn, depth+1)
+	}
+}
+
+// inCycle returns true if following the creators from i leads back to i,
+// which can only happen with a corrupted dump.
+func inCycle(parents []int, i int) bool {
+	// A cycle reachable from i but not containing i is at most len(parents)
+	// steps away.
+	p := parents[i]
+	for steps := 0; p != -1 && steps < len(parents); steps++ {
+		if p == i {
+			return true
+		}
+		p = parents[p]
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/maruel/ut"
+)
+
+func TestSnapshotTree(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"goroutine 1 [select]:",
+		"main.main()",
+		"	/home/user/src/main.go:22 +0x40",
+		"",
+		"goroutine 5 [IO wait]:",
+		"main.serve()",
+		"	/home/user/src/main.go:40 +0x27",
+		"created by main.main in goroutine 1",
+		"	/home/user/src/main.go:21 +0x35",
+		"",
+		"goroutine 6 [IO wait]:",
+		"main.serve()",
+		"	/home/user/src/main.go:40 +0x27",
+		"created by main.main in goroutine 1",
+		"	/home/user/src/main.go:21 +0x35",
+		"",
+		"goroutine 7 [chan receive]:",
+		"main.worker()",
+		"	/home/user/src/main.go:10 +0x27",
+		"created by main.serve in goroutine 5",
+		"	/home/user/src/main.go:41 +0x35",
+		"",
+		"goroutine 8 [chan receive]:",
+		"main.worker()",
+		"	/home/user/src/main.go:10 +0x27",
+		"created by main.serve in goroutine 6",
+		"	/home/user/src/main.go:41 +0x35",
+		"",
+		"goroutine 9 [sleep]:",
+		"main.poll()",
+		"	/home/user/src/main.go:30 +0x11",
+		"created by main.start in goroutine 4",
+		"	/home/user/src/main.go:35 +0x12",
+		"",
+	}
+	s, err := ParseSnapshot(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	roots := s.Tree()
+	ut.AssertEqual(t, 2, len(roots))
+	ut.AssertEqual(t, 1, roots[0].Goroutine.ID)
+	ut.AssertEqual(t, 5, roots[0].Size())
+	// Goroutine 4 exited.
+	ut.AssertEqual(t, 9, roots[1].Goroutine.ID)
+	ut.AssertEqual(t, 1, roots[1].Size())
+
+	var walked []int
+	var depths []int
+	roots[0].Walk(func(n *Node, depth int) bool {
+		walked = append(walked, n.Goroutine.ID)
+		depths = append(depths, depth)
+		return n.Goroutine.ID != 6
+	})
+	ut.AssertEqual(t, []int{1, 5, 7, 6}, walked)
+	ut.AssertEqual(t, []int{0, 1, 2, 1}, depths)
+
+	tree := (&Criteria{Similarity: AnyPointer}).BucketizeTree(roots)
+	ut.AssertEqual(t, 2, len(tree))
+	ut.AssertEqual(t, 5, tree[0].Size())
+	ut.AssertEqual(t, 1, len(tree[0].Children))
+	ut.AssertEqual(t, 2, len(tree[0].Children[0].Routines))
+	ut.AssertEqual(t, 1, len(tree[0].Children[0].Children))
+	ut.AssertEqual(t, 2, len(tree[0].Children[0].Children[0].Routines))
+	expected := []string{
+		"1: select main.main @ main.go:22",
+		"  2: IO wait main.serve @ main.go:40",
+		"    2: chan receive main.worker @ main.go:10",
+		"1: sleep main.poll @ main.go:30",
+		"",
+	}
+	ut.AssertEqual(t, strings.Join(expected, "\n"), (&Palette{}).TreeLines(tree, false))
+}
+
+func TestSnapshotTreeGo120(t *testing.T) {
+	t.Parallel()
+	// Before Go 1.21 the creator ID is not printed; the creator is not guessed
+	// from the "created by" function.
+	data := []string{
+		"goroutine 1 [select]:",
+		"main.main()",
+		"	/home/user/src/main.go:22 +0x40",
+		"",
+		"goroutine 5 [chan receive]:",
+		"main.worker()",
+		"	/home/user/src/main.go:10 +0x27",
+		"created by main.main",
+		"	/home/user/src/main.go:21 +0x35",
+		"",
+	}
+	s, err := ParseSnapshot(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard)
+	ut.AssertEqual(t, nil, err)
+	roots := s.Tree()
+	ut.AssertEqual(t, 2, len(roots))
+	ut.AssertEqual(t, 1, roots[0].Goroutine.ID)
+	ut.AssertEqual(t, 0, len(roots[0].Children))
+	ut.AssertEqual(t, 5, roots[1].Goroutine.ID)
+	ut.AssertEqual(t, (*Goroutine)(nil), s.Parent(roots[1].Goroutine))
+}
@@ -6,6 +6,7 @@ package stack
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -29,6 +30,10 @@ type Palette struct {
 	FunctionOther          string
 	FunctionOtherExported  string
 	Arguments              string
+
+	// Diff count changes.
+	CountIncrease string
+	CountDecrease string
 }
 
 // CalcLengths returns the maximum length of the source lines and package names.
@@ -56,9 +61,10 @@ func CalcLengths(buckets Buckets, fullPath bool) (int, int) {
 }
 
 // functionColor returns the color to be used for the function name based on
-// the type of package the function is in.
+// the type of package the function is in. The calls in
+// Criteria.FrameworkPrefixes are colored like the standard library.
 func (p *Palette) functionColor(line *Call) string {
-	if line.IsStdlib() {
+	if line.IsStdlib() || line.IsFramework() {
 		if line.Func.IsExported() {
 			return p.FunctionStdLibExported
 		}
@@ -73,7 +79,7 @@ func (p *Palette) functionColor(line *Call) string {
 
 // routineColor returns the color for the header of the goroutines bucket.
 func (p *Palette) routineColor(bucket *Bucket, multipleBuckets bool) string {
-	if bucket.First() && multipleBuckets {
+	if (bucket.Crashed() || bucket.First()) && multipleBuckets {
 		return p.RoutineFirst
 	}
 	return p.Routine
@@ -81,6 +87,16 @@ func (p *Palette) routineColor(bucket *Bucket, multipleBuckets bool) string {
 
 // BucketHeader prints the header of a goroutine signature.
 func (p *Palette) BucketHeader(bucket *Bucket, fullPath, multipleBuckets bool) string {
+	return fmt.Sprintf(
+		"%s%d: %s%s%s\n",
+		p.routineColor(bucket, multipleBuckets), len(bucket.Routines),
+		bucket.State, p.bucketExtra(bucket, fullPath),
+		p.EOLReset)
+}
+
+// bucketExtra returns the sleep, locked, GC assist, labels, annotations and
+// created by decorations of a bucket header.
+func (p *Palette) bucketExtra(bucket *Bucket, fullPath bool) string {
 	extra := ""
 	if bucket.SleepMax != 0 {
 		if bucket.SleepMin != bucket.SleepMax {
@@ -90,7 +106,19 @@ func (p *Palette) BucketHeader(bucket *Bucket, fullPath, multipleBuckets bool) s
 		}
 	}
 	if bucket.Locked {
-		extra += " [locked]"
+		extra += " [locked" + lockedThreads(bucket) + "]"
+	}
+	if bucket.GCAssist {
+		extra += " [captured during GC assist]"
+	}
+	if bucket.Health() == HealthIdle {
+		extra += " [idle]"
+	}
+	if labels := bucket.Labels(); len(labels) != 0 {
+		extra += " " + formatLabels(labels)
+	}
+	if len(bucket.Annotations) != 0 {
+		extra += " [" + bucket.Annotations.String() + "]"
 	}
 	created := bucket.CreatedBy.Func.PkgDotName()
 	if created != "" {
@@ -102,11 +130,7 @@ func (p *Palette) BucketHeader(bucket *Bucket, fullPath, multipleBuckets bool) s
 		}
 		extra += p.CreatedBy + " [Created by " + created + "]"
 	}
-	return fmt.Sprintf(
-		"%s%d: %s%s%s\n",
-		p.routineColor(bucket, multipleBuckets), len(bucket.Routines),
-		bucket.State, extra,
-		p.EOLReset)
+	return extra
 }
 
 // callLine prints one stack line.
@@ -117,23 +141,294 @@ func (p *Palette) callLine(line *Call, srcLen, pkgLen int, fullPath bool) string
 	} else {
 		src = line.SourceLine()
 	}
+	extra := ""
+	if line.Reconstructed {
+		extra = " [reconstructed]"
+	}
+	if line.Inlined {
+		extra = " [inlined]"
+	}
+	if line.Kind == FrameC {
+		extra += " [C]"
+	}
 	return fmt.Sprintf(
-		"    %s%-*s %s%-*s %s%s%s(%s)%s",
+		"    %s%-*s %s%-*s %s%s%s(%s)%s%s",
 		p.Package, pkgLen, line.Func.PkgName(),
 		p.SourceFile, srcLen, src,
 		p.functionColor(line), line.Func.Name(),
-		p.Arguments, line.Args,
+		p.Arguments, line.Args, extra,
 		p.EOLReset)
 }
 
+// OriginLines prints the signatures with exact arguments folded into the
+// bucket, each with its header and its stack. It returns an empty string if
+// there is only one.
+func (p *Palette) OriginLines(bucket *Bucket, srcLen, pkgLen int, fullPath bool) string {
+	origins := bucket.Origins(ExactLines)
+	if len(origins) < 2 {
+		return ""
+	}
+	out := fmt.Sprintf("  Folded from %d signatures:\n", len(origins))
+	for i := range origins {
+		out += fmt.Sprintf("  - %s%d: %s%s%s\n", p.Routine, len(origins[i].Routines), origins[i].State, p.bucketExtra(&origins[i], fullPath), p.EOLReset)
+		out += p.StackLines(&origins[i].Signature, srcLen, pkgLen, fullPath)
+	}
+	return out
+}
+
+// ArgLines prints the pointer arguments that are identical across all the
+// goroutines of the bucket. It returns an empty string if the bucket has a
+// single goroutine.
+func (p *Palette) ArgLines(bucket *Bucket) string {
+	if len(bucket.Routines) < 2 {
+		return ""
+	}
+	out := ""
+	for _, s := range bucket.ArgStats() {
+		a := Arg{Value: s.Value}
+		if !s.Constant() || !a.IsPtr() {
+			continue
+		}
+		out += fmt.Sprintf("  %s arg #%d identical across all %d goroutines of the bucket (0x%x)\n", bucket.Stack.Calls[s.Call].Func.PkgDotName(), s.Arg+1, len(bucket.Routines), s.Value)
+	}
+	return out
+}
+
+// IDLine prints the IDs of the goroutines of the bucket as compact ranges.
+func (p *Palette) IDLine(bucket *Bucket) string {
+	return "  goroutines: " + bucket.IDRanges().String() + "\n"
+}
+
+// FingerprintLine prints the fingerprint of the bucket, as used by
+// KnownIssues.
+func (p *Palette) FingerprintLine(bucket *Bucket) string {
+	return "  fingerprint: " + bucket.Fingerprint() + "\n"
+}
+
+// AgeLine prints how long the goroutines of the bucket have been blocked, or
+// nothing when none has been blocked for a minute.
+func (p *Palette) AgeLine(bucket *Bucket) string {
+	a := bucket.Age()
+	if a.Oldest == 0 {
+		return ""
+	}
+	if len(bucket.Routines) == 1 {
+		return fmt.Sprintf("  blocked: %d minutes\n", a.Oldest)
+	}
+	return fmt.Sprintf("  blocked: oldest %d minutes, median %d, newest %d\n", a.Oldest, a.Median, a.Newest)
+}
+
+// MemoryLine prints the estimated stack memory of the goroutines of the
+// bucket.
+func (p *Palette) MemoryLine(bucket *Bucket) string {
+	total, measured := bucket.StackMemory()
+	if measured == 0 {
+		return fmt.Sprintf("  stack memory: >=%s (no frame pointers, assuming %s each)\n", formatBytes(total), formatBytes(MinStackSize))
+	}
+	return fmt.Sprintf("  stack memory: ~%s (%d/%d goroutines measured)\n", formatBytes(total), measured, len(bucket.Routines))
+}
+
+// MemorySummary prints the estimated stack memory of all the goroutines.
+func (p *Palette) MemorySummary(buckets Buckets) string {
+	var total uint64
+	count := 0
+	for i := range buckets {
+		t, _ := buckets[i].StackMemory()
+		total += t
+		count += len(buckets[i].Routines)
+	}
+	return fmt.Sprintf("Stack memory: ~%s in %d goroutines\n", formatBytes(total), count)
+}
+
+// RemainderLine prints the count of the buckets trimmed by Top. It returns an
+// empty string if none were.
+func (p *Palette) RemainderLine(r Remainder) string {
+	if r.Buckets == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%sand %d more signatures (%d goroutines)%s\n", p.Routine, r.Buckets, r.Goroutines, p.EOLReset)
+}
+
 // StackLines prints one complete stack trace, without the header.
 func (p *Palette) StackLines(signature *Signature, srcLen, pkgLen int, fullPath bool) string {
-	out := make([]string, len(signature.Stack.Calls))
+	out := make([]string, 0, len(signature.Stack.Calls)+2)
+	elided := signature.Stack.Elided
 	for i := range signature.Stack.Calls {
-		out[i] = p.callLine(&signature.Stack.Calls[i], srcLen, pkgLen, fullPath)
+		if signature.Stack.MiddleElided != 0 && i == signature.Stack.MiddleIndex {
+			out = append(out, fmt.Sprintf("    (...%d frames elided)", signature.Stack.MiddleElided))
+		}
+		if elided && signature.Stack.Calls[i].Reconstructed {
+			// Reconstructed calls are the bottom of the stack, after the elided
+			// ones.
+			out = append(out, "    (...)")
+			elided = false
+		}
+		out = append(out, p.callLine(&signature.Stack.Calls[i], srcLen, pkgLen, fullPath))
 	}
-	if signature.Stack.Elided {
+	if elided {
 		out = append(out, "    (...)")
 	}
 	return strings.Join(out, "\n") + "\n"
 }
+
+// DiffLines prints a diff of two dumps.
+//
+// The buckets found in both dumps are printed first with the old and new
+// headers side by side, followed by the buckets that disappeared and the ones
+// that appeared.
+func (p *Palette) DiffLines(d *BucketsDiff, srcLen, pkgLen int, fullPath bool) string {
+	out := ""
+	if len(d.Matched) != 0 {
+		out += "Matching:\n"
+		// The old side is padded according to its length without colors.
+		plain := &Palette{}
+		counts := make([]string, len(d.Matched))
+		olds := make([]string, len(d.Matched))
+		countLen := 0
+		oldLen := 0
+		for i := range d.Matched {
+			pair := &d.Matched[i]
+			counts[i] = fmt.Sprintf("%d -> %d (%+d)", len(pair.Old.Routines), len(pair.New.Routines), pair.Delta())
+			olds[i] = pair.Old.State + plain.bucketExtra(&pair.Old, fullPath)
+			if len(counts[i]) > countLen {
+				countLen = len(counts[i])
+			}
+			if len(olds[i]) > oldLen {
+				oldLen = len(olds[i])
+			}
+		}
+		for i := range d.Matched {
+			pair := &d.Matched[i]
+			color := ""
+			if delta := pair.Delta(); delta > 0 {
+				color = p.CountIncrease
+			} else if delta < 0 {
+				color = p.CountDecrease
+			}
+			out += fmt.Sprintf(
+				"%s%-*s%s: %s%s%s%s%s | %s%s%s%s\n",
+				color, countLen, counts[i], p.EOLReset,
+				p.routineColor(&pair.Old, false), pair.Old.State, p.bucketExtra(&pair.Old, fullPath), p.EOLReset,
+				strings.Repeat(" ", oldLen-len(olds[i])),
+				p.routineColor(&pair.New, false), pair.New.State, p.bucketExtra(&pair.New, fullPath), p.EOLReset)
+			out += p.StackLines(&pair.New.Signature, srcLen, pkgLen, fullPath)
+		}
+	}
+	if len(d.Removed) != 0 {
+		out += "Only in old:\n"
+		for i := range d.Removed {
+			out += p.BucketHeader(&d.Removed[i], fullPath, false)
+			out += p.StackLines(&d.Removed[i].Signature, srcLen, pkgLen, fullPath)
+		}
+	}
+	if len(d.Added) != 0 {
+		out += "Only in new:\n"
+		for i := range d.Added {
+			out += p.BucketHeader(&d.Added[i], fullPath, false)
+			out += p.StackLines(&d.Added[i].Signature, srcLen, pkgLen, fullPath)
+		}
+	}
+	return out
+}
+
+// LeakLines prints the leak suspects, each with its goroutine count in each
+// dump, its growth rate and example goroutine IDs, followed by its stack.
+func (p *Palette) LeakLines(leaks []LeakSuspect, srcLen, pkgLen int, fullPath bool) string {
+	out := ""
+	for i := range leaks {
+		l := &leaks[i]
+		counts := make([]string, len(l.Counts))
+		for j, c := range l.Counts {
+			counts[j] = strconv.Itoa(c)
+		}
+		rate := ""
+		if l.Rate != 0 {
+			rate = fmt.Sprintf(", %.2f/s", l.Rate)
+		}
+		examples := ""
+		for j, id := range l.Examples {
+			if j == 0 {
+				examples = "; e.g. goroutine "
+			} else {
+				examples += ", "
+			}
+			examples += strconv.Itoa(id)
+		}
+		out += fmt.Sprintf(
+			"%s%s (%+d%s): %s%s%s%s\n",
+			p.CountIncrease, strings.Join(counts, " -> "), l.Growth, rate,
+			l.Bucket.State, p.bucketExtra(&l.Bucket, fullPath),
+			examples, p.EOLReset)
+		out += p.StackLines(&l.Bucket.Signature, srcLen, pkgLen, fullPath)
+	}
+	return out
+}
+
+// TreeLines prints the creation tree of the goroutines, each bucket indented
+// under the bucket of its creators with its goroutine count, its state and
+// its innermost call.
+func (p *Palette) TreeLines(buckets []TreeBucket, fullPath bool) string {
+	out := ""
+	for i := range buckets {
+		out += p.treeLines(&buckets[i], "", fullPath)
+	}
+	return out
+}
+
+// FindingLines prints the findings, each followed by the headers of the
+// affected buckets.
+func (p *Palette) FindingLines(findings []Finding, buckets Buckets, fullPath bool) string {
+	out := ""
+	for _, f := range findings {
+		out += fmt.Sprintf("%s: %s: %s\n", f.Severity, f.Name, f.Explanation)
+		for _, i := range f.Buckets {
+			out += "  - " + p.BucketHeader(&buckets[i], fullPath, false)
+		}
+	}
+	return out
+}
+
+// lockedThreads returns the mapping of the locked goroutines to their thread,
+// if known.
+func lockedThreads(bucket *Bucket) string {
+	var out []string
+	for _, r := range bucket.Routines {
+		if !r.Locked {
+			continue
+		}
+		if r.OSThreadID != nil {
+			out = append(out, fmt.Sprintf("goroutine %d on thread %d", r.ID, *r.OSThreadID))
+		} else if r.M != nil {
+			out = append(out, fmt.Sprintf("goroutine %d on m=%d", r.ID, *r.M))
+		}
+	}
+	if len(out) == 0 {
+		return ""
+	}
+	return ": " + strings.Join(out, ", ")
+}
+
+// treeLines prints the bucket and its children, recursively.
+func (p *Palette) treeLines(bucket *TreeBucket, indent string, fullPath bool) string {
+	call := ""
+	if len(bucket.Stack.Calls) != 0 {
+		c := &bucket.Stack.Calls[0]
+		src := c.SourceLine()
+		if fullPath {
+			src = c.FullSourceLine()
+		}
+		call = fmt.Sprintf(" %s%s %s@ %s", p.functionColor(c), c.Func.PkgDotName(), p.SourceFile, src)
+	}
+	state := bucket.State
+	if len(bucket.Annotations) != 0 {
+		state += " [" + bucket.Annotations.String() + "]"
+	}
+	out := fmt.Sprintf(
+		"%s%s%d: %s%s%s\n",
+		indent, p.routineColor(&bucket.Bucket, true), len(bucket.Routines),
+		state, call, p.EOLReset)
+	for i := range bucket.Children {
+		out += p.treeLines(&bucket.Children[i], indent+"  ", fullPath)
+	}
+	return out
+}
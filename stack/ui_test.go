@@ -23,14 +23,15 @@ var p = &Palette{
 	FunctionOther:          "J",
 	FunctionOtherExported:  "K",
 	Arguments:              "L",
+	CountIncrease:          "M",
+	CountDecrease:          "N",
 }
 
 func TestCalcLengths(t *testing.T) {
 	t.Parallel()
 	b := Buckets{
 		{
-			Signature{Stack: Stack{Calls: []Call{{SourcePath: "/gopath/baz.go", Func: Function{"main.func·001"}}}}},
-			nil,
+			Signature: Signature{Stack: Stack{Calls: []Call{{SourcePath: "/gopath/baz.go", Func: Function{"main.func·001"}}}}},
 		},
 	}
 	srcLen, pkgLen := CalcLengths(b, true)
@@ -44,7 +45,7 @@ func TestCalcLengths(t *testing.T) {
 func TestBucketHeader(t *testing.T) {
 	t.Parallel()
 	b := &Bucket{
-		Signature{
+		Signature: Signature{
 			State: "chan receive",
 			CreatedBy: Call{
 				SourcePath: "/gopath/src/github.com/foo/bar/baz.go",
@@ -54,7 +55,7 @@ func TestBucketHeader(t *testing.T) {
 			SleepMax: 6,
 			SleepMin: 2,
 		},
-		[]Goroutine{
+		Routines: []Goroutine{
 			{
 				First: true,
 			},
@@ -67,15 +68,27 @@ func TestBucketHeader(t *testing.T) {
 	ut.AssertEqual(t, "C2: chan receive [2~6 minutes]D [Created by main.mainImpl @ baz.go:74]A\n", p.BucketHeader(b, false, false))
 
 	b = &Bucket{
-		Signature{
+		Signature: Signature{
 			State:    "b0rked",
 			SleepMax: 6,
 			SleepMin: 6,
 			Locked:   true,
 		},
-		nil,
 	}
 	ut.AssertEqual(t, "C0: b0rked [6 minutes] [locked]A\n", p.BucketHeader(b, false, false))
+
+	b.Annotate("issue", "FOO-123")
+	b.Annotate("known", "")
+	ut.AssertEqual(t, "C0: b0rked [6 minutes] [locked] [issue=FOO-123, known]A\n", p.BucketHeader(b, false, false))
+
+	m := 3
+	b.Routines = []Goroutine{{Signature: Signature{Locked: true}, ID: 7, M: &m}, {Signature: Signature{Locked: true}, ID: 8}}
+	ut.AssertEqual(t, "C2: b0rked [6 minutes] [locked: goroutine 7 on m=3] [issue=FOO-123, known]A\n", p.BucketHeader(b, false, false))
+
+	// Delve prints the OS thread.
+	tid := 4242
+	b.Routines[1].OSThreadID = &tid
+	ut.AssertEqual(t, "C2: b0rked [6 minutes] [locked: goroutine 7 on m=3, goroutine 8 on thread 4242] [issue=FOO-123, known]A\n", p.BucketHeader(b, false, false))
 }
 
 func TestStackLines(t *testing.T) {
@@ -147,3 +160,133 @@ func TestStackLines(t *testing.T) {
 		"    (...)\n"
 	ut.AssertEqual(t, expected, p.StackLines(s, 10, 10, false))
 }
+
+func TestDiffLines(t *testing.T) {
+	t.Parallel()
+	d := &BucketsDiff{
+		Matched: []BucketPair{
+			{
+				Old: Bucket{
+					Signature: Signature{
+						State: "IO wait",
+						Stack: Stack{Calls: []Call{{SourcePath: "/src/main.go", Line: 30, Func: Function{"main.read"}}}},
+					},
+					Routines: []Goroutine{{ID: 4}},
+				},
+				New: Bucket{
+					Signature: Signature{
+						State: "IO wait",
+						Stack: Stack{Calls: []Call{{SourcePath: "/src/main.go", Line: 30, Func: Function{"main.read"}}}},
+					},
+					Routines: []Goroutine{{ID: 4}},
+				},
+			},
+			{
+				Old: Bucket{
+					Signature: Signature{
+						State:    "chan receive",
+						SleepMin: 2,
+						SleepMax: 2,
+						Stack:    Stack{Calls: []Call{{SourcePath: "/src/main.go", Line: 10, Func: Function{"main.worker"}}}},
+					},
+					Routines:    []Goroutine{{ID: 1}, {ID: 2}},
+					Annotations: Annotations{"issue": "FOO-1"},
+				},
+				New: Bucket{
+					Signature: Signature{
+						State:  "chan receive",
+						Locked: true,
+						Stack:  Stack{Calls: []Call{{SourcePath: "/src/main.go", Line: 10, Func: Function{"main.worker"}}}},
+					},
+					Routines: []Goroutine{{ID: 1}, {ID: 2}, {ID: 7}},
+				},
+			},
+			{
+				Old: Bucket{
+					Signature: Signature{
+						State: "select",
+						Stack: Stack{Calls: []Call{{SourcePath: "/src/main.go", Line: 50, Func: Function{"main.wait"}}}},
+					},
+					Routines: []Goroutine{{ID: 11}, {ID: 12}},
+				},
+				New: Bucket{
+					Signature: Signature{
+						State: "select",
+						Stack: Stack{Calls: []Call{{SourcePath: "/src/main.go", Line: 50, Func: Function{"main.wait"}}}},
+					},
+					Routines: []Goroutine{{ID: 11}},
+				},
+			},
+		},
+		Removed: Buckets{
+			{
+				Signature: Signature{
+					State: "running",
+					Stack: Stack{Calls: []Call{{SourcePath: "/src/main.go", Line: 20, Func: Function{"main.gone"}}}},
+				},
+				Routines: []Goroutine{{ID: 3}},
+			},
+		},
+		Added: Buckets{
+			{
+				Signature: Signature{
+					State: "semacquire",
+					Stack: Stack{Calls: []Call{{SourcePath: "/src/main.go", Line: 40, Func: Function{"main.lock"}}}},
+				},
+				Routines: []Goroutine{{ID: 9}},
+			},
+		},
+	}
+	expected := "" +
+		"Matching:\n" +
+		"1 -> 1 (+0)A: CIO waitA                                | CIO waitA\n" +
+		"    Emain F/src/main.go:30 IreadL()A\n" +
+		"M2 -> 3 (+1)A: Cchan receive [2 minutes] [issue=FOO-1]A | Cchan receive [locked]A\n" +
+		"    Emain F/src/main.go:10 IworkerL()A\n" +
+		"N2 -> 1 (-1)A: CselectA                                 | CselectA\n" +
+		"    Emain F/src/main.go:50 IwaitL()A\n" +
+		"Only in old:\n" +
+		"C1: runningA\n" +
+		"    Emain F/src/main.go:20 IgoneL()A\n" +
+		"Only in new:\n" +
+		"C1: semacquireA\n" +
+		"    Emain F/src/main.go:40 IlockL()A\n"
+	ut.AssertEqual(t, expected, p.DiffLines(d, 0, 0, true))
+}
+
+func TestStackLinesReconstructed(t *testing.T) {
+	t.Parallel()
+	s := &Signature{
+		Stack: Stack{
+			Calls: []Call{
+				{SourcePath: "/src/main.go", Line: 7, Func: Function{"main.recurse"}},
+				{SourcePath: "/src/main.go", Line: 12, Func: Function{"main.main.func1"}, Reconstructed: true},
+			},
+			Elided: true,
+		},
+	}
+	expected := "" +
+		"    Emain F/src/main.go:7 IrecurseL()A\n" +
+		"    (...)\n" +
+		"    Emain F/src/main.go:12 Imain.func1L() [reconstructed]A\n"
+	ut.AssertEqual(t, expected, p.StackLines(s, 0, 0, true))
+}
+
+func TestStackLinesMiddleElided(t *testing.T) {
+	t.Parallel()
+	s := &Signature{
+		Stack: Stack{
+			Calls: []Call{
+				{SourcePath: "/src/main.go", Line: 7, Func: Function{"main.recurse"}},
+				{SourcePath: "/src/main.go", Line: 12, Func: Function{"main.main"}},
+			},
+			MiddleElided: 2000,
+			MiddleIndex:  1,
+		},
+	}
+	expected := "" +
+		"    Emain F/src/main.go:7 IrecurseL()A\n" +
+		"    (...2000 frames elided)\n" +
+		"    Emain F/src/main.go:12 ImainL()A\n"
+	ut.AssertEqual(t, expected, p.StackLines(s, 0, 0, true))
+}
@@ -0,0 +1,174 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package watchdog periodically captures the goroutines of the current process
+// to detect goroutine leaks while it runs.
+//
+// Embed it in a service to be notified of a leak before the process runs out
+// of memory, instead of analyzing the dump post-mortem:
+//
+//	w := watchdog.Start(watchdog.Options{MinGrowth: 1000})
+//	defer w.Stop()
+package watchdog
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/maruel/panicparse/alert"
+	"github.com/maruel/panicparse/stack"
+)
+
+// Finding is a bucket of goroutines that grew between two captures.
+type Finding struct {
+	// Time is when the capture was taken.
+	Time time.Time
+	// Bucket is the bucket in the last capture.
+	Bucket stack.Bucket
+	// Growth is the number of goroutines added to the bucket since the
+	// previous capture.
+	Growth int
+}
+
+// Options configures a Watchdog. The zero value is valid.
+type Options struct {
+	// Interval is the time between two captures. Defaults to one minute.
+	Interval time.Duration
+	// MinGrowth is the minimum number of goroutines a bucket must gain between
+	// two captures to be reported. Defaults to 100.
+	MinGrowth int
+	// Criteria defines how goroutines are bucketized. Defaults to AnyPointer.
+	Criteria *stack.Criteria
+	// OnFinding is called for each bucket that grew. Defaults to logging the
+	// finding with the log package. It is called from the watchdog goroutine.
+	OnFinding func(Finding)
+	// Deduper, when set, suppresses the findings of a bucket already reported
+	// within its Warning window, keyed by the bucket fingerprint, so a leak
+	// that keeps growing or a process restarted in a loop doesn't flood
+	// OnFinding.
+	Deduper *alert.Deduper
+}
+
+// Watchdog captures the goroutines of the process periodically.
+type Watchdog struct {
+	opts    Options
+	capture func() []byte
+	prev    stack.Buckets
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// Start starts a Watchdog. The first capture is taken immediately and is the
+// baseline of the next one.
+func Start(opts Options) *Watchdog {
+	w := newWatchdog(opts, captureAll)
+	go w.run()
+	return w
+}
+
+// Stop stops the Watchdog and waits for the current capture to complete. It
+// can be called multiple times.
+func (w *Watchdog) Stop() {
+	w.once.Do(func() { close(w.stop) })
+	<-w.done
+}
+
+// Private stuff.
+
+func newWatchdog(opts Options, capture func() []byte) *Watchdog {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Minute
+	}
+	if opts.MinGrowth <= 0 {
+		opts.MinGrowth = 100
+	}
+	if opts.Criteria == nil {
+		opts.Criteria = &stack.Criteria{Similarity: stack.AnyPointer}
+	}
+	if opts.OnFinding == nil {
+		opts.OnFinding = logFinding
+	}
+	return &Watchdog{opts: opts, capture: capture, stop: make(chan struct{}), done: make(chan struct{})}
+}
+
+func (w *Watchdog) run() {
+	defer close(w.done)
+	t := time.NewTicker(w.opts.Interval)
+	defer t.Stop()
+	w.check(time.Now())
+	for {
+		select {
+		case <-w.stop:
+			return
+		case now := <-t.C:
+			w.check(now)
+		}
+	}
+}
+
+// check takes a capture and reports the buckets that grew since the previous
+// one.
+func (w *Watchdog) check(now time.Time) {
+	goroutines, err := stack.ParseDump(bytes.NewReader(w.capture()), ioutil.Discard)
+	if err != nil {
+		log.Printf("watchdog: failed to parse the goroutines: %s", err)
+		return
+	}
+	c := w.opts.Criteria
+	buckets := stack.SortBuckets(c.Bucketize(goroutines))
+	if w.prev != nil {
+		d := c.Diff(w.prev, buckets)
+		for _, m := range d.Matched {
+			if growth := m.Delta(); growth >= w.opts.MinGrowth {
+				w.report(Finding{Time: now, Bucket: m.New, Growth: growth})
+			}
+		}
+		for _, b := range d.Added {
+			if len(b.Routines) >= w.opts.MinGrowth {
+				w.report(Finding{Time: now, Bucket: b, Growth: len(b.Routines)})
+			}
+		}
+	}
+	w.prev = buckets
+}
+
+// report calls OnFinding unless the Deduper suppresses the finding.
+func (w *Watchdog) report(f Finding) {
+	if d := w.opts.Deduper; d != nil {
+		ok, err := d.Allow(f.Bucket.Fingerprint(), alert.Warning, f.Time)
+		if err != nil {
+			log.Printf("watchdog: failed to save the alert state: %s", err)
+		}
+		if !ok {
+			return
+		}
+	}
+	w.opts.OnFinding(f)
+}
+
+// captureAll returns the stack of all goroutines.
+func captureAll() []byte {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+func logFinding(f Finding) {
+	where := "unknown"
+	if len(f.Bucket.Stack.Calls) != 0 {
+		c := &f.Bucket.Stack.Calls[0]
+		where = c.Func.PkgDotName() + " @ " + c.FullSourceLine()
+	}
+	log.Printf("watchdog: possible goroutine leak: %d goroutines (+%d) %s in %s", len(f.Bucket.Routines), f.Growth, f.Bucket.State, where)
+}
@@ -0,0 +1,94 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package watchdog
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maruel/panicparse/alert"
+	"github.com/maruel/ut"
+)
+
+// dump returns a dump with n goroutines blocked in main.leak and one in
+// main.main.
+func dump(n int) []byte {
+	out := []string{
+		"goroutine 1 [running]:",
+		"main.main()",
+		"	/gopath/src/github.com/foo/bar/baz.go:10 +0x27",
+		"",
+	}
+	for i := 0; i < n; i++ {
+		out = append(out,
+			fmt.Sprintf("goroutine %d [chan receive]:", i+2),
+			"main.leak()",
+			"	/gopath/src/github.com/foo/bar/baz.go:20 +0x27",
+			"created by main.main",
+			"	/gopath/src/github.com/foo/bar/baz.go:11 +0x35",
+			"")
+	}
+	return []byte(strings.Join(out, "\n"))
+}
+
+func TestWatchdog(t *testing.T) {
+	t.Parallel()
+	counts := []int{0, 5, 6, 20}
+	var findings []Finding
+	w := newWatchdog(Options{MinGrowth: 5, OnFinding: func(f Finding) { findings = append(findings, f) }}, func() []byte {
+		n := counts[0]
+		counts = counts[1:]
+		return dump(n)
+	})
+	now := time.Date(2016, 3, 1, 12, 0, 0, 0, time.UTC)
+	// Baseline.
+	w.check(now)
+	ut.AssertEqual(t, 0, len(findings))
+	// New bucket.
+	w.check(now.Add(time.Minute))
+	ut.AssertEqual(t, 1, len(findings))
+	ut.AssertEqual(t, 5, findings[0].Growth)
+	ut.AssertEqual(t, "main.leak", findings[0].Bucket.Stack.Calls[0].Func.Raw)
+	// Below the threshold.
+	w.check(now.Add(2 * time.Minute))
+	ut.AssertEqual(t, 1, len(findings))
+	w.check(now.Add(3 * time.Minute))
+	ut.AssertEqual(t, 2, len(findings))
+	ut.AssertEqual(t, 14, findings[1].Growth)
+	ut.AssertEqual(t, 20, len(findings[1].Bucket.Routines))
+	ut.AssertEqual(t, now.Add(3*time.Minute), findings[1].Time)
+}
+
+func TestWatchdogDeduper(t *testing.T) {
+	t.Parallel()
+	d, err := alert.New("", map[alert.Severity]time.Duration{alert.Warning: time.Hour})
+	ut.AssertEqual(t, nil, err)
+	counts := []int{0, 5, 10, 15}
+	var findings []Finding
+	w := newWatchdog(Options{MinGrowth: 5, Deduper: d, OnFinding: func(f Finding) { findings = append(findings, f) }}, func() []byte {
+		n := counts[0]
+		counts = counts[1:]
+		return dump(n)
+	})
+	now := time.Date(2016, 3, 1, 12, 0, 0, 0, time.UTC)
+	w.check(now)
+	w.check(now.Add(time.Minute))
+	ut.AssertEqual(t, 1, len(findings))
+	// The same bucket keeps growing within the window.
+	w.check(now.Add(2 * time.Minute))
+	ut.AssertEqual(t, 1, len(findings))
+	// The window elapsed.
+	w.check(now.Add(2 * time.Hour))
+	ut.AssertEqual(t, 2, len(findings))
+}
+
+func TestStartStop(t *testing.T) {
+	t.Parallel()
+	w := Start(Options{Interval: time.Hour, OnFinding: func(f Finding) {}})
+	w.Stop()
+	w.Stop()
+}